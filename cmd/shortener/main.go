@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"go-developer-course-shortener/internal/app/bots"
+	"go-developer-course-shortener/internal/app/geo"
 	"go-developer-course-shortener/internal/app/handlers"
 	"go-developer-course-shortener/internal/app/middleware"
 	"go-developer-course-shortener/internal/app/repository"
 	"go-developer-course-shortener/internal/app/repository/postgres"
 	"go-developer-course-shortener/internal/app/service"
+	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/app/urlcrypt"
 	"go-developer-course-shortener/internal/configs"
+	"go-developer-course-shortener/internal/health"
 	"go-developer-course-shortener/internal/worker"
 	pb "go-developer-course-shortener/proto"
 	"golang.org/x/sync/errgroup"
@@ -19,10 +25,11 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 var (
@@ -48,22 +55,84 @@ func main() {
 	// error group to control server instances
 	g, ctx := errgroup.WithContext(ctx)
 
+	// background tasks using the storage are waited for before the storage is released
+	var background sync.WaitGroup
+	runBackground := func(run func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run()
+		}()
+	}
+
 	var storage repository.Repository
-	switch {
-	case config.DatabaseDsn != "":
-		conn, err := pgx.Connect(ctx, config.DatabaseDsn)
+	var database *postgres.DBRepository
+	switch config.StorageMode() {
+	case configs.StoragePostgres:
+		pool, err := pgxpool.Connect(ctx, config.DatabaseDsn)
 		if err != nil {
 			log.Fatalf("Failed to connect to database. Error: %v", err.Error())
 		}
 
-		storage, err = postgres.NewDBRepository(conn)
+		db, err := postgres.NewDBRepository(pool)
 		if err != nil {
 			log.Fatalf("Failed to create DB repository. Error: %v", err.Error())
 		}
-	case config.FileStoragePath != "":
+		if len(config.DatabaseReplicaDsns) > 0 {
+			for _, dsn := range config.DatabaseReplicaDsns {
+				db.AddReplica(ctx, dsn)
+			}
+			db.SetReadYourWrites(config.ReadYourWrites)
+			runBackground(func() { db.RunReplicaChecks(ctx, postgres.ReplicaCheckInterval) })
+		}
+		database, storage = db, db
+	case configs.StorageFile:
 		storage = repository.NewFileRepository(config.FileStoragePath)
-	default:
-		storage = repository.NewInMemoryRepository()
+	case configs.StorageKV:
+		kv, err := repository.NewKVRepository(config.KVPath)
+		if err != nil {
+			log.Fatalf("Failed to open KV storage. Error: %v", err.Error())
+		}
+		storage = kv
+	case configs.StorageMemory:
+		switch {
+		case config.MemorySnapshotPath != "":
+			memory, err := repository.NewSnapshotRepository(config.MemorySnapshotPath)
+			if err != nil {
+				log.Fatalf("Failed to restore memory snapshot. Error: %v", err.Error())
+			}
+			if config.MemorySnapshotInterval > 0 {
+				runBackground(func() {
+					worker.RunMemorySnapshots(ctx, memory, config.MemorySnapshotPath, config.MemorySnapshotInterval)
+				})
+			}
+			storage = memory
+		case config.MemoryShards > 0:
+			storage = repository.NewShardedRepository(config.MemoryShards)
+		default:
+			storage = repository.NewInMemoryRepository()
+		}
+	}
+	if len(config.URLEncryptionKeys) > 0 {
+		cipher, err := newURLCipher(config)
+		if err != nil {
+			log.Fatalf("Failed to setup encryption of original urls. Error: %v", err.Error())
+		}
+		encrypted := repository.NewEncryptedRepository(storage, cipher)
+		if config.URLReencryptInterval > 0 {
+			runBackground(func() { worker.RunReencryption(ctx, encrypted, config.URLReencryptInterval) })
+		}
+		storage = encrypted
+	}
+	if config.CacheSize > 0 {
+		cache := repository.NewCachedRepository(storage, config.CacheSize, config.CacheTTL, config.CacheNegativeTTL)
+		if database != nil {
+			// links changed by other instances are invalidated by notifications of the database,
+			// their next reads go to the primary, so lagging replicas do not fill the cache with stale links
+			listener := postgres.NewListener(config.DatabaseDsn, database, cache)
+			runBackground(func() { listener.Run(ctx) })
+		}
+		storage = cache
 	}
 
 	// setup worker pool to handle delete requests
@@ -71,6 +140,33 @@ func main() {
 	workerPool := worker.NewWorkerPool(storage, jobs)
 	go workerPool.Run(ctx)
 
+	// setup click pool to save clicks of redirects in batches
+	clicks := make(chan types.Click, worker.MaxClickQueueSize)
+	clickPool := worker.NewClickPool(storage, clicks)
+	runBackground(func() { clickPool.Run(ctx) })
+
+	// setup page pool to fetch metadata of destination pages
+	pages := make(chan worker.PageJob, worker.MaxPageQueueSize)
+	pagePool := worker.NewPagePool(storage, pages)
+	go pagePool.Run(ctx)
+
+	// setup background checks of original urls
+	if config.HealthCheckInterval > 0 {
+		checker := health.NewChecker(storage, health.DefaultConfig(config.HealthCheckInterval))
+		runBackground(func() { checker.Run(ctx) })
+	}
+
+	// setup purge of old raw clicks
+	if config.ClickRetention > 0 {
+		runBackground(func() { worker.RunClickRetention(ctx, storage, config.ClickRetention) })
+	}
+	// setup purge of old deleted links
+	if config.DeletedRetention > 0 {
+		runBackground(func() {
+			worker.RunDeletedRetention(ctx, storage, config.DeletedRetention, config.ReusePurgedShortURLS)
+		})
+	}
+
 	_, subnet, err := net.ParseCIDR(config.TrustedSubnet)
 	if err != nil {
 		log.Printf("Failed to read trusted subnet parameter. Error: %v", err.Error())
@@ -78,6 +174,28 @@ func main() {
 
 	// create new service for all servers
 	svc := service.NewService(storage, jobs, subnet, config.BaseURL)
+	svc.SetPageJobs(pages)
+	svc.SetClickQueue(clicks)
+	svc.SetUndeleteGracePeriod(config.UndeleteGracePeriod)
+	if config.GeoIPPath != "" {
+		db, err := geo.Load(config.GeoIPPath)
+		if err != nil {
+			log.Fatalf("Failed to load geo database. Error: %v", err.Error())
+		}
+		svc.SetGeoDatabase(db)
+	}
+	if config.CrawlerRangesPath != "" {
+		ranges, err := bots.LoadRanges(config.CrawlerRangesPath)
+		if err != nil {
+			log.Fatalf("Failed to load crawler ranges. Error: %v", err.Error())
+		}
+		svc.SetCrawlerRanges(ranges)
+	}
+	if config.VisitorSalt != "" {
+		svc.SetVisitorSalt(config.VisitorSalt)
+	} else {
+		log.Println("Visitor salt is not set, unique visitors are counted by the random salt of this instance")
+	}
 	var httpSrv http.Server
 	var grpcSrv *grpc.Server
 
@@ -111,7 +229,7 @@ func main() {
 			log.Fatalf("GRPC server net.Listen: %v", err)
 		}
 
-		grpcSrv = grpc.NewServer(grpc.UnaryInterceptor(handlers.UnaryInterceptor))
+		grpcSrv = grpc.NewServer(grpc.UnaryInterceptor(handlers.UnaryInterceptor), grpc.StreamInterceptor(handlers.StreamInterceptor))
 		pb.RegisterShortenerServer(grpcSrv, handlers.NewGrpcHandler(svc))
 
 		log.Printf("GRPC server started on %v", config.GrpcPort)
@@ -131,13 +249,18 @@ func main() {
 
 	grpcSrv.GracefulStop()
 
+	// servers are stopped, queued clicks are saved by the click pool before it returns
+	clickPool.ClosePool()
+
 	// stop server context and release resources
 	cancel()
 
 	// close worker pool
 	workerPool.ClosePool()
+	pagePool.ClosePool()
 
-	// release resources
+	// wait for background tasks, then release resources
+	background.Wait()
 	storage.ReleaseStorage()
 	log.Println("Server Shutdown gracefully")
 
@@ -158,10 +281,47 @@ func NewHTTPHandler(svc *service.Service) http.Handler {
 	r.Post("/api/shorten", handler.HandlerJSONPOST)
 	r.Post("/api/shorten/batch", handler.HandlerBatchPOST)
 	r.Get("/{ID}", handler.HandlerGET)
+	r.Get("/{ID}+", handler.HandlerPreviewGET)
+	r.Get("/{ID}/qr", handler.HandlerQRGET)
 	r.Get("/api/user/urls", handler.HandlerUserStorageGET)
 	r.Get("/ping", handler.HandlerPing)
 	r.Delete("/api/user/urls", handler.HandlerUseStorageDELETE())
+	r.Post("/api/user/urls/restore", handler.HandlerRestorePOST)
+	r.Put("/api/user/urls/{ID}/schedule", handler.HandlerSchedulePUT)
+	r.Get("/api/user/urls/{ID}/targets", handler.HandlerTargetsGET)
+	r.Put("/api/user/urls/{ID}/targets", handler.HandlerTargetsPUT)
+	r.Get("/api/user/urls/{ID}/variants", handler.HandlerVariantsGET)
+	r.Put("/api/user/urls/{ID}/variants", handler.HandlerVariantsPUT)
+	r.Get("/api/user/urls/{ID}/stats", handler.HandlerLinkStatsGET)
+	r.Get("/api/user/urls/{ID}/health", handler.HandlerLinkHealthGET)
+	r.Put("/api/user/urls/{ID}/preview", handler.HandlerPreviewPUT)
+	r.Get("/api/user/urls/{ID}/qr", handler.HandlerUserQRGET)
+	r.Put("/api/user/urls/{ID}/metadata", handler.HandlerMetadataPUT)
+	r.Get("/api/user/urls/search", handler.HandlerSearchGET)
+	r.Get("/api/user/urls/export", handler.HandlerExportGET)
+	r.Post("/api/user/urls/import", handler.HandlerImportPOST)
+	r.Get("/api/user/collections", handler.HandlerCollectionsGET)
+	r.Post("/api/user/collections", handler.HandlerCollectionPOST)
+	r.Delete("/api/user/collections/{CollectionID}", handler.HandlerCollectionDELETE)
+	r.Get("/api/user/collections/{CollectionID}/urls", handler.HandlerCollectionURLSGET)
+	r.Put("/api/user/collections/{CollectionID}/urls", handler.HandlerCollectionURLSPUT)
+	r.Delete("/api/user/collections/{CollectionID}/urls", handler.HandlerCollectionURLSDELETE)
+	r.Get("/api/user/reports/{Report}", handler.HandlerReportGET)
 	r.Get("/api/internal/stats", handler.HandlerStats)
+	r.Get("/api/internal/reports/{Report}", handler.HandlerInternalReportGET)
 
 	return r
 }
+
+// newURLCipher returns the cipher of original urls configured by master keys and the index key.
+func newURLCipher(config *configs.Config) (*urlcrypt.Cipher, error) {
+	keys, err := urlcrypt.ParseKeys(config.URLEncryptionKeys)
+	if err != nil {
+		return nil, err
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(config.URLIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("index key: %w", err)
+	}
+	return urlcrypt.New(keys, indexKey)
+}
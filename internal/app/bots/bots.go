@@ -0,0 +1,136 @@
+// Package bots provides classification of visitors of short urls.
+// A visitor is a bot if User-Agent header matches a signature of automated clients
+// or ip belongs to a known crawler network, a visitor with odd headers or
+// too frequent visits is suspicious.
+package bots
+
+import (
+	"bufio"
+	_ "embed"
+	"go-developer-course-shortener/internal/app/types"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed signatures.txt
+var signaturesFile string
+
+// signatures are lower case markers of automated clients.
+var signatures = parseSignatures(signaturesFile)
+
+func parseSignatures(s string) []string {
+	var result []string
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result = append(result, strings.ToLower(line))
+	}
+	return result
+}
+
+// MatchSignature reports whether User-Agent header belongs to an automated client.
+func MatchSignature(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, signature := range signatures {
+		if strings.Contains(userAgent, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config contains settings of the classifier.
+type Config struct {
+	// RateLimit is the maximum number of visits from one ip during RateWindow, further visits are suspicious.
+	RateLimit int
+	// RateWindow is the period of visit counting.
+	RateWindow time.Duration
+}
+
+// DefaultConfig returns settings of the classifier: more than 30 visits a minute from one ip are suspicious.
+func DefaultConfig() Config {
+	return Config{RateLimit: 30, RateWindow: time.Minute}
+}
+
+type rateCounter struct {
+	start  time.Time
+	visits int
+}
+
+// Classifier tags visits as human, bot or suspicious.
+type Classifier struct {
+	mu      sync.Mutex
+	config  Config
+	ranges  *Ranges
+	rates   map[string]*rateCounter
+	pruneAt time.Time
+}
+
+// NewClassifier returns a new Classifier, ranges may be nil if crawler networks are unknown.
+func NewClassifier(ranges *Ranges, config Config) *Classifier {
+	return &Classifier{config: config, ranges: ranges, rates: make(map[string]*rateCounter)}
+}
+
+// Classify returns class of the visit.
+// Every visit counts toward the rate of the ip, including visits of bots.
+func (c *Classifier) Classify(header http.Header, ip net.IP, now time.Time) string {
+	frequent := c.countVisit(ip, now)
+
+	userAgent := header.Get("User-Agent")
+	switch {
+	case MatchSignature(userAgent), c.ranges.Contains(ip):
+		return types.ClickBot
+	case frequent, oddHeaders(header):
+		return types.ClickSuspicious
+	default:
+		return types.ClickHuman
+	}
+}
+
+// oddHeaders reports whether headers differ from headers of browsers:
+// browsers always send User-Agent and send Accept-Language with navigation requests.
+func oddHeaders(header http.Header) bool {
+	userAgent := header.Get("User-Agent")
+	if userAgent == "" {
+		return true
+	}
+	return strings.HasPrefix(userAgent, "Mozilla/") && header.Get("Accept-Language") == ""
+}
+
+// countVisit counts the visit from ip and reports whether the rate limit is exceeded.
+func (c *Classifier) countVisit(ip net.IP, now time.Time) bool {
+	if ip == nil || c.config.RateLimit <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.pruneAt) {
+		c.prune(now)
+		c.pruneAt = now.Add(c.config.RateWindow)
+	}
+
+	key := ip.String()
+	counter, ok := c.rates[key]
+	if !ok || now.Sub(counter.start) >= c.config.RateWindow {
+		counter = &rateCounter{start: now}
+		c.rates[key] = counter
+	}
+	counter.visits++
+	return counter.visits > c.config.RateLimit
+}
+
+// prune forgets counters of finished windows.
+func (c *Classifier) prune(now time.Time) {
+	for key, counter := range c.rates {
+		if now.Sub(counter.start) >= c.config.RateWindow {
+			delete(c.rates, key)
+		}
+	}
+}
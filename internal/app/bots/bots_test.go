@@ -0,0 +1,110 @@
+package bots
+
+import (
+	"go-developer-course-shortener/internal/app/types"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRanges = `# crawler networks
+66.249.64.0/19,Googlebot
+
+2001:4860:4801::/48
+`
+
+const browser = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0 Safari/537.36"
+
+func TestMatchSignature(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      bool
+	}{
+		{userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", want: true},
+		{userAgent: "curl/8.1.2", want: true},
+		{userAgent: "python-requests/2.31.0", want: true},
+		{userAgent: "Go-http-client/1.1", want: true},
+		{userAgent: "Mozilla/5.0 (X11; Linux x86_64) HeadlessChrome/118.0 Safari/537.36", want: true},
+		{userAgent: browser, want: false},
+		{userAgent: "grpc-go/1.50.1", want: false},
+		{userAgent: "", want: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MatchSignature(tt.userAgent), tt.userAgent)
+	}
+}
+
+func TestClassifier_Classify(t *testing.T) {
+	ranges, err := ReadRanges(strings.NewReader(testRanges))
+	require.NoError(t, err)
+	classifier := NewClassifier(ranges, DefaultConfig())
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		header http.Header
+		ip     string
+		want   string
+	}{
+		{name: "browser", header: http.Header{"User-Agent": {browser}, "Accept-Language": {"en"}}, ip: "192.0.2.1", want: types.ClickHuman},
+		{name: "signature", header: http.Header{"User-Agent": {"curl/8.1.2"}}, ip: "192.0.2.2", want: types.ClickBot},
+		{name: "crawler network", header: http.Header{"User-Agent": {browser}, "Accept-Language": {"en"}}, ip: "66.249.66.1", want: types.ClickBot},
+		{name: "crawler ipv6 network", header: http.Header{"User-Agent": {browser}, "Accept-Language": {"en"}}, ip: "2001:4860:4801::1", want: types.ClickBot},
+		{name: "no user agent", header: http.Header{}, ip: "192.0.2.3", want: types.ClickSuspicious},
+		{name: "browser without language", header: http.Header{"User-Agent": {browser}}, ip: "192.0.2.4", want: types.ClickSuspicious},
+		{name: "unknown ip", header: http.Header{"User-Agent": {browser}, "Accept-Language": {"en"}}, want: types.ClickHuman},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, classifier.Classify(tt.header, net.ParseIP(tt.ip), now))
+		})
+	}
+}
+
+func TestClassifier_Rate(t *testing.T) {
+	classifier := NewClassifier(nil, Config{RateLimit: 3, RateWindow: time.Minute})
+	header := http.Header{"User-Agent": {browser}, "Accept-Language": {"en"}}
+	ip := net.ParseIP("192.0.2.1")
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, types.ClickHuman, classifier.Classify(header, ip, now))
+	}
+	assert.Equal(t, types.ClickSuspicious, classifier.Classify(header, ip, now.Add(time.Second)))
+
+	// other ip is not affected
+	assert.Equal(t, types.ClickHuman, classifier.Classify(header, net.ParseIP("192.0.2.2"), now.Add(time.Second)))
+
+	// the next window starts a new count, finished windows are forgotten
+	assert.Equal(t, types.ClickHuman, classifier.Classify(header, ip, now.Add(time.Minute)))
+	classifier.Classify(header, ip, now.Add(3*time.Minute))
+	assert.Len(t, classifier.rates, 1)
+}
+
+func TestLoadRanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawlers.txt")
+	err := os.WriteFile(path, []byte(testRanges), 0666)
+	require.NoError(t, err)
+
+	ranges, err := LoadRanges(path)
+	require.NoError(t, err)
+	assert.True(t, ranges.Contains(net.ParseIP("66.249.64.1")))
+	assert.False(t, ranges.Contains(net.ParseIP("66.249.96.1")))
+
+	_, err = LoadRanges(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+
+	_, err = ReadRanges(strings.NewReader("66.249.64.0/19\nbad network\n"))
+	assert.Error(t, err)
+
+	// nil ranges contain nothing
+	var empty *Ranges
+	assert.False(t, empty.Contains(net.ParseIP("66.249.64.1")))
+}
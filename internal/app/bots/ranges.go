@@ -0,0 +1,72 @@
+package bots
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// Ranges represents networks of known crawlers.
+type Ranges struct {
+	networks []*net.IPNet
+}
+
+// LoadRanges reads crawler networks from the file.
+// Each line contains network in CIDR notation and an optional name of the crawler:
+//
+//	66.249.64.0/19,Googlebot
+//
+// Empty lines and lines starting with '#' are skipped.
+func LoadRanges(path string) (*Ranges, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ranges, err := ReadRanges(file)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Crawler ranges loaded: %d networks", len(ranges.networks))
+	return ranges, nil
+}
+
+// ReadRanges reads crawler networks from the reader.
+func ReadRanges(r io.Reader) (*Ranges, error) {
+	ranges := &Ranges{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		cidr, _, _ := strings.Cut(text, ",")
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ranges.networks = append(ranges.networks, network)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// Contains reports whether ip belongs to one of the crawler networks.
+func (r *Ranges) Contains(ip net.IP) bool {
+	if r == nil || ip == nil {
+		return false
+	}
+	for _, network := range r.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+// Package geo provides lookup of client location by ip address.
+// Networks are loaded from a local CSV file and kept in memory as a prefix trie.
+package geo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// Location represents a country and an optional region of the network.
+type Location struct {
+	Country string
+	Region  string
+}
+
+type node struct {
+	children [2]*node
+	location *Location
+}
+
+// Database implements longest prefix match of ip addresses to locations.
+type Database struct {
+	ipv4     *node
+	ipv6     *node
+	networks int
+}
+
+// NewDatabase returns an empty Database.
+func NewDatabase() *Database {
+	return &Database{ipv4: &node{}, ipv6: &node{}}
+}
+
+// Load reads networks from the CSV file.
+// Each row contains network in CIDR notation, country code and optional region:
+//
+//	203.0.113.0/24,DE,EU
+//
+// Rows starting with '#' and a header row are skipped.
+func Load(path string) (*Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db, err := Read(file)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Geo database loaded: %d networks", db.networks)
+	return db, nil
+}
+
+// Read reads networks in CSV format from the reader.
+func Read(r io.Reader) (*Database, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	db := NewDatabase()
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected network and country", line)
+		}
+
+		_, network, err := net.ParseCIDR(strings.TrimSpace(record[0]))
+		if err != nil {
+			if line == 1 {
+				// header row
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		location := Location{Country: strings.ToUpper(strings.TrimSpace(record[1]))}
+		if len(record) > 2 {
+			location.Region = strings.ToUpper(strings.TrimSpace(record[2]))
+		}
+		if err = db.Insert(network, location); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return db, nil
+}
+
+// Insert adds network with the location to the database.
+func (db *Database) Insert(network *net.IPNet, location Location) error {
+	if location.Country == "" {
+		return errors.New("country must not be empty")
+	}
+	ones, _ := network.Mask.Size()
+	ip, root := db.root(network.IP)
+	if ip == nil {
+		return fmt.Errorf("invalid network %v", network)
+	}
+
+	n := root
+	for i := 0; i < ones; i++ {
+		b := bit(ip, i)
+		if n.children[b] == nil {
+			n.children[b] = &node{}
+		}
+		n = n.children[b]
+	}
+	n.location = &location
+	db.networks++
+	return nil
+}
+
+// Lookup returns location of the most specific network containing ip.
+func (db *Database) Lookup(ip net.IP) (Location, bool) {
+	if db == nil {
+		return Location{}, false
+	}
+	ip, n := db.root(ip)
+	if ip == nil {
+		return Location{}, false
+	}
+
+	var found *Location
+	for i := 0; n != nil; i++ {
+		if n.location != nil {
+			found = n.location
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		n = n.children[bit(ip, i)]
+	}
+	if found == nil {
+		return Location{}, false
+	}
+	return *found, true
+}
+
+func (db *Database) root(ip net.IP) (net.IP, *node) {
+	if v4 := ip.To4(); v4 != nil {
+		return v4, db.ipv4
+	}
+	if v6 := ip.To16(); v6 != nil {
+		return v6, db.ipv6
+	}
+	return nil, nil
+}
+
+func bit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,74 @@
+package geo
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNetworks = `network,country,region
+# test networks
+10.0.0.0/8,us,na
+10.1.0.0/16,de,eu
+10.1.2.0/24,at,eu
+192.0.2.1/32,fr
+2001:db8::/32,jp,apac
+`
+
+func TestDatabaseLookup(t *testing.T) {
+	db, err := Read(strings.NewReader(testNetworks))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		ip     string
+		want   Location
+		wantOk bool
+	}{
+		{name: "widest network", ip: "10.200.0.1", want: Location{Country: "US", Region: "NA"}, wantOk: true},
+		{name: "nested network", ip: "10.1.200.1", want: Location{Country: "DE", Region: "EU"}, wantOk: true},
+		{name: "most specific network", ip: "10.1.2.3", want: Location{Country: "AT", Region: "EU"}, wantOk: true},
+		{name: "host network", ip: "192.0.2.1", want: Location{Country: "FR"}, wantOk: true},
+		{name: "ipv4-mapped ipv6", ip: "::ffff:10.1.2.3", want: Location{Country: "AT", Region: "EU"}, wantOk: true},
+		{name: "ipv6 network", ip: "2001:db8::1", want: Location{Country: "JP", Region: "APAC"}, wantOk: true},
+		{name: "unknown ipv4", ip: "192.0.2.2", want: Location{}, wantOk: false},
+		{name: "unknown ipv6", ip: "2001:db9::1", want: Location{}, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := db.Lookup(net.ParseIP(tt.ip))
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.csv")
+	err := os.WriteFile(path, []byte(testNetworks), 0666)
+	assert.NoError(t, err)
+
+	db, err := Load(path)
+	assert.NoError(t, err)
+	got, ok := db.Lookup(net.ParseIP("10.1.2.3"))
+	assert.True(t, ok)
+	assert.Equal(t, "AT", got.Country)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.csv"))
+	assert.Error(t, err)
+
+	_, err = Read(strings.NewReader("10.0.0.0/8,us\nbad network,de\n"))
+	assert.Error(t, err)
+
+	_, err = Read(strings.NewReader("10.0.0.0/8\n"))
+	assert.Error(t, err)
+
+	// nil database has no locations
+	var empty *Database
+	_, ok = empty.Lookup(net.ParseIP("10.1.2.3"))
+	assert.False(t, ok)
+}
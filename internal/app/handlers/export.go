@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"go-developer-course-shortener/internal/app/service"
+	"go-developer-course-shortener/internal/app/types"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ContentValueCSV    = "text/csv; charset=utf-8"
+	ContentValueNDJSON = "application/x-ndjson"
+
+	exportCSV    = "csv"
+	exportNDJSON = "ndjson"
+)
+
+// exportColumns is the header of the csv export.
+var exportColumns = []string{"short_url", "original_url", "created_at", "collection", "title", "note", "tags",
+	"health_status", "health_error", "health_checked_at", "page_title", "clicks"}
+
+// exportRecord returns the link as a row of the csv export, tags are separated by commas.
+func exportRecord(link types.ExportLink) []string {
+	var status, healthError, checkedAt, pageTitle string
+	if link.Health != nil {
+		if link.Health.StatusCode != 0 {
+			status = strconv.Itoa(link.Health.StatusCode)
+		}
+		healthError = link.Health.Error
+		checkedAt = link.Health.CheckedAt.UTC().Format(time.RFC3339)
+	}
+	if link.Page != nil {
+		pageTitle = link.Page.Title
+	}
+	return []string{link.ShortURL, link.OriginalURL, link.CreatedAt.UTC().Format(time.RFC3339), link.Collection,
+		link.Title, link.Note, strings.Join(link.Tags, ","), status, healthError, checkedAt, pageTitle, strconv.Itoa(link.Clicks)}
+}
+
+// exportWriter reports whether buffered parts of the export were sent to the client.
+type exportWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *exportWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+// HandlerExportGET implements streaming export of all links of current user id with click totals
+// as csv (format=csv, default) or newline delimited json (format=ndjson).
+func (h *Handler) HandlerExportGET(w http.ResponseWriter, r *http.Request) {
+	userID := service.ExtractUserIDFromContext(r.Context())
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportCSV
+	}
+
+	// links are buffered and sent in parts, errors can be reported until the first part is sent
+	out := &exportWriter{ResponseWriter: w}
+	var visit func(link types.ExportLink) error
+	var flush func() error
+	switch format {
+	case exportCSV:
+		writer := csv.NewWriter(out)
+		if err := writer.Write(exportColumns); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		visit = func(link types.ExportLink) error {
+			return writer.Write(exportRecord(link))
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		w.Header().Set(ContentType, ContentValueCSV)
+	case exportNDJSON:
+		writer := bufio.NewWriter(out)
+		encoder := json.NewEncoder(writer)
+		visit = func(link types.ExportLink) error {
+			return encoder.Encode(link)
+		}
+		flush = writer.Flush
+		w.Header().Set(ContentType, ContentValueNDJSON)
+	default:
+		http.Error(w, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="links.`+format+`"`)
+
+	log.Printf("Export links for userID: %s format: %s", userID, format)
+	err := h.service.ExportUserURLS(r.Context(), userID, visit)
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		if !out.started {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the response is already started, the client gets a truncated export
+		log.Printf("Failed to export links. Error: %v", err)
+	}
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
+	"go-developer-course-shortener/internal/app/qr"
 	"go-developer-course-shortener/internal/app/rand"
 	"go-developer-course-shortener/internal/app/service"
 	"go-developer-course-shortener/internal/app/types"
@@ -11,6 +13,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"log"
 	"net"
 	"net/http"
@@ -61,12 +64,16 @@ func (s *ShortenerServer) AddBatch(ctx context.Context, in *pb.AddBatchRequest)
 }
 
 func (s *ShortenerServer) AddLinkJSON(ctx context.Context, in *pb.AddLinkJSONRequest) (*pb.AddLinkJSONResponse, error) {
-	log.Printf("Long URL (AddLinkJSON): %v", in.GetLink())
 	longURL, err := service.ParseURL(in.GetLink())
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	metadata, err := service.NormalizeMetadata(types.Metadata{Title: in.GetTitle(), Note: in.GetNote(), Tags: in.GetTags()})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	userID := service.ExtractUserIDFromContext(ctx)
 
 	id := string(rand.GenerateRandom(shortLinkLength))
@@ -84,6 +91,12 @@ func (s *ShortenerServer) AddLinkJSON(ctx context.Context, in *pb.AddLinkJSONReq
 		if err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
+	} else if metadata.Title != "" || metadata.Note != "" || len(metadata.Tags) > 0 {
+		// metadata of the existing link is kept on conflict
+		err = s.service.SetMetadata(userID, shortURL, metadata)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
 	}
 
 	return &pb.AddLinkJSONResponse{
@@ -92,7 +105,6 @@ func (s *ShortenerServer) AddLinkJSON(ctx context.Context, in *pb.AddLinkJSONReq
 }
 
 func (s *ShortenerServer) AddLink(ctx context.Context, in *pb.AddLinkRequest) (*pb.AddLinkResponse, error) {
-	log.Printf("Long URL (AddLink): %v", in.GetLink().OriginalUrl)
 	longURL, err := service.ParseURL(in.GetLink().OriginalUrl)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
@@ -141,11 +153,35 @@ func (s *ShortenerServer) DeleteLink(ctx context.Context, in *pb.DeleteLinkReque
 	return &pb.DeleteLinkResponse{Code: http.StatusAccepted}, nil
 }
 
+func (s *ShortenerServer) RestoreLinks(ctx context.Context, in *pb.RestoreLinksRequest) (*pb.RestoreLinksResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	shortURLS := make([]string, len(in.Ids)) // allocate required capacity for the links
+	for i, id := range in.Ids {
+		shortURLS[i] = service.MakeShortURL(s.service.BaseURL, id.CorrelationId)
+	}
+	log.Printf("Restore %+v for userID (RestoreLinks): %s", shortURLS, userID)
+
+	restored, err := s.service.RestoreURLS(userID, shortURLS)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	response := pb.RestoreLinksResponse{Code: http.StatusOK}
+	for _, shortURL := range restored {
+		response.Restored = append(response.Restored, &pb.ShortURL{ShortUrl: shortURL})
+	}
+	return &response, nil
+}
+
 func (s *ShortenerServer) GetUserLinks(ctx context.Context, in *pb.GetUserLinksRequest) (*pb.GetUserLinksResponse, error) {
 	userID := service.ExtractUserIDFromContext(ctx)
 
-	log.Printf("Get all links for userID (GetUserLinks): %s", userID)
-	links, err := s.service.GetUserStorage(userID)
+	log.Printf("Get all links for userID (GetUserLinks): %s health: %s", userID, in.Health)
+	if in.Health != "" && in.Health != service.HealthBroken {
+		return nil, status.Error(codes.InvalidArgument, "unknown health filter")
+	}
+	links, err := s.service.GetUserStorageByHealth(userID, in.Health)
 	if err != nil {
 		return &pb.GetUserLinksResponse{Code: int32(http.StatusNoContent), Links: nil}, err
 	}
@@ -153,10 +189,217 @@ func (s *ShortenerServer) GetUserLinks(ctx context.Context, in *pb.GetUserLinksR
 	var response pb.GetUserLinksResponse
 
 	for _, v := range links {
-		response.Links = append(response.Links, &pb.Link{
-			Short: &pb.ShortURL{ShortUrl: v.ShortURL},
-			Orig:  &pb.OriginalURL{OriginalUrl: v.OriginalURL},
-		})
+		response.Links = append(response.Links, linkToProto(v))
+	}
+
+	response.Code = int32(http.StatusOK)
+	return &response, nil
+}
+
+func (s *ShortenerServer) ExportUserLinks(in *pb.ExportUserLinksRequest, stream pb.Shortener_ExportUserLinksServer) error {
+	userID := service.ExtractUserIDFromContext(stream.Context())
+
+	log.Printf("Export links for userID (ExportUserLinks): %s", userID)
+	err := s.service.ExportUserURLS(stream.Context(), userID, func(link types.ExportLink) error {
+		return stream.Send(&pb.ExportedLink{Link: linkToProto(link.Link), CreatedAt: timestamppb.New(link.CreatedAt), Clicks: int64(link.Clicks)})
+	})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+func (s *ShortenerServer) ImportLinks(stream pb.Shortener_ImportLinksServer) error {
+	userID := service.ExtractUserIDFromContext(stream.Context())
+
+	log.Printf("Import links for userID (ImportLinks): %s", userID)
+	line := 0
+	next := func() (types.ImportRow, error) {
+		in, err := stream.Recv()
+		if err != nil {
+			return types.ImportRow{}, err
+		}
+		line++
+		return types.ImportRow{Line: line, OriginalURL: in.GetOrig().GetOriginalUrl(), ShortID: in.GetShortId(),
+			Title: in.GetTitle(), Tags: in.GetTags()}, nil
+	}
+
+	response := pb.ImportLinksResponse{Code: int32(http.StatusOK)}
+	err := s.service.ImportURLS(userID, next, func(result types.ImportResult) error {
+		item := &pb.ImportResult{Line: int32(result.Line), Status: result.Status, Error: result.Error}
+		if result.ShortURL != "" {
+			item.Short = &pb.ShortURL{ShortUrl: result.ShortURL}
+		}
+		response.Results = append(response.Results, item)
+		return nil
+	})
+	if err != nil {
+		// errors of receiving are statuses already, invalid rows are reported in results
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	return stream.SendAndClose(&response)
+}
+
+// linkToProto converts link with metadata to grpc message.
+func linkToProto(link types.Link) *pb.Link {
+	return &pb.Link{
+		Short:      &pb.ShortURL{ShortUrl: link.ShortURL},
+		Orig:       &pb.OriginalURL{OriginalUrl: link.OriginalURL},
+		Title:      link.Title,
+		Note:       link.Note,
+		Tags:       link.Tags,
+		Collection: link.Collection,
+		Health:     healthToProto(link.Health),
+		Page:       pageToProto(link.Page),
+	}
+}
+
+// pageToProto converts metadata of the destination page to grpc message.
+func pageToProto(page *types.Page) *pb.LinkPage {
+	if page == nil {
+		return nil
+	}
+	return &pb.LinkPage{
+		Title:         page.Title,
+		OgTitle:       page.OGTitle,
+		OgDescription: page.OGDescription,
+		OgImage:       page.OGImage,
+		FetchedAt:     timestamppb.New(page.FetchedAt),
+	}
+}
+
+// healthToProto converts the last check of original url to grpc message.
+func healthToProto(health *types.Health) *pb.LinkHealth {
+	if health == nil {
+		return nil
+	}
+	return &pb.LinkHealth{
+		StatusCode: int32(health.StatusCode),
+		LatencyMs:  health.LatencyMS,
+		Error:      health.Error,
+		CheckedAt:  timestamppb.New(health.CheckedAt),
+		Broken:     health.Broken(),
+	}
+}
+
+func (s *ShortenerServer) CreateCollection(ctx context.Context, in *pb.CreateCollectionRequest) (*pb.CreateCollectionResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+	log.Printf("Create collection (CreateCollection): `%s`", in.Name)
+
+	collection, err := s.service.CreateCollection(userID, in.Name)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.CreateCollectionResponse{
+		Code:       int32(http.StatusCreated),
+		Collection: &pb.Collection{Id: collection.ID, Name: collection.Name},
+	}, nil
+}
+
+func (s *ShortenerServer) GetCollections(ctx context.Context, in *pb.GetCollectionsRequest) (*pb.GetCollectionsResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	collections, err := s.service.GetCollections(userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var response pb.GetCollectionsResponse
+	for _, v := range collections {
+		response.Collections = append(response.Collections, &pb.Collection{Id: v.ID, Name: v.Name, Links: int32(v.Links)})
+	}
+
+	response.Code = int32(http.StatusOK)
+	return &response, nil
+}
+
+func (s *ShortenerServer) DeleteCollection(ctx context.Context, in *pb.DeleteCollectionRequest) (*pb.DeleteCollectionResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+	log.Printf("Delete collection (DeleteCollection): `%s`", in.Id)
+
+	if err := s.service.DeleteCollection(userID, in.Id); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &pb.DeleteCollectionResponse{Code: int32(http.StatusOK)}, nil
+}
+
+func (s *ShortenerServer) MoveLinks(ctx context.Context, in *pb.MoveLinksRequest) (*pb.MoveLinksResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	shortURLS := make([]string, len(in.Links)) // allocate required capacity for the links
+	for i, v := range in.Links {
+		shortURLS[i] = service.MakeShortURL(s.service.BaseURL, v.GetShortUrl())
+	}
+	log.Printf("Move %+v to collection (MoveLinks): `%s`", shortURLS, in.CollectionId)
+
+	if err := s.service.MoveURLS(userID, in.CollectionId, shortURLS); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.MoveLinksResponse{Code: int32(http.StatusOK)}, nil
+}
+
+func (s *ShortenerServer) GetCollectionLinks(ctx context.Context, in *pb.GetCollectionLinksRequest) (*pb.GetCollectionLinksResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	page, err := s.service.GetCollectionURLS(userID, in.CollectionId, int(in.Limit), int(in.Offset))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var response pb.GetCollectionLinksResponse
+	for _, v := range page.Links {
+		response.Links = append(response.Links, linkToProto(v))
+	}
+
+	response.Code = int32(http.StatusOK)
+	response.Total = int32(page.Total)
+	return &response, nil
+}
+
+func (s *ShortenerServer) DeleteCollectionLinks(ctx context.Context, in *pb.DeleteCollectionLinksRequest) (*pb.DeleteCollectionLinksResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+	log.Printf("Delete all links in collection (DeleteCollectionLinks): `%s`", in.CollectionId)
+
+	if _, err := s.service.DeleteCollectionURLS(userID, in.CollectionId); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &pb.DeleteCollectionLinksResponse{Code: int32(http.StatusAccepted)}, nil
+}
+
+func (s *ShortenerServer) SetLinkMetadata(ctx context.Context, in *pb.SetLinkMetadataRequest) (*pb.SetLinkMetadataResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (SetLinkMetadata): `%s`", strID)
+
+	metadata := types.Metadata{Title: in.Title, Note: in.Note, Tags: in.Tags}
+	err := s.service.SetMetadata(userID, service.MakeShortURL(s.service.BaseURL, strID), metadata)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.SetLinkMetadataResponse{Code: int32(http.StatusOK)}, nil
+}
+
+func (s *ShortenerServer) SearchUserLinks(ctx context.Context, in *pb.SearchUserLinksRequest) (*pb.SearchUserLinksResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+	log.Printf("Search links for userID (SearchUserLinks): %s", userID)
+
+	links, err := s.service.SearchURLS(userID, types.SearchQuery{Tags: in.Tags, Text: in.Query})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var response pb.SearchUserLinksResponse
+	for _, v := range links {
+		response.Links = append(response.Links, linkToProto(v))
 	}
 
 	response.Code = int32(http.StatusOK)
@@ -168,28 +411,57 @@ func (s *ShortenerServer) GetOriginalByShort(ctx context.Context, in *pb.GetOrig
 	strID := in.Short.ShortUrl
 	log.Printf("ShortUrl (GetOriginalByShort): `%s`", strID)
 
-	originalLink, err := s.service.GetURL(service.MakeShortURL(s.service.BaseURL, strID))
+	shortURL := service.MakeShortURL(s.service.BaseURL, strID)
+	originalLink, err := s.service.GetURL(shortURL)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
-	log.Printf("Original URL (GetOriginalByShort): %s deleted: %v", originalLink.OriginalURL, originalLink.Deleted)
+	log.Printf("Short URL (GetOriginalByShort): %s deleted: %v", shortURL, originalLink.Deleted)
 
-	var code int32
-	if !originalLink.Deleted {
-		code = http.StatusTemporaryRedirect
-	} else {
-		code = http.StatusGone
+	visitor := s.service.Locate(service.VisitorFromContext(ctx))
+	visitor.Variant = in.GetVariant()
+
+	target := s.service.ResolveTarget(originalLink, visitor)
+	if target.Status == http.StatusTemporaryRedirect {
+		s.service.RecordClick(shortURL, originalLink, visitor, target)
 	}
 
 	return &pb.GetOriginalByShortResponse{
-		Code: code,
+		Code: int32(target.Status),
 		Link: &pb.OriginalLink{
-			Orig:    &pb.OriginalURL{OriginalUrl: originalLink.OriginalURL},
+			Orig:    &pb.OriginalURL{OriginalUrl: target.URL},
 			Deleted: originalLink.Deleted,
 		},
+		Variant: target.Variant,
+		Preview: originalLink.Preview.Always && target.Status == http.StatusTemporaryRedirect,
 	}, nil
 }
 
+func (s *ShortenerServer) SetLinkSchedule(ctx context.Context, in *pb.SetLinkScheduleRequest) (*pb.SetLinkScheduleResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (SetLinkSchedule): `%s`", strID)
+
+	var schedule types.Schedule
+	if in.NotBefore != nil {
+		notBefore := in.NotBefore.AsTime()
+		schedule.NotBefore = &notBefore
+	}
+	if in.NotAfter != nil {
+		notAfter := in.NotAfter.AsTime()
+		schedule.NotAfter = &notAfter
+	}
+	schedule.PendingURL = in.GetPending().GetOriginalUrl()
+
+	err := s.service.SetSchedule(userID, service.MakeShortURL(s.service.BaseURL, strID), schedule)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.SetLinkScheduleResponse{Code: int32(http.StatusOK)}, nil
+}
+
 func (s *ShortenerServer) GetStats(ctx context.Context, in *pb.GetStatsRequest) (*pb.GetStatsResponse, error) {
 	// get user ip (check "X-Real-IP" metadata)
 	var token string
@@ -213,6 +485,274 @@ func (s *ShortenerServer) GetStats(ctx context.Context, in *pb.GetStatsRequest)
 	}, nil
 }
 
+func (s *ShortenerServer) SetLinkTargets(ctx context.Context, in *pb.SetLinkTargetsRequest) (*pb.SetLinkTargetsResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (SetLinkTargets): `%s`", strID)
+
+	rules := make([]types.TargetRule, len(in.Rules)) // allocate required capacity for the rules
+	for i, v := range in.Rules {
+		rules[i] = types.TargetRule{Type: v.Type, Header: v.Header, Value: v.Value, URL: v.GetTarget().GetOriginalUrl()}
+	}
+
+	err := s.service.SetTargets(userID, service.MakeShortURL(s.service.BaseURL, strID), rules)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.SetLinkTargetsResponse{Code: int32(http.StatusOK)}, nil
+}
+
+func (s *ShortenerServer) GetLinkTargets(ctx context.Context, in *pb.GetLinkTargetsRequest) (*pb.GetLinkTargetsResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (GetLinkTargets): `%s`", strID)
+
+	targets, err := s.service.GetTargets(userID, service.MakeShortURL(s.service.BaseURL, strID))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	response := pb.GetLinkTargetsResponse{
+		Code:    int32(http.StatusOK),
+		Default: &pb.OriginalURL{OriginalUrl: targets.Default},
+	}
+	for _, v := range targets.Rules {
+		response.Rules = append(response.Rules, &pb.TargetRule{
+			Type:   v.Type,
+			Header: v.Header,
+			Value:  v.Value,
+			Target: &pb.OriginalURL{OriginalUrl: v.URL},
+		})
+	}
+	return &response, nil
+}
+
+func (s *ShortenerServer) SetLinkVariants(ctx context.Context, in *pb.SetLinkVariantsRequest) (*pb.SetLinkVariantsResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (SetLinkVariants): `%s`", strID)
+
+	variants := make([]types.Variant, len(in.Variants)) // allocate required capacity for the variants
+	for i, v := range in.Variants {
+		variants[i] = types.Variant{Name: v.Name, URL: v.GetTarget().GetOriginalUrl(), Weight: int(v.Weight)}
+	}
+
+	err := s.service.SetVariants(userID, service.MakeShortURL(s.service.BaseURL, strID), variants)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.SetLinkVariantsResponse{Code: int32(http.StatusOK)}, nil
+}
+
+func (s *ShortenerServer) GetLinkVariants(ctx context.Context, in *pb.GetLinkVariantsRequest) (*pb.GetLinkVariantsResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (GetLinkVariants): `%s`", strID)
+
+	variants, err := s.service.GetVariants(userID, service.MakeShortURL(s.service.BaseURL, strID))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	var response pb.GetLinkVariantsResponse
+	for _, v := range variants {
+		response.Variants = append(response.Variants, &pb.Variant{
+			Name:   v.Name,
+			Target: &pb.OriginalURL{OriginalUrl: v.URL},
+			Weight: int32(v.Weight),
+			Clicks: int64(v.Clicks),
+		})
+	}
+
+	response.Code = int32(http.StatusOK)
+	return &response, nil
+}
+
+func (s *ShortenerServer) GetLinkStats(ctx context.Context, in *pb.GetLinkStatsRequest) (*pb.GetLinkStatsResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (GetLinkStats): `%s`", strID)
+
+	stats, err := s.service.GetLinkStats(userID, service.MakeShortURL(s.service.BaseURL, strID), in.GetIncludeBots())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	response := pb.GetLinkStatsResponse{
+		Code:         int32(http.StatusOK),
+		Total:        int64(stats.Total),
+		Variants:     make(map[string]int64, len(stats.Variants)),
+		Countries:    make(map[string]int64, len(stats.Countries)),
+		Bots:         make(map[string]int64, len(stats.Bots)),
+		Classes:      make(map[string]int64, len(stats.Classes)),
+		Uniques:      stats.Uniques,
+		UniquesByDay: stats.UniquesByDay,
+	}
+	for k, v := range stats.Variants {
+		response.Variants[k] = int64(v)
+	}
+	for k, v := range stats.Countries {
+		response.Countries[k] = int64(v)
+	}
+	for k, v := range stats.Bots {
+		response.Bots[k] = int64(v)
+	}
+	for k, v := range stats.Classes {
+		response.Classes[k] = int64(v)
+	}
+	return &response, nil
+}
+
+func (s *ShortenerServer) GetLinkHealth(ctx context.Context, in *pb.GetLinkHealthRequest) (*pb.GetLinkHealthResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (GetLinkHealth): `%s`", strID)
+
+	health, err := s.service.GetLinkHealth(userID, service.MakeShortURL(s.service.BaseURL, strID))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if health == nil {
+		return &pb.GetLinkHealthResponse{Code: int32(http.StatusNoContent)}, nil
+	}
+	return &pb.GetLinkHealthResponse{Code: int32(http.StatusOK), Health: healthToProto(health)}, nil
+}
+
+func (s *ShortenerServer) SetLinkPreview(ctx context.Context, in *pb.SetLinkPreviewRequest) (*pb.SetLinkPreviewResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (SetLinkPreview): `%s`", strID)
+
+	preview := types.Preview{Always: in.Always, Title: in.Title, Description: in.Description}
+	err := s.service.SetPreview(userID, service.MakeShortURL(s.service.BaseURL, strID), preview)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.SetLinkPreviewResponse{Code: int32(http.StatusOK)}, nil
+}
+
+func (s *ShortenerServer) GetLinkPreview(ctx context.Context, in *pb.GetLinkPreviewRequest) (*pb.GetLinkPreviewResponse, error) {
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (GetLinkPreview): `%s`", strID)
+
+	originalLink, err := s.service.GetURL(service.MakeShortURL(s.service.BaseURL, strID))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	target := s.service.ResolveTarget(originalLink, s.service.Locate(service.VisitorFromContext(ctx)))
+	if target.Status != http.StatusTemporaryRedirect {
+		return &pb.GetLinkPreviewResponse{Code: int32(target.Status)}, nil
+	}
+
+	preview := service.PreviewOf(originalLink, target)
+	return &pb.GetLinkPreviewResponse{
+		Code:        int32(http.StatusOK),
+		Destination: &pb.OriginalURL{OriginalUrl: target.URL},
+		Title:       preview.Title,
+		Description: preview.Description,
+		CreatedAt:   timestamppb.New(originalLink.CreatedAt),
+	}, nil
+}
+
+func (s *ShortenerServer) GetQRCode(ctx context.Context, in *pb.GetQRCodeRequest) (*pb.GetQRCodeResponse, error) {
+	strID := in.GetShort().GetShortUrl()
+	log.Printf("ShortUrl (GetQRCode): `%s`", strID)
+
+	shortURL := service.MakeShortURL(s.service.BaseURL, strID)
+	link, err := s.service.GetURL(shortURL)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if link.Deleted {
+		return &pb.GetQRCodeResponse{Code: int32(http.StatusGone)}, nil
+	}
+
+	options := service.DefaultQROptions()
+	if in.Format != "" {
+		options.Format = in.Format
+	}
+	if in.Size != 0 {
+		options.Size = int(in.Size)
+	}
+	if in.Level != "" {
+		if options.Level, err = qr.ParseLevel(in.Level); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if in.Margin != nil {
+		options.Margin = int(in.GetMargin())
+	}
+
+	code, err := s.service.GetQRCode(shortURL, options)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &pb.GetQRCodeResponse{Code: int32(http.StatusOK), ContentType: code.ContentType, Image: code.Image}, nil
+}
+
+// reportQueryGrpc returns report query of the request, unset times are zero.
+func reportQueryGrpc(in *pb.GetReportRequest) types.ReportQuery {
+	query := types.ReportQuery{Dimension: in.GetReport(), Limit: int(in.GetLimit())}
+	if in.From != nil {
+		query.From = in.GetFrom().AsTime()
+	}
+	if in.To != nil {
+		query.To = in.GetTo().AsTime()
+	}
+	return query
+}
+
+func reportResponse(items []types.ReportItem) *pb.GetReportResponse {
+	response := pb.GetReportResponse{Code: int32(http.StatusOK), Items: make([]*pb.ReportItem, len(items))}
+	for i, item := range items {
+		response.Items[i] = &pb.ReportItem{Key: item.Key, Clicks: int64(item.Clicks)}
+	}
+	return &response
+}
+
+func (s *ShortenerServer) GetReport(ctx context.Context, in *pb.GetReportRequest) (*pb.GetReportResponse, error) {
+	userID := service.ExtractUserIDFromContext(ctx)
+
+	items, err := s.service.GetReport(userID, reportQueryGrpc(in))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return reportResponse(items), nil
+}
+
+func (s *ShortenerServer) GetInternalReport(ctx context.Context, in *pb.GetReportRequest) (*pb.GetReportResponse, error) {
+	// get user ip (check "X-Real-IP" metadata)
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		values := md.Get("X-Real-IP")
+		if len(values) > 0 {
+			token = values[0]
+		}
+	}
+	userIP := net.ParseIP(token)
+
+	items, err := s.service.GetInternalReport(userIP, reportQueryGrpc(in))
+	if err != nil {
+		if errors.Is(err, service.ErrForbidden) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return reportResponse(items), nil
+}
+
 func (s *ShortenerServer) Ping(ctx context.Context, in *pb.PingRequest) (*pb.PingResponse, error) {
 	userID := service.ExtractUserIDFromContext(ctx)
 	log.Printf("userID (Ping): %v\n", userID)
@@ -228,21 +768,38 @@ func (s *ShortenerServer) Ping(ctx context.Context, in *pb.PingRequest) (*pb.Pin
 }
 
 func UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	userID := uuid.NewString()
+	return handler(withUserID(ctx), req)
+}
 
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		values := md.Get(service.AccessToken)
-		if len(values) > 0 {
-			userID = values[0]
-			log.Printf("UnaryInterceptor userID from context: '%s'", userID)
-		}
-	}
+// StreamInterceptor resolves user id of streaming calls the same way as UnaryInterceptor.
+func StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &userStream{ServerStream: ss, ctx: withUserID(ss.Context())})
+}
+
+// userStream wraps a server stream to provide the context with resolved user id.
+type userStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *userStream) Context() context.Context {
+	return s.ctx
+}
+
+// withUserID returns the context with user id from metadata, a new user id is set if metadata has none.
+func withUserID(ctx context.Context) context.Context {
+	userID := uuid.NewString()
 
 	md, ok := metadata.FromIncomingContext(ctx)
-	if ok {
-		md.Append(service.AccessToken, string(userID))
+	if !ok {
+		md = metadata.MD{}
+	}
+	if values := md.Get(service.AccessToken); len(values) > 0 {
+		userID = values[0]
+		log.Printf("Interceptor userID from context: '%s'", userID)
 	}
-	newCtx := metadata.NewIncomingContext(ctx, md)
 
-	return handler(newCtx, req)
+	md = md.Copy()
+	md.Append(service.AccessToken, userID)
+	return metadata.NewIncomingContext(ctx, md)
 }
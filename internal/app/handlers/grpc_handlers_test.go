@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go-developer-course-shortener/internal/app/repository"
 	"go-developer-course-shortener/internal/app/service"
+	"go-developer-course-shortener/internal/app/types"
 	"go-developer-course-shortener/internal/configs"
 	"go-developer-course-shortener/internal/worker"
 	"google.golang.org/grpc"
@@ -13,11 +14,15 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	pb "go-developer-course-shortener/proto"
 )
@@ -68,7 +73,7 @@ func startGrpcServer() {
 			log.Fatalf("GRPC server net.Listen: %v", err)
 		}
 
-		grpcSrv = grpc.NewServer(grpc.UnaryInterceptor(UnaryInterceptor))
+		grpcSrv = grpc.NewServer(grpc.UnaryInterceptor(UnaryInterceptor), grpc.StreamInterceptor(StreamInterceptor))
 
 		pb.RegisterShortenerServer(grpcSrv, NewGrpcHandler(svc))
 
@@ -118,6 +123,10 @@ func TestShortenerServer_All_Negative(t *testing.T) {
 	_, err = c.DeleteLink(ctx, &deleteRequest)
 	assert.NotNil(t, err)
 
+	// RestoreLinks
+	_, err = c.RestoreLinks(ctx, &pb.RestoreLinksRequest{Ids: []*pb.CorrelationID{{CorrelationId: "grpc_id1"}}})
+	assert.NotNil(t, err)
+
 	// GetUserLinks
 	_, err = c.GetUserLinks(ctx, &pb.GetUserLinksRequest{})
 	assert.NotNil(t, err)
@@ -175,7 +184,7 @@ func TestShortenerServer_All_Positive(t *testing.T) {
 	assert.Equal(t, int32(http.StatusCreated), batchResponse.Code)
 
 	// AddLinkJSON
-	linkJSONResponse, err := c.AddLinkJSON(ctx, &pb.AddLinkJSONRequest{Link: "https://github.com/test_repo3"})
+	linkJSONResponse, err := c.AddLinkJSON(ctx, &pb.AddLinkJSONRequest{Link: "https://github.com/test_repo3", Title: "Repo", Tags: []string{"Test"}})
 	assert.NoError(t, err)
 	assert.Equal(t, int32(http.StatusCreated), linkJSONResponse.Code)
 
@@ -196,11 +205,57 @@ func TestShortenerServer_All_Positive(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int32(http.StatusAccepted), deleteLinkResponse.Code)
 
+	// RestoreLinks, links are deleted by the workers, so nothing is restored yet
+	restoreLinksResponse, err := c.RestoreLinks(ctx, &pb.RestoreLinksRequest{Ids: []*pb.CorrelationID{{CorrelationId: "unknown"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), restoreLinksResponse.Code)
+	assert.Empty(t, restoreLinksResponse.Restored)
+
 	// GetUserLinks
 	userLinksResponse, err := c.GetUserLinks(ctx, &pb.GetUserLinksRequest{})
 	log.Printf("userLinksResponse: %v", userLinksResponse)
 	assert.NoError(t, err)
 	assert.Equal(t, int32(http.StatusOK), userLinksResponse.Code)
+	// batch links are listed first
+	assert.Equal(t, 4, len(userLinksResponse.Links))
+	assert.Equal(t, "Repo", userLinksResponse.Links[2].Title)
+	assert.Equal(t, []string{"test"}, userLinksResponse.Links[2].Tags)
+
+	// ImportLinks
+	importStream, err := c.ImportLinks(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, importStream.Send(&pb.ImportLinkRequest{Orig: &pb.OriginalURL{OriginalUrl: "https://github.com/grpc_import"}, ShortId: "grpc-import", Title: "Imported"}))
+	assert.NoError(t, importStream.Send(&pb.ImportLinkRequest{Orig: &pb.OriginalURL{OriginalUrl: "https://github.com/grpc_import/reserved"}, ShortId: "api"}))
+	importResponse, err := importStream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), importResponse.Code)
+	if assert.Len(t, importResponse.Results, 2) {
+		assert.Equal(t, types.ImportCreated, importResponse.Results[0].Status)
+		assert.True(t, strings.HasSuffix(importResponse.Results[0].Short.GetShortUrl(), "/grpc-import"))
+		assert.Equal(t, int32(2), importResponse.Results[1].Line)
+		assert.Equal(t, types.ImportFailed, importResponse.Results[1].Status)
+	}
+
+	// ExportUserLinks
+	exportStream, err := c.ExportUserLinks(ctx, &pb.ExportUserLinksRequest{})
+	assert.NoError(t, err)
+	var exported []*pb.ExportedLink
+	for {
+		exportedLink, err := exportStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		exported = append(exported, exportedLink)
+	}
+	if assert.Len(t, exported, 5) {
+		assert.Equal(t, "Repo", exported[2].Link.Title)
+		assert.Equal(t, int64(0), exported[2].Clicks)
+		assert.NotNil(t, exported[2].CreatedAt)
+		assert.Equal(t, "Imported", exported[4].Link.Title)
+	}
 
 	// GetOriginalByShort (positive test)
 	shortURL, err := url.Parse(linkResponse.Short.ShortUrl)
@@ -211,15 +266,265 @@ func TestShortenerServer_All_Positive(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int32(http.StatusTemporaryRedirect), origResponse.Code)
 
+	shortURL, err = url.Parse(linkJSONResponse.Result)
+	assert.NoError(t, err)
+	linkJSON := shortURL.Path[1:] // remove '/'
+
 	// GetOriginalByShort (negative test)
 	_, err = c.GetOriginalByShort(ctx, &pb.GetOriginalByShortRequest{Short: &pb.ShortURL{ShortUrl: "error_short_url"}})
 	assert.Error(t, err, status.Error(codes.InvalidArgument, err.Error()))
 
+	// SetLinkSchedule (expired link)
+	scheduleResponse, err := c.SetLinkSchedule(ctx, &pb.SetLinkScheduleRequest{
+		Short:    &pb.ShortURL{ShortUrl: link},
+		NotAfter: timestamppb.New(time.Now().Add(-time.Hour)),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), scheduleResponse.Code)
+	origResponse, err = c.GetOriginalByShort(ctx, &pb.GetOriginalByShortRequest{Short: &pb.ShortURL{ShortUrl: link}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusGone), origResponse.Code)
+	assert.Equal(t, "", origResponse.Link.Orig.OriginalUrl)
+
+	// SetLinkSchedule (negative test)
+	_, err = c.SetLinkSchedule(ctx, &pb.SetLinkScheduleRequest{Short: &pb.ShortURL{ShortUrl: "error_short_url"}})
+	assert.Error(t, err)
+
+	// SetLinkTargets
+	targetsResponse, err := c.SetLinkTargets(ctx, &pb.SetLinkTargetsRequest{
+		Short: &pb.ShortURL{ShortUrl: link},
+		Rules: []*pb.TargetRule{{Type: "header", Header: "X-Campaign", Value: "grpc", Target: &pb.OriginalURL{OriginalUrl: "https://github.com/grpc"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), targetsResponse.Code)
+
+	// GetLinkTargets
+	linkTargetsResponse, err := c.GetLinkTargets(ctx, &pb.GetLinkTargetsRequest{Short: &pb.ShortURL{ShortUrl: link}})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/test_repo4", linkTargetsResponse.Default.OriginalUrl)
+	assert.Equal(t, 1, len(linkTargetsResponse.Rules))
+
+	// GetLinkTargets (negative test)
+	_, err = c.GetLinkTargets(ctx, &pb.GetLinkTargetsRequest{Short: &pb.ShortURL{ShortUrl: "error_short_url"}})
+	assert.Error(t, err)
+
+	// SetLinkVariants
+	variantsResponse, err := c.SetLinkVariants(ctx, &pb.SetLinkVariantsRequest{
+		Short: &pb.ShortURL{ShortUrl: linkJSON},
+		Variants: []*pb.Variant{
+			{Name: "a", Target: &pb.OriginalURL{OriginalUrl: "https://github.com/a"}, Weight: 1},
+			{Name: "b", Target: &pb.OriginalURL{OriginalUrl: "https://github.com/b"}, Weight: 1},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), variantsResponse.Code)
+
+	// GetOriginalByShort (sticky variant)
+	origResponse, err = c.GetOriginalByShort(ctx, &pb.GetOriginalByShortRequest{Short: &pb.ShortURL{ShortUrl: linkJSON}, Variant: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", origResponse.Variant)
+	assert.Equal(t, "https://github.com/b", origResponse.Link.Orig.OriginalUrl)
+
+	// GetLinkVariants
+	linkVariantsResponse, err := c.GetLinkVariants(ctx, &pb.GetLinkVariantsRequest{Short: &pb.ShortURL{ShortUrl: linkJSON}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(linkVariantsResponse.Variants))
+	assert.Equal(t, int64(1), linkVariantsResponse.Variants[1].Clicks)
+
+	// GetLinkStats
+	linkStatsResponse, err := c.GetLinkStats(ctx, &pb.GetLinkStatsRequest{Short: &pb.ShortURL{ShortUrl: linkJSON}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), linkStatsResponse.Total)
+	assert.Equal(t, int64(1), linkStatsResponse.Variants["b"])
+	assert.Empty(t, linkStatsResponse.Bots)
+	assert.Equal(t, int64(1), linkStatsResponse.Classes["human"])
+	assert.Equal(t, uint64(1), linkStatsResponse.Uniques)
+
+	// GetReport
+	reportResponse, err := c.GetReport(ctx, &pb.GetReportRequest{Report: types.ReportLinks})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), reportResponse.Code)
+	assert.NotEmpty(t, reportResponse.Items)
+	for _, item := range reportResponse.Items {
+		assert.Equal(t, int64(1), item.Clicks)
+	}
+
+	// GetReport (negative tests)
+	_, err = c.GetReport(ctx, &pb.GetReportRequest{Report: "unknown"})
+	assert.Error(t, err)
+	_, err = c.GetReport(ctx, &pb.GetReportRequest{Report: types.ReportLinks, Limit: 1000})
+	assert.Error(t, err)
+
+	// GetLinkStats (negative test)
+	_, err = c.GetLinkStats(ctx, &pb.GetLinkStatsRequest{Short: &pb.ShortURL{ShortUrl: "error_short_url"}})
+	assert.Error(t, err)
+
+	// GetLinkVariants (negative test)
+	_, err = c.GetLinkVariants(ctx, &pb.GetLinkVariantsRequest{Short: &pb.ShortURL{ShortUrl: "error_short_url"}})
+	assert.Error(t, err)
+
+	// SetLinkPreview
+	previewResponse, err := c.SetLinkPreview(ctx, &pb.SetLinkPreviewRequest{
+		Short:       &pb.ShortURL{ShortUrl: linkJSON},
+		Always:      true,
+		Title:       "Preview",
+		Description: "Preview description",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), previewResponse.Code)
+
+	// GetOriginalByShort (preview)
+	origResponse, err = c.GetOriginalByShort(ctx, &pb.GetOriginalByShortRequest{Short: &pb.ShortURL{ShortUrl: linkJSON}, Variant: "b"})
+	assert.NoError(t, err)
+	assert.True(t, origResponse.Preview)
+
+	// GetLinkPreview
+	linkPreviewResponse, err := c.GetLinkPreview(ctx, &pb.GetLinkPreviewRequest{Short: &pb.ShortURL{ShortUrl: linkJSON}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), linkPreviewResponse.Code)
+	assert.Equal(t, "Preview", linkPreviewResponse.Title)
+	assert.Equal(t, "Preview description", linkPreviewResponse.Description)
+	assert.NotEmpty(t, linkPreviewResponse.Destination.OriginalUrl)
+	assert.False(t, linkPreviewResponse.CreatedAt.AsTime().IsZero())
+
+	// SetLinkPreview (negative test)
+	_, err = c.SetLinkPreview(ctx, &pb.SetLinkPreviewRequest{Short: &pb.ShortURL{ShortUrl: "error_short_url"}})
+	assert.Error(t, err)
+
+	// GetLinkPreview (negative test)
+	_, err = c.GetLinkPreview(ctx, &pb.GetLinkPreviewRequest{Short: &pb.ShortURL{ShortUrl: "error_short_url"}})
+	assert.Error(t, err)
+
+	// GetQRCode
+	margin := int32(0)
+	qrResponse, err := c.GetQRCode(ctx, &pb.GetQRCodeRequest{Short: &pb.ShortURL{ShortUrl: linkJSON}, Format: "svg", Level: "q", Margin: &margin})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), qrResponse.Code)
+	assert.Equal(t, "image/svg+xml", qrResponse.ContentType)
+	assert.Contains(t, string(qrResponse.Image), "M0,0h7v1h-7z")
+
+	// GetQRCode (negative test)
+	_, err = c.GetQRCode(ctx, &pb.GetQRCodeRequest{Short: &pb.ShortURL{ShortUrl: "error_short_url"}})
+	assert.Error(t, err)
+	_, err = c.GetQRCode(ctx, &pb.GetQRCodeRequest{Short: &pb.ShortURL{ShortUrl: linkJSON}, Format: "gif"})
+	assert.Error(t, err)
+
+	// SetLinkMetadata
+	metadataResponse, err := c.SetLinkMetadata(ctx, &pb.SetLinkMetadataRequest{
+		Short: &pb.ShortURL{ShortUrl: link},
+		Title: "Repository four",
+		Note:  "grpc note",
+		Tags:  []string{"grpc", "test"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), metadataResponse.Code)
+
+	// SearchUserLinks
+	searchResponse, err := c.SearchUserLinks(ctx, &pb.SearchUserLinksRequest{Tags: []string{"test"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), searchResponse.Code)
+	assert.Equal(t, 2, len(searchResponse.Links))
+	searchResponse, err = c.SearchUserLinks(ctx, &pb.SearchUserLinksRequest{Tags: []string{"grpc"}, Query: "note"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(searchResponse.Links))
+	assert.Equal(t, "Repository four", searchResponse.Links[0].Title)
+
+	// SetLinkMetadata (negative test)
+	_, err = c.SetLinkMetadata(ctx, &pb.SetLinkMetadataRequest{Short: &pb.ShortURL{ShortUrl: "error_short_url"}})
+	assert.Error(t, err)
+
+	// SearchUserLinks (negative test)
+	_, err = c.SearchUserLinks(ctx, &pb.SearchUserLinksRequest{Tags: []string{""}})
+	assert.Error(t, err)
+
+	// CreateCollection
+	collectionResponse, err := c.CreateCollection(ctx, &pb.CreateCollectionRequest{Name: "grpc"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusCreated), collectionResponse.Code)
+	collectionID := collectionResponse.Collection.Id
+
+	// MoveLinks
+	moveResponse, err := c.MoveLinks(ctx, &pb.MoveLinksRequest{CollectionId: collectionID, Links: []*pb.ShortURL{{ShortUrl: link}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), moveResponse.Code)
+
+	// GetCollections
+	collectionsResponse, err := c.GetCollections(ctx, &pb.GetCollectionsRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(collectionsResponse.Collections))
+	assert.Equal(t, int32(1), collectionsResponse.Collections[0].Links)
+
+	// GetCollectionLinks
+	collectionLinksResponse, err := c.GetCollectionLinks(ctx, &pb.GetCollectionLinksRequest{CollectionId: collectionID, Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), collectionLinksResponse.Total)
+	assert.Equal(t, collectionID, collectionLinksResponse.Links[0].Collection)
+
+	// DeleteCollectionLinks
+	deleteLinksResponse, err := c.DeleteCollectionLinks(ctx, &pb.DeleteCollectionLinksRequest{CollectionId: collectionID})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusAccepted), deleteLinksResponse.Code)
+
+	// DeleteCollection
+	deleteCollectionResponse, err := c.DeleteCollection(ctx, &pb.DeleteCollectionRequest{Id: collectionID})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), deleteCollectionResponse.Code)
+
+	// collections (negative tests)
+	_, err = c.CreateCollection(ctx, &pb.CreateCollectionRequest{Name: ""})
+	assert.Error(t, err)
+	_, err = c.MoveLinks(ctx, &pb.MoveLinksRequest{CollectionId: collectionID, Links: []*pb.ShortURL{{ShortUrl: link}}})
+	assert.Error(t, err)
+	_, err = c.GetCollectionLinks(ctx, &pb.GetCollectionLinksRequest{CollectionId: collectionID})
+	assert.Error(t, err)
+	_, err = c.DeleteCollectionLinks(ctx, &pb.DeleteCollectionLinksRequest{CollectionId: collectionID})
+	assert.Error(t, err)
+	_, err = c.DeleteCollection(ctx, &pb.DeleteCollectionRequest{Id: collectionID})
+	assert.Error(t, err)
+
+	// GetLinkHealth, links are not checked yet
+	healthResponse, err := c.GetLinkHealth(ctx, &pb.GetLinkHealthRequest{Short: &pb.ShortURL{ShortUrl: link}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusNoContent), healthResponse.Code)
+	assert.Nil(t, healthResponse.Health)
+
+	// GetUserLinks with health filter
+	brokenResponse, err := c.GetUserLinks(ctx, &pb.GetUserLinksRequest{Health: service.HealthBroken})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), brokenResponse.Code)
+	assert.Empty(t, brokenResponse.Links)
+
+	// health (negative tests)
+	_, err = c.GetLinkHealth(ctx, &pb.GetLinkHealthRequest{Short: &pb.ShortURL{ShortUrl: "unknown"}})
+	assert.Error(t, err)
+	_, err = c.GetUserLinks(ctx, &pb.GetUserLinksRequest{Health: "unknown"})
+	assert.Error(t, err)
+
 	// GetStats
 	statsResponse, err := c.GetStats(ctx, &pb.GetStatsRequest{})
 	log.Printf("userLinksResponse: %v", statsResponse)
 	assert.NoError(t, err)
 	assert.Equal(t, int32(1), statsResponse.GetUsers())
-	assert.Equal(t, int32(2), statsResponse.GetUrls())
+	assert.Equal(t, int32(5), statsResponse.GetUrls())
 	assert.Equal(t, int32(http.StatusOK), statsResponse.Code)
+
+	// GetInternalReport, direct visits are not reported as referrers
+	internalReportResponse, err := c.GetInternalReport(ctx, &pb.GetReportRequest{Report: types.ReportReferrers})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(http.StatusOK), internalReportResponse.Code)
+	assert.Empty(t, internalReportResponse.Items)
+
+	// ImportLinks and ExportUserLinks without user id use a new user
+	anonymousImport, err := c.ImportLinks(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, anonymousImport.Send(&pb.ImportLinkRequest{Orig: &pb.OriginalURL{OriginalUrl: "https://github.com/grpc_import/anonymous"}}))
+	importResponse, err = anonymousImport.CloseAndRecv()
+	assert.NoError(t, err)
+	if assert.Len(t, importResponse.Results, 1) {
+		assert.Equal(t, types.ImportCreated, importResponse.Results[0].Status)
+	}
+	anonymousExport, err := c.ExportUserLinks(context.Background(), &pb.ExportUserLinksRequest{})
+	assert.NoError(t, err)
+	_, err = anonymousExport.Recv()
+	assert.Equal(t, io.EOF, err)
 }
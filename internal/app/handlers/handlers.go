@@ -4,6 +4,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi/v5"
 	"go-developer-course-shortener/internal/app/rand"
 	"go-developer-course-shortener/internal/app/service"
@@ -12,13 +13,17 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 const (
 	ContentType           = "Content-Type"
 	ContentValuePlainText = "text/plain; charset=utf-8"
 	ContentValueJSON      = "application/json"
+	ContentValueHTML      = "text/html; charset=utf-8"
 	shortLinkLength       = 5
+	variantCookieMaxAge   = 30 * 24 * 60 * 60 // 30 days in seconds
 )
 
 // Handler contains service for current Repository.
@@ -38,7 +43,7 @@ func (h *Handler) HandlerBatchPOST(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Printf("Request batch JSON: %+v", request)
+	log.Printf("Request batch JSON: %d links", len(request))
 
 	userID := service.ExtractUserIDFromContext(r.Context())
 
@@ -89,15 +94,18 @@ func (h *Handler) HandlerJSONPOST(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `Invalid JSON format in request body. Expected: {"url": "<some_url>"}`, http.StatusBadRequest)
 		return
 	}
-	log.Printf("Request JSON: %+v", request)
-
-	log.Printf("Long URL: %v", request.URL)
 	longURL, err := service.ParseURL(request.URL)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	metadata, err := service.NormalizeMetadata(types.Metadata{Title: request.Title, Note: request.Note, Tags: request.Tags})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	userID := service.ExtractUserIDFromContext(r.Context())
 
 	id := string(rand.GenerateRandom(shortLinkLength))
@@ -117,6 +125,13 @@ func (h *Handler) HandlerJSONPOST(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+	} else if metadata.Title != "" || metadata.Note != "" || len(metadata.Tags) > 0 {
+		// metadata of the existing link is kept on conflict
+		err = h.service.SetMetadata(userID, shortURL, metadata)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	response := types.ResponseJSON{Result: shortURL}
@@ -150,7 +165,6 @@ func (h *Handler) HandlerPOST(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Long URL: %v", string(body))
 	longURL, err := service.ParseURL(string(body))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -217,15 +231,57 @@ func (h *Handler) HandlerUseStorageDELETE() http.HandlerFunc {
 	}
 }
 
+// HandlerRestorePOST implements restoring links of current user id deleted within the grace period.
+// It responds with short urls of restored links, links deleted earlier or not deleted are skipped.
+func (h *Handler) HandlerRestorePOST(w http.ResponseWriter, r *http.Request) {
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	var ids []string
+	if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Restore %+v for userID: %s", ids, userID)
+
+	shortURLS := make([]string, len(ids)) // allocate required capacity for the links
+	for i, id := range ids {
+		shortURLS[i] = service.MakeShortURL(h.service.BaseURL, id)
+	}
+
+	restored, err := h.service.RestoreURLS(userID, shortURLS)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if restored == nil {
+		restored = []string{}
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	if err = json.NewEncoder(w).Encode(restored); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 // HandlerUserStorageGET implements getting list of urls for current user id.
+// Query parameter health=broken returns only urls whose original urls failed the last check.
 func (h *Handler) HandlerUserStorageGET(w http.ResponseWriter, r *http.Request) {
 	userID := service.ExtractUserIDFromContext(r.Context())
-	log.Printf("Get all links for userID: %s", userID)
-	links, err := h.service.GetUserStorage(userID)
+	health := r.URL.Query().Get("health")
+	if health != "" && health != service.HealthBroken {
+		http.Error(w, "unknown health filter", http.StatusBadRequest)
+		return
+	}
+	log.Printf("Get all links for userID: %s health: %s", userID, health)
+	links, err := h.service.GetUserStorageByHealth(userID, health)
 	if err != nil {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	if links == nil && health != "" {
+		links = []types.Link{}
+	}
 
 	body, err := json.Marshal(links)
 	if err != nil {
@@ -241,24 +297,484 @@ func (h *Handler) HandlerUserStorageGET(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// HandlerSearchGET implements searching links of current user id by tags (tag) and text (q).
+func (h *Handler) HandlerSearchGET(w http.ResponseWriter, r *http.Request) {
+	userID := service.ExtractUserIDFromContext(r.Context())
+	query := types.SearchQuery{Tags: r.URL.Query()["tag"], Text: r.URL.Query().Get("q")}
+	log.Printf("Search links for userID: %s query: %+v", userID, query)
+
+	links, err := h.service.SearchURLS(userID, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if links == nil {
+		links = []types.Link{}
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	if err = json.NewEncoder(w).Encode(links); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandlerMetadataPUT implements setting title, note and tags for short url of current user id.
+func (h *Handler) HandlerMetadataPUT(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	var metadata types.Metadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Request metadata for `%s`: %+v", strID, metadata)
+
+	err := h.service.SetMetadata(userID, service.MakeShortURL(h.service.BaseURL, strID), metadata)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlerCollectionPOST implements creating a collection for current user id.
+func (h *Handler) HandlerCollectionPOST(w http.ResponseWriter, r *http.Request) {
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	var request types.RequestCollectionJSON
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Request collection: %+v", request)
+
+	collection, err := h.service.CreateCollection(userID, request.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(collection); err != nil {
+		log.Printf("Failed to write collection: %v", err)
+	}
+}
+
+// HandlerCollectionsGET implements getting collections of current user id.
+func (h *Handler) HandlerCollectionsGET(w http.ResponseWriter, r *http.Request) {
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	collections, err := h.service.GetCollections(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if collections == nil {
+		collections = []types.Collection{}
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	if err = json.NewEncoder(w).Encode(collections); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandlerCollectionDELETE implements deleting a collection of current user id, its links are kept.
+func (h *Handler) HandlerCollectionDELETE(w http.ResponseWriter, r *http.Request) {
+	collectionID := chi.URLParam(r, "CollectionID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+	log.Printf("Delete collection `%s` for userID: %s", collectionID, userID)
+
+	if err := h.service.DeleteCollection(userID, collectionID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlerCollectionURLSPUT implements moving links of current user id to the collection.
+func (h *Handler) HandlerCollectionURLSPUT(w http.ResponseWriter, r *http.Request) {
+	collectionID := chi.URLParam(r, "CollectionID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	var ids []string
+	if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Move %+v to collection `%s`", ids, collectionID)
+
+	shortURLS := make([]string, len(ids)) // allocate required capacity for the links
+	for i, id := range ids {
+		shortURLS[i] = service.MakeShortURL(h.service.BaseURL, id)
+	}
+
+	if err := h.service.MoveURLS(userID, collectionID, shortURLS); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlerCollectionURLSGET implements getting a page of links in the collection of current user id.
+// The page is set with limit and offset query parameters.
+func (h *Handler) HandlerCollectionURLSGET(w http.ResponseWriter, r *http.Request) {
+	collectionID := chi.URLParam(r, "CollectionID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	var limit, offset int
+	var err error
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "limit must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "offset must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	links, err := h.service.GetCollectionURLS(userID, collectionID, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	if err = json.NewEncoder(w).Encode(links); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandlerCollectionURLSDELETE implements deleting all links in the collection of current user id.
+func (h *Handler) HandlerCollectionURLSDELETE(w http.ResponseWriter, r *http.Request) {
+	collectionID := chi.URLParam(r, "CollectionID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+	log.Printf("Delete all links in collection `%s` for userID: %s", collectionID, userID)
+
+	if _, err := h.service.DeleteCollectionURLS(userID, collectionID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	w.WriteHeader(http.StatusAccepted)
+}
+
 // HandlerGET implements getting original url by short url.
+// Links with preview mode render the preview page instead of redirect.
+// Link preview bots of chat apps get a page with OpenGraph and Twitter card tags.
 func (h *Handler) HandlerGET(w http.ResponseWriter, r *http.Request) {
 	strID := chi.URLParam(r, "ID")
 	log.Printf("strID: `%s`", strID)
 
-	originalLink, err := h.service.GetURL(service.MakeShortURL(h.service.BaseURL, strID))
+	v, ok := h.visit(w, r, strID)
+	if !ok {
+		return
+	}
+
+	if v.target.Status == http.StatusTemporaryRedirect {
+		h.service.RecordClick(v.shortURL, v.link, v.visitor, v.target)
+		if service.DetectBot(r.UserAgent()) != "" {
+			h.renderUnfurl(w, v)
+			return
+		}
+		if v.link.Preview.Always {
+			h.renderPreview(w, v)
+			return
+		}
+	}
+
+	w.Header().Set(ContentType, ContentValuePlainText)
+	if v.target.URL != "" {
+		w.Header().Set("Location", v.target.URL)
+	}
+	w.WriteHeader(v.target.Status)
+}
+
+// visit contains resolved short url for the current request.
+type visit struct {
+	shortURL string
+	link     types.OriginalLink
+	visitor  service.Visitor
+	target   service.Target
+}
+
+// visit resolves target of the short url for the visitor and keeps the served variant sticky.
+func (h *Handler) visit(w http.ResponseWriter, r *http.Request, strID string) (visit, bool) {
+	shortURL := service.MakeShortURL(h.service.BaseURL, strID)
+	originalLink, err := h.service.GetURL(shortURL)
 	if err != nil {
 		http.Error(w, "ID not found", http.StatusBadRequest)
+		return visit{}, false
+	}
+	log.Printf("Short URL: %s deleted: %v", shortURL, originalLink.Deleted)
+
+	visitor := h.service.Locate(service.VisitorFromRequest(r))
+	if c, err := r.Cookie(service.VariantCookie(strID)); err == nil {
+		visitor.Variant = c.Value
+	}
+
+	target := h.service.ResolveTarget(originalLink, visitor)
+	log.Printf("Target status: %d variant: `%s`", target.Status, target.Variant)
+
+	if target.Variant != "" {
+		// keep the variant sticky for the visitor
+		http.SetCookie(w, &http.Cookie{
+			Name:   service.VariantCookie(strID),
+			Value:  target.Variant,
+			Path:   "/" + strID,
+			MaxAge: variantCookieMaxAge,
+		})
+	}
+	return visit{shortURL: shortURL, link: originalLink, visitor: visitor, target: target}, true
+}
+
+// HandlerPreviewGET implements rendering of the preview page for short url (/{ID}+).
+func (h *Handler) HandlerPreviewGET(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	log.Printf("strID (preview): `%s`", strID)
+
+	v, ok := h.visit(w, r, strID)
+	if !ok {
 		return
 	}
-	log.Printf("Original URL: %s deleted: %v", originalLink.OriginalURL, originalLink.Deleted)
+	if v.target.Status != http.StatusTemporaryRedirect {
+		// nothing to preview: link is deleted, expired or not active yet
+		w.Header().Set(ContentType, ContentValuePlainText)
+		w.WriteHeader(v.target.Status)
+		return
+	}
+	h.renderPreview(w, v)
+}
 
-	w.Header().Set(ContentType, ContentValuePlainText)
-	w.Header().Set("Location", originalLink.OriginalURL)
-	if !originalLink.Deleted {
-		w.WriteHeader(http.StatusTemporaryRedirect)
-	} else {
+// HandlerPreviewPUT implements setting preview settings for short url of current user id.
+func (h *Handler) HandlerPreviewPUT(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	var preview types.Preview
+	if err := json.NewDecoder(r.Body).Decode(&preview); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Request preview for `%s`: %+v", strID, preview)
+
+	err := h.service.SetPreview(userID, service.MakeShortURL(h.service.BaseURL, strID), preview)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlerSchedulePUT implements setting activation window for short url of current user id.
+func (h *Handler) HandlerSchedulePUT(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	var schedule types.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Request schedule for `%s`", strID)
+
+	err := h.service.SetSchedule(userID, service.MakeShortURL(h.service.BaseURL, strID), schedule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlerTargetsPUT implements replacing target rules for short url of current user id.
+func (h *Handler) HandlerTargetsPUT(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	var rules []types.TargetRule
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Request target rules for `%s`: %d rules", strID, len(rules))
+
+	err := h.service.SetTargets(userID, service.MakeShortURL(h.service.BaseURL, strID), rules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlerTargetsGET implements getting target rules for short url of current user id.
+func (h *Handler) HandlerTargetsGET(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	targets, err := h.service.GetTargets(userID, service.MakeShortURL(h.service.BaseURL, strID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	if err = json.NewEncoder(w).Encode(targets); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandlerVariantsPUT implements replacing weighted variants for short url of current user id.
+func (h *Handler) HandlerVariantsPUT(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	var variants []types.Variant
+	if err := json.NewDecoder(r.Body).Decode(&variants); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Request variants for `%s`: %d variants", strID, len(variants))
+
+	err := h.service.SetVariants(userID, service.MakeShortURL(h.service.BaseURL, strID), variants)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlerVariantsGET implements getting variants with click counters for short url of current user id.
+func (h *Handler) HandlerVariantsGET(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	variants, err := h.service.GetVariants(userID, service.MakeShortURL(h.service.BaseURL, strID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	if err = json.NewEncoder(w).Encode(variants); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandlerLinkStatsGET implements getting click counters for short url of current user id.
+// Only people are counted unless include_bots is set.
+func (h *Handler) HandlerLinkStatsGET(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	includeBots := false
+	if v := r.URL.Query().Get("include_bots"); v != "" {
+		var err error
+		if includeBots, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "include_bots must be a boolean", http.StatusBadRequest)
+			return
+		}
+	}
+
+	stats, err := h.service.GetLinkStats(userID, service.MakeShortURL(h.service.BaseURL, strID), includeBots)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	if err = json.NewEncoder(w).Encode(stats); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandlerLinkHealthGET implements getting the last check of original url for short url of current user id.
+// It responds with no content if the url was not checked yet.
+func (h *Handler) HandlerLinkHealthGET(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	health, err := h.service.GetLinkHealth(userID, service.MakeShortURL(h.service.BaseURL, strID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if health == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	if err = json.NewEncoder(w).Encode(health); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandlerQRGET implements getting qr code image for short url (/{ID}/qr).
+func (h *Handler) HandlerQRGET(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	log.Printf("strID (qr): `%s`", strID)
+
+	shortURL := service.MakeShortURL(h.service.BaseURL, strID)
+	link, err := h.service.GetURL(shortURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if link.Deleted {
 		w.WriteHeader(http.StatusGone)
+		return
+	}
+	h.writeQRCode(w, r, shortURL)
+}
+
+// HandlerUserQRGET implements getting qr code image for short url of current user id.
+func (h *Handler) HandlerUserQRGET(w http.ResponseWriter, r *http.Request) {
+	strID := chi.URLParam(r, "ID")
+	userID := service.ExtractUserIDFromContext(r.Context())
+
+	shortURL := service.MakeShortURL(h.service.BaseURL, strID)
+	link, err := h.service.GetURL(shortURL)
+	if err != nil || link.UserID != userID {
+		http.Error(w, "ID not found", http.StatusNotFound)
+		return
+	}
+	h.writeQRCode(w, r, shortURL)
+}
+
+// writeQRCode writes qr code image with options from the query (format, size, level, margin).
+func (h *Handler) writeQRCode(w http.ResponseWriter, r *http.Request, shortURL string) {
+	query := r.URL.Query()
+	options, err := service.ParseQROptions(query.Get("format"), query.Get("size"), query.Get("level"), query.Get("margin"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code, err := h.service.GetQRCode(shortURL, options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set(ContentType, code.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(code.Image); err != nil {
+		log.Printf("Failed to write qr code: %v", err)
 	}
 }
 
@@ -280,6 +796,76 @@ func (h *Handler) HandlerStats(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// reportQuery returns report query from the url: report name, optional from and to in RFC 3339 format and limit.
+func reportQuery(r *http.Request) (types.ReportQuery, error) {
+	query := types.ReportQuery{Dimension: chi.URLParam(r, "Report")}
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		if query.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return query, errors.New("from must be a time in RFC 3339 format")
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if query.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return query, errors.New("to must be a time in RFC 3339 format")
+		}
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			return query, errors.New("limit must be a number")
+		}
+	}
+	return query, nil
+}
+
+func writeReport(w http.ResponseWriter, items []types.ReportItem) {
+	w.Header().Set(ContentType, ContentValueJSON)
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandlerReportGET implements getting top links, referrers or countries by clicks on urls of current user id.
+func (h *Handler) HandlerReportGET(w http.ResponseWriter, r *http.Request) {
+	userID := service.ExtractUserIDFromContext(r.Context())
+	query, err := reportQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, err := h.service.GetReport(userID, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeReport(w, items)
+}
+
+// HandlerInternalReportGET implements getting top links, referrers or countries by clicks on urls of all users.
+// It is available only from the trusted subnet.
+func (h *Handler) HandlerInternalReportGET(w http.ResponseWriter, r *http.Request) {
+	// get user ip (check "X-Real-IP" header)
+	userIP := net.ParseIP(r.Header.Get("X-Real-IP"))
+	query, err := reportQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, err := h.service.GetInternalReport(userIP, query)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrForbidden) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeReport(w, items)
+}
+
 // HandlerPing verifies current status of repository.
 func (h *Handler) HandlerPing(w http.ResponseWriter, r *http.Request) {
 	if !h.service.Ping() {
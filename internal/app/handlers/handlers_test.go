@@ -3,15 +3,20 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"go-developer-course-shortener/internal/app/bots"
+	"go-developer-course-shortener/internal/app/geo"
 	"go-developer-course-shortener/internal/app/middleware"
 	"go-developer-course-shortener/internal/app/repository"
 	"go-developer-course-shortener/internal/app/repository/mocks"
 	"go-developer-course-shortener/internal/app/service"
 	"go-developer-course-shortener/internal/app/types"
 	"go-developer-course-shortener/internal/configs"
+	"go-developer-course-shortener/internal/health"
 	"go-developer-course-shortener/internal/worker"
+	"image/png"
 	"io"
 	"log"
 	"net"
@@ -21,12 +26,21 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 )
 
+// browserHeaders are sent with test requests, so clicks are counted as visits of people.
+var browserHeaders = map[string]string{
+	"User-Agent":      "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0",
+	"Accept":          "text/html,application/xhtml+xml",
+	"Accept-Language": "en-US,en;q=0.5",
+}
+
 func testRequest(t *testing.T, ts *httptest.Server, method, path string, body io.Reader) (*http.Response, string) {
 	req, err := http.NewRequest(method, ts.URL+path, body)
 	assert.NoError(t, err)
@@ -37,6 +51,9 @@ func testRequest(t *testing.T, ts *httptest.Server, method, path string, body io
 		},
 	}
 
+	for k, v := range browserHeaders {
+		req.Header.Set(k, v)
+	}
 	req.Header.Set("X-Real-IP", "localhost:8080")
 	resp, err := client.Do(req)
 	assert.NoError(t, err)
@@ -108,10 +125,33 @@ func NewRouter(config *configs.Config, auth ...bool) chi.Router {
 	r.Post("/api/shorten", handler.HandlerJSONPOST)
 	r.Post("/api/shorten/batch", handler.HandlerBatchPOST)
 	r.Get("/{ID}", handler.HandlerGET)
+	r.Get("/{ID}+", handler.HandlerPreviewGET)
+	r.Get("/{ID}/qr", handler.HandlerQRGET)
 	r.Get("/api/user/urls", handler.HandlerUserStorageGET)
 	r.Get("/ping", handler.HandlerPing)
 	r.Delete("/api/user/urls", handler.HandlerUseStorageDELETE())
+	r.Put("/api/user/urls/{ID}/schedule", handler.HandlerSchedulePUT)
+	r.Get("/api/user/urls/{ID}/targets", handler.HandlerTargetsGET)
+	r.Put("/api/user/urls/{ID}/targets", handler.HandlerTargetsPUT)
+	r.Get("/api/user/urls/{ID}/variants", handler.HandlerVariantsGET)
+	r.Put("/api/user/urls/{ID}/variants", handler.HandlerVariantsPUT)
+	r.Get("/api/user/urls/{ID}/stats", handler.HandlerLinkStatsGET)
+	r.Get("/api/user/urls/{ID}/health", handler.HandlerLinkHealthGET)
+	r.Put("/api/user/urls/{ID}/preview", handler.HandlerPreviewPUT)
+	r.Get("/api/user/urls/{ID}/qr", handler.HandlerUserQRGET)
+	r.Put("/api/user/urls/{ID}/metadata", handler.HandlerMetadataPUT)
+	r.Get("/api/user/urls/search", handler.HandlerSearchGET)
+	r.Get("/api/user/urls/export", handler.HandlerExportGET)
+	r.Post("/api/user/urls/import", handler.HandlerImportPOST)
+	r.Get("/api/user/collections", handler.HandlerCollectionsGET)
+	r.Post("/api/user/collections", handler.HandlerCollectionPOST)
+	r.Delete("/api/user/collections/{CollectionID}", handler.HandlerCollectionDELETE)
+	r.Get("/api/user/collections/{CollectionID}/urls", handler.HandlerCollectionURLSGET)
+	r.Put("/api/user/collections/{CollectionID}/urls", handler.HandlerCollectionURLSPUT)
+	r.Delete("/api/user/collections/{CollectionID}/urls", handler.HandlerCollectionURLSDELETE)
+	r.Get("/api/user/reports/{Report}", handler.HandlerReportGET)
 	r.Get("/api/internal/stats", handler.HandlerStats)
+	r.Get("/api/internal/reports/{Report}", handler.HandlerInternalReportGET)
 
 	return r
 }
@@ -940,3 +980,1453 @@ func TestHandlerJsonPost(t *testing.T) {
 		})
 	}
 }
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func newClockService(storage repository.Repository, clock service.Clock) *service.Service {
+	jobs := make(chan worker.Job, worker.MaxWorkerPoolSize)
+	svc := service.NewService(storage, jobs, nil, "http://localhost:8080")
+	svc.SetClock(clock)
+	return svc
+}
+
+func NewClockRouter(storage repository.Repository, clock service.Clock) chi.Router {
+	return NewServiceRouter(newClockService(storage, clock))
+}
+
+func NewServiceRouter(svc *service.Service) chi.Router {
+	handler := NewHTTPHandler(svc)
+
+	r := chi.NewRouter()
+	r.Use(AuthHandleMock)
+	r.Post("/", handler.HandlerPOST)
+	r.Post("/api/shorten", handler.HandlerJSONPOST)
+	r.Post("/api/shorten/batch", handler.HandlerBatchPOST)
+	r.Get("/{ID}", handler.HandlerGET)
+	r.Get("/api/user/urls", handler.HandlerUserStorageGET)
+	r.Post("/api/user/urls/restore", handler.HandlerRestorePOST)
+	r.Put("/api/user/urls/{ID}/schedule", handler.HandlerSchedulePUT)
+	r.Get("/api/user/urls/{ID}/targets", handler.HandlerTargetsGET)
+	r.Put("/api/user/urls/{ID}/targets", handler.HandlerTargetsPUT)
+	r.Get("/api/user/urls/{ID}/variants", handler.HandlerVariantsGET)
+	r.Put("/api/user/urls/{ID}/variants", handler.HandlerVariantsPUT)
+	r.Get("/api/user/urls/{ID}/stats", handler.HandlerLinkStatsGET)
+	r.Get("/api/user/urls/{ID}/health", handler.HandlerLinkHealthGET)
+	r.Get("/{ID}+", handler.HandlerPreviewGET)
+	r.Get("/{ID}/qr", handler.HandlerQRGET)
+	r.Put("/api/user/urls/{ID}/preview", handler.HandlerPreviewPUT)
+	r.Get("/api/user/urls/{ID}/qr", handler.HandlerUserQRGET)
+	r.Put("/api/user/urls/{ID}/metadata", handler.HandlerMetadataPUT)
+	r.Get("/api/user/urls/search", handler.HandlerSearchGET)
+	r.Get("/api/user/urls/export", handler.HandlerExportGET)
+	r.Post("/api/user/urls/import", handler.HandlerImportPOST)
+	r.Get("/api/user/collections", handler.HandlerCollectionsGET)
+	r.Post("/api/user/collections", handler.HandlerCollectionPOST)
+	r.Delete("/api/user/collections/{CollectionID}", handler.HandlerCollectionDELETE)
+	r.Get("/api/user/collections/{CollectionID}/urls", handler.HandlerCollectionURLSGET)
+	r.Put("/api/user/collections/{CollectionID}/urls", handler.HandlerCollectionURLSPUT)
+	r.Delete("/api/user/collections/{CollectionID}/urls", handler.HandlerCollectionURLSDELETE)
+	r.Get("/api/user/reports/{Report}", handler.HandlerReportGET)
+	r.Get("/api/internal/reports/{Report}", handler.HandlerInternalReportGET)
+	return r
+}
+
+func TestHandlerSchedule(t *testing.T) {
+	launch := time.Date(2030, time.January, 1, 12, 0, 0, 0, time.UTC)
+	finish := launch.Add(24 * time.Hour)
+
+	type want struct {
+		statusCode     int
+		headerLocation string
+	}
+	tests := []struct {
+		name     string
+		schedule string
+		now      time.Time
+		want     want
+	}{
+		{
+			name:     "pending url before launch",
+			schedule: `{"not_before":"2030-01-01T12:00:00Z","not_after":"2030-01-02T12:00:00Z","pending_url":"https://github.com/coming_soon"}`,
+			now:      launch.Add(-time.Minute),
+			want:     want{statusCode: http.StatusTemporaryRedirect, headerLocation: "https://github.com/coming_soon"},
+		},
+		{
+			name:     "no pending url before launch",
+			schedule: `{"not_before":"2030-01-01T12:00:00Z"}`,
+			now:      launch.Add(-time.Minute),
+			want:     want{statusCode: http.StatusNotFound, headerLocation: ""},
+		},
+		{
+			name:     "original url inside window",
+			schedule: `{"not_before":"2030-01-01T12:00:00Z","not_after":"2030-01-02T12:00:00Z","pending_url":"https://github.com/coming_soon"}`,
+			now:      launch,
+			want:     want{statusCode: http.StatusTemporaryRedirect, headerLocation: "https://github.com/launch"},
+		},
+		{
+			name:     "expired link",
+			schedule: `{"not_after":"2030-01-02T12:00:00Z"}`,
+			now:      finish,
+			want:     want{statusCode: http.StatusGone, headerLocation: ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temp, file := createFileRepository(t)
+			defer func() {
+				err := os.RemoveAll(temp)
+				assert.NoError(t, err)
+			}()
+
+			storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+			for _, storage := range storages {
+				clock := &fixedClock{now: tt.now}
+				ts := httptest.NewServer(NewClockRouter(storage, clock))
+
+				resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/launch"))
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+				shortURL, err := url.Parse(body)
+				assert.NoError(t, err)
+
+				resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/schedule", bytes.NewBufferString(tt.schedule))
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+				resp, _ = testRequest(t, ts, http.MethodGet, shortURL.Path, nil)
+				assert.Equal(t, tt.want.statusCode, resp.StatusCode)
+				assert.Equal(t, tt.want.headerLocation, resp.Header.Get("Location"))
+				ts.Close()
+			}
+		})
+	}
+}
+
+func TestHandlerScheduleErrors(t *testing.T) {
+	storage := repository.NewInMemoryRepository()
+	ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+	defer ts.Close()
+
+	// unknown short url
+	resp, _ := testRequest(t, ts, http.MethodPut, "/api/user/urls/unknown/schedule", bytes.NewBufferString(`{}`))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/launch"))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	shortURL, err := url.Parse(body)
+	assert.NoError(t, err)
+
+	// invalid window
+	resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/schedule",
+		bytes.NewBufferString(`{"not_before":"2030-01-02T12:00:00Z","not_after":"2030-01-01T12:00:00Z"}`))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// invalid json
+	resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/schedule", bytes.NewBufferString(`{`))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func testRequestWithHeaders(t *testing.T, ts *httptest.Server, method, path string, headers map[string]string) *http.Response {
+	req, err := http.NewRequest(method, ts.URL+path, nil)
+	assert.NoError(t, err)
+	for k, v := range browserHeaders {
+		req.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	err = resp.Body.Close()
+	assert.NoError(t, err)
+	return resp
+}
+
+func TestHandlerTargets(t *testing.T) {
+	rules := `[
+		{"type":"platform","value":"ios","url":"https://apps.apple.com/app"},
+		{"type":"platform","value":"android","url":"https://play.google.com/app"},
+		{"type":"header","header":"X-Campaign","value":"beta","url":"https://github.com/beta"},
+		{"type":"language","value":"de","url":"https://github.com/de"}
+	]`
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		wantLocation string
+	}{
+		{
+			name:         "ios",
+			headers:      map[string]string{"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X)"},
+			wantLocation: "https://apps.apple.com/app",
+		},
+		{
+			name:         "android",
+			headers:      map[string]string{"User-Agent": "Mozilla/5.0 (Linux; Android 13; Pixel 7)"},
+			wantLocation: "https://play.google.com/app",
+		},
+		{
+			name:         "custom header",
+			headers:      map[string]string{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64)", "X-Campaign": "Beta"},
+			wantLocation: "https://github.com/beta",
+		},
+		{
+			name:         "preferred language",
+			headers:      map[string]string{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64)", "Accept-Language": "en;q=0.5, de-AT, fr;q=0.8"},
+			wantLocation: "https://github.com/de",
+		},
+		{
+			name:         "default target",
+			headers:      map[string]string{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64)", "Accept-Language": "en-US,de;q=0.9"},
+			wantLocation: "https://github.com/default",
+		},
+	}
+
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/default"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		shortURL, err := url.Parse(body)
+		assert.NoError(t, err)
+
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/targets", bytes.NewBufferString(rules))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls"+shortURL.Path+"/targets", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var targets types.LinkTargets
+		err = json.Unmarshal([]byte(body), &targets)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://github.com/default", targets.Default)
+		assert.Equal(t, 4, len(targets.Rules))
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				resp := testRequestWithHeaders(t, ts, http.MethodGet, shortURL.Path, tt.headers)
+				assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+				assert.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+			})
+		}
+
+		// invalid rules
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/targets",
+			bytes.NewBufferString(`[{"type":"platform","value":"windows","url":"https://github.com"}]`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/targets",
+			bytes.NewBufferString(`[{"type":"unknown","value":"x","url":"https://github.com"}]`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		// unknown link
+		resp, _ = testRequest(t, ts, http.MethodGet, "/api/user/urls/unknown/targets", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		ts.Close()
+	}
+}
+
+func TestHandlerVariants(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/default"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		shortURL, err := url.Parse(body)
+		assert.NoError(t, err)
+		cookie := service.VariantCookie(shortURL.Path[1:])
+
+		// all traffic to variant "a"
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/variants",
+			bytes.NewBufferString(`[{"name":"a","url":"https://github.com/a","weight":100},{"name":"b","url":"https://github.com/b","weight":0}]`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = testRequestWithHeaders(t, ts, http.MethodGet, shortURL.Path, nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		assert.Equal(t, "https://github.com/a", resp.Header.Get("Location"))
+		assert.Equal(t, 1, len(resp.Cookies()))
+		assert.Equal(t, cookie, resp.Cookies()[0].Name)
+		assert.Equal(t, "a", resp.Cookies()[0].Value)
+
+		// sticky variant is served while it has weight
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/variants",
+			bytes.NewBufferString(`[{"name":"a","url":"https://github.com/a","weight":1},{"name":"b","url":"https://github.com/b","weight":1000}]`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		for i := 0; i < 3; i++ {
+			resp = testRequestWithHeaders(t, ts, http.MethodGet, shortURL.Path, map[string]string{"Cookie": cookie + "=a"})
+			assert.Equal(t, "https://github.com/a", resp.Header.Get("Location"))
+		}
+
+		// sticky variant without weight is replaced
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/variants",
+			bytes.NewBufferString(`[{"name":"a","url":"https://github.com/a","weight":0},{"name":"b","url":"https://github.com/b","weight":1}]`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp = testRequestWithHeaders(t, ts, http.MethodGet, shortURL.Path, map[string]string{"Cookie": cookie + "=a"})
+		assert.Equal(t, "https://github.com/b", resp.Header.Get("Location"))
+
+		// per-variant clicks
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls"+shortURL.Path+"/variants", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var variants []types.VariantStats
+		err = json.Unmarshal([]byte(body), &variants)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(variants))
+		assert.Equal(t, 4, variants[0].Clicks)
+		assert.Equal(t, 1, variants[1].Clicks)
+
+		// invalid variants
+		invalid := []string{
+			`[{"name":"a","url":"https://github.com/a","weight":0}]`,
+			`[{"name":"a","url":"https://github.com/a","weight":-1}]`,
+			`[{"name":"a b","url":"https://github.com/a","weight":1}]`,
+			`[{"name":"a","url":"https://github.com/a","weight":1},{"name":"a","url":"https://github.com/b","weight":1}]`,
+		}
+		for _, v := range invalid {
+			resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/variants", bytes.NewBufferString(v))
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		}
+
+		// unknown link
+		resp, _ = testRequest(t, ts, http.MethodGet, "/api/user/urls/unknown/variants", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		ts.Close()
+	}
+}
+
+func TestHandlerCountryTargets(t *testing.T) {
+	db, err := geo.Read(strings.NewReader("203.0.113.0/24,DE,EU\n198.51.100.0/24,FR,EU\n192.0.2.0/24,US,NA\n"))
+	assert.NoError(t, err)
+
+	svc := newClockService(repository.NewInMemoryRepository(), &fixedClock{now: time.Now()})
+	svc.SetGeoDatabase(db)
+	ts := httptest.NewServer(NewServiceRouter(svc))
+	defer ts.Close()
+
+	resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/default"))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	shortURL, err := url.Parse(body)
+	assert.NoError(t, err)
+
+	resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/targets",
+		bytes.NewBufferString(`[{"type":"country","value":"de","url":"https://github.com/de"},{"type":"country","value":"eu","url":"https://github.com/eu"}]`))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		wantLocation string
+	}{
+		{name: "country", headers: map[string]string{"X-Real-IP": "203.0.113.10"}, wantLocation: "https://github.com/de"},
+		{name: "region", headers: map[string]string{"X-Forwarded-For": "198.51.100.7, 10.0.0.1"}, wantLocation: "https://github.com/eu"},
+		{name: "other country", headers: map[string]string{"X-Real-IP": "192.0.2.1"}, wantLocation: "https://github.com/default"},
+		{name: "unknown network", headers: nil, wantLocation: "https://github.com/default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := testRequestWithHeaders(t, ts, http.MethodGet, shortURL.Path, tt.headers)
+			assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+			assert.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+		})
+	}
+
+	// country is recorded in click stats
+	resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls"+shortURL.Path+"/stats", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var stats types.ClickStats
+	err = json.Unmarshal([]byte(body), &stats)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.Total)
+	assert.Equal(t, map[string]int{"DE": 1, "FR": 1, "US": 1}, stats.Countries)
+
+	// unknown link
+	resp, _ = testRequest(t, ts, http.MethodGet, "/api/user/urls/unknown/stats", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHandlerPreview(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/preview?a=1&b=2"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		shortURL, err := url.Parse(body)
+		assert.NoError(t, err)
+
+		// preview page is available without any settings
+		resp, body = testRequest(t, ts, http.MethodGet, shortURL.Path+"+", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentValueHTML, resp.Header.Get(ContentType))
+		assert.Contains(t, body, "https://github.com/preview?a=1&amp;b=2")
+		assert.Contains(t, body, "Created on")
+
+		// plain redirect is not affected
+		resp, _ = testRequest(t, ts, http.MethodGet, shortURL.Path, nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+
+		// always show preview with escaped title and description
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/preview",
+			bytes.NewBufferString(`{"always":true,"title":"<b>Docs</b>","description":"Project docs"}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, body = testRequest(t, ts, http.MethodGet, shortURL.Path, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentValueHTML, resp.Header.Get(ContentType))
+		assert.Contains(t, body, "&lt;b&gt;Docs&lt;/b&gt;")
+		assert.Contains(t, body, "Project docs")
+		assert.Contains(t, body, "https://github.com/preview?a=1&amp;b=2")
+
+		// link is not active yet: destination is not revealed
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/schedule",
+			bytes.NewBufferString(`{"not_before":"2100-01-01T12:00:00Z"}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, body = testRequest(t, ts, http.MethodGet, shortURL.Path+"+", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.NotContains(t, body, "github.com/preview")
+
+		// invalid settings
+		invalid := []string{
+			`{"title":"` + strings.Repeat("a", 201) + `"}`,
+			`{"description":"` + strings.Repeat("a", 1001) + `"}`,
+			`{"always":"yes"}`,
+		}
+		for _, v := range invalid {
+			resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/preview", bytes.NewBufferString(v))
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		}
+
+		// unknown link
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls/unknown/preview", bytes.NewBufferString(`{}`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp, _ = testRequest(t, ts, http.MethodGet, "/unknown+", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		ts.Close()
+	}
+}
+
+func TestHandlerQRCode(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/qr"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		shortURL, err := url.Parse(body)
+		assert.NoError(t, err)
+
+		// default png
+		resp, body = testRequest(t, ts, http.MethodGet, shortURL.Path+"/qr", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "image/png", resp.Header.Get(ContentType))
+		img, err := png.Decode(strings.NewReader(body))
+		assert.NoError(t, err)
+		assert.Equal(t, 256, img.Bounds().Dx())
+
+		// cached code is the same
+		_, cached := testRequest(t, ts, http.MethodGet, shortURL.Path+"/qr", nil)
+		assert.Equal(t, body, cached)
+
+		// svg with options
+		resp, body = testRequest(t, ts, http.MethodGet, shortURL.Path+"/qr?format=svg&size=512&level=h&margin=0", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "image/svg+xml", resp.Header.Get(ContentType))
+		assert.Contains(t, body, `width="512"`)
+		assert.Contains(t, body, "M0,0h7v1h-7z")
+
+		// code of the current user
+		resp, userBody := testRequest(t, ts, http.MethodGet, "/api/user/urls"+shortURL.Path+"/qr?format=svg&size=512&level=h&margin=0", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, body, userBody)
+
+		// invalid options
+		invalid := []string{"format=gif", "size=10", "size=big", "level=X", "margin=-1", "margin=17", "size=64&level=h&margin=16"}
+		for _, v := range invalid {
+			resp, _ = testRequest(t, ts, http.MethodGet, shortURL.Path+"/qr?"+v, nil)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, v)
+		}
+
+		// unknown link
+		resp, _ = testRequest(t, ts, http.MethodGet, "/unknown/qr", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp, _ = testRequest(t, ts, http.MethodGet, "/api/user/urls/unknown/qr", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		ts.Close()
+	}
+}
+
+func TestHandlerMetadataSearch(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+
+		// metadata at creation
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/shorten",
+			bytes.NewBufferString(`{"url":"https://github.com/golang/go","title":"Go repository","note":"Issues and releases","tags":[" Go ","golang","go"]}`))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var created types.ResponseJSON
+		assert.NoError(t, json.Unmarshal([]byte(body), &created))
+		goURL := created.Result
+
+		// metadata later
+		resp, body = testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://docs.example.com/rust-book"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		rustURL := body
+		shortURL, err := url.Parse(rustURL)
+		assert.NoError(t, err)
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/metadata",
+			bytes.NewBufferString(`{"title":"The book","note":"Read before the go workshop","tags":["rust","books"]}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// links are returned with metadata
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var links []types.Link
+		assert.NoError(t, json.Unmarshal([]byte(body), &links))
+		assert.Equal(t, []types.Link{
+			{ShortURL: goURL, OriginalURL: "https://github.com/golang/go",
+				Metadata: types.Metadata{Title: "Go repository", Note: "Issues and releases", Tags: []string{"go", "golang"}}},
+			{ShortURL: rustURL, OriginalURL: "https://docs.example.com/rust-book",
+				Metadata: types.Metadata{Title: "The book", Note: "Read before the go workshop", Tags: []string{"rust", "books"}}},
+		}, links)
+
+		tests := []struct {
+			query string
+			want  []string
+		}{
+			{query: "", want: []string{goURL, rustURL}},
+			{query: "tag=GO", want: []string{goURL}},
+			{query: "tag=go&tag=golang", want: []string{goURL}},
+			{query: "tag=go&tag=rust", want: []string{}},
+			{query: "q=go", want: []string{goURL, rustURL}},
+			{query: "q=releases", want: []string{goURL}},
+			{query: "q=rust", want: []string{rustURL}},
+			{query: "q=github.com", want: []string{goURL}},
+			{query: "q=book+workshop&tag=books", want: []string{rustURL}},
+			{query: "q=unknown", want: []string{}},
+		}
+		for _, tt := range tests {
+			resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls/search?"+tt.query, nil)
+			assert.Equal(t, http.StatusOK, resp.StatusCode, tt.query)
+			var found []types.Link
+			assert.NoError(t, json.Unmarshal([]byte(body), &found))
+			got := []string{}
+			for _, v := range found {
+				got = append(got, v.ShortURL)
+			}
+			assert.Equal(t, tt.want, got, tt.query)
+		}
+
+		// invalid metadata
+		invalid := []string{
+			`{"title":"` + strings.Repeat("a", 201) + `"}`,
+			`{"note":"` + strings.Repeat("a", 1001) + `"}`,
+			`{"tags":[""]}`,
+			`{"tags":["` + strings.Repeat("a", 51) + `"]}`,
+		}
+		for _, v := range invalid {
+			resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+shortURL.Path+"/metadata", bytes.NewBufferString(v))
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, v)
+		}
+		resp, _ = testRequest(t, ts, http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url":"https://github.com/x","tags":[" "]}`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		// unknown link
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls/unknown/metadata", bytes.NewBufferString(`{"title":"x"}`))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		ts.Close()
+	}
+}
+
+func TestHandlerCollections(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		jobs := make(chan worker.Job, worker.MaxWorkerPoolSize)
+		ts := httptest.NewServer(NewServiceRouter(service.NewService(storage, jobs, nil, "http://localhost:8080")))
+
+		var ids []string
+		for i := 0; i < 3; i++ {
+			resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString(fmt.Sprintf("https://github.com/campaign%d", i)))
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			shortURL, err := url.Parse(body)
+			assert.NoError(t, err)
+			ids = append(ids, shortURL.Path[1:])
+		}
+
+		// create collections
+		resp, body := testRequest(t, ts, http.MethodGet, "/api/user/collections", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "[]\n", body)
+
+		var spring, autumn types.Collection
+		resp, body = testRequest(t, ts, http.MethodPost, "/api/user/collections", bytes.NewBufferString(`{"name":" Spring "}`))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.NoError(t, json.Unmarshal([]byte(body), &spring))
+		assert.Equal(t, "Spring", spring.Name)
+		assert.NotEmpty(t, spring.ID)
+		resp, body = testRequest(t, ts, http.MethodPost, "/api/user/collections", bytes.NewBufferString(`{"name":"Autumn"}`))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.NoError(t, json.Unmarshal([]byte(body), &autumn))
+
+		// move links between collections
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/collections/"+spring.ID+"/urls",
+			bytes.NewBufferString(fmt.Sprintf(`["%s","%s","%s"]`, ids[0], ids[1], ids[2])))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/collections/"+autumn.ID+"/urls",
+			bytes.NewBufferString(fmt.Sprintf(`["%s"]`, ids[2])))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/collections", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var collections []types.Collection
+		assert.NoError(t, json.Unmarshal([]byte(body), &collections))
+		assert.Equal(t, []types.Collection{
+			{ID: spring.ID, Name: "Spring", Links: 2},
+			{ID: autumn.ID, Name: "Autumn", Links: 1},
+		}, collections)
+
+		// pagination
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/collections/"+spring.ID+"/urls?limit=1&offset=1", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var page types.CollectionLinks
+		assert.NoError(t, json.Unmarshal([]byte(body), &page))
+		assert.Equal(t, 2, page.Total)
+		assert.Equal(t, 1, len(page.Links))
+		assert.Equal(t, "http://localhost:8080/"+ids[1], page.Links[0].ShortURL)
+		assert.Equal(t, spring.ID, page.Links[0].Collection)
+
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/collections/"+spring.ID+"/urls?offset=5", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"links":[],"total":2}`+"\n", body)
+
+		// bulk delete goes to the worker pool
+		resp, _ = testRequest(t, ts, http.MethodDelete, "/api/user/collections/"+spring.ID+"/urls", nil)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		job := <-jobs
+		assert.Equal(t, "4b003ed0-4d8f-46eb-8322-e90174110517", job.UserID)
+		assert.Equal(t, []string{"http://localhost:8080/" + ids[0], "http://localhost:8080/" + ids[1]}, job.ShortURLS)
+
+		// delete collection keeps links
+		resp, _ = testRequest(t, ts, http.MethodDelete, "/api/user/collections/"+autumn.ID, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var links []types.Link
+		assert.NoError(t, json.Unmarshal([]byte(body), &links))
+		assert.Equal(t, 3, len(links))
+		assert.Equal(t, "", links[2].Collection)
+
+		// errors
+		invalid := []struct {
+			method string
+			path   string
+			body   string
+			status int
+		}{
+			{method: http.MethodPost, path: "/api/user/collections", body: `{"name":"Spring"}`, status: http.StatusBadRequest},
+			{method: http.MethodPost, path: "/api/user/collections", body: `{"name":" "}`, status: http.StatusBadRequest},
+			{method: http.MethodPost, path: "/api/user/collections", body: `{"name":"` + strings.Repeat("a", 101) + `"}`, status: http.StatusBadRequest},
+			{method: http.MethodPut, path: "/api/user/collections/" + autumn.ID + "/urls", body: `["` + ids[0] + `"]`, status: http.StatusBadRequest},
+			{method: http.MethodPut, path: "/api/user/collections/" + spring.ID + "/urls", body: `["unknown"]`, status: http.StatusBadRequest},
+			{method: http.MethodPut, path: "/api/user/collections/" + spring.ID + "/urls", body: `[]`, status: http.StatusBadRequest},
+			{method: http.MethodGet, path: "/api/user/collections/" + spring.ID + "/urls?limit=101", status: http.StatusBadRequest},
+			{method: http.MethodGet, path: "/api/user/collections/" + spring.ID + "/urls?offset=-1", status: http.StatusBadRequest},
+			{method: http.MethodGet, path: "/api/user/collections/" + spring.ID + "/urls?limit=x", status: http.StatusBadRequest},
+			{method: http.MethodGet, path: "/api/user/collections/" + autumn.ID + "/urls", status: http.StatusBadRequest},
+			{method: http.MethodDelete, path: "/api/user/collections/" + autumn.ID, status: http.StatusNotFound},
+			{method: http.MethodDelete, path: "/api/user/collections/" + autumn.ID + "/urls", status: http.StatusNotFound},
+		}
+		for _, tt := range invalid {
+			resp, _ = testRequest(t, ts, tt.method, tt.path, bytes.NewBufferString(tt.body))
+			assert.Equal(t, tt.status, resp.StatusCode, tt.method+" "+tt.path)
+		}
+		ts.Close()
+	}
+}
+
+func TestHandlerHealth(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer destination.Close()
+
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+
+		var paths []string
+		for _, v := range []string{"/ok", "/gone"} {
+			resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString(destination.URL+v))
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			shortURL, err := url.Parse(body)
+			assert.NoError(t, err)
+			paths = append(paths, shortURL.Path)
+		}
+
+		// links are not checked yet
+		resp, _ := testRequest(t, ts, http.MethodGet, "/api/user/urls"+paths[0]+"/health", nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		resp, body := testRequest(t, ts, http.MethodGet, "/api/user/urls?health=broken", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `[]`, body)
+
+		config := health.DefaultConfig(time.Hour)
+		config.HostInterval = 0
+		checker := health.NewChecker(storage, config)
+		// the destination is a local test server
+		checker.SetTransport(&http.Transport{})
+		checked, err := checker.CheckOnce(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, checked)
+
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls?health=broken", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var links []types.Link
+		assert.NoError(t, json.Unmarshal([]byte(body), &links))
+		if assert.Equal(t, 1, len(links)) {
+			assert.Equal(t, destination.URL+"/gone", links[0].OriginalURL)
+			assert.Equal(t, http.StatusGone, links[0].Health.StatusCode)
+		}
+
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		links = nil
+		assert.NoError(t, json.Unmarshal([]byte(body), &links))
+		assert.Equal(t, 2, len(links))
+
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls"+paths[0]+"/health", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var linkHealth types.Health
+		assert.NoError(t, json.Unmarshal([]byte(body), &linkHealth))
+		assert.Equal(t, http.StatusOK, linkHealth.StatusCode)
+		assert.False(t, linkHealth.Broken())
+		assert.False(t, linkHealth.CheckedAt.IsZero())
+
+		resp, _ = testRequest(t, ts, http.MethodGet, "/api/user/urls?health=unknown", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp, _ = testRequest(t, ts, http.MethodGet, "/api/user/urls/unknown/health", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		ts.Close()
+	}
+}
+
+func TestHandlerPages(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		svc := newClockService(storage, &fixedClock{now: time.Now()})
+		pages := make(chan worker.PageJob, worker.MaxPageQueueSize)
+		svc.SetPageJobs(pages)
+		ts := httptest.NewServer(NewServiceRouter(svc))
+
+		// every way of link creation queues the page job
+		resp, shortURL := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/pages"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, worker.PageJob{ShortURLS: []string{shortURL}}, <-pages)
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url":"https://github.com/pages/json"}`))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var created types.ResponseJSON
+		assert.NoError(t, json.Unmarshal([]byte(body), &created))
+		assert.Equal(t, worker.PageJob{ShortURLS: []string{created.Result}}, <-pages)
+
+		resp, body = testRequest(t, ts, http.MethodPost, "/api/shorten/batch", bytes.NewBufferString(
+			`[{"correlation_id":"1","original_url":"https://github.com/pages/1"},{"correlation_id":"2","original_url":"https://github.com/pages/2"}]`))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var batch types.ResponseBatch
+		assert.NoError(t, json.Unmarshal([]byte(body), &batch))
+		assert.Equal(t, worker.PageJob{ShortURLS: []string{batch[0].ShortURL, batch[1].ShortURL}}, <-pages)
+
+		// fetched page is returned with the link and used by the preview page
+		page := types.Page{Title: "Pages", OGTitle: "GitHub Pages", OGDescription: "Websites for you and your projects",
+			OGImage: "https://github.com/pages.png", FetchedAt: time.Now().UTC()}
+		assert.NoError(t, storage.SavePage(shortURL, page))
+
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var links []types.Link
+		assert.NoError(t, json.Unmarshal([]byte(body), &links))
+		if assert.NotEmpty(t, links) && assert.NotNil(t, links[0].Page) {
+			assert.Equal(t, shortURL, links[0].ShortURL)
+			assert.Equal(t, page.OGTitle, links[0].Page.OGTitle)
+			assert.Equal(t, page.OGImage, links[0].Page.OGImage)
+		}
+
+		path, err := url.Parse(shortURL)
+		assert.NoError(t, err)
+		resp, body = testRequest(t, ts, http.MethodGet, path.Path+"+", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, body, "<h1>GitHub Pages</h1>")
+		assert.Contains(t, body, "Websites for you and your projects")
+
+		// owner settings have priority
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+path.Path+"/preview", bytes.NewBufferString(`{"title":"Docs"}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, body = testRequest(t, ts, http.MethodGet, path.Path+"+", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, body, "<h1>Docs</h1>")
+		assert.Contains(t, body, "Websites for you and your projects")
+
+		// link creation is not blocked by the full queue
+		for i := 0; i < worker.MaxPageQueueSize+1; i++ {
+			resp, _ = testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString(fmt.Sprintf("https://github.com/pages/%d", i+3)))
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		}
+		assert.Equal(t, worker.MaxPageQueueSize, len(pages))
+		ts.Close()
+	}
+}
+
+func TestHandlerUnfurl(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	unfurl := func(t *testing.T, ts *httptest.Server, path, userAgent string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		assert.NoError(t, err)
+		req.Header.Set("User-Agent", userAgent)
+		client := &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		resp, err := client.Do(req)
+		assert.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Body.Close())
+		return resp, string(body)
+	}
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+
+		resp, shortURL := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/unfurl"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		path, err := url.Parse(shortURL)
+		assert.NoError(t, err)
+
+		// without metadata the host of the destination is the title
+		resp, body := unfurl(t, ts, path.Path, "Twitterbot/1.0")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentValueHTML, resp.Header.Get(ContentType))
+		assert.Contains(t, body, `<meta property="og:title" content="github.com">`)
+		assert.Contains(t, body, `<meta property="og:url" content="`+shortURL+`">`)
+		assert.Contains(t, body, `<meta name="twitter:card" content="summary">`)
+		assert.NotContains(t, body, "og:image")
+
+		// metadata of the destination page
+		page := types.Page{OGTitle: "Unfurl", OGDescription: "Cards & previews",
+			OGImage: "https://github.com/unfurl.png?a=1&b=2", FetchedAt: time.Now().UTC()}
+		assert.NoError(t, storage.SavePage(shortURL, page))
+		resp, body = unfurl(t, ts, path.Path, "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, body, `<meta property="og:title" content="Unfurl">`)
+		assert.Contains(t, body, `<meta property="og:description" content="Cards &amp; previews">`)
+		assert.Contains(t, body, `<meta property="og:image" content="https://github.com/unfurl.png?a=1&amp;b=2">`)
+		assert.Contains(t, body, `<meta name="twitter:card" content="summary_large_image">`)
+
+		// owner settings have priority
+		resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+path.Path+"/preview", bytes.NewBufferString(`{"title":"<Docs>"}`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, body = unfurl(t, ts, path.Path, "facebookexternalhit/1.1")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, body, `<meta property="og:title" content="&lt;Docs&gt;">`)
+
+		// other clients are redirected
+		resp = testRequestWithHeaders(t, ts, http.MethodGet, path.Path, nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+
+		// bot visits are not counted as clicks
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls"+path.Path+"/stats", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var stats types.ClickStats
+		assert.NoError(t, json.Unmarshal([]byte(body), &stats))
+		assert.Equal(t, 1, stats.Total)
+		assert.Equal(t, map[string]int{"Twitter": 1, "Slack": 1, "Facebook": 1}, stats.Bots)
+		ts.Close()
+	}
+}
+
+func TestHandlerUnfurlBeforeLaunch(t *testing.T) {
+	launch := time.Date(2030, time.January, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: launch.Add(-time.Minute)}
+	storage := repository.NewInMemoryRepository()
+	ts := httptest.NewServer(NewClockRouter(storage, clock))
+	defer ts.Close()
+
+	slackbot := func(path string) string {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		assert.NoError(t, err)
+		req.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		assert.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		return string(body)
+	}
+
+	resp, shortURL := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/launch"))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	path, err := url.Parse(shortURL)
+	assert.NoError(t, err)
+	schedule := `{"not_before":"2030-01-01T12:00:00Z","pending_url":"https://example.com/coming_soon"}`
+	resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+path.Path+"/schedule", bytes.NewBufferString(schedule))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	page := types.Page{Title: "Secret title", OGTitle: "Secret launch", OGDescription: "Secret details",
+		OGImage: "https://github.com/secret.png", FetchedAt: time.Now().UTC()}
+	assert.NoError(t, storage.SavePage(shortURL, page))
+
+	// the destination page is not revealed before launch
+	body := slackbot(path.Path)
+	assert.Contains(t, body, `<meta property="og:title" content="example.com">`)
+	assert.NotContains(t, body, "Secret")
+	assert.NotContains(t, body, "og:image")
+	assert.NotContains(t, body, "github.com")
+	resp, body = testRequest(t, ts, http.MethodGet, path.Path+"+", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "https://example.com/coming_soon")
+	assert.NotContains(t, body, "Secret")
+
+	// owner settings are shown
+	resp, _ = testRequest(t, ts, http.MethodPut, "/api/user/urls"+path.Path+"/preview", bytes.NewBufferString(`{"title":"Soon"}`))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body = slackbot(path.Path)
+	assert.Contains(t, body, `<meta property="og:title" content="Soon">`)
+	assert.NotContains(t, body, "Secret")
+
+	// the destination page is used after launch
+	clock.now = launch
+	body = slackbot(path.Path)
+	assert.Contains(t, body, `<meta property="og:title" content="Soon">`)
+	assert.Contains(t, body, `<meta property="og:description" content="Secret details">`)
+	assert.Contains(t, body, `<meta property="og:image" content="https://github.com/secret.png">`)
+}
+
+func TestHandlerBotClicks(t *testing.T) {
+	ranges, err := bots.ReadRanges(strings.NewReader("66.249.64.0/19,Googlebot\n"))
+	assert.NoError(t, err)
+
+	svc := newClockService(repository.NewInMemoryRepository(), &fixedClock{now: time.Now()})
+	svc.SetCrawlerRanges(ranges)
+	ts := httptest.NewServer(NewServiceRouter(svc))
+	defer ts.Close()
+
+	resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/bots"))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	shortURL, err := url.Parse(body)
+	assert.NoError(t, err)
+
+	visits := []map[string]string{
+		nil,
+		{"User-Agent": "curl/8.1.2"},
+		{"X-Real-IP": "66.249.66.1"},
+		{"User-Agent": ""},
+		{"Accept-Language": ""},
+	}
+	for _, headers := range visits {
+		resp = testRequestWithHeaders(t, ts, http.MethodGet, shortURL.Path, headers)
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	}
+
+	// only people are counted by default
+	resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls"+shortURL.Path+"/stats", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var stats types.ClickStats
+	assert.NoError(t, json.Unmarshal([]byte(body), &stats))
+	assert.Equal(t, 1, stats.Total)
+	assert.Equal(t, map[string]int{types.ClickHuman: 1, types.ClickBot: 2, types.ClickSuspicious: 2}, stats.Classes)
+
+	resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls"+shortURL.Path+"/stats?include_bots=true", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal([]byte(body), &stats))
+	assert.Equal(t, 5, stats.Total)
+
+	resp, _ = testRequest(t, ts, http.MethodGet, "/api/user/urls"+shortURL.Path+"/stats?include_bots=maybe", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHandlerQueuedClicks(t *testing.T) {
+	storage := repository.NewInMemoryRepository()
+	svc := newClockService(storage, &fixedClock{now: time.Now()})
+	clicks := make(chan types.Click, 2)
+	svc.SetClickQueue(clicks)
+	ts := httptest.NewServer(NewServiceRouter(svc))
+	defer ts.Close()
+
+	resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/queued"))
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	shortURL, err := url.Parse(body)
+	assert.NoError(t, err)
+
+	// redirects queue clicks and do not wait for the storage, clicks of a full queue are dropped
+	for i := 0; i < 3; i++ {
+		resp = testRequestWithHeaders(t, ts, http.MethodGet, shortURL.Path, nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	}
+	assert.Len(t, clicks, 2)
+	stats, err := storage.GetClickStats("http://localhost:8080"+shortURL.Path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Total)
+
+	pool := worker.NewClickPool(storage, clicks)
+	pool.ClosePool()
+	pool.Run(context.Background())
+	resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls"+shortURL.Path+"/stats?include_bots=true", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, json.Unmarshal([]byte(body), &stats))
+	assert.Equal(t, 2, stats.Total)
+}
+
+func TestHandlerUniques(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	now := time.Now()
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: now}))
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/uniques"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		shortURL, err := url.Parse(body)
+		assert.NoError(t, err)
+
+		visits := []map[string]string{
+			nil,
+			nil,
+			{"X-Real-IP": "192.0.2.1"},
+			{"X-Real-IP": "192.0.2.1", "User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)"},
+			{"X-Real-IP": "192.0.2.1", "User-Agent": "curl/8.1.2"},
+		}
+		for _, headers := range visits {
+			resp = testRequestWithHeaders(t, ts, http.MethodGet, shortURL.Path, headers)
+			assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		}
+
+		// repeated visits and bots are not unique visitors
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls"+shortURL.Path+"/stats", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var stats types.ClickStats
+		assert.NoError(t, json.Unmarshal([]byte(body), &stats))
+		assert.Equal(t, 4, stats.Total)
+		assert.Equal(t, uint64(3), stats.Uniques)
+		assert.Equal(t, map[string]uint64{now.UTC().Format(types.DayLayout): 3}, stats.UniquesByDay)
+
+		// visitors are not stored
+		if _, ok := storage.(*repository.FileRepository); ok {
+			clicks, err := os.ReadFile(file + ".clicks")
+			assert.NoError(t, err)
+			assert.NotContains(t, string(clicks), "192.0.2.1")
+			assert.NotContains(t, string(clicks), "Mozilla")
+		}
+		ts.Close()
+	}
+}
+
+func TestHandlerReports(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	db, err := geo.Read(strings.NewReader("203.0.113.0/24,DE,EU\n198.51.100.0/24,FR,EU\n192.0.2.0/24,US,NA\n"))
+	assert.NoError(t, err)
+	_, subnet, err := net.ParseCIDR("10.0.0.0/8")
+	assert.NoError(t, err)
+
+	now := time.Now()
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		jobs := make(chan worker.Job, worker.MaxWorkerPoolSize)
+		svc := service.NewService(storage, jobs, subnet, "http://localhost:8080")
+		svc.SetClock(&fixedClock{now: now})
+		svc.SetGeoDatabase(db)
+		ts := httptest.NewServer(NewServiceRouter(svc))
+
+		var links []string
+		for _, v := range []string{"https://github.com/reports/a", "https://github.com/reports/b"} {
+			resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString(v))
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			shortURL, err := url.Parse(body)
+			assert.NoError(t, err)
+			links = append(links, shortURL.Path)
+		}
+
+		visits := []struct {
+			path    string
+			headers map[string]string
+		}{
+			{path: links[0], headers: map[string]string{"X-Real-IP": "203.0.113.10", "Referer": "https://Example.com/page"}},
+			{path: links[0], headers: map[string]string{"X-Real-IP": "198.51.100.7", "Referer": "https://news.example/"}},
+			{path: links[0], headers: map[string]string{"X-Real-IP": "192.0.2.1"}},
+			{path: links[1], headers: map[string]string{"X-Real-IP": "203.0.113.11", "Referer": "https://example.com/other"}},
+			{path: links[1], headers: map[string]string{"X-Real-IP": "203.0.113.12", "User-Agent": "curl/8.1.2"}},
+		}
+		for _, v := range visits {
+			resp := testRequestWithHeaders(t, ts, http.MethodGet, v.path, v.headers)
+			assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		}
+
+		report := func(path string) []types.ReportItem {
+			resp, body := testRequest(t, ts, http.MethodGet, path, nil)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var items []types.ReportItem
+			assert.NoError(t, json.Unmarshal([]byte(body), &items))
+			return items
+		}
+
+		// bots and direct visits are not reported
+		assert.Equal(t, []types.ReportItem{{Key: "http://localhost:8080" + links[0], Clicks: 3}, {Key: "http://localhost:8080" + links[1], Clicks: 1}},
+			report("/api/user/reports/links"))
+		assert.Equal(t, []types.ReportItem{{Key: "example.com", Clicks: 2}, {Key: "news.example", Clicks: 1}},
+			report("/api/user/reports/referrers"))
+		assert.Equal(t, []types.ReportItem{{Key: "DE", Clicks: 2}}, report("/api/user/reports/countries?limit=1"))
+
+		// clicks out of the range
+		from := url.QueryEscape(now.Add(-2 * time.Hour).Format(time.RFC3339))
+		to := url.QueryEscape(now.Add(-time.Hour).Format(time.RFC3339))
+		assert.Empty(t, report("/api/user/reports/links?from="+from+"&to="+to))
+
+		invalid := []string{
+			"/api/user/reports/unknown",
+			"/api/user/reports/links?from=yesterday",
+			"/api/user/reports/links?to=2023-05-01",
+			"/api/user/reports/links?limit=ten",
+			"/api/user/reports/links?limit=1000",
+			"/api/user/reports/links?from=" + to + "&to=" + from,
+			"/api/user/reports/links?from=2000-01-01T00:00:00Z",
+		}
+		for _, v := range invalid {
+			resp, _ := testRequest(t, ts, http.MethodGet, v, nil)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, v)
+		}
+
+		// internal report is available only from the trusted subnet
+		resp, _ := testRequest(t, ts, http.MethodGet, "/api/internal/reports/countries", nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/internal/reports/countries", nil)
+		assert.NoError(t, err)
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		resp, err = http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		var items []types.ReportItem
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&items))
+		assert.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, []types.ReportItem{{Key: "DE", Clicks: 2}, {Key: "FR", Clicks: 1}, {Key: "US", Clicks: 1}}, items)
+
+		// purged raw clicks are kept in rollups
+		_, err = storage.PurgeClicks(now.Add(time.Minute))
+		assert.NoError(t, err)
+		if _, ok := storage.(*repository.FileRepository); ok {
+			clicks, err := os.ReadFile(file + ".clicks")
+			assert.NoError(t, err)
+			assert.Empty(t, clicks)
+
+			// rollups are restored from the archive
+			storage = repository.NewFileRepository(file)
+			ts.Close()
+			ts = httptest.NewServer(NewClockRouter(storage, &fixedClock{now: now}))
+		}
+		assert.Equal(t, []types.ReportItem{{Key: "example.com", Clicks: 2}, {Key: "news.example", Clicks: 1}},
+			report("/api/user/reports/referrers"))
+		resp, body := testRequest(t, ts, http.MethodGet, "/api/user/urls"+links[0]+"/stats", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var stats types.ClickStats
+		assert.NoError(t, json.Unmarshal([]byte(body), &stats))
+		assert.Equal(t, 3, stats.Total)
+		assert.Equal(t, uint64(3), stats.Uniques)
+		ts.Close()
+	}
+}
+
+func TestHandlerExport(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/api/shorten",
+			bytes.NewBufferString(`{"url":"https://github.com/export","title":"Export, \"quoted\"","note":"first line\nsecond line","tags":["go","csv"]}`))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var created types.ResponseJSON
+		assert.NoError(t, json.Unmarshal([]byte(body), &created))
+		exportURL := created.Result
+
+		resp, otherURL := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/export/other"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		// only clicks of people are counted
+		shortURL, err := url.Parse(exportURL)
+		assert.NoError(t, err)
+		for _, headers := range []map[string]string{nil, nil, {"User-Agent": "curl/8.1.2"}} {
+			resp = testRequestWithHeaders(t, ts, http.MethodGet, shortURL.Path, headers)
+			assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		}
+
+		// csv is the default format
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls/export", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentValueCSV, resp.Header.Get(ContentType))
+		assert.Equal(t, `attachment; filename="links.csv"`, resp.Header.Get("Content-Disposition"))
+		records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+		assert.NoError(t, err)
+		if assert.Len(t, records, 3) {
+			assert.Equal(t, exportColumns, records[0])
+			_, err = time.Parse(time.RFC3339, records[1][2])
+			assert.NoError(t, err)
+			assert.Equal(t, []string{exportURL, "https://github.com/export", records[1][2], "", "Export, \"quoted\"", "first line\nsecond line", "go,csv", "", "", "", "", "2"},
+				records[1])
+			assert.Equal(t, otherURL, records[2][0])
+			assert.Equal(t, "0", records[2][11])
+		}
+
+		resp, body = testRequest(t, ts, http.MethodGet, "/api/user/urls/export?format=ndjson", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentValueNDJSON, resp.Header.Get(ContentType))
+		var links []types.ExportLink
+		decoder := json.NewDecoder(strings.NewReader(body))
+		for decoder.More() {
+			var link types.ExportLink
+			assert.NoError(t, decoder.Decode(&link))
+			links = append(links, link)
+		}
+		assert.Equal(t, 2, strings.Count(body, "\n"))
+		if assert.Len(t, links, 2) {
+			assert.Equal(t, exportURL, links[0].ShortURL)
+			assert.Equal(t, []string{"go", "csv"}, links[0].Tags)
+			assert.Equal(t, 2, links[0].Clicks)
+			assert.False(t, links[0].CreatedAt.IsZero())
+			assert.Equal(t, otherURL, links[1].ShortURL)
+		}
+
+		resp, _ = testRequest(t, ts, http.MethodGet, "/api/user/urls/export?format=xlsx", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		ts.Close()
+	}
+
+	// storage errors are reported before the export is started
+	ts := httptest.NewServer(NewRouter(&configs.Config{DatabaseDsn: "mock"}))
+	defer ts.Close()
+	resp, _ := testRequest(t, ts, http.MethodGet, "/api/user/urls/export", nil)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Content-Disposition"))
+}
+
+func TestHandlerImport(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	importLinks := func(ts *httptest.Server, format string, body string) []types.ImportResult {
+		resp, respBody := testRequest(t, ts, http.MethodPost, "/api/user/urls/import?format="+format, strings.NewReader(body))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentValueJSON, resp.Header.Get(ContentType))
+		var results []types.ImportResult
+		assert.NoError(t, json.Unmarshal([]byte(respBody), &results), respBody)
+		return results
+	}
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		ts := httptest.NewServer(NewClockRouter(storage, &fixedClock{now: time.Now()}))
+
+		results := importLinks(ts, "csv", "original_url,short_id,title,tags\n"+
+			"https://github.com/import/legacy,legacy-1,Legacy,\"Go, import\"\n"+
+			"https://github.com/import/generated,,,\n"+
+			",empty,,\n"+
+			"https://github.com/import/reserved,api,,\n"+
+			"https://github.com/import/invalid,bad.id,,\n"+
+			"https://github.com/import/repeated,legacy-1,,\n")
+		if assert.Len(t, results, 6) {
+			assert.Equal(t, types.ImportResult{Line: 2, Status: types.ImportCreated, ShortURL: "http://localhost:8080/legacy-1"}, results[0])
+			assert.Equal(t, types.ImportCreated, results[1].Status)
+			assert.Equal(t, 3, results[1].Line)
+			assert.Len(t, strings.TrimPrefix(results[1].ShortURL, "http://localhost:8080/"), 5)
+			for i, result := range results[2:] {
+				assert.Equal(t, i+4, result.Line)
+				assert.Equal(t, types.ImportFailed, result.Status)
+				assert.NotEmpty(t, result.Error)
+				assert.Empty(t, result.ShortURL)
+			}
+		}
+
+		// imported short ids keep working
+		resp := testRequestWithHeaders(t, ts, http.MethodGet, "/legacy-1", nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		assert.Equal(t, "https://github.com/import/legacy", resp.Header.Get("Location"))
+		resp, body := testRequest(t, ts, http.MethodGet, "/api/user/urls/search?tag=import", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var links []types.Link
+		assert.NoError(t, json.Unmarshal([]byte(body), &links))
+		assert.Equal(t, []types.Link{{ShortURL: "http://localhost:8080/legacy-1", OriginalURL: "https://github.com/import/legacy",
+			Metadata: types.Metadata{Title: "Legacy", Tags: []string{"go", "import"}}}}, links)
+
+		// columns without header, the import stops on a syntax error
+		results = importLinks(ts, "csv", "https://github.com/import/positional,legacy-2\n"+
+			"https://github.com/import/quote,\"legacy-3\n")
+		if assert.Len(t, results, 2) {
+			assert.Equal(t, types.ImportResult{Line: 1, Status: types.ImportCreated, ShortURL: "http://localhost:8080/legacy-2"}, results[0])
+			assert.Equal(t, 2, results[1].Line)
+			assert.Equal(t, types.ImportFailed, results[1].Status)
+		}
+
+		// malformed lines do not stop the import, empty lines are skipped
+		results = importLinks(ts, "ndjson", `{"original_url":"https://github.com/import/ndjson","short_id":"legacy-4","tags":["ndjson"]}`+"\n"+
+			"\n"+
+			`{"original_url":`+"\n"+
+			`{"original_url":"https://github.com/import/existing","short_id":"legacy-1"}`+"\n")
+		if assert.Len(t, results, 3) {
+			assert.Equal(t, types.ImportResult{Line: 1, Status: types.ImportCreated, ShortURL: "http://localhost:8080/legacy-4"}, results[0])
+			assert.Equal(t, 3, results[1].Line)
+			assert.Equal(t, types.ImportFailed, results[1].Status)
+			assert.Equal(t, types.ImportResult{Line: 4, Status: types.ImportFailed, Error: "short id `legacy-1` already exists"}, results[2])
+		}
+
+		// rows are saved in chunks
+		var rows strings.Builder
+		for i := 0; i < 250; i++ {
+			fmt.Fprintf(&rows, `{"original_url":"https://github.com/import/chunk/%d","short_id":"chunk-%d"}`+"\n", i, i)
+		}
+		results = importLinks(ts, "ndjson", rows.String())
+		if assert.Len(t, results, 250) {
+			for i, result := range results {
+				assert.Equal(t, types.ImportResult{Line: i + 1, Status: types.ImportCreated, ShortURL: fmt.Sprintf("http://localhost:8080/chunk-%d", i)}, result)
+			}
+		}
+
+		results = importLinks(ts, "ndjson", `{"original_url":"https://github.com/import/long","title":"`+strings.Repeat("a", maxImportLineSize)+`"}`+"\n"+
+			`{"original_url":"https://github.com/import/after-long"}`+"\n")
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, types.ImportResult{Line: 1, Status: types.ImportFailed, Error: "line is too long, maximum is 65536 bytes"}, results[0])
+		}
+
+		assert.Empty(t, importLinks(ts, "csv", ""))
+		resp, _ = testRequest(t, ts, http.MethodPost, "/api/user/urls/import?format=xlsx", strings.NewReader(""))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		ts.Close()
+	}
+}
+
+func TestHandlerRestore(t *testing.T) {
+	temp, file := createFileRepository(t)
+	defer func() {
+		err := os.RemoveAll(temp)
+		assert.NoError(t, err)
+	}()
+
+	storages := []repository.Repository{repository.NewInMemoryRepository(), repository.NewFileRepository(file)}
+	for _, storage := range storages {
+		jobs := make(chan worker.Job, worker.MaxWorkerPoolSize)
+		svc := service.NewService(storage, jobs, nil, "http://localhost:8080")
+		ts := httptest.NewServer(NewServiceRouter(svc))
+
+		resp, body := testRequest(t, ts, http.MethodPost, "/", bytes.NewBufferString("https://github.com/restore"))
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		shortURL, err := url.Parse(body)
+		assert.NoError(t, err)
+		id := shortURL.Path[1:]
+
+		// links deleted within the grace period are restored
+		assert.NoError(t, storage.DeleteURLS(context.Background(), "4b003ed0-4d8f-46eb-8322-e90174110517", []string{body}))
+		resp, _ = testRequest(t, ts, http.MethodGet, "/"+id, nil)
+		assert.Equal(t, http.StatusGone, resp.StatusCode)
+		resp, body = testRequest(t, ts, http.MethodPost, "/api/user/urls/restore", bytes.NewBufferString(`["`+id+`","unknown"]`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `["http://localhost:8080/`+id+`"]`+"\n", body)
+		resp, _ = testRequest(t, ts, http.MethodGet, "/"+id, nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+
+		// not deleted links are skipped
+		resp, body = testRequest(t, ts, http.MethodPost, "/api/user/urls/restore", bytes.NewBufferString(`["`+id+`"]`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "[]\n", body)
+
+		// links deleted before the grace period are not restored
+		svc.SetUndeleteGracePeriod(0)
+		assert.NoError(t, storage.DeleteURLS(context.Background(), "4b003ed0-4d8f-46eb-8322-e90174110517", []string{"http://localhost:8080/" + id}))
+		resp, body = testRequest(t, ts, http.MethodPost, "/api/user/urls/restore", bytes.NewBufferString(`["`+id+`"]`))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "[]\n", body)
+
+		resp, _ = testRequest(t, ts, http.MethodPost, "/api/user/urls/restore", bytes.NewBufferString("not json"))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		ts.Close()
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/service"
+	"go-developer-course-shortener/internal/app/types"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxImportLineSize limits size of a line of the ndjson import.
+const maxImportLineSize = 64 << 10
+
+// csvImportReader returns rows of the csv import one by one.
+// Columns are original_url, short_id, title and tags separated by commas. The first record is a header
+// if it contains original_url, then columns are found by names and short_url of the export is used as short_id.
+func csvImportReader(r io.Reader) func() (types.ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	columns := map[string]int{"original_url": 0, "short_id": 1, "title": 2, "tags": 3}
+	first, done := true, false
+	return func() (types.ImportRow, error) {
+		for !done {
+			record, err := reader.Read()
+			var parseError *csv.ParseError
+			if errors.As(err, &parseError) {
+				// the reader can not find the next row after a syntax error
+				done = true
+				return types.ImportRow{Line: parseError.Line, Error: parseError.Err.Error()}, nil
+			} else if err != nil {
+				return types.ImportRow{}, err
+			}
+
+			if first {
+				first = false
+				if header := csvHeader(record); header != nil {
+					columns = header
+					continue
+				}
+			}
+			line, _ := reader.FieldPos(0)
+			return csvRow(line, record, columns), nil
+		}
+		return types.ImportRow{}, io.EOF
+	}
+}
+
+// csvHeader returns indexes of known columns of the header, nil if the record is not a header.
+func csvHeader(record []string) map[string]int {
+	columns := make(map[string]int)
+	for i, name := range record {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	if _, ok := columns["original_url"]; !ok {
+		return nil
+	}
+	return columns
+}
+
+func csvRow(line int, record []string, columns map[string]int) types.ImportRow {
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	row := types.ImportRow{Line: line, OriginalURL: field("original_url"), ShortID: field("short_id"), Title: field("title")}
+	if row.ShortID == "" && field("short_url") != "" {
+		shortURL, err := url.Parse(field("short_url"))
+		if err != nil {
+			row.Error = "short_url must be a valid url"
+			return row
+		}
+		row.ShortID = path.Base(shortURL.Path)
+	}
+	for _, tag := range strings.Split(field("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			row.Tags = append(row.Tags, tag)
+		}
+	}
+	return row
+}
+
+// ndjsonImportReader returns rows of the ndjson import one by one, empty lines are skipped.
+// Lines which are not valid json objects are returned as failed rows, the import stops on a too long line.
+func ndjsonImportReader(r io.Reader) func() (types.ImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportLineSize)
+	line := 0
+	done := false
+	return func() (types.ImportRow, error) {
+		for !done && scanner.Scan() {
+			line++
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+			row := types.ImportRow{}
+			if err := json.Unmarshal(data, &row); err != nil {
+				row = types.ImportRow{Error: err.Error()}
+			}
+			row.Line = line
+			return row, nil
+		}
+		if errors.Is(scanner.Err(), bufio.ErrTooLong) && !done {
+			// the scanner can not continue after a long line
+			done = true
+			return types.ImportRow{Line: line + 1, Error: fmt.Sprintf("line is too long, maximum is %d bytes", maxImportLineSize)}, nil
+		}
+		if err := scanner.Err(); err != nil && !done {
+			return types.ImportRow{}, err
+		}
+		return types.ImportRow{}, io.EOF
+	}
+}
+
+// HandlerImportPOST implements import of links of current user id from csv (format=csv, default)
+// or newline delimited json (format=ndjson). The body is read row by row and the response is a json array
+// with the result of every row. HTTP/1 responses can not be written while the body is read,
+// so the report is kept in a temporary file until the import is done.
+func (h *Handler) HandlerImportPOST(w http.ResponseWriter, r *http.Request) {
+	userID := service.ExtractUserIDFromContext(r.Context())
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportCSV
+	}
+
+	var next func() (types.ImportRow, error)
+	switch format {
+	case exportCSV:
+		next = csvImportReader(r.Body)
+	case exportNDJSON:
+		next = ndjsonImportReader(r.Body)
+	default:
+		http.Error(w, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	report, err := os.CreateTemp("", "import-*.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		report.Close()
+		os.Remove(report.Name())
+	}()
+
+	log.Printf("Import links for userID: %s format: %s", userID, format)
+	writer := bufio.NewWriter(report)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	separator := "["
+	err = h.service.ImportURLS(userID, next, func(result types.ImportResult) error {
+		if _, err := writer.WriteString(separator); err != nil {
+			return err
+		}
+		separator = ","
+		return encoder.Encode(result)
+	})
+	if err != nil {
+		// rows reported before the error are saved
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if separator == "[" {
+		_, err = writer.WriteString("[")
+	}
+	if err == nil {
+		_, err = writer.WriteString("]\n")
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		_, err = report.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueJSON)
+	if _, err = io.Copy(w, report); err != nil {
+		log.Printf("Failed to write import report. Error: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"go-developer-course-shortener/internal/app/service"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="robots" content="noindex">
+  <title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title>
+</head>
+<body>
+  <main>
+    <h1>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</h1>
+    <p>This short link leads to:</p>
+    <p><code>{{.URL}}</code></p>
+    {{- if .Description}}
+    <p>{{.Description}}</p>
+    {{- end}}
+    {{- if not .CreatedAt.IsZero}}
+    <p>Created on {{.CreatedAt.Format "2006-01-02"}}</p>
+    {{- end}}
+    <p><a href="{{.URL}}" rel="noopener noreferrer">Continue</a></p>
+  </main>
+</body>
+</html>
+`))
+
+var unfurlTemplate = template.Must(template.New("unfurl").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="robots" content="noindex">
+  <title>{{.Title}}</title>
+  <meta property="og:type" content="website">
+  <meta property="og:url" content="{{.URL}}">
+  <meta property="og:title" content="{{.Title}}">
+  {{- if .Description}}
+  <meta property="og:description" content="{{.Description}}">
+  {{- end}}
+  {{- if .Image}}
+  <meta property="og:image" content="{{.Image}}">
+  <meta name="twitter:card" content="summary_large_image">
+  <meta name="twitter:image" content="{{.Image}}">
+  {{- else}}
+  <meta name="twitter:card" content="summary">
+  {{- end}}
+  <meta name="twitter:title" content="{{.Title}}">
+  {{- if .Description}}
+  <meta name="twitter:description" content="{{.Description}}">
+  {{- end}}
+</head>
+<body>
+  <p><a href="{{.URL}}">{{.Title}}</a></p>
+</body>
+</html>
+`))
+
+// renderUnfurl writes page with the card of the visited link for link preview bots.
+func (h *Handler) renderUnfurl(w http.ResponseWriter, v visit) {
+	buf := bytes.NewBuffer([]byte{})
+	if err := unfurlTemplate.Execute(buf, service.UnfurlOf(v.shortURL, v.link, v.target)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueHTML)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("Failed to write unfurl page. Error: %v", err)
+	}
+}
+
+// renderPreview writes preview page of the visited link.
+func (h *Handler) renderPreview(w http.ResponseWriter, v visit) {
+	preview := service.PreviewOf(v.link, v.target)
+	data := struct {
+		URL         string
+		Title       string
+		Description string
+		CreatedAt   time.Time
+	}{
+		URL:         v.target.URL,
+		Title:       preview.Title,
+		Description: preview.Description,
+		CreatedAt:   v.link.CreatedAt,
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if err := previewTemplate.Execute(buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(ContentType, ContentValueHTML)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("Failed to write preview page. Error: %v", err)
+	}
+}
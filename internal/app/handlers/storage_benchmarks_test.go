@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"go-developer-course-shortener/internal/app/service"
+	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/worker"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// benchmarkLinks is the number of links saved before parallel benchmarks of storages.
+const benchmarkLinks = 10000
+
+// benchmarkStorages are memory storages compared by parallel benchmarks.
+var benchmarkStorages = []struct {
+	name       string
+	newStorage func() repository.Repository
+}{
+	{name: "InMemory", newStorage: func() repository.Repository { return repository.NewInMemoryRepository() }},
+	{name: "Sharded", newStorage: func() repository.Repository { return repository.NewShardedRepository(0) }},
+}
+
+// prepareBenchmarkStorage saves benchmarkLinks links of 100 users and returns their short urls.
+func prepareBenchmarkStorage(b *testing.B, storage repository.Repository) []string {
+	shortURLS := make([]string, benchmarkLinks)
+	for i := range shortURLS {
+		shortURLS[i] = "http://localhost:8080/" + strconv.Itoa(i)
+		userID := "user" + strconv.Itoa(i%100)
+		if err := storage.SaveURL(userID, shortURLS[i], "https://github.com/test_repo"+strconv.Itoa(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return shortURLS
+}
+
+// BenchmarkStorageRedirectParallel looks up links and saves clicks like redirects do.
+func BenchmarkStorageRedirectParallel(b *testing.B) {
+	for _, bs := range benchmarkStorages {
+		b.Run(bs.name, func(b *testing.B) {
+			storage := bs.newStorage()
+			shortURLS := prepareBenchmarkStorage(b, storage)
+			now := time.Now()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					shortURL := shortURLS[i%len(shortURLS)]
+					link, err := storage.GetURL(shortURL)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					err = storage.SaveClicks([]types.Click{{UserID: link.UserID, ShortURL: shortURL, Class: types.ClickHuman,
+						Visitor: uint64(i), Time: now}})
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					i += 7
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStorageLookupParallel only looks up links.
+func BenchmarkStorageLookupParallel(b *testing.B) {
+	for _, bs := range benchmarkStorages {
+		b.Run(bs.name, func(b *testing.B) {
+			storage := bs.newStorage()
+			shortURLS := prepareBenchmarkStorage(b, storage)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := storage.GetURL(shortURLS[i%len(shortURLS)]); err != nil {
+						b.Error(err)
+						return
+					}
+					i += 7
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStorageMixedParallel saves a new link in every tenth operation and looks up links in others.
+func BenchmarkStorageMixedParallel(b *testing.B) {
+	for _, bs := range benchmarkStorages {
+		b.Run(bs.name, func(b *testing.B) {
+			storage := bs.newStorage()
+			shortURLS := prepareBenchmarkStorage(b, storage)
+			var counter int64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if i%10 == 0 {
+						id := strconv.FormatInt(atomic.AddInt64(&counter, 1), 10)
+						if err := storage.SaveURL("user"+id, "http://localhost:8080/new"+id, "https://github.com/new_repo"+id); err != nil {
+							b.Error(err)
+							return
+						}
+					} else if _, err := storage.GetURL(shortURLS[i%len(shortURLS)]); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkHandlerGETParallel serves redirects by the handler without network.
+func BenchmarkHandlerGETParallel(b *testing.B) {
+	for _, bs := range benchmarkStorages {
+		b.Run(bs.name, func(b *testing.B) {
+			storage := bs.newStorage()
+			shortURLS := prepareBenchmarkStorage(b, storage)
+			paths := make([]string, len(shortURLS))
+			for i := range paths {
+				paths[i] = "/" + strconv.Itoa(i)
+			}
+
+			jobs := make(chan worker.Job, worker.MaxWorkerPoolSize)
+			svc := service.NewService(storage, jobs, nil, "http://localhost:8080")
+			handler := NewHTTPHandler(svc)
+			r := chi.NewRouter()
+			r.Get("/{ID}", handler.HandlerGET)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go worker.NewWorkerPool(storage, jobs).Run(ctx)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					w := httptest.NewRecorder()
+					r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, paths[i%len(paths)], nil))
+					if w.Code != http.StatusTemporaryRedirect {
+						b.Errorf("unexpected status %d", w.Code)
+						return
+					}
+					i += 7
+				}
+			})
+		})
+	}
+}
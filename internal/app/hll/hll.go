@@ -0,0 +1,138 @@
+// Package hll provides HyperLogLog sketches for approximate counting of distinct values.
+// A sketch keeps only the maximum rank of hashes per register, so the values can not be
+// restored from it. Sketches with the same precision are merged by taking maximum ranks.
+package hll
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	// Precision is the number of hash bits selecting a register.
+	Precision = 12
+	// Registers is the number of registers of a sketch, standard error of the estimate is 1.04/sqrt(Registers) ≈ 1.6%.
+	Registers = 1 << Precision
+	// MaxRank is the maximum rank stored in a register.
+	MaxRank = 64 - Precision + 1
+
+	version = 1
+)
+
+// Sketch represents HyperLogLog registers.
+type Sketch struct {
+	registers [Registers]uint8
+}
+
+// New returns an empty Sketch.
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Position returns register of the hash and rank of the rest of its bits.
+func Position(hash uint64) (int, uint8) {
+	register := int(hash >> (64 - Precision))
+	rank := uint8(bits.LeadingZeros64(hash<<Precision|1<<(Precision-1)) + 1)
+	return register, rank
+}
+
+// Insert adds the hash of a value to the sketch.
+func (s *Sketch) Insert(hash uint64) {
+	s.Set(Position(hash))
+}
+
+// Set raises the rank of the register.
+func (s *Sketch) Set(register int, rank uint8) {
+	if register < 0 || register >= Registers || rank > MaxRank {
+		return
+	}
+	if rank > s.registers[register] {
+		s.registers[register] = rank
+	}
+}
+
+// Merge adds values of the other sketch to the sketch.
+func (s *Sketch) Merge(other *Sketch) {
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Estimate returns approximate number of distinct values added to the sketch.
+func (s *Sketch) Estimate() uint64 {
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(Registers)
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// MarshalBinary encodes the sketch as a version byte followed by the registers.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, 1+Registers)
+	data = append(data, version)
+	return append(data, s.registers[:]...), nil
+}
+
+// UnmarshalBinary decodes the sketch encoded by MarshalBinary.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) != 1+Registers || data[0] != version {
+		return errors.New("invalid sketch")
+	}
+	for _, rank := range data[1:] {
+		if rank > MaxRank {
+			return errors.New("invalid sketch")
+		}
+	}
+	copy(s.registers[:], data[1:])
+	return nil
+}
+
+// Days represents sketches of days, so distinct values can be counted for any range of days.
+type Days map[string]*Sketch
+
+// Set raises the rank of the register in the sketch of the day.
+func (d Days) Set(day string, register int, rank uint8) {
+	sketch, ok := d[day]
+	if !ok {
+		sketch = New()
+		d[day] = sketch
+	}
+	sketch.Set(register, rank)
+}
+
+// Estimates returns approximate number of distinct values of all days and of every day.
+func (d Days) Estimates() (uint64, map[string]uint64) {
+	total := New()
+	byDay := make(map[string]uint64, len(d))
+	for day, sketch := range d {
+		total.Merge(sketch)
+		byDay[day] = sketch.Estimate()
+	}
+	return total.Estimate(), byDay
+}
+
+// Merge adds values of the sketch to the sketch of the day.
+func (d Days) Merge(day string, sketch *Sketch) {
+	current, ok := d[day]
+	if !ok {
+		current = New()
+		d[day] = current
+	}
+	current.Merge(sketch)
+}
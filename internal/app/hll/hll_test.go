@@ -0,0 +1,102 @@
+package hll
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:])
+}
+
+func TestSketch_Estimate(t *testing.T) {
+	tests := []struct {
+		name     string
+		distinct int
+	}{
+		{name: "empty", distinct: 0},
+		{name: "small", distinct: 10},
+		{name: "medium", distinct: 5000},
+		{name: "large", distinct: 200000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sketch := New()
+			for i := 0; i < tt.distinct; i++ {
+				// duplicates do not change the estimate
+				sketch.Insert(hash(fmt.Sprint(i)))
+				sketch.Insert(hash(fmt.Sprint(i)))
+			}
+			assert.InEpsilon(t, float64(tt.distinct)+1, float64(sketch.Estimate())+1, 0.05)
+		})
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, b, all := New(), New(), New()
+	for i := 0; i < 3000; i++ {
+		a.Insert(hash(fmt.Sprint(i)))
+		all.Insert(hash(fmt.Sprint(i)))
+	}
+	for i := 2000; i < 6000; i++ {
+		b.Insert(hash(fmt.Sprint(i)))
+		all.Insert(hash(fmt.Sprint(i)))
+	}
+	a.Merge(b)
+	assert.Equal(t, all.Estimate(), a.Estimate())
+	assert.InEpsilon(t, 6000, float64(a.Estimate()), 0.05)
+}
+
+func TestSketch_Binary(t *testing.T) {
+	sketch := New()
+	for i := 0; i < 100; i++ {
+		sketch.Insert(hash(fmt.Sprint(i)))
+	}
+	data, err := sketch.MarshalBinary()
+	require.NoError(t, err)
+
+	decoded := New()
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, sketch, decoded)
+
+	assert.Error(t, decoded.UnmarshalBinary(data[:10]))
+	data[1] = MaxRank + 1
+	assert.Error(t, decoded.UnmarshalBinary(data))
+}
+
+func TestPosition(t *testing.T) {
+	register, rank := Position(0)
+	assert.Equal(t, 0, register)
+	assert.Equal(t, uint8(MaxRank), rank)
+
+	register, rank = Position(1<<63 | 1<<(63-Precision))
+	assert.Equal(t, Registers/2, register)
+	assert.Equal(t, uint8(1), rank)
+}
+
+func TestDays(t *testing.T) {
+	days := make(Days)
+	for i := 0; i < 100; i++ {
+		register, rank := Position(hash(fmt.Sprint(i)))
+		days.Set("2024-01-01", register, rank)
+		register, rank = Position(hash(fmt.Sprint(i + 50)))
+		days.Set("2024-01-02", register, rank)
+	}
+	total, byDay := days.Estimates()
+	assert.InDelta(t, 150, total, 3)
+	assert.Len(t, byDay, 2)
+	assert.InDelta(t, 100, byDay["2024-01-01"], 2)
+	assert.InDelta(t, 100, byDay["2024-01-02"], 2)
+
+	// nil days have no values
+	var empty Days
+	total, byDay = empty.Estimates()
+	assert.Equal(t, uint64(0), total)
+	assert.Empty(t, byDay)
+}
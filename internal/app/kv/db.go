@@ -0,0 +1,269 @@
+// Package kv provides an embedded key-value store kept in a single file.
+//
+// Keys are sorted in a copy-on-write B+tree. A write transaction writes changed nodes to free pages
+// and commits by writing one of two meta pages pointing to the new root after the nodes are synced.
+// The other meta page still points to the previous state, so a crash during a commit keeps the state
+// of the last finished commit. Pages freed by a commit are reused only when no read transaction sees them.
+//
+// One transaction writes at a time, read transactions run concurrently and see the state committed before they started.
+// The file must be opened by one process at a time.
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrClosed is returned by transactions of a closed database.
+	ErrClosed = errors.New("database is closed")
+	// ErrReadOnly is returned by changes in read transactions.
+	ErrReadOnly = errors.New("transaction is read-only")
+	// ErrKeySize is returned for empty keys and keys longer than MaxKeySize.
+	ErrKeySize = errors.New("key is empty or too large")
+)
+
+// MaxKeySize limits keys, so branches keep many children in a page.
+const MaxKeySize = 1024
+
+// cacheSize is the number of decoded nodes kept in memory.
+const cacheSize = 4096
+
+// DB is a key-value store in a file.
+type DB struct {
+	file *os.File
+
+	// writeMu serializes write transactions
+	writeMu sync.Mutex
+
+	// mu guards the committed state, free pages and read transactions
+	mu   sync.Mutex
+	meta meta
+	// free pages sorted by id and number of pages of the stored freelist
+	free          []pgid
+	freelistPages int
+	// pending are pages freed by commits by txid, readers are numbers of read transactions by txid
+	pending map[uint64][]pgid
+	readers map[uint64]int
+	closed  bool
+
+	cacheMu sync.Mutex
+	cache   map[pgid]*node
+}
+
+// Open opens the database file at the path, a new file is created if it does not exist.
+func Open(path string) (*DB, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{
+		file:    file,
+		pending: make(map[uint64][]pgid),
+		readers: make(map[uint64]int),
+		cache:   make(map[pgid]*node),
+	}
+
+	info, err := file.Stat()
+	if err == nil {
+		if info.Size() == 0 {
+			err = db.init()
+		} else {
+			err = db.load()
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// init writes both meta pages of an empty database.
+func (db *DB) init() error {
+	db.meta = meta{hwm: 2}
+	data := db.meta.encode()
+	for id := pgid(0); id < 2; id++ {
+		if _, err := db.file.WriteAt(data, int64(id)*pageSize); err != nil {
+			return err
+		}
+	}
+	return db.file.Sync()
+}
+
+// load reads the newest valid meta page and the list of free pages.
+func (db *DB) load() error {
+	var metas []meta
+	var err error
+	for id := pgid(0); id < 2; id++ {
+		var p page
+		var m meta
+		if p, err = db.readPage(id, 2); err == nil {
+			if m, err = decodeMeta(p); err == nil {
+				metas = append(metas, m)
+			}
+		}
+	}
+	if len(metas) == 0 {
+		return err
+	}
+	db.meta = metas[0]
+	if len(metas) == 2 && metas[1].txid > metas[0].txid {
+		db.meta = metas[1]
+	}
+
+	if db.meta.freelist != 0 {
+		p, err := db.readPage(db.meta.freelist, db.meta.hwm)
+		if err != nil {
+			return err
+		}
+		if db.free, err = decodeFreelist(p); err != nil {
+			return err
+		}
+		db.freelistPages = p.pages
+	}
+	return nil
+}
+
+// readPage reads the page and its overflow pages below the high water mark.
+func (db *DB) readPage(id pgid, hwm pgid) (page, error) {
+	if id >= hwm {
+		return page{}, ErrCorrupted
+	}
+	buf := make([]byte, pageSize)
+	if _, err := db.file.ReadAt(buf, int64(id)*pageSize); err != nil {
+		return page{}, err
+	}
+	p, err := decodePage(buf)
+	if p.pages > 1 {
+		if id+pgid(p.pages) > hwm {
+			return page{}, ErrCorrupted
+		}
+		buf = append(buf, make([]byte, (p.pages-1)*pageSize)...)
+		if _, err = db.file.ReadAt(buf[pageSize:], int64(id+1)*pageSize); err != nil {
+			return page{}, err
+		}
+		p, err = decodePage(buf)
+	}
+	return p, err
+}
+
+// node returns the stored node from the cache or the file.
+func (db *DB) node(id pgid, hwm pgid) (*node, error) {
+	db.cacheMu.Lock()
+	n, ok := db.cache[id]
+	db.cacheMu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	p, err := db.readPage(id, hwm)
+	if err != nil {
+		return nil, err
+	}
+	if n, err = decodeNode(id, p); err != nil {
+		return nil, err
+	}
+
+	db.cacheMu.Lock()
+	defer db.cacheMu.Unlock()
+	if len(db.cache) >= cacheSize {
+		// nodes are not ordered by use, a quarter of arbitrary nodes is evicted
+		for evict := range db.cache {
+			delete(db.cache, evict)
+			if len(db.cache) < cacheSize*3/4 {
+				break
+			}
+		}
+	}
+	db.cache[id] = n
+	return n, nil
+}
+
+// release moves pending pages which are not seen by read transactions to free pages.
+// Pages freed by the commit of txid are seen by readers of earlier transactions.
+func (db *DB) release() {
+	oldest := uint64(math.MaxUint64)
+	for txid := range db.readers {
+		if txid < oldest {
+			oldest = txid
+		}
+	}
+	released := false
+	db.cacheMu.Lock()
+	for txid, ids := range db.pending {
+		if txid > oldest {
+			continue
+		}
+		for _, id := range ids {
+			delete(db.cache, id)
+		}
+		db.free = append(db.free, ids...)
+		delete(db.pending, txid)
+		released = true
+	}
+	db.cacheMu.Unlock()
+	if released {
+		sort.Slice(db.free, func(i, j int) bool { return db.free[i] < db.free[j] })
+	}
+}
+
+// View runs the read transaction.
+func (db *DB) View(fn func(tx *Tx) error) error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	tx := &Tx{db: db, meta: db.meta}
+	db.readers[tx.meta.txid]++
+	db.mu.Unlock()
+
+	defer func() {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		if db.readers[tx.meta.txid]--; db.readers[tx.meta.txid] == 0 {
+			delete(db.readers, tx.meta.txid)
+		}
+	}()
+	return fn(tx)
+}
+
+// Update runs the write transaction and commits it if fn returns no error.
+// Changes are durable when Update returns.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	db.release()
+	tx := &Tx{db: db, meta: db.meta, writable: true, free: append([]pgid(nil), db.free...), hwm: db.meta.hwm,
+		pages: make(map[pgid][]byte)}
+	db.mu.Unlock()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// Close waits for the running write transaction and closes the file.
+func (db *DB) Close() error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	return db.file.Close()
+}
@@ -0,0 +1,246 @@
+package kv
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contents returns all keys and values of the database.
+func contents(t *testing.T, db *DB) map[string]string {
+	t.Helper()
+	result := make(map[string]string)
+	var keys []string
+	err := db.View(func(tx *Tx) error {
+		return tx.Scan(nil, nil, func(key []byte, value []byte) bool {
+			keys = append(keys, string(key))
+			result[string(key)] = string(value)
+			return true
+		})
+	})
+	require.NoError(t, err)
+	require.True(t, sort.StringsAreSorted(keys), "keys must be scanned in order")
+	return result
+}
+
+func TestDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	db, err := Open(path)
+	require.NoError(t, err)
+
+	random := rand.New(rand.NewSource(1))
+	model := make(map[string]string)
+	for round := 0; round < 30; round++ {
+		err = db.Update(func(tx *Tx) error {
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("key%05d", random.Intn(3000))
+				if random.Intn(4) == 0 {
+					delete(model, key)
+					if err := tx.Delete([]byte(key)); err != nil {
+						return err
+					}
+					continue
+				}
+				// some values take several pages
+				value := bytes.Repeat([]byte{byte('a' + random.Intn(26))}, 1+random.Intn(100))
+				if random.Intn(50) == 0 {
+					value = bytes.Repeat(value, 200)
+				}
+				model[key] = string(value)
+				if err := tx.Put([]byte(key), value); err != nil {
+					return err
+				}
+			}
+			// the transaction sees its own changes
+			for key, value := range model {
+				got, err := tx.Get([]byte(key))
+				if err != nil {
+					return err
+				}
+				if string(got) != value {
+					return fmt.Errorf("key %s: got %q, want %q", key, got, value)
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		if round%10 == 9 {
+			require.NoError(t, db.Close())
+			db, err = Open(path)
+			require.NoError(t, err)
+		}
+	}
+	assert.Equal(t, model, contents(t, db))
+
+	// range scans stop at the end of the range and when visit returns false
+	err = db.View(func(tx *Tx) error {
+		var keys []string
+		err := tx.Scan([]byte("key01000"), []byte("key01100"), func(key []byte, value []byte) bool {
+			keys = append(keys, string(key))
+			return true
+		})
+		require.NoError(t, err)
+		for _, key := range keys {
+			assert.True(t, key >= "key01000" && key < "key01100", key)
+		}
+		var want []string
+		for key := range model {
+			if key >= "key01000" && key < "key01100" {
+				want = append(want, key)
+			}
+		}
+		sort.Strings(want)
+		assert.Equal(t, want, keys)
+
+		count := 0
+		err = tx.ScanPrefix([]byte("key0"), func(key []byte, value []byte) bool {
+			count++
+			return count < 5
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 5, count)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// failed transactions change nothing
+	err = db.Update(func(tx *Tx) error {
+		if err := tx.Put([]byte("rolled back"), []byte("value")); err != nil {
+			return err
+		}
+		return os.ErrInvalid
+	})
+	require.ErrorIs(t, err, os.ErrInvalid)
+	err = db.View(func(tx *Tx) error {
+		value, err := tx.Get([]byte("rolled back"))
+		assert.Nil(t, value)
+		assert.ErrorIs(t, tx.Put([]byte("key"), []byte("value")), ErrReadOnly)
+		return err
+	})
+	require.NoError(t, err)
+
+	// deleting all keys leaves an empty tree
+	err = db.Update(func(tx *Tx) error {
+		for key := range model {
+			if err := tx.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, contents(t, db))
+	require.NoError(t, db.Close())
+	assert.ErrorIs(t, db.View(func(tx *Tx) error { return nil }), ErrClosed)
+}
+
+func TestDB_Crash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.kv")
+	db, err := Open(path)
+	require.NoError(t, err)
+	put := func(key string, value string) {
+		t.Helper()
+		require.NoError(t, db.Update(func(tx *Tx) error {
+			return tx.Put([]byte(key), []byte(value))
+		}))
+	}
+	put("a", "1")
+	put("b", "2")
+	require.NoError(t, db.Close())
+
+	// the meta page of the last commit is torn, the previous commit is restored.
+	// The second commit is written to the first meta page.
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte("torn"), headerSize+20)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	db, err = Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1"}, contents(t, db))
+	put("c", "3")
+	require.NoError(t, db.Close())
+	db, err = Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "c": "3"}, contents(t, db))
+	require.NoError(t, db.Close())
+
+	require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte{1}, 2*pageSize), 0666))
+	_, err = Open(path)
+	assert.Error(t, err)
+}
+
+func TestDB_Concurrent(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.kv"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// every transaction sees a consistent state: all keys have the same value
+				err := db.View(func(tx *Tx) error {
+					var values []string
+					err := tx.Scan(nil, nil, func(key []byte, value []byte) bool {
+						values = append(values, string(value))
+						return true
+					})
+					for _, value := range values {
+						if value != values[0] {
+							return fmt.Errorf("inconsistent values %s and %s", values[0], value)
+						}
+					}
+					return err
+				})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+
+	update := func(round int) {
+		err := db.Update(func(tx *Tx) error {
+			value := []byte(fmt.Sprintf("round%03d", round))
+			for i := 0; i < 300; i++ {
+				if err := tx.Put([]byte(fmt.Sprintf("key%04d", i)), value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	for round := 0; round < 50; round++ {
+		update(round)
+	}
+	close(done)
+	wg.Wait()
+
+	// freed pages are reused, so the file does not grow with every commit once readers are done
+	info, err := db.file.Stat()
+	require.NoError(t, err)
+	size := info.Size()
+	for round := 50; round < 100; round++ {
+		update(round)
+	}
+	info, err = db.file.Stat()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), size)
+}
@@ -0,0 +1,182 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// node is a decoded leaf or branch of the tree. Stored nodes are shared by transactions and never changed,
+// write transactions change copies of nodes on the path to the changed keys.
+type node struct {
+	// id and pages of the stored node, zero for nodes created by the transaction
+	id    pgid
+	pages int
+
+	leaf bool
+	keys [][]byte
+	// values of keys of a leaf
+	values [][]byte
+	// children of a branch, keys[i] is the smallest key of children[i] except keys smaller than keys[0]
+	children []pgid
+	// nodes are children changed by the transaction, nil for unchanged children
+	nodes []*node
+}
+
+// find returns the index of the first key not less than the key and whether it is equal to the key.
+func (n *node) find(key []byte) (int, bool) {
+	i := sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) >= 0 })
+	return i, i < len(n.keys) && bytes.Equal(n.keys[i], key)
+}
+
+// childIndex returns the index of the child of the branch containing the key.
+func (n *node) childIndex(key []byte) int {
+	i := sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) > 0 })
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+// clone returns a copy of the stored node which can be changed, keys and values themselves are never changed.
+func (n *node) clone() *node {
+	c := &node{id: n.id, pages: n.pages, leaf: n.leaf}
+	c.keys = append([][]byte(nil), n.keys...)
+	if n.leaf {
+		c.values = append([][]byte(nil), n.values...)
+	} else {
+		c.children = append([]pgid(nil), n.children...)
+	}
+	return c
+}
+
+func (n *node) put(key []byte, value []byte) {
+	i, found := n.find(key)
+	if found {
+		n.values[i] = value
+		return
+	}
+	n.keys = append(n.keys, nil)
+	copy(n.keys[i+1:], n.keys[i:])
+	n.keys[i] = key
+	n.values = append(n.values, nil)
+	copy(n.values[i+1:], n.values[i:])
+	n.values[i] = value
+}
+
+func (n *node) remove(i int) {
+	n.keys = append(n.keys[:i], n.keys[i+1:]...)
+	n.values = append(n.values[:i], n.values[i+1:]...)
+}
+
+func (n *node) elementSize(i int) int {
+	size := uvarintSize(len(n.keys[i])) + len(n.keys[i])
+	if n.leaf {
+		return size + uvarintSize(len(n.values[i])) + len(n.values[i])
+	}
+	return size + 8
+}
+
+// split divides the node into nodes filling pages, a single large element takes several pages.
+func (n *node) split() []*node {
+	var parts []*node
+	start, size := 0, headerSize
+	for i := range n.keys {
+		elementSize := n.elementSize(i)
+		if i > start && size+elementSize > pageSize {
+			parts = append(parts, n.slice(start, i))
+			start, size = i, headerSize
+		}
+		size += elementSize
+	}
+	return append(parts, n.slice(start, len(n.keys)))
+}
+
+func (n *node) slice(from, to int) *node {
+	part := &node{leaf: n.leaf, keys: n.keys[from:to]}
+	if n.leaf {
+		part.values = n.values[from:to]
+	} else {
+		part.children = n.children[from:to]
+	}
+	return part
+}
+
+// encode returns pages of the node.
+func (n *node) encode() []byte {
+	size := 0
+	for i := range n.keys {
+		size += n.elementSize(i)
+	}
+	body := make([]byte, 0, size)
+	for i, key := range n.keys {
+		body = binary.AppendUvarint(body, uint64(len(key)))
+		if n.leaf {
+			body = binary.AppendUvarint(body, uint64(len(n.values[i])))
+			body = append(body, key...)
+			body = append(body, n.values[i]...)
+		} else {
+			body = append(body, key...)
+			body = binary.LittleEndian.AppendUint64(body, uint64(n.children[i]))
+		}
+	}
+	flags := branchPage
+	if n.leaf {
+		flags = leafPage
+	}
+	return encodePage(flags, len(n.keys), body)
+}
+
+// decodeNode returns the node of the page, keys and values refer to the body of the page.
+func decodeNode(id pgid, p page) (*node, error) {
+	if p.flags != leafPage && p.flags != branchPage {
+		return nil, ErrCorrupted
+	}
+	n := &node{id: id, pages: p.pages, leaf: p.flags == leafPage, keys: make([][]byte, p.count)}
+	if n.leaf {
+		n.values = make([][]byte, p.count)
+	} else {
+		n.children = make([]pgid, p.count)
+	}
+	body := p.body
+	next := func() (int, bool) {
+		v, size := binary.Uvarint(body)
+		if size <= 0 || v > uint64(len(body)) {
+			return 0, false
+		}
+		body = body[size:]
+		return int(v), true
+	}
+	for i := 0; i < p.count; i++ {
+		keySize, ok := next()
+		if !ok {
+			return nil, ErrCorrupted
+		}
+		if n.leaf {
+			valueSize, ok := next()
+			if !ok || keySize+valueSize > len(body) {
+				return nil, ErrCorrupted
+			}
+			n.keys[i] = body[:keySize:keySize]
+			n.values[i] = body[keySize : keySize+valueSize : keySize+valueSize]
+			body = body[keySize+valueSize:]
+		} else {
+			if keySize+8 > len(body) {
+				return nil, ErrCorrupted
+			}
+			n.keys[i] = body[:keySize:keySize]
+			n.children[i] = pgid(binary.LittleEndian.Uint64(body[keySize:]))
+			body = body[keySize+8:]
+		}
+	}
+	return n, nil
+}
+
+func uvarintSize(v int) int {
+	size := 1
+	for v >= 0x80 {
+		v >>= 7
+		size++
+	}
+	return size
+}
@@ -0,0 +1,132 @@
+package kv
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const (
+	// pageSize is the size of pages of the file, nodes larger than a page take several contiguous pages.
+	pageSize = 4096
+	// headerSize is the size of the header of a page: flags, overflow pages, number of elements and checksum.
+	headerSize = 16
+
+	magic   uint32 = 0x6b767374
+	version uint32 = 1
+)
+
+// flags of pages.
+const (
+	leafPage     uint16 = 1
+	branchPage   uint16 = 2
+	metaPage     uint16 = 4
+	freelistPage uint16 = 8
+)
+
+// pgid is the number of a page in the file.
+type pgid uint64
+
+// ErrCorrupted is returned if a page of the file does not match its checksum.
+var ErrCorrupted = errors.New("database file is corrupted")
+
+// pagesFor returns the number of pages of a body of the size.
+func pagesFor(size int) int {
+	return (headerSize + size + pageSize - 1) / pageSize
+}
+
+// encodePage returns pages of the body with the header, the checksum covers everything after the header.
+func encodePage(flags uint16, count int, body []byte) []byte {
+	pages := pagesFor(len(body))
+	buf := make([]byte, pages*pageSize)
+	binary.LittleEndian.PutUint16(buf[0:2], flags)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(pages-1))
+	binary.LittleEndian.PutUint32(buf[8:12], uint32(count))
+	copy(buf[headerSize:], body)
+	binary.LittleEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(buf[headerSize:]))
+	return buf
+}
+
+// page is a decoded header with the body of all pages of the node.
+type page struct {
+	flags uint16
+	pages int
+	count int
+	body  []byte
+}
+
+// decodePage verifies the checksum of pages read from the file.
+func decodePage(buf []byte) (page, error) {
+	p := page{
+		flags: binary.LittleEndian.Uint16(buf[0:2]),
+		pages: int(binary.LittleEndian.Uint32(buf[4:8])) + 1,
+		count: int(binary.LittleEndian.Uint32(buf[8:12])),
+		body:  buf[headerSize:],
+	}
+	if len(buf) != p.pages*pageSize || binary.LittleEndian.Uint32(buf[12:16]) != crc32.ChecksumIEEE(p.body) {
+		return p, ErrCorrupted
+	}
+	return p, nil
+}
+
+// meta points to the committed state of the file. Two meta pages are written in turn,
+// so the previous one stays valid while the next one is written.
+type meta struct {
+	root     pgid
+	freelist pgid
+	// hwm is the number of pages of the file
+	hwm  pgid
+	txid uint64
+}
+
+func (m meta) encode() []byte {
+	body := make([]byte, 48)
+	binary.LittleEndian.PutUint32(body[0:4], magic)
+	binary.LittleEndian.PutUint32(body[4:8], version)
+	binary.LittleEndian.PutUint32(body[8:12], pageSize)
+	binary.LittleEndian.PutUint64(body[16:24], uint64(m.root))
+	binary.LittleEndian.PutUint64(body[24:32], uint64(m.freelist))
+	binary.LittleEndian.PutUint64(body[32:40], uint64(m.hwm))
+	binary.LittleEndian.PutUint64(body[40:48], m.txid)
+	return encodePage(metaPage, 0, body)
+}
+
+func decodeMeta(p page) (meta, error) {
+	body := p.body
+	if p.flags != metaPage || binary.LittleEndian.Uint32(body[0:4]) != magic {
+		return meta{}, errors.New("not a database file")
+	}
+	if binary.LittleEndian.Uint32(body[4:8]) != version || binary.LittleEndian.Uint32(body[8:12]) != pageSize {
+		return meta{}, errors.New("unsupported version of database file")
+	}
+	return meta{
+		root:     pgid(binary.LittleEndian.Uint64(body[16:24])),
+		freelist: pgid(binary.LittleEndian.Uint64(body[24:32])),
+		hwm:      pgid(binary.LittleEndian.Uint64(body[32:40])),
+		txid:     binary.LittleEndian.Uint64(body[40:48]),
+	}, nil
+}
+
+// encodeFreelist returns at least the number of pages of the list of ids.
+func encodeFreelist(ids []pgid, pages int) []byte {
+	size := 8 * len(ids)
+	if size < pages*pageSize-headerSize {
+		size = pages*pageSize - headerSize
+	}
+	body := make([]byte, size)
+	for i, id := range ids {
+		binary.LittleEndian.PutUint64(body[8*i:], uint64(id))
+	}
+	return encodePage(freelistPage, len(ids), body)
+}
+
+func decodeFreelist(p page) ([]pgid, error) {
+	if p.flags != freelistPage || 8*p.count > len(p.body) {
+		return nil, ErrCorrupted
+	}
+	ids := make([]pgid, p.count)
+	for i := range ids {
+		ids[i] = pgid(binary.LittleEndian.Uint64(p.body[8*i:]))
+	}
+	return ids, nil
+}
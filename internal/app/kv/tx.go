@@ -0,0 +1,326 @@
+package kv
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Tx is a read or write transaction, it must not be used after View or Update returns.
+// A write transaction is not safe for concurrent use.
+type Tx struct {
+	db       *DB
+	meta     meta
+	writable bool
+
+	// root is the changed root of a write transaction, nil until the first change
+	root *node
+	// free pages available to the transaction and the high water mark of allocated pages
+	free []pgid
+	hwm  pgid
+	// freed are pages of replaced nodes, pages are the written pages by id
+	freed []pgid
+	pages map[pgid][]byte
+}
+
+// entry points to a written node from its parent.
+type entry struct {
+	key []byte
+	id  pgid
+}
+
+func (tx *Tx) rootNode() (*node, error) {
+	if tx.root != nil {
+		return tx.root, nil
+	}
+	if tx.meta.root == 0 {
+		return nil, nil
+	}
+	return tx.db.node(tx.meta.root, tx.meta.hwm)
+}
+
+func (tx *Tx) child(n *node, i int) (*node, error) {
+	if n.nodes != nil && n.nodes[i] != nil {
+		return n.nodes[i], nil
+	}
+	return tx.db.node(n.children[i], tx.meta.hwm)
+}
+
+// Get returns the value of the key or nil if the key does not exist, values of existing keys are not nil.
+// The value must not be changed.
+func (tx *Tx) Get(key []byte) ([]byte, error) {
+	n, err := tx.rootNode()
+	for err == nil && n != nil && !n.leaf {
+		n, err = tx.child(n, n.childIndex(key))
+	}
+	if err != nil || n == nil {
+		return nil, err
+	}
+	if i, found := n.find(key); found {
+		return n.values[i], nil
+	}
+	return nil, nil
+}
+
+// Scan calls visit for keys from the key from up to the key to in order until visit returns false.
+// Nil to scans up to the last key. Keys and values must not be changed.
+func (tx *Tx) Scan(from []byte, to []byte, visit func(key []byte, value []byte) bool) error {
+	n, err := tx.rootNode()
+	if err != nil || n == nil {
+		return err
+	}
+	_, err = tx.scan(n, from, to, visit)
+	return err
+}
+
+// ScanPrefix calls visit for keys starting with the prefix in order until visit returns false.
+func (tx *Tx) ScanPrefix(prefix []byte, visit func(key []byte, value []byte) bool) error {
+	return tx.Scan(prefix, prefixEnd(prefix), visit)
+}
+
+// prefixEnd returns the first key after all keys with the prefix, nil if there is no such key.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// scan visits keys of the subtree, it reports whether keys after the subtree must be visited.
+func (tx *Tx) scan(n *node, from []byte, to []byte, visit func(key []byte, value []byte) bool) (bool, error) {
+	if n.leaf {
+		i, _ := n.find(from)
+		for ; i < len(n.keys); i++ {
+			if to != nil && bytes.Compare(n.keys[i], to) >= 0 {
+				return false, nil
+			}
+			if !visit(n.keys[i], n.values[i]) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	start := n.childIndex(from)
+	for i := start; i < len(n.children); i++ {
+		if i > start && to != nil && bytes.Compare(n.keys[i], to) >= 0 {
+			return false, nil
+		}
+		child, err := tx.child(n, i)
+		if err != nil {
+			return false, err
+		}
+		if more, err := tx.scan(child, from, to, visit); !more || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Put sets the value of the key.
+func (tx *Tx) Put(key []byte, value []byte) error {
+	leaf, err := tx.writableLeaf(key)
+	if err != nil {
+		return err
+	}
+	leaf.put(append([]byte(nil), key...), append(make([]byte, 0, len(value)), value...))
+	return nil
+}
+
+// Delete removes the key, missing keys are ignored.
+func (tx *Tx) Delete(key []byte) error {
+	value, err := tx.Get(key)
+	if err != nil || value == nil {
+		return err
+	}
+	leaf, err := tx.writableLeaf(key)
+	if err != nil {
+		return err
+	}
+	if i, found := leaf.find(key); found {
+		leaf.remove(i)
+	}
+	return nil
+}
+
+// writableLeaf returns the leaf of the key, nodes on the path are replaced by copies changed by the transaction.
+func (tx *Tx) writableLeaf(key []byte) (*node, error) {
+	if !tx.writable {
+		return nil, ErrReadOnly
+	}
+	if len(key) == 0 || len(key) > MaxKeySize {
+		return nil, ErrKeySize
+	}
+	if tx.root == nil {
+		if tx.meta.root == 0 {
+			tx.root = &node{leaf: true}
+		} else {
+			root, err := tx.db.node(tx.meta.root, tx.meta.hwm)
+			if err != nil {
+				return nil, err
+			}
+			tx.root = root.clone()
+		}
+	}
+
+	n := tx.root
+	for !n.leaf {
+		i := n.childIndex(key)
+		if n.nodes == nil {
+			n.nodes = make([]*node, len(n.children))
+		}
+		if n.nodes[i] == nil {
+			child, err := tx.db.node(n.children[i], tx.meta.hwm)
+			if err != nil {
+				return nil, err
+			}
+			n.nodes[i] = child.clone()
+		}
+		n = n.nodes[i]
+	}
+	return n, nil
+}
+
+// alloc returns the first page of count contiguous free pages, the file grows if there are no such pages.
+func (tx *Tx) alloc(count int) pgid {
+	for i := 0; i+count <= len(tx.free); i++ {
+		if tx.free[i+count-1] == tx.free[i]+pgid(count-1) {
+			id := tx.free[i]
+			tx.free = append(tx.free[:i], tx.free[i+count:]...)
+			return id
+		}
+	}
+	id := tx.hwm
+	tx.hwm += pgid(count)
+	return id
+}
+
+func (tx *Tx) release(id pgid, pages int) {
+	for i := 0; i < pages; i++ {
+		tx.freed = append(tx.freed, id+pgid(i))
+	}
+}
+
+// spill writes the changed node and its changed children and returns entries of nodes replacing it.
+// Empty nodes are removed, a root with a single child is replaced by the child.
+func (tx *Tx) spill(n *node) []entry {
+	if n.id != 0 {
+		tx.release(n.id, n.pages)
+		n.id = 0
+	}
+	if !n.leaf {
+		keys := make([][]byte, 0, len(n.children))
+		children := make([]pgid, 0, len(n.children))
+		for i, id := range n.children {
+			if n.nodes == nil || n.nodes[i] == nil {
+				keys = append(keys, n.keys[i])
+				children = append(children, id)
+				continue
+			}
+			for _, e := range tx.spill(n.nodes[i]) {
+				keys = append(keys, e.key)
+				children = append(children, e.id)
+			}
+		}
+		n.keys, n.children, n.nodes = keys, children, nil
+		if n == tx.root && len(n.children) == 1 {
+			return []entry{{key: n.keys[0], id: n.children[0]}}
+		}
+	}
+	if len(n.keys) == 0 {
+		return nil
+	}
+
+	parts := n.split()
+	entries := make([]entry, len(parts))
+	for i, part := range parts {
+		data := part.encode()
+		id := tx.alloc(len(data) / pageSize)
+		tx.pages[id] = data
+		entries[i] = entry{key: part.keys[0], id: id}
+	}
+	return entries
+}
+
+// commit writes changed nodes and the list of free pages, syncs them and then writes the meta page.
+func (tx *Tx) commit() error {
+	if tx.root == nil {
+		return nil
+	}
+	db := tx.db
+
+	entries := tx.spill(tx.root)
+	for len(entries) > 1 {
+		root := &node{}
+		for _, e := range entries {
+			root.keys = append(root.keys, e.key)
+			root.children = append(root.children, e.id)
+		}
+		tx.root = root
+		entries = tx.spill(root)
+	}
+	next := meta{txid: tx.meta.txid + 1}
+	if len(entries) == 1 {
+		next.root = entries[0].id
+	}
+
+	// the list contains free pages after the commit including pages still seen by readers,
+	// they are all free when the file is opened again
+	db.mu.Lock()
+	if tx.meta.freelist != 0 {
+		tx.release(tx.meta.freelist, db.freelistPages)
+	}
+	ids := append([]pgid(nil), tx.free...)
+	for _, pending := range db.pending {
+		ids = append(ids, pending...)
+	}
+	db.mu.Unlock()
+	ids = append(ids, tx.freed...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	// pages of the list are allocated before it is encoded, so the list does not contain them.
+	// The list without them is not longer, so it fits into the allocated pages.
+	count := pagesFor(8 * len(ids))
+	next.freelist = tx.alloc(count)
+	kept := ids[:0]
+	for _, id := range ids {
+		if id < next.freelist || id >= next.freelist+pgid(count) {
+			kept = append(kept, id)
+		}
+	}
+	data := encodeFreelist(kept, count)
+	tx.pages[next.freelist] = data
+	next.hwm = tx.hwm
+
+	written := make([]pgid, 0, len(tx.pages))
+	for id := range tx.pages {
+		written = append(written, id)
+	}
+	sort.Slice(written, func(i, j int) bool { return written[i] < written[j] })
+	for _, id := range written {
+		if _, err := db.file.WriteAt(tx.pages[id], int64(id)*pageSize); err != nil {
+			return err
+		}
+	}
+	if err := db.file.Sync(); err != nil {
+		return err
+	}
+	if _, err := db.file.WriteAt(next.encode(), int64(next.txid%2)*pageSize); err != nil {
+		return err
+	}
+	if err := db.file.Sync(); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.meta = next
+	db.free = tx.free
+	db.freelistPages = len(data) / pageSize
+	if len(tx.freed) > 0 {
+		db.pending[next.txid] = tx.freed
+	}
+	return nil
+}
@@ -1,11 +1,10 @@
 package middleware
 
 import (
-	"fmt"
+	"go-developer-course-shortener/internal/app/service"
 	"log"
 	"net"
 	"net/http"
-	"strings"
 )
 
 // TrustedSubnetHandle allows requests for endpoint /api/internal/stats only for trusted subnet.
@@ -19,7 +18,7 @@ func TrustedSubnetHandle(trustedSubnet string) func(next http.Handler) http.Hand
 				return
 			}
 			// get user ip
-			userIP, err := resolveIP(r)
+			userIP, err := service.ResolveIP(r.Header)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusForbidden)
 				return
@@ -39,20 +38,3 @@ func TrustedSubnetHandle(trustedSubnet string) func(next http.Handler) http.Hand
 		})
 	}
 }
-
-func resolveIP(r *http.Request) (net.IP, error) {
-	// check "X-Real-IP" header
-	ipStr := r.Header.Get("X-Real-IP")
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		// X-Real-IP is empty then try X-Forwarded-For
-		ips := r.Header.Get("X-Forwarded-For")
-		ipSplit := strings.Split(ips, ",")
-		ipStr = ipSplit[0]
-		ip = net.ParseIP(ipStr)
-	}
-	if ip == nil {
-		return nil, fmt.Errorf("failed parse ip from http header")
-	}
-	return ip, nil
-}
@@ -0,0 +1,180 @@
+// Package migrate copies links and collections between storages.
+// Links are copied with all attributes, user ids, short urls and deleted flags are kept.
+// Links with short urls existing in the target are skipped, so an interrupted copy can be repeated.
+// Clicks and their rollups are not copied.
+package migrate
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"go-developer-course-shortener/internal/app/types"
+)
+
+// DefaultBatchSize is the number of links saved together if the batch size is not set.
+const DefaultBatchSize = 500
+
+// Options represents settings of the copy.
+type Options struct {
+	// DryRun reads both storages and counts links to copy without writing to the target.
+	DryRun bool
+	// BatchSize is the number of links saved together, DefaultBatchSize if zero.
+	BatchSize int
+	// Progress is called after every batch with current counters, it may be nil.
+	Progress func(report Report)
+}
+
+// Report represents counters of the copy.
+type Report struct {
+	// Read is the number of links of the source, Deleted of them are deleted, Users is the number of their owners.
+	Read    int
+	Deleted int
+	Users   int
+	// Copied is the number of links saved to the target or to be saved in the dry run.
+	Copied int
+	// Skipped is the number of links with short urls existing in the target or conflicting with its links.
+	Skipped int
+	// Collections is the number of copied collections, collections existing in the target are skipped.
+	Collections int
+	// Verified is the number of links of the source found in the target with the same owner and deleted flag.
+	// Missing links are not found in the target, Mismatched links differ in the owner or the deleted flag.
+	// Links are verified only if the copy is not a dry run.
+	Verified   int
+	Missing    int
+	Mismatched int
+}
+
+// Failed reports whether the verification found links which were not copied as they are.
+func (r Report) Failed() bool {
+	return r.Missing > 0 || r.Mismatched > 0
+}
+
+// linkState represents attributes of the link which must be kept by the copy.
+type linkState struct {
+	userID  string
+	deleted bool
+}
+
+// Copy copies collections and links from the source to the target and verifies the target.
+func Copy(ctx context.Context, source repository.Repository, target repository.Repository, options Options) (Report, error) {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	var report Report
+
+	existing, err := states(ctx, target)
+	if err != nil {
+		return report, err
+	}
+	if report.Collections, err = copyCollections(source, target, options.DryRun); err != nil {
+		return report, err
+	}
+
+	copied := make(map[string]linkState)
+	users := make(map[string]bool)
+	batch := make([]types.Record, 0, options.BatchSize)
+	flush := func() error {
+		saved := len(batch)
+		if !options.DryRun && len(batch) > 0 {
+			if saved, err = target.SaveRecords(batch); err != nil {
+				return err
+			}
+		}
+		report.Copied += saved
+		report.Skipped += len(batch) - saved
+		batch = batch[:0]
+		if options.Progress != nil {
+			options.Progress(report)
+		}
+		return nil
+	}
+
+	err = source.ForEachRecord(ctx, func(record types.Record) error {
+		report.Read++
+		if record.Deleted {
+			report.Deleted++
+		}
+		// purged links have no owner
+		if record.UserID != "" && !users[record.UserID] {
+			users[record.UserID] = true
+			report.Users++
+		}
+		copied[record.ShortURL] = linkState{userID: record.UserID, deleted: record.Deleted}
+		if _, ok := existing[record.ShortURL]; ok {
+			report.Skipped++
+			return nil
+		}
+		batch = append(batch, record)
+		if len(batch) < options.BatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil || options.DryRun {
+		return report, err
+	}
+
+	// links of the target are read again, so links skipped by the target are found
+	saved, err := states(ctx, target)
+	if err != nil {
+		return report, err
+	}
+	for shortURL, state := range copied {
+		switch got, ok := saved[shortURL]; {
+		case !ok:
+			report.Missing++
+		case got != state:
+			report.Mismatched++
+		default:
+			report.Verified++
+		}
+	}
+	return report, nil
+}
+
+// states returns owners and deleted flags of all links of the storage by short urls.
+func states(ctx context.Context, storage repository.Repository) (map[string]linkState, error) {
+	links := make(map[string]linkState)
+	err := storage.ForEachRecord(ctx, func(record types.Record) error {
+		links[record.ShortURL] = linkState{userID: record.UserID, deleted: record.Deleted}
+		return nil
+	})
+	return links, err
+}
+
+// copyCollections creates collections of the source which are not in the target by ids or names of the user.
+func copyCollections(source repository.Repository, target repository.Repository, dryRun bool) (int, error) {
+	collections, err := source.GetAllCollections()
+	if err != nil {
+		return 0, err
+	}
+	existing, err := target.GetAllCollections()
+	if err != nil {
+		return 0, err
+	}
+	type key struct{ userID, value string }
+	ids := make(map[key]bool, len(existing))
+	names := make(map[key]bool, len(existing))
+	for _, collection := range existing {
+		ids[key{collection.UserID, collection.ID}] = true
+		names[key{collection.UserID, collection.Name}] = true
+	}
+
+	copied := 0
+	for _, collection := range collections {
+		if ids[key{collection.UserID, collection.ID}] || names[key{collection.UserID, collection.Name}] {
+			continue
+		}
+		if !dryRun {
+			if err = target.CreateCollection(collection.UserID, collection.Collection); err != nil {
+				return copied, err
+			}
+		}
+		ids[key{collection.UserID, collection.ID}] = true
+		names[key{collection.UserID, collection.Name}] = true
+		copied++
+	}
+	return copied, nil
+}
@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"go-developer-course-shortener/internal/app/types"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// records returns all links of the storage by short urls, creation times are in UTC.
+func records(t *testing.T, storage repository.Repository) map[string]types.OriginalLink {
+	links := make(map[string]types.OriginalLink)
+	err := storage.ForEachRecord(context.Background(), func(record types.Record) error {
+		record.CreatedAt = record.CreatedAt.UTC().Round(0)
+		links[record.ShortURL] = record.OriginalLink
+		return nil
+	})
+	require.NoError(t, err)
+	return links
+}
+
+func TestCopy(t *testing.T) {
+	created := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	notAfter := created.Add(24 * time.Hour)
+	source := repository.NewInMemoryRepository()
+	saved, err := source.SaveRecords([]types.Record{
+		{ShortURL: "http://localhost:8080/a", OriginalLink: types.OriginalLink{UserID: "user1", OriginalURL: "https://a.example",
+			Schedule: types.Schedule{NotAfter: &notAfter}, Targets: []types.TargetRule{{Type: types.TargetPlatform, Value: types.PlatformIOS, URL: "https://ios.example"}},
+			Variants: []types.Variant{{Name: "b", URL: "https://b.example", Weight: 1}}, Preview: types.Preview{Always: true, Title: "A"},
+			Metadata: types.Metadata{Title: "Title", Note: "Note", Tags: []string{"go"}}, Collection: "c1",
+			Health: &types.Health{StatusCode: 200, CheckedAt: created}, Page: &types.Page{Title: "Page", FetchedAt: created}, CreatedAt: created}},
+		{ShortURL: "http://localhost:8080/b", OriginalLink: types.OriginalLink{UserID: "user1", OriginalURL: "https://b.example", Deleted: true, CreatedAt: created}},
+		{ShortURL: "http://localhost:8080/c", OriginalLink: types.OriginalLink{UserID: "user2", OriginalURL: "https://c.example", CreatedAt: created}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, saved)
+	require.NoError(t, source.CreateCollection("user1", types.Collection{ID: "c1", Name: "Work"}))
+
+	path := filepath.Join(t.TempDir(), "links.json")
+	target := repository.NewFileRepository(path)
+	// the link existing in the target is kept
+	require.NoError(t, target.SaveURL("user2", "http://localhost:8080/c", "https://c.example"))
+
+	var progress []Report
+	report, err := Copy(context.Background(), source, target, Options{DryRun: true, BatchSize: 1,
+		Progress: func(report Report) { progress = append(progress, report) }})
+	require.NoError(t, err)
+	assert.Equal(t, Report{Read: 3, Deleted: 1, Users: 2, Copied: 2, Skipped: 1, Collections: 1}, report)
+	assert.Len(t, progress, 3)
+	assert.Len(t, records(t, target), 1, "dry run must not change the target")
+	collections, err := target.GetAllCollections()
+	require.NoError(t, err)
+	assert.Empty(t, collections)
+
+	report, err = Copy(context.Background(), source, target, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, Report{Read: 3, Deleted: 1, Users: 2, Copied: 2, Skipped: 1, Collections: 1, Verified: 3}, report)
+	assert.False(t, report.Failed())
+	want, got := records(t, source), records(t, target)
+	assert.Equal(t, "https://c.example", got["http://localhost:8080/c"].OriginalURL)
+	delete(want, "http://localhost:8080/c")
+	delete(got, "http://localhost:8080/c")
+	assert.Equal(t, want, got)
+	collections, err = target.GetAllCollections()
+	require.NoError(t, err)
+	assert.Equal(t, []types.CollectionRecord{{UserID: "user1", Collection: types.Collection{ID: "c1", Name: "Work"}}}, collections)
+
+	// the copy can be repeated
+	report, err = Copy(context.Background(), source, target, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, Report{Read: 3, Deleted: 1, Users: 2, Skipped: 3, Verified: 3}, report)
+
+	// links owned by other users are reported
+	back := repository.NewInMemoryRepository()
+	require.NoError(t, back.SaveURL("user3", "http://localhost:8080/a", "https://other.example"))
+	report, err = Copy(context.Background(), target, back, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, Report{Read: 3, Deleted: 1, Users: 2, Copied: 2, Skipped: 1, Collections: 1, Verified: 2, Mismatched: 1}, report)
+	assert.True(t, report.Failed())
+	link, err := back.GetURL("http://localhost:8080/b")
+	require.NoError(t, err)
+	assert.True(t, link.Deleted)
+}
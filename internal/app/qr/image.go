@@ -0,0 +1,72 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// PNG returns the code as a grayscale PNG image of size x size pixels.
+// Margin is the width of the quiet zone in modules. Each module is drawn with
+// the same integer number of pixels, leftover pixels are added to the quiet zone.
+func (c *Code) PNG(size, margin int) ([]byte, error) {
+	scale := size / (c.Size + 2*margin)
+	if scale < 1 {
+		return nil, fmt.Errorf("size must be at least %d pixels", c.Size+2*margin)
+	}
+	offset := (size - c.Size*scale) / 2
+
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Black(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray(offset+x*scale+dx, offset+y*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG returns the code as an SVG image of size x size pixels.
+// Margin is the width of the quiet zone in modules.
+func (c *Code) SVG(size, margin int) []byte {
+	var buf bytes.Buffer
+	total := c.Size + 2*margin
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		size, size, total, total)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#FFFFFF"/>`+"\n")
+	buf.WriteString(`<path fill="#000000" d="`)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Black(x, y) {
+				continue
+			}
+			// merge horizontal runs of dark modules into one rectangle
+			run := 1
+			for c.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d,%dh%dv1h-%dz", x+margin, y+margin, run, run)
+			x += run - 1
+		}
+	}
+	buf.WriteString(`"/>` + "\n</svg>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,545 @@
+// Package qr implements QR Code Model 2 encoder (ISO/IEC 18004) for short links.
+// Data is always encoded in byte mode, the smallest version that fits the data is chosen
+// and the mask with the lowest penalty score is applied.
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Level represents error correction level of the code.
+type Level int
+
+const (
+	// L recovers about 7% of damaged codewords.
+	L Level = iota
+	// M recovers about 15% of damaged codewords.
+	M
+	// Q recovers about 25% of damaged codewords.
+	Q
+	// H recovers about 30% of damaged codewords.
+	H
+)
+
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+// formatBits is the level indicator used in format information, in order L, M, Q, H.
+var formatBits = [4]int{1, 0, 3, 2}
+
+// eccCodewordsPerBlock is indexed by level and version.
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// errorCorrectionBlocks is indexed by level and version.
+var errorCorrectionBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// ParseLevel returns the level by its name (L, M, Q or H).
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return L, nil
+	case "M":
+		return M, nil
+	case "Q":
+		return Q, nil
+	case "H":
+		return H, nil
+	}
+	return 0, fmt.Errorf("unknown error correction level `%s`", s)
+}
+
+// String returns name of the level.
+func (l Level) String() string {
+	return [...]string{"L", "M", "Q", "H"}[l]
+}
+
+// Code represents encoded symbol, true modules are dark.
+type Code struct {
+	Size    int
+	modules [][]bool
+}
+
+// Black reports whether the module at column x and row y is dark.
+// Modules outside the symbol are light.
+func (c *Code) Black(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+// Encode returns the code of the data with the error correction level.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < L || level > H {
+		return nil, errors.New("invalid error correction level")
+	}
+
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		if len(data) <= dataCapacity(version, level) {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, fmt.Errorf("data is too long: %d bytes", len(data))
+	}
+
+	codewords := addErrorCorrection(dataCodewords(data, version, level), version, level)
+
+	e := newEncoder(version)
+	e.drawFunctionPatterns(level)
+	e.drawCodewords(codewords)
+
+	best, minPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		e.applyMask(mask)
+		e.drawFormatBits(level, mask)
+		if penalty := e.penalty(); minPenalty < 0 || penalty < minPenalty {
+			best, minPenalty = mask, penalty
+		}
+		e.applyMask(mask) // masks are XOR, so the second call reverts the first one
+	}
+	e.applyMask(best)
+	e.drawFormatBits(level, best)
+
+	return &Code{Size: e.size, modules: e.modules}, nil
+}
+
+// rawDataModules returns number of modules available for data and error correction codewords.
+func rawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		alignments := version/7 + 2
+		result -= (25*alignments-10)*alignments - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func dataCodewordsCount(version int, level Level) int {
+	return rawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*errorCorrectionBlocks[level][version]
+}
+
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// dataCapacity returns max number of bytes of the version in byte mode.
+func dataCapacity(version int, level Level) int {
+	return (dataCodewordsCount(version, level)*8 - 4 - countBits(version)) / 8
+}
+
+type bitBuffer []byte
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, byte(value>>i&1))
+	}
+}
+
+// dataCodewords returns byte mode segment padded to the capacity of the version.
+func dataCodewords(data []byte, version int, level Level) []byte {
+	capacity := dataCodewordsCount(version, level) * 8
+
+	var bits bitBuffer
+	bits.append(0x4, 4) // byte mode
+	bits.append(len(data), countBits(version))
+	for _, v := range data {
+		bits.append(int(v), 8)
+	}
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	result := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		result[i>>3] |= bit << (7 - i&7)
+	}
+	return result
+}
+
+// addErrorCorrection splits data into blocks, appends error correction codewords to each block
+// and interleaves the blocks.
+func addErrorCorrection(data []byte, version int, level Level) []byte {
+	blocks := errorCorrectionBlocks[level][version]
+	eccLength := eccCodewordsPerBlock[level][version]
+	rawCodewords := rawDataModules(version) / 8
+	shortBlocks := blocks - rawCodewords%blocks
+	shortBlockLength := rawCodewords / blocks
+
+	divisor := reedSolomonDivisor(eccLength)
+	result := make([][]byte, blocks)
+	for i, k := 0, 0; i < blocks; i++ {
+		length := shortBlockLength - eccLength
+		if i >= shortBlocks {
+			length++
+		}
+		block := make([]byte, 0, shortBlockLength+1)
+		block = append(block, data[k:k+length]...)
+		k += length
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < shortBlocks {
+			block = append(block, 0) // placeholder, skipped on interleaving
+		}
+		result[i] = append(block, ecc...)
+	}
+
+	interleaved := make([]byte, 0, rawCodewords)
+	for i := range result[0] {
+		for j, block := range result {
+			if i != shortBlockLength-eccLength || j >= shortBlocks {
+				interleaved = append(interleaved, block[i])
+			}
+		}
+	}
+	return interleaved
+}
+
+// multiply multiplies two elements of GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func multiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// reedSolomonDivisor returns coefficients of the generator polynomial of the degree,
+// the leading coefficient is omitted.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = multiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = multiply(root, 0x02)
+	}
+	return result
+}
+
+func reedSolomonRemainder(data []byte, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= multiply(d, factor)
+		}
+	}
+	return result
+}
+
+type encoder struct {
+	version    int
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+func newEncoder(version int) *encoder {
+	size := version*4 + 17
+	e := &encoder{version: version, size: size, modules: make([][]bool, size), isFunction: make([][]bool, size)}
+	for i := 0; i < size; i++ {
+		e.modules[i] = make([]bool, size)
+		e.isFunction[i] = make([]bool, size)
+	}
+	return e
+}
+
+func (e *encoder) setFunction(x, y int, dark bool) {
+	e.modules[y][x] = dark
+	e.isFunction[y][x] = true
+}
+
+// alignmentPositions returns centers of alignment patterns on each axis.
+func (e *encoder) alignmentPositions() []int {
+	if e.version == 1 {
+		return nil
+	}
+	count := e.version/7 + 2
+	step := (e.version*8 + count*3 + 5) / (count*4 - 4) * 2
+	result := make([]int, count)
+	result[0] = 6
+	for i, pos := count-1, e.size-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+func (e *encoder) drawFunctionPatterns(level Level) {
+	// timing patterns
+	for i := 0; i < e.size; i++ {
+		e.setFunction(6, i, i%2 == 0)
+		e.setFunction(i, 6, i%2 == 0)
+	}
+
+	// finder patterns with separators
+	for _, c := range [][2]int{{3, 3}, {e.size - 4, 3}, {3, e.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < e.size && y >= 0 && y < e.size {
+					dist := maxInt(abs(dx), abs(dy))
+					e.setFunction(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	// alignment patterns, except the ones overlapping finder patterns
+	positions := e.alignmentPositions()
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					e.setFunction(x+dx, y+dy, maxInt(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// reserve format area, real bits are drawn after masking
+	e.drawFormatBits(level, 0)
+	e.drawVersion()
+}
+
+// drawFormatBits draws both copies of format information and the dark module.
+func (e *encoder) drawFormatBits(level Level, mask int) {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	bit := func(i int) bool {
+		return bits>>i&1 != 0
+	}
+
+	// near top left finder
+	for i := 0; i <= 5; i++ {
+		e.setFunction(8, i, bit(i))
+	}
+	e.setFunction(8, 7, bit(6))
+	e.setFunction(8, 8, bit(7))
+	e.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		e.setFunction(14-i, 8, bit(i))
+	}
+
+	// near top right and bottom left finders
+	for i := 0; i < 8; i++ {
+		e.setFunction(e.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		e.setFunction(8, e.size-15+i, bit(i))
+	}
+	e.setFunction(8, e.size-8, true)
+}
+
+// drawVersion draws both copies of version information for versions 7 and above.
+func (e *encoder) drawVersion() {
+	if e.version < 7 {
+		return
+	}
+	rem := e.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := e.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 != 0
+		a, b := e.size-11+i%3, i/3
+		e.setFunction(a, b, dark)
+		e.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places codewords in zigzag order from the bottom right corner.
+func (e *encoder) drawCodewords(data []byte) {
+	i := 0
+	for right := e.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < e.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = e.size - 1 - vert
+				}
+				if !e.isFunction[y][x] && i < len(data)*8 {
+					e.modules[y][x] = data[i>>3]>>(7-i&7)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (e *encoder) applyMask(mask int) {
+	for y := 0; y < e.size; y++ {
+		for x := 0; x < e.size; x++ {
+			if e.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			e.modules[y][x] = e.modules[y][x] != invert
+		}
+	}
+}
+
+// penalty returns score of the symbol, masks with lower score are easier to read.
+func (e *encoder) penalty() int {
+	const (
+		penaltyRun     = 3
+		penaltyBlock   = 3
+		penaltyFinder  = 40
+		penaltyBalance = 10
+	)
+	finder := []bool{true, false, true, true, true, false, true}
+
+	result, dark := 0, 0
+	line := make([]bool, e.size)
+	for _, vertical := range []bool{false, true} {
+		for i := 0; i < e.size; i++ {
+			for j := 0; j < e.size; j++ {
+				if vertical {
+					line[j] = e.modules[j][i]
+				} else {
+					line[j] = e.modules[i][j]
+				}
+			}
+
+			// runs of the same color
+			run := 1
+			for j := 1; j <= e.size; j++ {
+				if j < e.size && line[j] == line[j-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += penaltyRun + run - 5
+				}
+				run = 1
+			}
+
+			// finder-like patterns with four light modules on either side
+			for j := 0; j+len(finder) <= e.size; j++ {
+				if !matches(line[j:j+len(finder)], finder) {
+					continue
+				}
+				if isLight(line, j-4, j) || isLight(line, j+len(finder), j+len(finder)+4) {
+					result += penaltyFinder
+				}
+			}
+		}
+	}
+
+	for y := 0; y < e.size; y++ {
+		for x := 0; x < e.size; x++ {
+			if e.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := e.modules[y][x]
+				if c == e.modules[y][x-1] && c == e.modules[y-1][x] && c == e.modules[y-1][x-1] {
+					result += penaltyBlock
+				}
+			}
+		}
+	}
+
+	// deviation of dark modules from 50% in steps of 5%
+	total := e.size * e.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	if k > 0 {
+		result += k * penaltyBalance
+	}
+	return result
+}
+
+func matches(line []bool, pattern []bool) bool {
+	for i := range pattern {
+		if line[i] != pattern[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isLight reports whether modules in [from, to) are light, modules outside the line are light.
+func isLight(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,262 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decode reads data back from the code, checking format information and error correction codewords.
+func decode(t *testing.T, c *Code) ([]byte, Level) {
+	version := (c.Size - 17) / 4
+	require.Equal(t, version*4+17, c.Size)
+
+	// format information, first copy
+	var positions [15][2]int
+	for i := 0; i <= 5; i++ {
+		positions[i] = [2]int{8, i}
+	}
+	positions[6] = [2]int{8, 7}
+	positions[7] = [2]int{8, 8}
+	positions[8] = [2]int{7, 8}
+	for i := 9; i < 15; i++ {
+		positions[i] = [2]int{14 - i, 8}
+	}
+	bits := 0
+	for i, p := range positions {
+		if c.Black(p[0], p[1]) {
+			bits |= 1 << i
+		}
+	}
+	bits ^= 0x5412
+	data := bits >> 10
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	require.Equal(t, bits&0x3FF, rem, "format information checksum")
+
+	var level Level
+	for l, v := range formatBits {
+		if v == data>>3 {
+			level = Level(l)
+		}
+	}
+	mask := data & 7
+
+	// function patterns must match the encoder layout
+	e := newEncoder(version)
+	e.drawFunctionPatterns(level)
+	e.drawFormatBits(level, mask)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if e.isFunction[y][x] {
+				require.Equal(t, e.modules[y][x], c.Black(x, y), "function module (%d, %d)", x, y)
+			}
+			e.modules[y][x] = c.Black(x, y)
+		}
+	}
+	e.applyMask(mask)
+
+	// read codewords in zigzag order
+	codewords := make([]byte, rawDataModules(version)/8)
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if !e.isFunction[y][x] && i < len(codewords)*8 {
+					if e.modules[y][x] {
+						codewords[i>>3] |= 1 << (7 - i&7)
+					}
+					i++
+				}
+			}
+		}
+	}
+
+	// deinterleave and check error correction of each block
+	blocks := errorCorrectionBlocks[level][version]
+	eccLength := eccCodewordsPerBlock[level][version]
+	shortBlocks := blocks - len(codewords)%blocks
+	shortDataLength := len(codewords)/blocks - eccLength
+	dataBlocks := make([][]byte, blocks)
+	eccBlocks := make([][]byte, blocks)
+	k := 0
+	for i := 0; i <= shortDataLength; i++ {
+		for j := 0; j < blocks; j++ {
+			if i < shortDataLength || j >= shortBlocks {
+				dataBlocks[j] = append(dataBlocks[j], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < eccLength; i++ {
+		for j := 0; j < blocks; j++ {
+			eccBlocks[j] = append(eccBlocks[j], codewords[k])
+			k++
+		}
+	}
+	var stream []byte
+	divisor := reedSolomonDivisor(eccLength)
+	for j := range dataBlocks {
+		require.Equal(t, eccBlocks[j], reedSolomonRemainder(dataBlocks[j], divisor), "block %d", j)
+		stream = append(stream, dataBlocks[j]...)
+	}
+
+	// byte mode segment
+	bit := func(n int) int {
+		return int(stream[n>>3]>>(7-n&7)) & 1
+	}
+	read := func(pos, n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v = v<<1 | bit(pos+i)
+		}
+		return v
+	}
+	require.Equal(t, 0x4, read(0, 4))
+	length := read(4, countBits(version))
+	pos := 4 + countBits(version)
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = byte(read(pos+i*8, 8))
+	}
+	return result, level
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		level       Level
+		wantVersion int
+	}{
+		{name: "empty", data: "", level: L, wantVersion: 1},
+		{name: "version 1 low", data: strings.Repeat("a", 17), level: L, wantVersion: 1},
+		{name: "version 2 low", data: strings.Repeat("a", 18), level: L, wantVersion: 2},
+		{name: "version 1 medium", data: strings.Repeat("b", 14), level: M, wantVersion: 1},
+		{name: "version 2 medium", data: strings.Repeat("b", 15), level: M, wantVersion: 2},
+		{name: "version 1 quartile", data: strings.Repeat("c", 11), level: Q, wantVersion: 1},
+		{name: "version 1 high", data: strings.Repeat("d", 7), level: H, wantVersion: 1},
+		{name: "short link", data: "http://localhost:8080/abcde", level: M, wantVersion: 3},
+		{name: "version 40 low", data: strings.Repeat("z", 2953), level: L, wantVersion: 40},
+		{name: "version 40 medium", data: strings.Repeat("z", 2331), level: M, wantVersion: 40},
+		{name: "version 40 quartile", data: strings.Repeat("z", 1663), level: Q, wantVersion: 40},
+		{name: "version 40 high", data: strings.Repeat("z", 1273), level: H, wantVersion: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode([]byte(tt.data), tt.level)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVersion*4+17, code.Size)
+
+			data, level := decode(t, code)
+			assert.Equal(t, tt.data, string(data))
+			assert.Equal(t, tt.level, level)
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	_, err := Encode(bytes.Repeat([]byte("z"), 2954), L)
+	assert.Error(t, err)
+	_, err = Encode(bytes.Repeat([]byte("z"), 1274), H)
+	assert.Error(t, err)
+	_, err = Encode([]byte("a"), Level(4))
+	assert.Error(t, err)
+}
+
+func TestDataCodewords(t *testing.T) {
+	// total number of data codewords of version 40 for each level
+	want := map[Level]int{L: 2956, M: 2334, Q: 1666, H: 1276}
+	for level, codewords := range want {
+		assert.Equal(t, codewords, dataCodewordsCount(40, level), level.String())
+	}
+	// all versions must encode and decode back
+	for version := minVersion; version <= maxVersion; version++ {
+		for level := L; level <= H; level++ {
+			data := bytes.Repeat([]byte{byte(version)}, dataCapacity(version, level))
+			code, err := Encode(data, level)
+			require.NoError(t, err)
+			assert.Equal(t, version*4+17, code.Size, fmt.Sprintf("%d-%s", version, level))
+			got, _ := decode(t, code)
+			assert.Equal(t, data, got)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"L", "M", "Q", "H"} {
+		level, err := ParseLevel(strings.ToLower(name))
+		assert.NoError(t, err)
+		assert.Equal(t, name, level.String())
+	}
+	_, err := ParseLevel("X")
+	assert.Error(t, err)
+}
+
+func TestReedSolomon(t *testing.T) {
+	// codewords of "HELLO WORLD" in version 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	assert.Equal(t, want, reedSolomonRemainder(data, reedSolomonDivisor(len(want))))
+}
+
+func TestCode_PNG(t *testing.T) {
+	code, err := Encode([]byte("http://localhost:8080/abcde"), M)
+	require.NoError(t, err)
+
+	b, err := code.PNG(300, 4)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 300, 300), img.Bounds())
+
+	// 37 modules with quiet zone fit 8 pixels each, 4 pixels are left over
+	scale, offset := 8, (300-code.Size*8)/2
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			r, _, _, _ := img.At(offset+x*scale+scale/2, offset+y*scale+scale/2).RGBA()
+			assert.Equal(t, code.Black(x, y), r == 0, "module (%d, %d)", x, y)
+		}
+	}
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.NotZero(t, r)
+
+	_, err = code.PNG(36, 4)
+	assert.Error(t, err)
+}
+
+func TestCode_SVG(t *testing.T) {
+	code, err := Encode([]byte("http://localhost:8080/abcde"), M)
+	require.NoError(t, err)
+
+	b := code.SVG(256, 2)
+	var svg struct {
+		Width   string `xml:"width,attr"`
+		ViewBox string `xml:"viewBox,attr"`
+		Path    struct {
+			D string `xml:"d,attr"`
+		} `xml:"path"`
+	}
+	require.NoError(t, xml.Unmarshal(b, &svg))
+	assert.Equal(t, "256", svg.Width)
+	assert.Equal(t, "0 0 33 33", svg.ViewBox)
+	// top left finder pattern starts with a run of 7 dark modules
+	assert.True(t, strings.HasPrefix(svg.Path.D, "M2,2h7v1h-7z"))
+}
@@ -20,3 +20,8 @@ func GenerateRandom(size int) []byte {
 	}
 	return b
 }
+
+// Intn returns a random number in the half-open interval [0,n).
+func Intn(n int) int {
+	return rand.Intn(n)
+}
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"go-developer-course-shortener/internal/app/types"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// cacheVersionShards is the number of version counters of short urls. An invalidation prevents caching of lookups
+// started before it only for short urls sharing the counter, lookups of other short urls are cached.
+const cacheVersionShards = 256
+
+// CachedRepository wraps a Repository and keeps results of GetURL in a size-bounded LRU cache.
+// Unknown short urls are cached for a shorter time, so links created by other instances are found soon.
+// Concurrent lookups of the same short url make one lookup of the wrapped repository.
+// Cached links are invalidated by changes made through the wrapper, except health checks and fetched pages,
+// which refresh cached links in place. Checks and pages saved by other instances are seen after ttl.
+type CachedRepository struct {
+	Repository
+
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+	group       singleflight.Group
+
+	mu sync.Mutex
+	// entries by short url, the most recently used entry is at the front of order
+	entries map[string]*list.Element
+	order   *list.List
+	// versions of short urls are changed by their invalidations, lookups started before them are not cached
+	versions [cacheVersionShards]uint64
+}
+
+type cacheEntry struct {
+	shortURL string
+	link     types.OriginalLink
+	found    bool
+	expires  time.Time
+}
+
+// check that CachedRepository implements all required methods
+var _ Repository = (*CachedRepository)(nil)
+
+// NewCachedRepository returns a new CachedRepository with up to size links, found links are kept for ttl
+// and unknown short urls for negativeTTL. Zero negativeTTL disables caching of unknown short urls.
+func NewCachedRepository(storage Repository, size int, ttl time.Duration, negativeTTL time.Duration) *CachedRepository {
+	log.Printf("Cache of %d links is used", size)
+	return &CachedRepository{
+		Repository:  storage,
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// GetURL returns the cached link or looks it up once for all concurrent requests of the short url.
+func (r *CachedRepository) GetURL(shortURL string) (types.OriginalLink, error) {
+	if entry, ok := r.get(shortURL); ok {
+		if !entry.found {
+			return types.OriginalLink{}, ErrNotFound
+		}
+		return entry.link, nil
+	}
+
+	result, err, _ := r.group.Do(shortURL, func() (interface{}, error) {
+		r.mu.Lock()
+		version := r.versions[versionShard(shortURL)]
+		r.mu.Unlock()
+
+		link, err := r.Repository.GetURL(shortURL)
+		switch {
+		case err == nil:
+			r.put(version, &cacheEntry{shortURL: shortURL, link: link, found: true, expires: r.now().Add(r.ttl)})
+		case errors.Is(err, ErrNotFound) && r.negativeTTL > 0:
+			r.put(version, &cacheEntry{shortURL: shortURL, expires: r.now().Add(r.negativeTTL)})
+		}
+		return link, err
+	})
+	if err != nil {
+		return types.OriginalLink{}, err
+	}
+	return result.(types.OriginalLink), nil
+}
+
+// get returns the entry of the short url if it is not expired.
+func (r *CachedRepository) get(shortURL string) (*cacheEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	element, ok := r.entries[shortURL]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !r.now().Before(entry.expires) {
+		r.order.Remove(element)
+		delete(r.entries, shortURL)
+		return nil, false
+	}
+	r.order.MoveToFront(element)
+	return entry, true
+}
+
+// versionShard returns the index of the version counter of the short url.
+func versionShard(shortURL string) int {
+	h := fnv.New32a()
+	h.Write([]byte(shortURL))
+	return int(h.Sum32() % cacheVersionShards)
+}
+
+// put adds the entry if the short url was not invalidated since the version, the least recently used entry is evicted.
+func (r *CachedRepository) put(version uint64, entry *cacheEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if version != r.versions[versionShard(entry.shortURL)] {
+		return
+	}
+	if element, ok := r.entries[entry.shortURL]; ok {
+		element.Value = entry
+		r.order.MoveToFront(element)
+		return
+	}
+	r.entries[entry.shortURL] = r.order.PushFront(entry)
+	for r.order.Len() > r.size {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cacheEntry).shortURL)
+	}
+}
+
+// Invalidate removes cached links of short urls, following lookups read them from the wrapped repository.
+func (r *CachedRepository) Invalidate(shortURLS ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, shortURL := range shortURLS {
+		r.versions[versionShard(shortURL)]++
+		if element, ok := r.entries[shortURL]; ok {
+			r.order.Remove(element)
+			delete(r.entries, shortURL)
+		}
+		r.group.Forget(shortURL)
+	}
+}
+
+// refresh updates the cached link of the short url without evicting it, lookups started before are not cached.
+func (r *CachedRepository) refresh(shortURL string, update func(link *types.OriginalLink)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.versions[versionShard(shortURL)]++
+	element, ok := r.entries[shortURL]
+	if !ok {
+		return
+	}
+	// entries are read outside the lock, so the refreshed entry replaces the cached one
+	entry := *element.Value.(*cacheEntry)
+	if !entry.found {
+		return
+	}
+	update(&entry.link)
+	element.Value = &entry
+}
+
+// Purge removes all cached links.
+func (r *CachedRepository) Purge() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.versions {
+		r.versions[i]++
+	}
+	for shortURL := range r.entries {
+		r.group.Forget(shortURL)
+	}
+	r.entries = make(map[string]*list.Element)
+	r.order.Init()
+}
+
+func (r *CachedRepository) SaveURL(userID string, shortURL string, originalURL string) error {
+	defer r.Invalidate(shortURL)
+	return r.Repository.SaveURL(userID, shortURL, originalURL)
+}
+
+func (r *CachedRepository) SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error) {
+	defer func() {
+		shortURLS := make([]string, len(links))
+		for i, link := range links {
+			shortURLS[i] = link.ShortURL
+		}
+		r.Invalidate(shortURLS...)
+	}()
+	return r.Repository.SaveBatchURLS(userID, links)
+}
+
+func (r *CachedRepository) SaveRecords(records []types.Record) (int, error) {
+	defer func() {
+		shortURLS := make([]string, len(records))
+		for i, record := range records {
+			shortURLS[i] = record.ShortURL
+		}
+		r.Invalidate(shortURLS...)
+	}()
+	return r.Repository.SaveRecords(records)
+}
+
+func (r *CachedRepository) ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error {
+	defer r.Invalidate(shortURL)
+	return r.Repository.ReplaceOriginalURL(shortURL, oldURL, newURL)
+}
+
+func (r *CachedRepository) DeleteURLS(ctx context.Context, userID string, shortURLS []string) error {
+	defer r.Invalidate(shortURLS...)
+	return r.Repository.DeleteURLS(ctx, userID, shortURLS)
+}
+
+func (r *CachedRepository) RestoreURLS(userID string, shortURLS []string, deletedAfter time.Time) ([]string, error) {
+	defer r.Invalidate(shortURLS...)
+	return r.Repository.RestoreURLS(userID, shortURLS, deletedAfter)
+}
+
+// PurgeURLS purges the cache if urls are purged, purged short urls are not known.
+func (r *CachedRepository) PurgeURLS(deletedBefore time.Time, reuse bool) (int, error) {
+	purged, err := r.Repository.PurgeURLS(deletedBefore, reuse)
+	if purged > 0 {
+		r.Purge()
+	}
+	return purged, err
+}
+
+func (r *CachedRepository) SetSchedule(userID string, shortURL string, schedule types.Schedule) error {
+	defer r.Invalidate(shortURL)
+	return r.Repository.SetSchedule(userID, shortURL, schedule)
+}
+
+func (r *CachedRepository) SetTargets(userID string, shortURL string, targets []types.TargetRule) error {
+	defer r.Invalidate(shortURL)
+	return r.Repository.SetTargets(userID, shortURL, targets)
+}
+
+func (r *CachedRepository) SetVariants(userID string, shortURL string, variants []types.Variant) error {
+	defer r.Invalidate(shortURL)
+	return r.Repository.SetVariants(userID, shortURL, variants)
+}
+
+func (r *CachedRepository) SetPreview(userID string, shortURL string, preview types.Preview) error {
+	defer r.Invalidate(shortURL)
+	return r.Repository.SetPreview(userID, shortURL, preview)
+}
+
+func (r *CachedRepository) SetMetadata(userID string, shortURL string, metadata types.Metadata) error {
+	defer r.Invalidate(shortURL)
+	return r.Repository.SetMetadata(userID, shortURL, metadata)
+}
+
+// DeleteCollection purges the cache, links of the collection are not known.
+func (r *CachedRepository) DeleteCollection(userID string, collectionID string) error {
+	defer r.Purge()
+	return r.Repository.DeleteCollection(userID, collectionID)
+}
+
+func (r *CachedRepository) MoveURLS(userID string, collectionID string, shortURLS []string) error {
+	defer r.Invalidate(shortURLS...)
+	return r.Repository.MoveURLS(userID, collectionID, shortURLS)
+}
+
+// SaveHealth refreshes cached links with the checks, so health sweeps do not evict them.
+func (r *CachedRepository) SaveHealth(results map[string]types.Health) error {
+	if err := r.Repository.SaveHealth(results); err != nil {
+		return err
+	}
+	for shortURL, health := range results {
+		health := health
+		r.refresh(shortURL, func(link *types.OriginalLink) { link.Health = &health })
+	}
+	return nil
+}
+
+// SavePage refreshes the cached link with the page, so page fetches do not evict it.
+func (r *CachedRepository) SavePage(shortURL string, page types.Page) error {
+	if err := r.Repository.SavePage(shortURL, page); err != nil {
+		return err
+	}
+	r.refresh(shortURL, func(link *types.OriginalLink) { link.Page = &page })
+	return nil
+}
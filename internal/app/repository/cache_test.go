@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-developer-course-shortener/internal/app/types"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRepository counts lookups of short urls, lookups wait for release if it is set.
+type countingRepository struct {
+	*InMemoryRepository
+	lookups int32
+	release chan struct{}
+	err     error
+}
+
+func (r *countingRepository) GetURL(shortURL string) (types.OriginalLink, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	if r.release != nil {
+		<-r.release
+	}
+	if r.err != nil {
+		return types.OriginalLink{}, r.err
+	}
+	return r.InMemoryRepository.GetURL(shortURL)
+}
+
+func TestCachedRepository(t *testing.T) {
+	backend := &countingRepository{InMemoryRepository: NewInMemoryRepository()}
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	cache := NewCachedRepository(backend, 2, time.Minute, 5*time.Second)
+	cache.now = func() time.Time { return now }
+
+	require.NoError(t, cache.SaveURL("user1", "a", "https://a.example"))
+	require.NoError(t, cache.SaveURL("user1", "b", "https://b.example"))
+	require.NoError(t, cache.SaveURL("user1", "c", "https://c.example"))
+	lookup := func(shortURL string, want string, lookups int32) {
+		t.Helper()
+		link, err := cache.GetURL(shortURL)
+		if want == "" {
+			assert.ErrorIs(t, err, ErrNotFound)
+		} else {
+			require.NoError(t, err)
+			assert.Equal(t, want, link.OriginalURL)
+		}
+		assert.Equal(t, lookups, atomic.LoadInt32(&backend.lookups))
+	}
+
+	lookup("a", "https://a.example", 1)
+	lookup("a", "https://a.example", 1)
+	lookup("b", "https://b.example", 2)
+	// the least recently used link is evicted
+	lookup("c", "https://c.example", 3)
+	lookup("b", "https://b.example", 3)
+	lookup("a", "https://a.example", 4)
+
+	// unknown short urls are cached for the negative ttl
+	lookup("d", "", 5)
+	lookup("d", "", 5)
+	now = now.Add(5 * time.Second)
+	lookup("d", "", 6)
+	// and invalidated by saving
+	require.NoError(t, cache.SaveURL("user1", "d", "https://d.example"))
+	lookup("d", "https://d.example", 7)
+
+	// links expire after the ttl
+	now = now.Add(time.Minute)
+	lookup("d", "https://d.example", 8)
+
+	// edits invalidate the link
+	require.NoError(t, cache.SetMetadata("user1", "d", types.Metadata{Title: "D"}))
+	link, err := cache.GetURL("d")
+	require.NoError(t, err)
+	assert.Equal(t, "D", link.Metadata.Title)
+	assert.Equal(t, int32(9), atomic.LoadInt32(&backend.lookups))
+	require.NoError(t, cache.DeleteURLS(context.Background(), "user1", []string{"d"}))
+	lookup("d", "https://d.example", 10)
+	cache.Purge()
+	lookup("d", "https://d.example", 11)
+
+	// errors of the backend are not cached
+	backend.err = errors.New("connection refused")
+	cache.Invalidate("d")
+	_, err = cache.GetURL("d")
+	assert.EqualError(t, err, "connection refused")
+	_, err = cache.GetURL("d")
+	assert.Error(t, err)
+	assert.Equal(t, int32(13), atomic.LoadInt32(&backend.lookups))
+}
+
+func TestCachedRepository_Singleflight(t *testing.T) {
+	backend := &countingRepository{InMemoryRepository: NewInMemoryRepository(), release: make(chan struct{})}
+	require.NoError(t, backend.SaveURL("user1", "a", "https://a.example"))
+	cache := NewCachedRepository(backend, 10, time.Minute, time.Second)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			link, err := cache.GetURL("a")
+			assert.NoError(t, err)
+			assert.Equal(t, "https://a.example", link.OriginalURL)
+		}()
+	}
+	// wait until the first lookup is started, others join it
+	for atomic.LoadInt32(&backend.lookups) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&backend.lookups))
+}
+
+func TestCachedRepository_InvalidateDuringLookup(t *testing.T) {
+	backend := &countingRepository{InMemoryRepository: NewInMemoryRepository(), release: make(chan struct{})}
+	require.NoError(t, backend.SaveURL("user1", "a", "https://a.example"))
+	cache := NewCachedRepository(backend, 10, time.Minute, time.Second)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := cache.GetURL("a")
+		assert.NoError(t, err)
+	}()
+	for atomic.LoadInt32(&backend.lookups) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// the link read before the change must not be cached
+	cache.Invalidate("a")
+	backend.release <- struct{}{}
+	<-done
+
+	close(backend.release)
+	_, err := cache.GetURL("a")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&backend.lookups))
+}
+
+func TestCachedRepository_InvalidateOtherDuringLookup(t *testing.T) {
+	backend := &countingRepository{InMemoryRepository: NewInMemoryRepository(), release: make(chan struct{})}
+	require.NoError(t, backend.SaveURL("user1", "a", "https://a.example"))
+	cache := NewCachedRepository(backend, 10, time.Minute, time.Second)
+	other := "b"
+	for versionShard(other) == versionShard("a") {
+		other += "b"
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := cache.GetURL("a")
+		assert.NoError(t, err)
+	}()
+	for atomic.LoadInt32(&backend.lookups) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// changes of other short urls do not prevent caching of the link
+	require.NoError(t, cache.SaveURL("user1", other, "https://b.example"))
+	backend.release <- struct{}{}
+	<-done
+
+	close(backend.release)
+	_, err := cache.GetURL("a")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&backend.lookups))
+}
+
+func TestCachedRepository_RefreshHealthAndPage(t *testing.T) {
+	backend := &countingRepository{InMemoryRepository: NewInMemoryRepository()}
+	require.NoError(t, backend.SaveURL("user1", "a", "https://a.example"))
+	cache := NewCachedRepository(backend, 10, time.Minute, time.Second)
+	_, err := cache.GetURL("a")
+	require.NoError(t, err)
+
+	// checks and pages refresh the cached link without evicting it
+	checkedAt := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, cache.SaveHealth(map[string]types.Health{"a": {StatusCode: 404, CheckedAt: checkedAt}}))
+	require.NoError(t, cache.SavePage("a", types.Page{Title: "A", FetchedAt: checkedAt}))
+	link, err := cache.GetURL("a")
+	require.NoError(t, err)
+	require.NotNil(t, link.Health)
+	assert.Equal(t, 404, link.Health.StatusCode)
+	require.NotNil(t, link.Page)
+	assert.Equal(t, "A", link.Page.Title)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&backend.lookups))
+
+	// links which are not cached are not added
+	require.NoError(t, backend.SaveURL("user1", "b", "https://b.example"))
+	require.NoError(t, cache.SavePage("b", types.Page{Title: "B", FetchedAt: checkedAt}))
+	link, err = cache.GetURL("b")
+	require.NoError(t, err)
+	assert.Equal(t, "B", link.Page.Title)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&backend.lookups))
+}
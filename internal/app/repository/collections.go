@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"go-developer-course-shortener/internal/app/types"
+)
+
+// pageLinks returns links in [offset, offset+limit), zero limit returns all links from offset.
+func pageLinks(links []types.Link, limit int, offset int) []types.Link {
+	if offset >= len(links) {
+		return nil
+	}
+	links = links[offset:]
+	if limit > 0 && limit < len(links) {
+		links = links[:limit]
+	}
+	return links
+}
+
+func findCollection(collections []types.Collection, collectionID string) int {
+	for i, c := range collections {
+		if c.ID == collectionID {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasCollectionName(collections []types.Collection, name string) bool {
+	for _, c := range collections {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
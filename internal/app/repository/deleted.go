@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"go-developer-course-shortener/internal/app/types"
+	"time"
+)
+
+// restorable reports whether the link of the user was deleted after the time, so it can be restored.
+func restorable(link *types.OriginalLink, userID string, deletedAfter time.Time) bool {
+	return userID != "" && link.UserID == userID && link.Deleted && link.DeletedAt.After(deletedAfter)
+}
+
+// purgeable reports whether the link was deleted before the time. Links deleted before the time of deletion was saved
+// are not purged, the retention of such links can not be known.
+// Links left by the previous purges are purged again only if their short urls may be reused.
+func purgeable(link *types.OriginalLink, deletedBefore time.Time, reuse bool) bool {
+	return link.Deleted && !link.DeletedAt.IsZero() && link.DeletedAt.Before(deletedBefore) && (reuse || link.UserID != "")
+}
+
+// purgedLink returns the link left instead of the purged link, it keeps the short url reserved
+// without the owner and the original url.
+func purgedLink(link types.OriginalLink) types.OriginalLink {
+	return types.OriginalLink{Deleted: true, DeletedAt: link.DeletedAt, CreatedAt: link.CreatedAt}
+}
+
+// removeShortURL returns a copy of short urls without the short url.
+func removeShortURL(shortURLS []string, shortURL string) []string {
+	kept := make([]string, 0, len(shortURLS))
+	for _, id := range shortURLS {
+		if id != shortURL {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/types"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeletedURLS(t *testing.T) {
+	kv, err := NewKVRepository(filepath.Join(t.TempDir(), "shortener.kv"))
+	require.NoError(t, err)
+	defer kv.ReleaseStorage()
+
+	storages := map[string]Repository{
+		"Memory":  NewInMemoryRepository(),
+		"Sharded": NewShardedRepository(4),
+		"File":    NewFileRepository(filepath.Join(t.TempDir(), "shortener.json")),
+		"KV":      kv,
+	}
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, storage.SaveURL("user1", "a", "https://example.com/a"))
+			require.NoError(t, storage.SaveURL("user1", "b", "https://example.com/b"))
+			require.NoError(t, storage.SaveURL("user2", "c", "https://example.com/c"))
+			require.NoError(t, storage.SaveClicks([]types.Click{{UserID: "user1", ShortURL: "a", Class: types.ClickHuman, Visitor: 1, Time: time.Now()}}))
+
+			start := time.Now()
+			require.NoError(t, storage.DeleteURLS(context.Background(), "user1", []string{"a", "b", "c"}))
+			link, err := storage.GetURL("a")
+			require.NoError(t, err)
+			assert.True(t, link.Deleted)
+			assert.False(t, link.DeletedAt.Before(start))
+			link, err = storage.GetURL("c")
+			require.NoError(t, err)
+			assert.False(t, link.Deleted, "links of other users must not be deleted")
+
+			// links are restored by their owners within the grace period
+			restored, err := storage.RestoreURLS("user2", []string{"a"}, start.Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Empty(t, restored)
+			restored, err = storage.RestoreURLS("user1", []string{"a", "c"}, start.Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a"}, restored)
+			link, err = storage.GetURL("a")
+			require.NoError(t, err)
+			assert.False(t, link.Deleted)
+			assert.True(t, link.DeletedAt.IsZero())
+			restored, err = storage.RestoreURLS("user1", []string{"b"}, time.Now().Add(time.Hour))
+			require.NoError(t, err)
+			assert.Empty(t, restored, "links deleted before the grace period must not be restored")
+
+			require.NoError(t, storage.DeleteURLS(context.Background(), "user1", []string{"a"}))
+			stats, err := storage.GetClickStats("a", true)
+			require.NoError(t, err)
+			assert.Equal(t, 1, stats.Total)
+			query := types.ReportQuery{Dimension: types.ReportLinks, From: start.Add(-time.Hour), To: start.Add(time.Hour)}
+			report, err := storage.GetClickReport(query)
+			require.NoError(t, err)
+			assert.Equal(t, []types.ReportItem{{Key: "a", Clicks: 1}}, report)
+
+			// purged links keep their short urls reserved
+			purged, err := storage.PurgeURLS(start, false)
+			require.NoError(t, err)
+			assert.Zero(t, purged, "links deleted after the time must not be purged")
+			purged, err = storage.PurgeURLS(time.Now().Add(time.Hour), false)
+			require.NoError(t, err)
+			assert.Equal(t, 2, purged)
+			link, err = storage.GetURL("a")
+			require.NoError(t, err)
+			assert.Equal(t, types.OriginalLink{Deleted: true, DeletedAt: link.DeletedAt, CreatedAt: link.CreatedAt}, link)
+			assert.Error(t, storage.SaveURL("user3", "a", "https://example.com/new"))
+			shortURL, _ := storage.GetShortURLByOriginalURL("https://example.com/a")
+			assert.NotEqual(t, "a", shortURL)
+			stats, err = storage.GetClickStats("a", true)
+			require.NoError(t, err)
+			assert.Zero(t, stats.Total)
+			assert.Zero(t, stats.Uniques)
+			report, err = storage.GetClickReport(query)
+			require.NoError(t, err)
+			assert.Empty(t, report)
+			restored, err = storage.RestoreURLS("user1", []string{"a"}, time.Time{})
+			require.NoError(t, err)
+			assert.Empty(t, restored, "purged links must not be restored")
+			urls, users, err := storage.GetInternalStats()
+			require.NoError(t, err)
+			assert.Equal(t, 3, urls)
+			assert.Equal(t, 1, users)
+
+			purged, err = storage.PurgeURLS(time.Now().Add(time.Hour), false)
+			require.NoError(t, err)
+			assert.Zero(t, purged)
+
+			// short urls are reused only if the policy allows it
+			purged, err = storage.PurgeURLS(time.Now().Add(time.Hour), true)
+			require.NoError(t, err)
+			assert.Equal(t, 2, purged)
+			_, err = storage.GetURL("a")
+			assert.ErrorIs(t, err, ErrNotFound)
+			require.NoError(t, storage.SaveURL("user3", "a", "https://example.com/new"))
+			urls, users, err = storage.GetInternalStats()
+			require.NoError(t, err)
+			assert.Equal(t, 2, urls)
+			assert.Equal(t, 2, users)
+		})
+	}
+}
+
+func TestDeletedURLSWithoutTime(t *testing.T) {
+	kv, err := NewKVRepository(filepath.Join(t.TempDir(), "shortener.kv"))
+	require.NoError(t, err)
+	defer kv.ReleaseStorage()
+
+	storages := map[string]Repository{
+		"Memory":  NewInMemoryRepository(),
+		"Sharded": NewShardedRepository(4),
+		"File":    NewFileRepository(filepath.Join(t.TempDir(), "shortener.json")),
+		"KV":      kv,
+	}
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			// links deleted before the time of deletion was saved are kept
+			saved, err := storage.SaveRecords([]types.Record{{ShortURL: "old",
+				OriginalLink: types.OriginalLink{UserID: "user1", OriginalURL: "https://example.com/old", Deleted: true}}})
+			require.NoError(t, err)
+			require.Equal(t, 1, saved)
+			purged, err := storage.PurgeURLS(time.Now().Add(time.Hour), true)
+			require.NoError(t, err)
+			assert.Zero(t, purged)
+			link, err := storage.GetURL("old")
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.com/old", link.OriginalURL)
+		})
+	}
+}
+
+func TestDeletedURLSInCollections(t *testing.T) {
+	kv, err := NewKVRepository(filepath.Join(t.TempDir(), "shortener.kv"))
+	require.NoError(t, err)
+	defer kv.ReleaseStorage()
+
+	storages := map[string]Repository{
+		"Memory":  NewInMemoryRepository(),
+		"Sharded": NewShardedRepository(4),
+		"File":    NewFileRepository(filepath.Join(t.TempDir(), "shortener.json")),
+		"KV":      kv,
+	}
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, storage.SaveURL("user1", "a", "https://example.com/a"))
+			require.NoError(t, storage.SaveURL("user1", "b", "https://example.com/b"))
+			require.NoError(t, storage.CreateCollection("user1", types.Collection{ID: "c1", Name: "Work"}))
+			require.NoError(t, storage.MoveURLS("user1", "c1", []string{"a", "b"}))
+
+			// deleted links are not counted and not listed in their collections
+			start := time.Now().Add(-time.Minute)
+			require.NoError(t, storage.DeleteURLS(context.Background(), "user1", []string{"a"}))
+			collections, err := storage.GetCollections("user1")
+			require.NoError(t, err)
+			require.Len(t, collections, 1)
+			assert.Equal(t, 1, collections[0].Links)
+			links, total, err := storage.GetCollectionURLS("user1", "c1", 10, 0)
+			require.NoError(t, err)
+			assert.Equal(t, 1, total)
+			require.Len(t, links, 1)
+			assert.Equal(t, "b", links[0].ShortURL)
+
+			// restored links are in their collections again
+			restored, err := storage.RestoreURLS("user1", []string{"a"}, start)
+			require.NoError(t, err)
+			require.Equal(t, []string{"a"}, restored)
+			collections, err = storage.GetCollections("user1")
+			require.NoError(t, err)
+			assert.Equal(t, 2, collections[0].Links)
+			_, total, err = storage.GetCollectionURLS("user1", "c1", 10, 0)
+			require.NoError(t, err)
+			assert.Equal(t, 2, total)
+		})
+	}
+}
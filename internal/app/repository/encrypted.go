@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/app/urlcrypt"
+	"log"
+	"sync"
+	"time"
+)
+
+// errDuplicateURL is returned if the encrypted url of a plaintext url is already saved by another short url.
+var errDuplicateURL = errors.New("original url is saved by another short url")
+
+// EncryptedRepository wraps a Repository and keeps original urls encrypted in it.
+// Original urls are looked up by their blind index, so the wrapped repository never sees plaintext urls.
+// Plaintext urls stored before the encryption was enabled are still read and encrypted by Reencrypt.
+// Words of encrypted original urls are not found by search, the search filters links of the wrapped repository.
+type EncryptedRepository struct {
+	Repository
+
+	cipher *urlcrypt.Cipher
+
+	// duplicates are stored plaintext urls of short urls skipped by Reencrypt
+	duplicatesMu sync.Mutex
+	duplicates   map[string]string
+}
+
+// check that EncryptedRepository implements all required methods
+var _ Repository = (*EncryptedRepository)(nil)
+
+// NewEncryptedRepository returns a new EncryptedRepository encrypting original urls by the cipher.
+func NewEncryptedRepository(storage Repository, cipher *urlcrypt.Cipher) *EncryptedRepository {
+	log.Println("Encryption of original urls is used")
+	return &EncryptedRepository{Repository: storage, cipher: cipher, duplicates: make(map[string]string)}
+}
+
+// decryptLinks replaces original urls of the links by decrypted urls.
+func (r *EncryptedRepository) decryptLinks(links []types.Link) error {
+	for i := range links {
+		url, err := r.cipher.Decrypt(links[i].OriginalURL)
+		if err != nil {
+			return err
+		}
+		links[i].OriginalURL = url
+	}
+	return nil
+}
+
+func (r *EncryptedRepository) SaveURL(userID string, shortURL string, originalURL string) error {
+	encrypted, err := r.cipher.Encrypt(originalURL)
+	if err != nil {
+		return err
+	}
+	return r.Repository.SaveURL(userID, shortURL, encrypted)
+}
+
+func (r *EncryptedRepository) SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error) {
+	encrypted := make(types.BatchLinks, len(links))
+	for i, link := range links {
+		url, err := r.cipher.Encrypt(link.OriginalURL)
+		if err != nil {
+			return nil, err
+		}
+		encrypted[i] = link
+		encrypted[i].OriginalURL = url
+	}
+	return r.Repository.SaveBatchURLS(userID, encrypted)
+}
+
+// SaveRecords encrypts plaintext original urls, encrypted urls are saved as they are.
+func (r *EncryptedRepository) SaveRecords(records []types.Record) (int, error) {
+	encrypted := make([]types.Record, len(records))
+	for i, record := range records {
+		encrypted[i] = record
+		if urlcrypt.Encrypted(record.OriginalURL) {
+			continue
+		}
+		url, err := r.cipher.Encrypt(record.OriginalURL)
+		if err != nil {
+			return 0, err
+		}
+		encrypted[i].OriginalURL = url
+	}
+	return r.Repository.SaveRecords(encrypted)
+}
+
+func (r *EncryptedRepository) GetURL(shortURL string) (types.OriginalLink, error) {
+	link, err := r.Repository.GetURL(shortURL)
+	if err != nil {
+		return link, err
+	}
+	link.OriginalURL, err = r.cipher.Decrypt(link.OriginalURL)
+	return link, err
+}
+
+// GetShortURLByOriginalURL looks up the blind index of the url, then the plaintext url stored before the encryption.
+func (r *EncryptedRepository) GetShortURLByOriginalURL(originalURL string) (string, error) {
+	shortURL, err := r.Repository.GetShortURLByOriginalURL(r.cipher.Index(originalURL))
+	if err == nil && shortURL != "" {
+		return shortURL, nil
+	}
+	return r.Repository.GetShortURLByOriginalURL(originalURL)
+}
+
+func (r *EncryptedRepository) GetUserStorage(userID string) ([]types.Link, error) {
+	links, err := r.Repository.GetUserStorage(userID)
+	if err != nil {
+		return nil, err
+	}
+	return links, r.decryptLinks(links)
+}
+
+func (r *EncryptedRepository) ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error {
+	return r.Repository.ExportUserURLS(ctx, userID, func(link types.ExportLink) error {
+		url, err := r.cipher.Decrypt(link.OriginalURL)
+		if err != nil {
+			return err
+		}
+		link.OriginalURL = url
+		return visit(link)
+	})
+}
+
+// ForEachRecord visits records with decrypted original urls.
+func (r *EncryptedRepository) ForEachRecord(ctx context.Context, visit func(record types.Record) error) error {
+	return r.Repository.ForEachRecord(ctx, func(record types.Record) error {
+		url, err := r.cipher.Decrypt(record.OriginalURL)
+		if err != nil {
+			return err
+		}
+		record.OriginalURL = url
+		return visit(record)
+	})
+}
+
+// ReplaceOriginalURL compares and replaces decrypted original urls.
+func (r *EncryptedRepository) ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error {
+	link, err := r.Repository.GetURL(shortURL)
+	if err != nil {
+		return err
+	}
+	current, err := r.cipher.Decrypt(link.OriginalURL)
+	if err != nil {
+		return err
+	}
+	if current != oldURL {
+		return ErrNotFound
+	}
+	encrypted, err := r.cipher.Encrypt(newURL)
+	if err != nil {
+		return err
+	}
+	return r.Repository.ReplaceOriginalURL(shortURL, link.OriginalURL, encrypted)
+}
+
+// SearchURLS searches links of the wrapped repository by tags and matches words of decrypted links.
+func (r *EncryptedRepository) SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error) {
+	links, err := r.Repository.SearchURLS(userID, types.SearchQuery{Tags: query.Tags})
+	if err != nil {
+		return nil, err
+	}
+	if err = r.decryptLinks(links); err != nil {
+		return nil, err
+	}
+	found := links[:0]
+	for _, link := range links {
+		if matchesQuery(link, query) {
+			found = append(found, link)
+		}
+	}
+	return found, nil
+}
+
+func (r *EncryptedRepository) GetCollectionURLS(userID string, collectionID string, limit int, offset int) ([]types.Link, int, error) {
+	links, total, err := r.Repository.GetCollectionURLS(userID, collectionID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return links, total, r.decryptLinks(links)
+}
+
+func (r *EncryptedRepository) GetHealthCheckURLS(checkedBefore time.Time, limit int) ([]types.Link, error) {
+	links, err := r.Repository.GetHealthCheckURLS(checkedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	return links, r.decryptLinks(links)
+}
+
+// Reencrypt encrypts original urls which are plaintext or encrypted by an old master key and returns their number.
+// Urls changed concurrently are skipped, failed urls are logged and tried again by the next call.
+// Plaintext urls saved again after the encryption was enabled are kept, their lookup key belongs to the encrypted copy,
+// they are skipped until they are changed.
+func (r *EncryptedRepository) Reencrypt(ctx context.Context) (int, error) {
+	stale := make(map[string]string)
+	r.duplicatesMu.Lock()
+	defer r.duplicatesMu.Unlock()
+	err := r.Repository.ForEachRecord(ctx, func(record types.Record) error {
+		// purged links keep short urls without original urls
+		if record.OriginalURL != "" && !r.cipher.Current(record.OriginalURL) &&
+			r.duplicates[record.ShortURL] != record.OriginalURL {
+			stale[record.ShortURL] = record.OriginalURL
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	reencrypted := 0
+	for shortURL, stored := range stale {
+		if err = ctx.Err(); err != nil {
+			return reencrypted, err
+		}
+		if err = r.reencrypt(shortURL, stored); err != nil {
+			if errors.Is(err, errDuplicateURL) {
+				log.Printf("Original url of %s is not re-encrypted, it is saved by another short url", shortURL)
+				r.duplicates[shortURL] = stored
+			} else if !errors.Is(err, ErrNotFound) {
+				log.Printf("Failed to re-encrypt original url of %s. Error: %v", shortURL, err)
+			}
+			continue
+		}
+		reencrypted++
+	}
+	return reencrypted, nil
+}
+
+func (r *EncryptedRepository) reencrypt(shortURL string, stored string) error {
+	url, err := r.cipher.Decrypt(stored)
+	if err != nil {
+		return err
+	}
+	if !urlcrypt.Encrypted(stored) {
+		owner, err := r.Repository.GetShortURLByOriginalURL(r.cipher.Index(url))
+		if err == nil && owner != "" && owner != shortURL {
+			return errDuplicateURL
+		}
+	}
+	encrypted, err := r.cipher.Encrypt(url)
+	if err != nil {
+		return err
+	}
+	return r.Repository.ReplaceOriginalURL(shortURL, stored, encrypted)
+}
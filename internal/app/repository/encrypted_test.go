@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/app/urlcrypt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCipher(t *testing.T, versions ...uint32) *urlcrypt.Cipher {
+	t.Helper()
+	keys := make(map[uint32][]byte)
+	for _, version := range versions {
+		keys[version] = bytes.Repeat([]byte{byte(version)}, urlcrypt.KeySize)
+	}
+	cipher, err := urlcrypt.New(keys, bytes.Repeat([]byte{9}, urlcrypt.KeySize))
+	require.NoError(t, err)
+	return cipher
+}
+
+func TestEncryptedRepository(t *testing.T) {
+	kv, err := NewKVRepository(filepath.Join(t.TempDir(), "shortener.kv"))
+	require.NoError(t, err)
+	defer kv.ReleaseStorage()
+
+	inners := map[string]Repository{
+		"Memory":  NewInMemoryRepository(),
+		"Sharded": NewShardedRepository(4),
+		"File":    NewFileRepository(filepath.Join(t.TempDir(), "shortener.json")),
+		"KV":      kv,
+	}
+	for name, inner := range inners {
+		t.Run(name, func(t *testing.T) {
+			storage := NewEncryptedRepository(inner, newTestCipher(t, 1))
+			secret := "https://example.com/reset?token=secret"
+			require.NoError(t, storage.SaveURL("user1", "a", secret))
+			_, err := storage.SaveBatchURLS("user1", types.BatchLinks{
+				{CorrelationID: "1", ShortURL: "b", OriginalURL: "https://example.com/docs", Metadata: types.Metadata{Tags: []string{"go"}}},
+			})
+			require.NoError(t, err)
+
+			stored, err := inner.GetURL("a")
+			require.NoError(t, err)
+			assert.NotContains(t, stored.OriginalURL, "secret", "the wrapped repository must not keep plaintext urls")
+			link, err := storage.GetURL("a")
+			require.NoError(t, err)
+			assert.Equal(t, secret, link.OriginalURL)
+			shortURL, err := storage.GetShortURLByOriginalURL(secret)
+			require.NoError(t, err)
+			assert.Equal(t, "a", shortURL)
+
+			links, err := storage.GetUserStorage("user1")
+			require.NoError(t, err)
+			require.Len(t, links, 2)
+			assert.Equal(t, secret, links[0].OriginalURL)
+			found, err := storage.SearchURLS("user1", types.SearchQuery{Tags: []string{"go"}, Text: "docs"})
+			require.NoError(t, err)
+			require.Len(t, found, 1)
+			assert.Equal(t, "https://example.com/docs", found[0].OriginalURL)
+
+			// plaintext urls stored before the encryption are found and encrypted
+			require.NoError(t, inner.SaveURL("user2", "c", "https://example.com/plain"))
+			shortURL, err = storage.GetShortURLByOriginalURL("https://example.com/plain")
+			require.NoError(t, err)
+			assert.Equal(t, "c", shortURL)
+			reencrypted, err := storage.Reencrypt(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 1, reencrypted)
+			stored, err = inner.GetURL("c")
+			require.NoError(t, err)
+			assert.True(t, urlcrypt.Encrypted(stored.OriginalURL))
+			shortURL, err = inner.GetShortURLByOriginalURL(stored.OriginalURL)
+			require.NoError(t, err)
+			assert.Equal(t, "c", shortURL, "the lookup key of the re-encrypted url must be indexed")
+
+			// all urls are re-encrypted by the new key, then the old key is not needed
+			rotated := NewEncryptedRepository(inner, newTestCipher(t, 1, 2))
+			reencrypted, err = rotated.Reencrypt(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 3, reencrypted)
+			current := NewEncryptedRepository(inner, newTestCipher(t, 2))
+			err = current.ForEachRecord(context.Background(), func(record types.Record) error {
+				assert.Contains(t, record.OriginalURL, "https://example.com/")
+				return nil
+			})
+			require.NoError(t, err)
+			shortURL, err = current.GetShortURLByOriginalURL(secret)
+			require.NoError(t, err)
+			assert.Equal(t, "a", shortURL)
+
+			assert.ErrorIs(t, current.ReplaceOriginalURL("a", "https://example.com/other", secret), ErrNotFound)
+			require.NoError(t, current.ReplaceOriginalURL("a", secret, "https://example.com/other"))
+			link, err = current.GetURL("a")
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.com/other", link.OriginalURL)
+
+			// purged links keep no original url to encrypt
+			require.NoError(t, current.DeleteURLS(context.Background(), "user1", []string{"b"}))
+			purged, err := current.PurgeURLS(time.Now().Add(time.Hour), false)
+			require.NoError(t, err)
+			assert.Equal(t, 1, purged)
+			reencrypted, err = NewEncryptedRepository(inner, newTestCipher(t, 2, 3)).Reencrypt(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 2, reencrypted)
+			stored, err = inner.GetURL("b")
+			require.NoError(t, err)
+			assert.Empty(t, stored.OriginalURL)
+		})
+	}
+}
+
+// replaceCounter counts replaced original urls.
+type replaceCounter struct {
+	Repository
+	replaced int
+}
+
+func (r *replaceCounter) ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error {
+	r.replaced++
+	return r.Repository.ReplaceOriginalURL(shortURL, oldURL, newURL)
+}
+
+func TestEncryptedRepository_ReencryptDuplicate(t *testing.T) {
+	kv, err := NewKVRepository(filepath.Join(t.TempDir(), "shortener.kv"))
+	require.NoError(t, err)
+	defer kv.ReleaseStorage()
+
+	inners := map[string]Repository{
+		"Memory":  NewInMemoryRepository(),
+		"Sharded": NewShardedRepository(4),
+		"File":    NewFileRepository(filepath.Join(t.TempDir(), "shortener.json")),
+		"KV":      kv,
+	}
+	for name, inner := range inners {
+		t.Run(name, func(t *testing.T) {
+			counter := &replaceCounter{Repository: inner}
+			storage := NewEncryptedRepository(counter, newTestCipher(t, 1))
+			url := "https://example.com/dup"
+			require.NoError(t, inner.SaveURL("user1", "plain", url))
+			require.NoError(t, storage.SaveURL("user2", "enc", url))
+
+			// the plaintext copy is skipped, the lookup key stays with the encrypted copy
+			for i := 0; i < 2; i++ {
+				reencrypted, err := storage.Reencrypt(context.Background())
+				require.NoError(t, err)
+				assert.Zero(t, reencrypted)
+			}
+			assert.Zero(t, counter.replaced)
+			stored, err := inner.GetURL("plain")
+			require.NoError(t, err)
+			assert.Equal(t, url, stored.OriginalURL)
+			shortURL, err := storage.GetShortURLByOriginalURL(url)
+			require.NoError(t, err)
+			assert.Equal(t, "enc", shortURL)
+
+			// a changed url is encrypted again
+			require.NoError(t, inner.ReplaceOriginalURL("plain", url, "https://example.com/changed"))
+			reencrypted, err := storage.Reencrypt(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 1, reencrypted)
+		})
+	}
+}
@@ -1,150 +1,1214 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/hll"
+	"go-developer-course-shortener/internal/app/rollup"
 	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/app/urlcrypt"
 	"io"
-	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
 // FileRepository implements Repository interface
 type FileRepository struct {
+	// mu serializes writes, so appended records are not lost by rewrites, and is locked for reading by scans,
+	// so rewrites do not replace the file while it is read. Every operation opens its own file.
+	mu              sync.RWMutex
 	fileStoragePath string
-	file            *os.File
+	// shortURLS are short urls of all records including purged links, they are loaded on the first write
+	shortURLS map[string]bool
+
+	// clicksMu serializes access to the clicks file and rollups, rollups are loaded on the first use
+	clicksMu sync.Mutex
+	rollups  *rollup.Table
+	uniques  map[string]hll.Days
 }
 
 // check that FileRepository implements all required methods
 var _ Repository = (*FileRepository)(nil)
 
 type fileRecord struct {
-	UserID      string `json:"user_id"`
-	ID          string `json:"id"`
-	OriginalURL string `json:"original_url"`
+	UserID      string             `json:"user_id"`
+	ID          string             `json:"id"`
+	OriginalURL string             `json:"original_url"`
+	Deleted     bool               `json:"deleted,omitempty"`
+	DeletedAt   *time.Time         `json:"deleted_at,omitempty"`
+	NotBefore   *time.Time         `json:"not_before,omitempty"`
+	NotAfter    *time.Time         `json:"not_after,omitempty"`
+	PendingURL  string             `json:"pending_url,omitempty"`
+	Targets     []types.TargetRule `json:"targets,omitempty"`
+	Variants    []types.Variant    `json:"variants,omitempty"`
+	Preview     *types.Preview     `json:"preview,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Note        string             `json:"note,omitempty"`
+	Tags        []string           `json:"tags,omitempty"`
+	Collection  string             `json:"collection,omitempty"`
+	Health      *types.Health      `json:"health,omitempty"`
+	Page        *types.Page        `json:"page,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
 }
 
-func (r *FileRepository) GetInternalStats() (int, int, error) {
-	urls := make(map[string]string)
-	users := make(map[string]string)
-	var err error
-	r.file, err = os.OpenFile(r.fileStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
+type fileCollectionRecord struct {
+	UserID string `json:"user_id"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+}
+
+type fileClickRecord struct {
+	UserID   string `json:"user_id,omitempty"`
+	ID       string `json:"id"`
+	Variant  string `json:"variant,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Referrer string `json:"referrer,omitempty"`
+	Bot      string `json:"bot,omitempty"`
+	Class    string `json:"class,omitempty"`
+	// HyperLogLog register of the visitor, the visitor is not kept
+	Register int       `json:"register,omitempty"`
+	Rank     uint8     `json:"rank,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// fileRollupRecord is a line of the rollups file: a bucket or a day sketch of unique visitors of purged clicks.
+type fileRollupRecord struct {
+	Bucket  *rollup.Bucket     `json:"bucket,omitempty"`
+	Uniques *fileUniquesRecord `json:"uniques,omitempty"`
+}
+
+type fileUniquesRecord struct {
+	ID     string `json:"id"`
+	Day    string `json:"day"`
+	Sketch []byte `json:"sketch"`
+}
+
+func (f *fileRecord) originalLink() types.OriginalLink {
+	var preview types.Preview
+	if f.Preview != nil {
+		preview = *f.Preview
+	}
+	var deletedAt time.Time
+	if f.DeletedAt != nil {
+		deletedAt = *f.DeletedAt
+	}
+	return types.OriginalLink{
+		UserID:      f.UserID,
+		OriginalURL: f.OriginalURL,
+		Deleted:     f.Deleted,
+		DeletedAt:   deletedAt,
+		Schedule:    types.Schedule{NotBefore: f.NotBefore, NotAfter: f.NotAfter, PendingURL: f.PendingURL},
+		Targets:     f.Targets,
+		Variants:    f.Variants,
+		Preview:     preview,
+		Metadata:    f.metadata(),
+		Collection:  f.Collection,
+		Health:      f.Health,
+		Page:        f.Page,
+		CreatedAt:   f.CreatedAt,
+	}
+}
+
+// newFileRecord returns the record of the link with all attributes.
+func newFileRecord(record types.Record) *fileRecord {
+	f := &fileRecord{
+		UserID:      record.UserID,
+		ID:          record.ShortURL,
+		OriginalURL: record.OriginalURL,
+		Deleted:     record.Deleted,
+		NotBefore:   record.Schedule.NotBefore,
+		NotAfter:    record.Schedule.NotAfter,
+		PendingURL:  record.Schedule.PendingURL,
+		Targets:     record.Targets,
+		Variants:    record.Variants,
+		Title:       record.Metadata.Title,
+		Note:        record.Metadata.Note,
+		Tags:        record.Metadata.Tags,
+		Collection:  record.Collection,
+		Health:      record.Health,
+		Page:        record.Page,
+		CreatedAt:   record.CreatedAt,
+	}
+	if record.Preview != (types.Preview{}) {
+		preview := record.Preview
+		f.Preview = &preview
+	}
+	if !record.DeletedAt.IsZero() {
+		deletedAt := record.DeletedAt
+		f.DeletedAt = &deletedAt
+	}
+	return f
+}
+
+func (f *fileRecord) metadata() types.Metadata {
+	return types.Metadata{Title: f.Title, Note: f.Note, Tags: f.Tags}
+}
+
+func (f *fileRecord) link() types.Link {
+	return types.Link{ShortURL: f.ID, OriginalURL: f.OriginalURL, Collection: f.Collection, Metadata: f.metadata(), Health: f.Health, Page: f.Page}
+}
+
+// rewriteRecords applies update to every record and atomically replaces the storage file.
+// It returns true if at least one record was updated.
+func (r *FileRepository) rewriteRecords(update func(record *fileRecord) bool) (bool, error) {
+	return r.replaceRecords(func(records []*fileRecord) ([]*fileRecord, bool) {
+		updated := false
+		for _, record := range records {
+			if update(record) {
+				updated = true
+			}
+		}
+		return records, updated
+	})
+}
+
+// replaceRecords atomically replaces the storage file by records returned by replace if it reports a change.
+func (r *FileRepository) replaceRecords(replace func(records []*fileRecord) ([]*fileRecord, bool)) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var records []*fileRecord
+	err := r.readRecords(func(record *fileRecord) bool {
+		records = append(records, record)
+		return true
+	})
 	if err != nil {
-		return len(urls), len(users), err
+		return false, err
+	}
+	records, changed := replace(records)
+	if !changed {
+		return false, nil
 	}
-	defer r.ReleaseStorage()
 
-	decoder := json.NewDecoder(r.file)
+	return true, replaceFile(r.fileStoragePath, func(encoder *json.Encoder) error {
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// replaceFile atomically replaces the file at the path by lines encoded by write.
+func replaceFile(path string, write func(encoder *json.Encoder) error) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err = write(json.NewEncoder(temp)); err != nil {
+		temp.Close()
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// forEachRecord calls visit for every record of the storage file until visit returns false.
+func (r *FileRepository) forEachRecord(visit func(record *fileRecord) bool) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.readRecords(visit)
+}
+
+// readRecords reads the storage file with its own file until visit returns false. It must be called with mu locked.
+func (r *FileRepository) readRecords(visit func(record *fileRecord) bool) error {
+	file, err := os.OpenFile(r.fileStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
 	for {
 		record := &fileRecord{}
 		if err := decoder.Decode(&record); err == io.EOF {
-			break
+			return nil
 		} else if err != nil {
-			return len(urls), len(users), err
+			return err
+		}
+		if !visit(record) {
+			return nil
 		}
+	}
+}
+
+// loadShortURLS reads short urls of the storage file once, then they are updated by every write.
+// It must be called with mu locked.
+func (r *FileRepository) loadShortURLS() error {
+	if r.shortURLS != nil {
+		return nil
+	}
+	shortURLS := make(map[string]bool)
+	err := r.readRecords(func(record *fileRecord) bool {
+		shortURLS[record.ID] = true
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	r.shortURLS = shortURLS
+	return nil
+}
+
+// appendRecords appends encoded records to the storage file with one write. It must be called with mu locked.
+func (r *FileRepository) appendRecords(data []byte) error {
+	file, err := os.OpenFile(r.fileStoragePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
 
+func (r *FileRepository) GetInternalStats() (int, int, error) {
+	urls := make(map[string]string)
+	users := make(map[string]string)
+	err := r.forEachRecord(func(record *fileRecord) bool {
 		log.Printf("Record from file (GetInternalStats): %+v", record)
 		urls[record.ID] = record.OriginalURL
-		users[record.UserID] = record.ID
-	}
+		if record.UserID != "" {
+			users[record.UserID] = record.ID
+		}
+		return true
+	})
 	return len(urls), len(users), err
 }
 
+// SaveURL appends the link unless the short url already exists, short urls of purged links stay reserved.
 func (r *FileRepository) SaveURL(userID string, shortURL string, originalURL string) error {
-	var err error
-	r.file, err = os.OpenFile(r.fileStoragePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
-	if err != nil {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.loadShortURLS(); err != nil {
 		return err
 	}
-	defer r.ReleaseStorage()
+	if r.shortURLS[shortURL] {
+		return fmt.Errorf("short url %s already exists", shortURL)
+	}
 
-	encoder := json.NewEncoder(r.file)
-	err = encoder.Encode(&fileRecord{UserID: userID, ID: shortURL, OriginalURL: originalURL})
+	data, err := json.Marshal(&fileRecord{UserID: userID, ID: shortURL, OriginalURL: originalURL, CreatedAt: time.Now()})
 	if err != nil {
 		return err
 	}
+	if err = r.appendRecords(append(data, '\n')); err != nil {
+		return err
+	}
+	r.shortURLS[shortURL] = true
 	return nil
 }
 
+// GetShortURLByOriginalURL compares lookup keys of all records, so encrypted urls are found by their blind index.
+// The first record is returned if the url is saved by several short urls, purged links are skipped.
 func (r *FileRepository) GetShortURLByOriginalURL(originalURL string) (string, error) {
-	return "", nil
+	key := urlcrypt.LookupKey(originalURL)
+	var found string
+	err := r.forEachRecord(func(record *fileRecord) bool {
+		if record.UserID != "" && urlcrypt.LookupKey(record.OriginalURL) == key {
+			found = record.ID
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", ErrNotFound
+	}
+	return found, nil
 }
 
+// SaveBatchURLS appends all links or none of them if one of short urls already exists.
 func (r *FileRepository) SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.loadShortURLS(); err != nil {
+		return nil, err
+	}
+
+	batch := make(map[string]bool, len(links))
+	for _, v := range links {
+		if batch[v.ShortURL] || r.shortURLS[v.ShortURL] {
+			return nil, fmt.Errorf("short url %s already exists", v.ShortURL)
+		}
+		batch[v.ShortURL] = true
+	}
+
+	// records are encoded before writing, so the batch is appended with one write
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
 	response := make(types.ResponseBatch, len(links)) // allocate required capacity for the links
 	for i, v := range links {
+		err := encoder.Encode(&fileRecord{UserID: userID, ID: v.ShortURL, OriginalURL: v.OriginalURL,
+			Title: v.Metadata.Title, Note: v.Metadata.Note, Tags: v.Metadata.Tags, CreatedAt: time.Now()})
+		if err != nil {
+			return nil, err
+		}
 		response[i] = types.ResponseBatchJSON{CorrelationID: v.CorrelationID, ShortURL: v.ShortURL}
 	}
+	if err := r.appendRecords(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	for shortURL := range batch {
+		r.shortURLS[shortURL] = true
+	}
 	return response, nil
 }
 
+// DeleteURLS marks links of the user as deleted, links of other users are skipped.
 func (r *FileRepository) DeleteURLS(ctx context.Context, userID string, shortURLS []string) error {
+	deleted := make(map[string]bool, len(shortURLS))
+	for _, shortURL := range shortURLS {
+		deleted[shortURL] = true
+	}
+	now := time.Now()
+	_, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if !deleted[record.ID] || record.UserID != userID || record.Deleted {
+			return false
+		}
+		record.Deleted = true
+		record.DeletedAt = &now
+		return true
+	})
+	return err
+}
+
+func (r *FileRepository) RestoreURLS(userID string, shortURLS []string, deletedAfter time.Time) ([]string, error) {
+	requested := make(map[string]bool, len(shortURLS))
+	for _, shortURL := range shortURLS {
+		requested[shortURL] = true
+	}
+	var restored []string
+	_, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if link := record.originalLink(); !requested[record.ID] || !restorable(&link, userID, deletedAfter) {
+			return false
+		}
+		record.Deleted = false
+		record.DeletedAt = nil
+		restored = append(restored, record.ID)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// PurgeURLS removes purged links from the storage file, then their clicks are removed from the clicks file
+// and the rollups file.
+func (r *FileRepository) PurgeURLS(deletedBefore time.Time, reuse bool) (int, error) {
+	purged := make(map[string]bool)
+	_, err := r.replaceRecords(func(records []*fileRecord) ([]*fileRecord, bool) {
+		kept := records[:0]
+		for _, record := range records {
+			link := record.originalLink()
+			if !purgeable(&link, deletedBefore, reuse) {
+				kept = append(kept, record)
+				continue
+			}
+			purged[record.ID] = true
+			if reuse {
+				delete(r.shortURLS, record.ID)
+			} else {
+				kept = append(kept, newFileRecord(types.Record{ShortURL: record.ID, OriginalLink: purgedLink(link)}))
+			}
+		}
+		return kept, len(purged) > 0
+	})
+	if err != nil || len(purged) == 0 {
+		return 0, err
+	}
+	return len(purged), r.deleteClicks(purged)
+}
+
+// deleteClicks removes clicks, rollups and unique visitors of the short urls, rollups are loaded again on the next use.
+func (r *FileRepository) deleteClicks(shortURLS map[string]bool) error {
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+	clicks, err := r.readClicks()
+	if err != nil {
+		return err
+	}
+	kept := clicks[:0]
+	for _, record := range clicks {
+		if !shortURLS[record.ID] {
+			kept = append(kept, record)
+		}
+	}
+	if err = writeClicks(r.clicksPath(), kept); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(r.rollupsPath(), os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	var rollups []*fileRollupRecord
+	decoder := json.NewDecoder(file)
+	for {
+		record := &fileRollupRecord{}
+		if err = decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			file.Close()
+			return err
+		}
+		if (record.Bucket != nil && shortURLS[record.Bucket.Key.ShortURL]) || (record.Uniques != nil && shortURLS[record.Uniques.ID]) {
+			continue
+		}
+		rollups = append(rollups, record)
+	}
+	file.Close()
+
+	r.rollups = nil
+	r.uniques = nil
+	return replaceFile(r.rollupsPath(), func(encoder *json.Encoder) error {
+		for _, record := range rollups {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *FileRepository) SetSchedule(userID string, shortURL string, schedule types.Schedule) error {
+	updated, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if record.ID != shortURL || record.UserID != userID {
+			return false
+		}
+		record.NotBefore = schedule.NotBefore
+		record.NotAfter = schedule.NotAfter
+		record.PendingURL = schedule.PendingURL
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrNotFound
+	}
 	return nil
 }
 
-func (r *FileRepository) GetURL(shortURL string) (types.OriginalLink, error) {
-	var err error
-	r.file, err = os.OpenFile(r.fileStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
+func (r *FileRepository) SetTargets(userID string, shortURL string, targets []types.TargetRule) error {
+	updated, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if record.ID != shortURL || record.UserID != userID {
+			return false
+		}
+		record.Targets = targets
+		return true
+	})
 	if err != nil {
-		return types.OriginalLink{}, err
+		return err
+	}
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *FileRepository) SetVariants(userID string, shortURL string, variants []types.Variant) error {
+	updated, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if record.ID != shortURL || record.UserID != userID {
+			return false
+		}
+		record.Variants = variants
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *FileRepository) SetPreview(userID string, shortURL string, preview types.Preview) error {
+	updated, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if record.ID != shortURL || record.UserID != userID {
+			return false
+		}
+		record.Preview = &preview
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *FileRepository) SetMetadata(userID string, shortURL string, metadata types.Metadata) error {
+	updated, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if record.ID != shortURL || record.UserID != userID {
+			return false
+		}
+		record.Title = metadata.Title
+		record.Note = metadata.Note
+		record.Tags = metadata.Tags
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *FileRepository) ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error {
+	updated, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if record.ID != shortURL || record.OriginalURL != oldURL {
+			return false
+		}
+		record.OriginalURL = newURL
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *FileRepository) SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error) {
+	var links []types.Link
+	err := r.forEachRecord(func(record *fileRecord) bool {
+		if record.UserID == userID && matchesQuery(record.link(), query) {
+			links = append(links, record.link())
+		}
+		return true
+	})
+	return links, err
+}
+
+// collectionsPath returns path of the file with collections next to the storage file.
+func (r *FileRepository) collectionsPath() string {
+	return r.fileStoragePath + ".collections"
+}
+
+func (r *FileRepository) readCollections() ([]fileCollectionRecord, error) {
+	file, err := os.OpenFile(r.collectionsPath(), os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return nil, err
 	}
-	defer r.ReleaseStorage()
+	defer file.Close()
 
-	decoder := json.NewDecoder(r.file)
+	var records []fileCollectionRecord
+	decoder := json.NewDecoder(file)
 	for {
-		record := &fileRecord{}
+		var record fileCollectionRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// userCollections returns collections of the user without number of links.
+func (r *FileRepository) userCollections(userID string) ([]types.Collection, error) {
+	records, err := r.readCollections()
+	if err != nil {
+		return nil, err
+	}
+	var collections []types.Collection
+	for _, record := range records {
+		if record.UserID == userID {
+			collections = append(collections, types.Collection{ID: record.ID, Name: record.Name})
+		}
+	}
+	return collections, nil
+}
+
+func (r *FileRepository) CreateCollection(userID string, collection types.Collection) error {
+	collections, err := r.userCollections(userID)
+	if err != nil {
+		return err
+	}
+	if hasCollectionName(collections, collection.Name) {
+		return errors.New("collection already exists")
+	}
+
+	file, err := os.OpenFile(r.collectionsPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	return encoder.Encode(&fileCollectionRecord{UserID: userID, ID: collection.ID, Name: collection.Name})
+}
+
+func (r *FileRepository) GetCollections(userID string) ([]types.Collection, error) {
+	collections, err := r.userCollections(userID)
+	if err != nil {
+		return nil, err
+	}
+	err = r.forEachRecord(func(record *fileRecord) bool {
+		if record.UserID != userID || record.Deleted {
+			return true
+		}
+		if i := findCollection(collections, record.Collection); i >= 0 {
+			collections[i].Links++
+		}
+		return true
+	})
+	return collections, err
+}
+
+func (r *FileRepository) DeleteCollection(userID string, collectionID string) error {
+	records, err := r.readCollections()
+	if err != nil {
+		return err
+	}
+	found := false
+	var kept []fileCollectionRecord
+	for _, record := range records {
+		if record.UserID == userID && record.ID == collectionID {
+			found = true
+			continue
+		}
+		kept = append(kept, record)
+	}
+	if !found {
+		return errors.New("collection not found")
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(r.collectionsPath()), filepath.Base(r.collectionsPath())+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	encoder := json.NewEncoder(temp)
+	for _, record := range kept {
+		if err = encoder.Encode(&record); err != nil {
+			temp.Close()
+			return err
+		}
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(temp.Name(), r.collectionsPath()); err != nil {
+		return err
+	}
+
+	_, err = r.rewriteRecords(func(record *fileRecord) bool {
+		if record.UserID != userID || record.Collection != collectionID {
+			return false
+		}
+		record.Collection = ""
+		return true
+	})
+	return err
+}
+
+func (r *FileRepository) MoveURLS(userID string, collectionID string, shortURLS []string) error {
+	collections, err := r.userCollections(userID)
+	if err != nil {
+		return err
+	}
+	if findCollection(collections, collectionID) < 0 {
+		return errors.New("collection not found")
+	}
+
+	updated, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if record.UserID != userID || !contains(shortURLS, record.ID) {
+			return false
+		}
+		record.Collection = collectionID
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *FileRepository) GetCollectionURLS(userID string, collectionID string, limit int, offset int) ([]types.Link, int, error) {
+	collections, err := r.userCollections(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if findCollection(collections, collectionID) < 0 {
+		return nil, 0, errors.New("collection not found")
+	}
+
+	var links []types.Link
+	err = r.forEachRecord(func(record *fileRecord) bool {
+		if record.UserID == userID && !record.Deleted && record.Collection == collectionID {
+			links = append(links, record.link())
+		}
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return pageLinks(links, limit, offset), len(links), nil
+}
+
+func (r *FileRepository) SaveHealth(results map[string]types.Health) error {
+	_, err := r.rewriteRecords(func(record *fileRecord) bool {
+		health, ok := results[record.ID]
+		if !ok {
+			return false
+		}
+		record.Health = &health
+		return true
+	})
+	return err
+}
+
+func (r *FileRepository) GetHealthCheckURLS(checkedBefore time.Time, limit int) ([]types.Link, error) {
+	var links []types.Link
+	err := r.forEachRecord(func(record *fileRecord) bool {
+		if !record.Deleted && needsHealthCheck(record.Health, checkedBefore) {
+			links = append(links, types.Link{ShortURL: record.ID, OriginalURL: record.OriginalURL, Health: record.Health})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return oldestChecks(links, limit), nil
+}
+
+func (r *FileRepository) SavePage(shortURL string, page types.Page) error {
+	updated, err := r.rewriteRecords(func(record *fileRecord) bool {
+		if record.ID != shortURL {
+			return false
+		}
+		record.Page = &page
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// clicksPath returns path of the file with clicks next to the storage file.
+func (r *FileRepository) clicksPath() string {
+	return r.fileStoragePath + ".clicks"
+}
+
+// rollupsPath returns path of the file with rollups of purged clicks next to the storage file.
+func (r *FileRepository) rollupsPath() string {
+	return r.fileStoragePath + ".rollups"
+}
+
+// click returns the click, owners are used for clicks saved before rollups without the owner.
+func (c *fileClickRecord) click(owners map[string]string) types.Click {
+	click := types.Click{UserID: c.UserID, ShortURL: c.ID, Variant: c.Variant, Country: c.Country, Referrer: c.Referrer,
+		Bot: c.Bot, Class: c.Class, Time: c.Time}
+	if click.UserID == "" {
+		click.UserID = owners[c.ID]
+	}
+	return click
+}
+
+// owners returns owners of short urls.
+func (r *FileRepository) owners() (map[string]string, error) {
+	owners := make(map[string]string)
+	err := r.forEachRecord(func(record *fileRecord) bool {
+		owners[record.ID] = record.UserID
+		return true
+	})
+	return owners, err
+}
+
+func (c *fileClickRecord) addUnique(uniques map[string]hll.Days) {
+	if c.Rank == 0 {
+		return
+	}
+	days, ok := uniques[c.ID]
+	if !ok {
+		days = make(hll.Days)
+		uniques[c.ID] = days
+	}
+	days.Set(c.Time.UTC().Format(types.DayLayout), c.Register, c.Rank)
+}
+
+// readClicks returns all clicks of the clicks file.
+func (r *FileRepository) readClicks() ([]*fileClickRecord, error) {
+	file, err := os.OpenFile(r.clicksPath(), os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*fileClickRecord
+	decoder := json.NewDecoder(file)
+	for {
+		record := &fileClickRecord{}
+		if err := decoder.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// loadRollups builds rollups and unique visitors from the rollups file and the clicks file once,
+// then they are updated by every saved click. It must be called with clicksMu locked.
+func (r *FileRepository) loadRollups() error {
+	if r.rollups != nil {
+		return nil
+	}
+	table := rollup.NewTable()
+	uniques := make(map[string]hll.Days)
+
+	file, err := os.OpenFile(r.rollupsPath(), os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	for {
+		record := &fileRollupRecord{}
 		if err := decoder.Decode(&record); err == io.EOF {
 			break
 		} else if err != nil {
-			return types.OriginalLink{}, err
+			return err
 		}
+		if record.Bucket != nil {
+			table.AddBucket(*record.Bucket)
+		}
+		if record.Uniques != nil {
+			sketch := hll.New()
+			if err = sketch.UnmarshalBinary(record.Uniques.Sketch); err != nil {
+				return err
+			}
+			if _, ok := uniques[record.Uniques.ID]; !ok {
+				uniques[record.Uniques.ID] = make(hll.Days)
+			}
+			uniques[record.Uniques.ID].Merge(record.Uniques.Day, sketch)
+		}
+	}
 
+	clicks, err := r.readClicks()
+	if err != nil {
+		return err
+	}
+	owners, err := r.owners()
+	if err != nil {
+		return err
+	}
+	for _, record := range clicks {
+		table.Add(record.click(owners), 1)
+		record.addUnique(uniques)
+	}
+
+	r.rollups = table
+	r.uniques = uniques
+	return nil
+}
+
+// SaveClicks appends clicks to the file of clicks with one write.
+func (r *FileRepository) SaveClicks(clicks []types.Click) error {
+	var data bytes.Buffer
+	records := make([]*fileClickRecord, len(clicks))
+	encoder := json.NewEncoder(&data)
+	for i, click := range clicks {
+		records[i] = &fileClickRecord{UserID: click.UserID, ID: click.ShortURL, Variant: click.Variant,
+			Country: click.Country, Referrer: click.Referrer, Bot: click.Bot, Class: click.Class, Time: click.Time}
+		if click.Visitor != 0 {
+			records[i].Register, records[i].Rank = hll.Position(click.Visitor)
+		}
+		if err := encoder.Encode(records[i]); err != nil {
+			return err
+		}
+	}
+
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+	file, err := os.OpenFile(r.clicksPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Write(data.Bytes()); err != nil {
+		return err
+	}
+
+	if r.rollups != nil {
+		for i, click := range clicks {
+			r.rollups.Add(click, 1)
+			records[i].addUnique(r.uniques)
+		}
+	}
+	return nil
+}
+
+func (r *FileRepository) GetClickStats(shortURL string, includeBots bool) (types.ClickStats, error) {
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+	if err := r.loadRollups(); err != nil {
+		return types.NewClickStats(), err
+	}
+	stats := r.rollups.Stats(shortURL, includeBots)
+	stats.Uniques, stats.UniquesByDay = r.uniques[shortURL].Estimates()
+	return stats, nil
+}
+
+func (r *FileRepository) GetClickReport(query types.ReportQuery) ([]types.ReportItem, error) {
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+	if err := r.loadRollups(); err != nil {
+		return nil, err
+	}
+	return r.rollups.Report(query), nil
+}
+
+// PurgeClicks appends rollups and unique visitors of clicks saved before the time to the rollups file
+// and removes the clicks from the clicks file.
+func (r *FileRepository) PurgeClicks(before time.Time) (int, error) {
+	r.clicksMu.Lock()
+	defer r.clicksMu.Unlock()
+	if err := r.loadRollups(); err != nil {
+		return 0, err
+	}
+	clicks, err := r.readClicks()
+	if err != nil {
+		return 0, err
+	}
+	owners, err := r.owners()
+	if err != nil {
+		return 0, err
+	}
+
+	var kept []*fileClickRecord
+	purged := rollup.NewTable()
+	uniques := make(map[string]hll.Days)
+	count := 0
+	for _, record := range clicks {
+		if !record.Time.Before(before) {
+			kept = append(kept, record)
+			continue
+		}
+		purged.Add(record.click(owners), 1)
+		record.addUnique(uniques)
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	if err = r.appendRollups(purged.Buckets(), uniques); err != nil {
+		return 0, err
+	}
+
+	return count, writeClicks(r.clicksPath(), kept)
+}
+
+func writeClicks(path string, clicks []*fileClickRecord) error {
+	return replaceFile(path, func(encoder *json.Encoder) error {
+		for _, record := range clicks {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *FileRepository) appendRollups(buckets []rollup.Bucket, uniques map[string]hll.Days) error {
+	file, err := os.OpenFile(r.rollupsPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for i := range buckets {
+		if err = encoder.Encode(&fileRollupRecord{Bucket: &buckets[i]}); err != nil {
+			return err
+		}
+	}
+	for shortURL, days := range uniques {
+		for day, sketch := range days {
+			data, err := sketch.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if err = encoder.Encode(&fileRollupRecord{Uniques: &fileUniquesRecord{ID: shortURL, Day: day, Sketch: data}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *FileRepository) GetURL(shortURL string) (types.OriginalLink, error) {
+	var found *fileRecord
+	err := r.forEachRecord(func(record *fileRecord) bool {
 		log.Printf("Record from file (get): %+v", record)
 		if record.ID == shortURL {
-			return types.OriginalLink{OriginalURL: record.OriginalURL, Deleted: false}, nil
+			found = record
+			return false
 		}
+		return true
+	})
+	if err != nil {
+		return types.OriginalLink{}, err
+	}
+	if found == nil {
+		return types.OriginalLink{}, ErrNotFound
 	}
-	return types.OriginalLink{}, errors.New("ID not found")
+	return found.originalLink(), nil
 }
 
 func (r *FileRepository) GetUserStorage(userID string) ([]types.Link, error) {
 	var links []types.Link
-	var err error
-	r.file, err = os.OpenFile(r.fileStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
+	err := r.forEachRecord(func(record *fileRecord) bool {
+		log.Printf("Record from file (getUserStorage): %+v", record)
+		if record.UserID == userID {
+			links = append(links, record.link())
+		}
+		return true
+	})
+	return links, err
+}
+
+// ExportUserURLS decodes the storage file record by record with its own file, so concurrent requests are not blocked.
+func (r *FileRepository) ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error {
+	r.clicksMu.Lock()
+	err := r.loadRollups()
+	rollups := r.rollups
+	r.clicksMu.Unlock()
 	if err != nil {
-		return links, err
+		return err
 	}
-	defer r.ReleaseStorage()
 
-	decoder := json.NewDecoder(r.file)
+	file, err := os.OpenFile(r.fileStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		record := &fileRecord{}
 		if err := decoder.Decode(&record); err == io.EOF {
-			break
+			return nil
 		} else if err != nil {
-			return links, err
+			return err
 		}
+		if record.UserID != userID || record.Deleted {
+			continue
+		}
+		link := types.ExportLink{Link: record.link(), CreatedAt: record.CreatedAt, Clicks: rollups.Total(record.ID)}
+		if err := visit(link); err != nil {
+			return err
+		}
+	}
+}
 
-		log.Printf("Record from file (getUserStorage): %+v", record)
-		if record.UserID == userID {
-			links = append(links, types.Link{ShortURL: record.ID, OriginalURL: record.OriginalURL})
+// ForEachRecord decodes the storage file record by record with its own file, so concurrent requests are not blocked.
+func (r *FileRepository) ForEachRecord(ctx context.Context, visit func(record types.Record) error) error {
+	file, err := os.OpenFile(r.fileStoragePath, os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record := &fileRecord{}
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := visit(types.Record{ShortURL: record.ID, OriginalLink: record.originalLink()}); err != nil {
+			return err
 		}
 	}
-	return links, nil
+}
+
+// SaveRecords appends records with new short urls with one write.
+func (r *FileRepository) SaveRecords(records []types.Record) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.loadShortURLS(); err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	saved := make(map[string]bool, len(records))
+	for _, record := range records {
+		if r.shortURLS[record.ShortURL] || saved[record.ShortURL] {
+			continue
+		}
+		saved[record.ShortURL] = true
+		if err := encoder.Encode(newFileRecord(record)); err != nil {
+			return 0, err
+		}
+	}
+	if err := r.appendRecords(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	for shortURL := range saved {
+		r.shortURLS[shortURL] = true
+	}
+	return len(saved), nil
+}
+
+func (r *FileRepository) GetAllCollections() ([]types.CollectionRecord, error) {
+	records, err := r.readCollections()
+	if err != nil {
+		return nil, err
+	}
+	collections := make([]types.CollectionRecord, len(records))
+	for i, record := range records {
+		collections[i] = types.CollectionRecord{UserID: record.UserID, Collection: types.Collection{ID: record.ID, Name: record.Name}}
+	}
+	return collections, nil
 }
 
 func (r *FileRepository) Ping() bool {
 	return true
 }
 
+// ReleaseStorage has nothing to release, every operation closes its own file.
 func (r *FileRepository) ReleaseStorage() {
 	log.Println("Storage released")
-	err := r.file.Close()
-	if err != nil && !errors.Is(err, fs.ErrClosed) {
-		log.Fatalf("Failed to release file storage. Error: %v", err.Error())
-	}
 }
 
 // NewFileRepository returns a new FileRepository.
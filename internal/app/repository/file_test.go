@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"go-developer-course-shortener/internal/app/types"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileRepositoryConcurrentAccess(t *testing.T) {
+	storage := NewFileRepository(filepath.Join(t.TempDir(), "shortener.json"))
+	defer storage.ReleaseStorage()
+	require.NoError(t, storage.SaveURL("user1", "a", "https://a.example"))
+
+	// rewrites of the file must not break concurrent reads and appends
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := strconv.Itoa(i)
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, storage.SaveURL("user1", id+"-"+strconv.Itoa(j), "https://example.com/"+id))
+				assert.NoError(t, storage.SetMetadata("user1", "a", types.Metadata{Title: id}))
+				assert.NoError(t, storage.SaveHealth(map[string]types.Health{"a": {StatusCode: 200, CheckedAt: time.Now()}}))
+				_, err := storage.GetURL("a")
+				assert.NoError(t, err)
+				_, err = storage.GetUserStorage("user1")
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	urls, users, err := storage.GetInternalStats()
+	require.NoError(t, err)
+	assert.Equal(t, 81, urls)
+	assert.Equal(t, 1, users)
+
+	// short urls are unique without scanning the file
+	assert.Error(t, storage.SaveURL("user2", "a", "https://x.example"))
+	_, err = storage.SaveBatchURLS("user2", types.BatchLinks{{ShortURL: "0-0", OriginalURL: "https://x.example"}})
+	assert.Error(t, err)
+	saved, err := storage.SaveRecords([]types.Record{{ShortURL: "a"}, {ShortURL: "b", OriginalLink: types.OriginalLink{UserID: "user2"}}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, saved)
+	assert.Error(t, storage.SaveURL("user2", "b", "https://x.example"))
+}
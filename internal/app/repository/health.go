@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"go-developer-course-shortener/internal/app/types"
+	"sort"
+	"time"
+)
+
+// needsHealthCheck reports whether the link was never checked or checked before the time.
+func needsHealthCheck(health *types.Health, checkedBefore time.Time) bool {
+	return health == nil || health.CheckedAt.Before(checkedBefore)
+}
+
+// oldestChecks returns up to limit links, never checked links go first, then the oldest checks.
+func oldestChecks(links []types.Link, limit int) []types.Link {
+	sort.SliceStable(links, func(i, j int) bool {
+		if links[i].Health == nil || links[j].Health == nil {
+			return links[i].Health == nil && links[j].Health != nil
+		}
+		return links[i].Health.CheckedAt.Before(links[j].Health.CheckedAt)
+	})
+	return pageLinks(links, limit, 0)
+}
@@ -3,54 +3,409 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/hll"
+	"go-developer-course-shortener/internal/app/rollup"
 	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/app/urlcrypt"
 	"log"
+	"sort"
+	"sync"
+	"time"
 )
 
 // InMemoryRepository implements Repository interface
 type InMemoryRepository struct {
-	inMemoryMap         map[string]string
+	mu                  sync.RWMutex
+	inMemoryMap         map[string]*inMemoryLink
 	inMemoryUserStorage map[string][]string
+	clicks              *rollup.Table
+	uniques             map[string]hll.Days
+	collections         map[string][]types.Collection
+
+	// snapshotMu serializes writes of snapshots, snapshotPath is the snapshot written by ReleaseStorage
+	snapshotMu   sync.Mutex
+	snapshotPath string
+}
+
+type inMemoryLink struct {
+	userID string
+	link   types.OriginalLink
+}
+
+func (l *inMemoryLink) toLink(shortURL string) types.Link {
+	return types.Link{ShortURL: shortURL, OriginalURL: l.link.OriginalURL, Collection: l.link.Collection,
+		Metadata: l.link.Metadata, Health: l.link.Health, Page: l.link.Page}
 }
 
 // check that InMemoryRepository implements all required methods
 var _ Repository = (*InMemoryRepository)(nil)
 
 func (r *InMemoryRepository) GetInternalStats() (int, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return len(r.inMemoryMap), len(r.inMemoryUserStorage), nil
 }
 
+// SaveURL saves the link unless the short url already exists, short urls of purged links stay reserved.
 func (r *InMemoryRepository) SaveURL(userID string, shortURL string, originalURL string) error {
-	r.inMemoryMap[shortURL] = originalURL
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.inMemoryMap[shortURL]; ok {
+		return fmt.Errorf("short url %s already exists", shortURL)
+	}
+	r.inMemoryMap[shortURL] = &inMemoryLink{userID: userID, link: types.OriginalLink{UserID: userID, OriginalURL: originalURL, CreatedAt: time.Now()}}
 	r.inMemoryUserStorage[userID] = append(r.inMemoryUserStorage[userID], shortURL)
 	return nil
 }
 
+// GetShortURLByOriginalURL compares lookup keys of all links, so encrypted urls are found by their blind index.
+// The oldest link is returned if the url is saved by several short urls, purged links are skipped.
 func (r *InMemoryRepository) GetShortURLByOriginalURL(originalURL string) (string, error) {
-	return "", nil
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key := urlcrypt.LookupKey(originalURL)
+	var found string
+	var createdAt time.Time
+	for shortURL, v := range r.inMemoryMap {
+		if v.userID == "" || urlcrypt.LookupKey(v.link.OriginalURL) != key {
+			continue
+		}
+		if found == "" || v.link.CreatedAt.Before(createdAt) || v.link.CreatedAt.Equal(createdAt) && shortURL < found {
+			found, createdAt = shortURL, v.link.CreatedAt
+		}
+	}
+	if found == "" {
+		return "", ErrNotFound
+	}
+	return found, nil
 }
 
+// DeleteURLS marks links of the user as deleted, links of other users are skipped.
 func (r *InMemoryRepository) DeleteURLS(ctx context.Context, userID string, shortURLS []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, shortURL := range shortURLS {
+		if v, ok := r.inMemoryMap[shortURL]; ok && v.userID == userID && !v.link.Deleted {
+			v.link.Deleted = true
+			v.link.DeletedAt = now
+		}
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) RestoreURLS(userID string, shortURLS []string, deletedAfter time.Time) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var restored []string
+	for _, shortURL := range shortURLS {
+		if v, ok := r.inMemoryMap[shortURL]; ok && restorable(&v.link, userID, deletedAfter) {
+			v.link.Deleted = false
+			v.link.DeletedAt = time.Time{}
+			restored = append(restored, shortURL)
+		}
+	}
+	return restored, nil
+}
+
+// PurgeURLS removes purged links from the links of their users and drops their rollups and unique visitors.
+func (r *InMemoryRepository) PurgeURLS(deletedBefore time.Time, reuse bool) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var purged []string
+	for id, v := range r.inMemoryMap {
+		if !purgeable(&v.link, deletedBefore, reuse) {
+			continue
+		}
+		if v.userID != "" {
+			r.inMemoryUserStorage[v.userID] = removeShortURL(r.inMemoryUserStorage[v.userID], id)
+			if len(r.inMemoryUserStorage[v.userID]) == 0 {
+				delete(r.inMemoryUserStorage, v.userID)
+			}
+		}
+		if reuse {
+			delete(r.inMemoryMap, id)
+		} else {
+			r.inMemoryMap[id] = &inMemoryLink{link: purgedLink(v.link)}
+		}
+		delete(r.uniques, id)
+		purged = append(purged, id)
+	}
+	r.clicks.Delete(purged...)
+	return len(purged), nil
+}
+
+func (r *InMemoryRepository) SetSchedule(userID string, shortURL string, schedule types.Schedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.inMemoryMap[shortURL]
+	if !ok || v.userID != userID {
+		return ErrNotFound
+	}
+	v.link.Schedule = schedule
+	return nil
+}
+
+func (r *InMemoryRepository) SetTargets(userID string, shortURL string, targets []types.TargetRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.inMemoryMap[shortURL]
+	if !ok || v.userID != userID {
+		return ErrNotFound
+	}
+	v.link.Targets = targets
+	return nil
+}
+
+func (r *InMemoryRepository) SetVariants(userID string, shortURL string, variants []types.Variant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.inMemoryMap[shortURL]
+	if !ok || v.userID != userID {
+		return ErrNotFound
+	}
+	v.link.Variants = variants
+	return nil
+}
+
+func (r *InMemoryRepository) SetPreview(userID string, shortURL string, preview types.Preview) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.inMemoryMap[shortURL]
+	if !ok || v.userID != userID {
+		return ErrNotFound
+	}
+	v.link.Preview = preview
+	return nil
+}
+
+func (r *InMemoryRepository) SetMetadata(userID string, shortURL string, metadata types.Metadata) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.inMemoryMap[shortURL]
+	if !ok || v.userID != userID {
+		return ErrNotFound
+	}
+	v.link.Metadata = metadata
+	return nil
+}
+
+func (r *InMemoryRepository) ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.inMemoryMap[shortURL]
+	if !ok || v.link.OriginalURL != oldURL {
+		return ErrNotFound
+	}
+	v.link.OriginalURL = newURL
+	return nil
+}
+
+func (r *InMemoryRepository) SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var links []types.Link
+	for _, id := range r.inMemoryUserStorage[userID] {
+		v, ok := r.inMemoryMap[id]
+		if !ok {
+			continue
+		}
+		link := v.toLink(id)
+		if matchesQuery(link, query) {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (r *InMemoryRepository) CreateCollection(userID string, collection types.Collection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if hasCollectionName(r.collections[userID], collection.Name) {
+		return errors.New("collection already exists")
+	}
+	collection.Links = 0
+	r.collections[userID] = append(r.collections[userID], collection)
+	return nil
+}
+
+func (r *InMemoryRepository) GetCollections(userID string) ([]types.Collection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	collections := make([]types.Collection, len(r.collections[userID]))
+	copy(collections, r.collections[userID])
+	for _, id := range r.inMemoryUserStorage[userID] {
+		if v, ok := r.inMemoryMap[id]; ok && !v.link.Deleted {
+			if i := findCollection(collections, v.link.Collection); i >= 0 {
+				collections[i].Links++
+			}
+		}
+	}
+	return collections, nil
+}
+
+func (r *InMemoryRepository) DeleteCollection(userID string, collectionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	collections := r.collections[userID]
+	i := findCollection(collections, collectionID)
+	if i < 0 {
+		return errors.New("collection not found")
+	}
+	r.collections[userID] = append(collections[:i:i], collections[i+1:]...)
+	for _, id := range r.inMemoryUserStorage[userID] {
+		if v, ok := r.inMemoryMap[id]; ok && v.link.Collection == collectionID {
+			v.link.Collection = ""
+		}
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) MoveURLS(userID string, collectionID string, shortURLS []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if findCollection(r.collections[userID], collectionID) < 0 {
+		return errors.New("collection not found")
+	}
+	moved := false
+	for _, shortURL := range shortURLS {
+		if v, ok := r.inMemoryMap[shortURL]; ok && v.userID == userID {
+			v.link.Collection = collectionID
+			moved = true
+		}
+	}
+	if !moved {
+		return ErrNotFound
+	}
 	return nil
 }
 
+func (r *InMemoryRepository) GetCollectionURLS(userID string, collectionID string, limit int, offset int) ([]types.Link, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if findCollection(r.collections[userID], collectionID) < 0 {
+		return nil, 0, errors.New("collection not found")
+	}
+	var links []types.Link
+	for _, id := range r.inMemoryUserStorage[userID] {
+		if v, ok := r.inMemoryMap[id]; ok && !v.link.Deleted && v.link.Collection == collectionID {
+			links = append(links, v.toLink(id))
+		}
+	}
+	return pageLinks(links, limit, offset), len(links), nil
+}
+
+func (r *InMemoryRepository) SaveHealth(results map[string]types.Health) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for shortURL, health := range results {
+		if v, ok := r.inMemoryMap[shortURL]; ok {
+			health := health
+			v.link.Health = &health
+		}
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) GetHealthCheckURLS(checkedBefore time.Time, limit int) ([]types.Link, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var links []types.Link
+	for id, v := range r.inMemoryMap {
+		if !v.link.Deleted && needsHealthCheck(v.link.Health, checkedBefore) {
+			links = append(links, types.Link{ShortURL: id, OriginalURL: v.link.OriginalURL, Health: v.link.Health})
+		}
+	}
+	return oldestChecks(links, limit), nil
+}
+
+func (r *InMemoryRepository) SavePage(shortURL string, page types.Page) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.inMemoryMap[shortURL]
+	if !ok {
+		return ErrNotFound
+	}
+	v.link.Page = &page
+	return nil
+}
+
+// SaveClicks adds clicks to rollups, single clicks are not kept.
+func (r *InMemoryRepository) SaveClicks(clicks []types.Click) error {
+	for _, click := range clicks {
+		r.clicks.Add(click, 1)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, click := range clicks {
+		if click.Visitor == 0 {
+			continue
+		}
+		days, ok := r.uniques[click.ShortURL]
+		if !ok {
+			days = make(hll.Days)
+			r.uniques[click.ShortURL] = days
+		}
+		register, rank := hll.Position(click.Visitor)
+		days.Set(click.Time.UTC().Format(types.DayLayout), register, rank)
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) GetClickStats(shortURL string, includeBots bool) (types.ClickStats, error) {
+	stats := r.clicks.Stats(shortURL, includeBots)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stats.Uniques, stats.UniquesByDay = r.uniques[shortURL].Estimates()
+	return stats, nil
+}
+
+func (r *InMemoryRepository) GetClickReport(query types.ReportQuery) ([]types.ReportItem, error) {
+	return r.clicks.Report(query), nil
+}
+
+// PurgeClicks does nothing, single clicks are not kept in memory.
+func (r *InMemoryRepository) PurgeClicks(before time.Time) (int, error) {
+	return 0, nil
+}
+
+// SaveBatchURLS saves all links or none of them if one of short urls already exists.
 func (r *InMemoryRepository) SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	batch := make(map[string]bool, len(links))
+	for _, v := range links {
+		if _, ok := r.inMemoryMap[v.ShortURL]; ok || batch[v.ShortURL] {
+			return nil, fmt.Errorf("short url %s already exists", v.ShortURL)
+		}
+		batch[v.ShortURL] = true
+	}
+
 	response := make(types.ResponseBatch, len(links)) // allocate required capacity for the links
 	for i, v := range links {
+		r.inMemoryMap[v.ShortURL] = &inMemoryLink{userID: userID, link: types.OriginalLink{UserID: userID, OriginalURL: v.OriginalURL,
+			Metadata: v.Metadata, CreatedAt: time.Now()}}
+		r.inMemoryUserStorage[userID] = append(r.inMemoryUserStorage[userID], v.ShortURL)
 		response[i] = types.ResponseBatchJSON{CorrelationID: v.CorrelationID, ShortURL: v.ShortURL}
 	}
 	return response, nil
 }
 
 func (r *InMemoryRepository) GetURL(shortURL string) (types.OriginalLink, error) {
-	URL, ok := r.inMemoryMap[shortURL]
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.inMemoryMap[shortURL]
 	if !ok {
-		return types.OriginalLink{}, errors.New("ID not found")
+		return types.OriginalLink{}, ErrNotFound
 	}
-	return types.OriginalLink{OriginalURL: URL, Deleted: false}, nil
+	return v.link, nil
 }
 
 func (r *InMemoryRepository) GetUserStorage(userID string) ([]types.Link, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	ids, ok := r.inMemoryUserStorage[userID]
 	if !ok {
 		return nil, errors.New("UserID not found")
@@ -58,26 +413,138 @@ func (r *InMemoryRepository) GetUserStorage(userID string) ([]types.Link, error)
 
 	links := make([]types.Link, len(ids)) // allocate required capacity for the links
 	for i, v := range ids {
-		URL, ok := r.inMemoryMap[v]
+		l, ok := r.inMemoryMap[v]
 		if !ok {
-			return links, errors.New("ID not found")
+			return links, ErrNotFound
 		}
-		links[i] = types.Link{ShortURL: v, OriginalURL: URL}
+		links[i] = l.toLink(v)
 	}
 	return links, nil
 }
 
+// ExportUserURLS copies only short urls of the user, links are read one by one without holding the lock during visit.
+func (r *InMemoryRepository) ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error {
+	r.mu.RLock()
+	ids := append([]string(nil), r.inMemoryUserStorage[userID]...)
+	r.mu.RUnlock()
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r.mu.RLock()
+		l, ok := r.inMemoryMap[id]
+		ok = ok && !l.link.Deleted
+		var link types.ExportLink
+		if ok {
+			link = types.ExportLink{Link: l.toLink(id), CreatedAt: l.link.CreatedAt}
+		}
+		r.mu.RUnlock()
+		if !ok {
+			continue
+		}
+
+		link.Clicks = r.clicks.Total(id)
+		if err := visit(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachRecord copies only short urls, links are read one by one without holding the lock during visit.
+func (r *InMemoryRepository) ForEachRecord(ctx context.Context, visit func(record types.Record) error) error {
+	r.mu.RLock()
+	ids := make([]string, 0, len(r.inMemoryMap))
+	for id := range r.inMemoryMap {
+		ids = append(ids, id)
+	}
+	r.mu.RUnlock()
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r.mu.RLock()
+		l, ok := r.inMemoryMap[id]
+		var record types.Record
+		if ok {
+			record = types.Record{ShortURL: id, OriginalLink: l.link}
+		}
+		r.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := visit(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) SaveRecords(records []types.Record) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saved := 0
+	for _, record := range records {
+		if _, ok := r.inMemoryMap[record.ShortURL]; ok {
+			continue
+		}
+		r.inMemoryMap[record.ShortURL] = &inMemoryLink{userID: record.UserID, link: record.OriginalLink}
+		if record.UserID != "" {
+			r.inMemoryUserStorage[record.UserID] = append(r.inMemoryUserStorage[record.UserID], record.ShortURL)
+		}
+		saved++
+	}
+	return saved, nil
+}
+
+func (r *InMemoryRepository) GetAllCollections() ([]types.CollectionRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var records []types.CollectionRecord
+	for userID, collections := range r.collections {
+		for _, collection := range collections {
+			records = append(records, types.CollectionRecord{UserID: userID, Collection: collection})
+		}
+	}
+	return records, nil
+}
+
 func (r *InMemoryRepository) Ping() bool {
 	return true
 }
 
+// ReleaseStorage writes the final snapshot if the storage was created by NewSnapshotRepository.
 func (r *InMemoryRepository) ReleaseStorage() {
+	if r.snapshotPath != "" {
+		if err := r.WriteSnapshot(r.snapshotPath); err != nil {
+			log.Printf("Failed to write memory snapshot. Error: %v", err.Error())
+		}
+	}
 	log.Println("Storage released")
-	// no need to release in memory storage
 }
 
 // NewInMemoryRepository returns a new InMemoryRepository.
 func NewInMemoryRepository() *InMemoryRepository {
 	log.Print("Memory storage is used")
-	return &InMemoryRepository{inMemoryMap: make(map[string]string), inMemoryUserStorage: make(map[string][]string)}
+	return &InMemoryRepository{
+		inMemoryMap:         make(map[string]*inMemoryLink),
+		inMemoryUserStorage: make(map[string][]string),
+		clicks:              rollup.NewTable(),
+		uniques:             make(map[string]hll.Days),
+		collections:         make(map[string][]types.Collection),
+	}
+}
+
+// NewSnapshotRepository returns a new InMemoryRepository restored from the snapshot at the path.
+// The final snapshot is written to the path by ReleaseStorage.
+func NewSnapshotRepository(path string) (*InMemoryRepository, error) {
+	r := NewInMemoryRepository()
+	if err := r.RestoreSnapshot(path); err != nil {
+		return nil, err
+	}
+	r.snapshotPath = path
+	return r, nil
 }
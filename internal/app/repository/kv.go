@@ -0,0 +1,1191 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/hll"
+	"go-developer-course-shortener/internal/app/kv"
+	"go-developer-course-shortener/internal/app/rollup"
+	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/app/urlcrypt"
+	"log"
+	"time"
+)
+
+// Prefixes of keys of KVRepository, parts of keys are separated by zero bytes.
+const (
+	// short url -> kvRecord
+	kvLinkPrefix = 'l'
+	// lookup key of original url -> short url of the first link
+	kvOriginalPrefix = 'o'
+	// user, sequence -> short url
+	kvUserPrefix = 'u'
+	// user, sequence -> collection
+	kvCollectionPrefix = 'c'
+	// user, collection, sequence -> short url of not deleted links of the collection
+	kvCollectionLinkPrefix = 'i'
+	// granularity, start, rollup key -> clicks
+	kvBucketPrefix = 'r'
+	// short url, rollup key -> clicks of all day buckets
+	kvTotalPrefix = 't'
+	// short url, day, register -> rank of unique visitors
+	kvUniquesPrefix = 'h'
+	// name -> counter
+	kvCounterPrefix = 'm'
+)
+
+// kvBatchSize is the number of records read by one transaction of iterations.
+const kvBatchSize = 500
+
+// KVRepository implements Repository interface in an embedded key-value file.
+// Links are indexed by short url, original url and user, so lookups and pages of links are range scans.
+// Every change is a transaction synced to the file.
+type KVRepository struct {
+	db *kv.DB
+}
+
+// kvRecord is the stored link, the sequence orders links of the user.
+type kvRecord struct {
+	fileRecord
+	Seq uint64 `json:"seq"`
+}
+
+// check that KVRepository implements all required methods
+var _ Repository = (*KVRepository)(nil)
+
+func kvKey(prefix byte, parts ...string) []byte {
+	key := []byte{prefix}
+	for i, part := range parts {
+		if i > 0 {
+			key = append(key, 0)
+		}
+		key = append(key, part...)
+	}
+	return key
+}
+
+// kvUint returns the big-endian representation of v, so keys are ordered by v.
+func kvUint(v uint64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return string(buf[:])
+}
+
+func kvLinkKey(shortURL string) []byte {
+	return kvKey(kvLinkPrefix, shortURL)
+}
+
+func kvCollectionLinkKey(userID string, collectionID string, seq uint64) []byte {
+	return kvKey(kvCollectionLinkPrefix, userID, collectionID, kvUint(seq))
+}
+
+func kvBucketKey(granularity string, start time.Time, key []byte) []byte {
+	return kvKey(kvBucketPrefix, granularity, kvUint(uint64(start.Unix())), string(key))
+}
+
+func getRecord(tx *kv.Tx, shortURL string) (*kvRecord, error) {
+	data, err := tx.Get(kvLinkKey(shortURL))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	record := &kvRecord{}
+	if err = json.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func putRecord(tx *kv.Tx, record *kvRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return tx.Put(kvLinkKey(record.ID), data)
+}
+
+// indexed reports whether the link is in the index of its collection.
+func (r *kvRecord) indexed() bool {
+	return r.Collection != "" && !r.Deleted
+}
+
+// addCounter adds delta to the counter stored at the key.
+func addCounter(tx *kv.Tx, key []byte, delta int) error {
+	value, err := counter(tx, key)
+	if err != nil {
+		return err
+	}
+	return tx.Put(key, binary.AppendUvarint(nil, uint64(value+delta)))
+}
+
+func counter(tx *kv.Tx, key []byte) (int, error) {
+	data, err := tx.Get(key)
+	if err != nil || data == nil {
+		return 0, err
+	}
+	value, size := binary.Uvarint(data)
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid counter %q", key)
+	}
+	return int(value), nil
+}
+
+// nextSeq returns the next number of the sequence of links and collections.
+func nextSeq(tx *kv.Tx) (uint64, error) {
+	key := kvKey(kvCounterPrefix, "seq")
+	if err := addCounter(tx, key, 1); err != nil {
+		return 0, err
+	}
+	seq, err := counter(tx, key)
+	return uint64(seq), err
+}
+
+// hasPrefix reports whether a key with the prefix exists.
+func hasPrefix(tx *kv.Tx, prefix []byte) (bool, error) {
+	found := false
+	err := tx.ScanPrefix(prefix, func(key []byte, value []byte) bool {
+		found = true
+		return false
+	})
+	return found, err
+}
+
+// saveRecord adds the link to all indexes, it reports false if the short url already exists.
+func saveRecord(tx *kv.Tx, record types.Record) (bool, error) {
+	if _, err := getRecord(tx, record.ShortURL); !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	seq, err := nextSeq(tx)
+	if err != nil {
+		return false, err
+	}
+	stored := &kvRecord{fileRecord: *newFileRecord(record), Seq: seq}
+	if err = putRecord(tx, stored); err != nil {
+		return false, err
+	}
+
+	if err = addCounter(tx, kvKey(kvCounterPrefix, "links"), 1); err != nil {
+		return false, err
+	}
+	// purged links keep only short urls
+	if record.UserID == "" {
+		return true, nil
+	}
+	userKnown, err := hasPrefix(tx, kvKey(kvUserPrefix, record.UserID, ""))
+	if err != nil {
+		return false, err
+	}
+	if !userKnown {
+		if err = addCounter(tx, kvKey(kvCounterPrefix, "users"), 1); err != nil {
+			return false, err
+		}
+	}
+	if err = tx.Put(kvKey(kvUserPrefix, record.UserID, kvUint(seq)), []byte(record.ShortURL)); err != nil {
+		return false, err
+	}
+	if stored.indexed() {
+		if err = tx.Put(kvCollectionLinkKey(record.UserID, record.Collection, seq), []byte(record.ShortURL)); err != nil {
+			return false, err
+		}
+	}
+
+	return true, indexOriginalURL(tx, record.OriginalURL, record.ShortURL)
+}
+
+// indexOriginalURL adds the short url to the index of original urls unless the url is already indexed.
+func indexOriginalURL(tx *kv.Tx, originalURL string, shortURL string) error {
+	if originalURL == "" {
+		return nil
+	}
+	key := kvKey(kvOriginalPrefix, urlcrypt.LookupKey(originalURL))
+	indexed, err := tx.Get(key)
+	if err != nil || indexed != nil {
+		return err
+	}
+	return tx.Put(key, []byte(shortURL))
+}
+
+// update changes the link of the short url and its collection index, change reports whether the link is changed.
+func (r *KVRepository) update(shortURL string, change func(link *types.OriginalLink) bool) (bool, error) {
+	updated := false
+	err := r.db.Update(func(tx *kv.Tx) error {
+		record, err := getRecord(tx, shortURL)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		link := record.originalLink()
+		if !change(&link) {
+			return nil
+		}
+		updated = true
+		return replaceRecord(tx, record, link)
+	})
+	return updated, err
+}
+
+// replaceRecord saves the changed link of the record and moves it between collection indexes.
+func replaceRecord(tx *kv.Tx, record *kvRecord, link types.OriginalLink) error {
+	changed := &kvRecord{fileRecord: *newFileRecord(types.Record{ShortURL: record.ID, OriginalLink: link}), Seq: record.Seq}
+	if record.indexed() && (!changed.indexed() || changed.Collection != record.Collection) {
+		if err := tx.Delete(kvCollectionLinkKey(record.UserID, record.Collection, record.Seq)); err != nil {
+			return err
+		}
+	}
+	if changed.indexed() {
+		if err := tx.Put(kvCollectionLinkKey(changed.UserID, changed.Collection, changed.Seq), []byte(changed.ID)); err != nil {
+			return err
+		}
+	}
+	return putRecord(tx, changed)
+}
+
+// updateOwned changes the link of the short url if it belongs to the user, ErrNotFound otherwise.
+func (r *KVRepository) updateOwned(userID string, shortURL string, change func(link *types.OriginalLink)) error {
+	updated, err := r.update(shortURL, func(link *types.OriginalLink) bool {
+		if link.UserID != userID {
+			return false
+		}
+		change(link)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanRecords calls visit for records of short urls stored as values of keys with the prefix.
+func scanRecords(tx *kv.Tx, prefix []byte, visit func(record *kvRecord) bool) error {
+	var shortURLS []string
+	err := tx.ScanPrefix(prefix, func(key []byte, value []byte) bool {
+		shortURLS = append(shortURLS, string(value))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, shortURL := range shortURLS {
+		record, err := getRecord(tx, shortURL)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !visit(record) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *KVRepository) GetInternalStats() (int, int, error) {
+	var urls, users int
+	err := r.db.View(func(tx *kv.Tx) error {
+		var err error
+		if urls, err = counter(tx, kvKey(kvCounterPrefix, "links")); err != nil {
+			return err
+		}
+		users, err = counter(tx, kvKey(kvCounterPrefix, "users"))
+		return err
+	})
+	return urls, users, err
+}
+
+func (r *KVRepository) SaveURL(userID string, shortURL string, originalURL string) error {
+	return r.db.Update(func(tx *kv.Tx) error {
+		saved, err := saveRecord(tx, types.Record{ShortURL: shortURL,
+			OriginalLink: types.OriginalLink{UserID: userID, OriginalURL: originalURL, CreatedAt: time.Now()}})
+		if err == nil && !saved {
+			err = fmt.Errorf("short url %s already exists", shortURL)
+		}
+		return err
+	})
+}
+
+// SaveBatchURLS saves all links in one transaction or none of them if one of short urls already exists.
+func (r *KVRepository) SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error) {
+	response := make(types.ResponseBatch, len(links)) // allocate required capacity for the links
+	err := r.db.Update(func(tx *kv.Tx) error {
+		now := time.Now()
+		for i, v := range links {
+			saved, err := saveRecord(tx, types.Record{ShortURL: v.ShortURL,
+				OriginalLink: types.OriginalLink{UserID: userID, OriginalURL: v.OriginalURL, Metadata: v.Metadata, CreatedAt: now}})
+			if err != nil {
+				return err
+			}
+			if !saved {
+				return fmt.Errorf("short url %s already exists", v.ShortURL)
+			}
+			response[i] = types.ResponseBatchJSON{CorrelationID: v.CorrelationID, ShortURL: v.ShortURL}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (r *KVRepository) GetURL(shortURL string) (types.OriginalLink, error) {
+	var link types.OriginalLink
+	err := r.db.View(func(tx *kv.Tx) error {
+		record, err := getRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+		link = record.originalLink()
+		return nil
+	})
+	return link, err
+}
+
+func (r *KVRepository) GetShortURLByOriginalURL(originalURL string) (string, error) {
+	var shortURL []byte
+	err := r.db.View(func(tx *kv.Tx) error {
+		var err error
+		shortURL, err = tx.Get(kvKey(kvOriginalPrefix, urlcrypt.LookupKey(originalURL)))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if shortURL == nil {
+		return "", ErrNotFound
+	}
+	return string(shortURL), nil
+}
+
+func (r *KVRepository) GetUserStorage(userID string) ([]types.Link, error) {
+	var links []types.Link
+	err := r.db.View(func(tx *kv.Tx) error {
+		return scanRecords(tx, kvKey(kvUserPrefix, userID, ""), func(record *kvRecord) bool {
+			links = append(links, record.link())
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, errors.New("UserID not found")
+	}
+	return links, nil
+}
+
+// humanClicks sums clicks of people on the short url.
+func humanClicks(tx *kv.Tx, shortURL string) (int, error) {
+	total := 0
+	err := scanTotals(tx, shortURL, func(key rollup.Key, clicks int) {
+		if key.Class == types.ClickHuman {
+			total += clicks
+		}
+	})
+	return total, err
+}
+
+// ExportUserURLS reads links in batches of the user index, a transaction is not held while the batch is visited.
+func (r *KVRepository) ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error {
+	prefix := kvKey(kvUserPrefix, userID, "")
+	return r.forEachBatch(ctx, prefix, func(tx *kv.Tx, shortURLS []string) ([]interface{}, error) {
+		var batch []interface{}
+		for _, shortURL := range shortURLS {
+			record, err := getRecord(tx, shortURL)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if record.Deleted {
+				continue
+			}
+			clicks, err := humanClicks(tx, shortURL)
+			if err != nil {
+				return nil, err
+			}
+			batch = append(batch, types.ExportLink{Link: record.link(), CreatedAt: record.CreatedAt, Clicks: clicks})
+		}
+		return batch, nil
+	}, func(item interface{}) error {
+		return visit(item.(types.ExportLink))
+	})
+}
+
+// ForEachRecord reads links in batches ordered by short url.
+func (r *KVRepository) ForEachRecord(ctx context.Context, visit func(record types.Record) error) error {
+	return r.forEachBatch(ctx, []byte{kvLinkPrefix}, func(tx *kv.Tx, shortURLS []string) ([]interface{}, error) {
+		batch := make([]interface{}, 0, len(shortURLS))
+		for _, shortURL := range shortURLS {
+			record, err := getRecord(tx, shortURL)
+			if err != nil {
+				return nil, err
+			}
+			batch = append(batch, types.Record{ShortURL: shortURL, OriginalLink: record.originalLink()})
+		}
+		return batch, nil
+	}, func(item interface{}) error {
+		return visit(item.(types.Record))
+	})
+}
+
+// forEachBatch scans keys with the prefix in batches, read converts short urls of a batch in the transaction
+// of the scan and visit is called for converted items after the transaction.
+// Values of the link index are its records, values of other indexes are short urls.
+func (r *KVRepository) forEachBatch(ctx context.Context, prefix []byte,
+	read func(tx *kv.Tx, shortURLS []string) ([]interface{}, error), visit func(item interface{}) error) error {
+	from := prefix
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var batch []interface{}
+		var last []byte
+		err := r.db.View(func(tx *kv.Tx) error {
+			var shortURLS []string
+			err := tx.Scan(from, kvPrefixEnd(prefix), func(key []byte, value []byte) bool {
+				if prefix[0] == kvLinkPrefix {
+					shortURLS = append(shortURLS, string(key[1:]))
+				} else {
+					shortURLS = append(shortURLS, string(value))
+				}
+				last = key
+				return len(shortURLS) < kvBatchSize
+			})
+			if err != nil {
+				return err
+			}
+			if len(shortURLS) == 0 {
+				return nil
+			}
+			// the next batch starts after the last key
+			last = append(append([]byte(nil), last...), 0)
+			batch, err = read(tx, shortURLS)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if last == nil {
+			return nil
+		}
+		for _, item := range batch {
+			if err = visit(item); err != nil {
+				return err
+			}
+		}
+		from = last
+	}
+}
+
+// kvPrefixEnd returns the first key after keys with the prefix.
+func kvPrefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	end[len(end)-1]++
+	return end
+}
+
+func (r *KVRepository) SaveRecords(records []types.Record) (int, error) {
+	saved := 0
+	err := r.db.Update(func(tx *kv.Tx) error {
+		saved = 0
+		for _, record := range records {
+			ok, err := saveRecord(tx, record)
+			if err != nil {
+				return err
+			}
+			if ok {
+				saved++
+			}
+		}
+		return nil
+	})
+	return saved, err
+}
+
+// ReplaceOriginalURL moves the short url to the lookup key of the new url if the key is changed.
+func (r *KVRepository) ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error {
+	return r.db.Update(func(tx *kv.Tx) error {
+		record, err := getRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+		if record.OriginalURL != oldURL {
+			return ErrNotFound
+		}
+		record.OriginalURL = newURL
+		if err = putRecord(tx, record); err != nil {
+			return err
+		}
+
+		oldKey := kvKey(kvOriginalPrefix, urlcrypt.LookupKey(oldURL))
+		if bytes.Equal(oldKey, kvKey(kvOriginalPrefix, urlcrypt.LookupKey(newURL))) {
+			return nil
+		}
+		indexed, err := tx.Get(oldKey)
+		if err != nil {
+			return err
+		}
+		if string(indexed) == shortURL {
+			if err = tx.Delete(oldKey); err != nil {
+				return err
+			}
+		}
+		return indexOriginalURL(tx, newURL, shortURL)
+	})
+}
+
+// getCollections returns collections of the user and their sequence numbers.
+func getCollections(tx *kv.Tx, userID string) ([]types.Collection, []uint64, error) {
+	prefix := kvKey(kvCollectionPrefix, userID, "")
+	var collections []types.Collection
+	var seqs []uint64
+	var err error
+	scanErr := tx.ScanPrefix(prefix, func(key []byte, value []byte) bool {
+		var collection types.Collection
+		if err = json.Unmarshal(value, &collection); err != nil {
+			return false
+		}
+		collections = append(collections, collection)
+		seqs = append(seqs, binary.BigEndian.Uint64(key[len(prefix):]))
+		return true
+	})
+	if scanErr != nil {
+		return nil, nil, scanErr
+	}
+	return collections, seqs, err
+}
+
+func (r *KVRepository) GetAllCollections() ([]types.CollectionRecord, error) {
+	var records []types.CollectionRecord
+	err := r.db.View(func(tx *kv.Tx) error {
+		var err error
+		scanErr := tx.ScanPrefix([]byte{kvCollectionPrefix}, func(key []byte, value []byte) bool {
+			var collection types.Collection
+			if err = json.Unmarshal(value, &collection); err != nil {
+				return false
+			}
+			userID := key[1 : bytes.IndexByte(key[1:], 0)+1]
+			records = append(records, types.CollectionRecord{UserID: string(userID), Collection: collection})
+			return true
+		})
+		if scanErr != nil {
+			return scanErr
+		}
+		return err
+	})
+	return records, err
+}
+
+func (r *KVRepository) Ping() bool {
+	return r.db.View(func(tx *kv.Tx) error { return nil }) == nil
+}
+
+// DeleteURLS marks links of the user as deleted in one transaction, links of other users are skipped.
+func (r *KVRepository) DeleteURLS(ctx context.Context, userID string, shortURLS []string) error {
+	now := time.Now()
+	return r.db.Update(func(tx *kv.Tx) error {
+		for _, shortURL := range shortURLS {
+			record, err := getRecord(tx, shortURL)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if record.UserID != userID || record.Deleted {
+				continue
+			}
+			link := record.originalLink()
+			link.Deleted = true
+			link.DeletedAt = now
+			if err = replaceRecord(tx, record, link); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RestoreURLS restores links of the user in one transaction, links are added to indexes of their collections again.
+func (r *KVRepository) RestoreURLS(userID string, shortURLS []string, deletedAfter time.Time) ([]string, error) {
+	var restored []string
+	err := r.db.Update(func(tx *kv.Tx) error {
+		restored = nil
+		for _, shortURL := range shortURLS {
+			record, err := getRecord(tx, shortURL)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			link := record.originalLink()
+			if !restorable(&link, userID, deletedAfter) {
+				continue
+			}
+			link.Deleted = false
+			link.DeletedAt = time.Time{}
+			if err = replaceRecord(tx, record, link); err != nil {
+				return err
+			}
+			restored = append(restored, shortURL)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// PurgeURLS scans all links and purges them with their clicks in one transaction.
+func (r *KVRepository) PurgeURLS(deletedBefore time.Time, reuse bool) (int, error) {
+	purged := 0
+	err := r.db.Update(func(tx *kv.Tx) error {
+		var records []*kvRecord
+		var err error
+		scanErr := tx.ScanPrefix(kvKey(kvLinkPrefix), func(key []byte, value []byte) bool {
+			record := &kvRecord{}
+			if err = json.Unmarshal(value, record); err != nil {
+				return false
+			}
+			if link := record.originalLink(); purgeable(&link, deletedBefore, reuse) {
+				records = append(records, record)
+			}
+			return true
+		})
+		if scanErr != nil {
+			return scanErr
+		}
+		if err != nil {
+			return err
+		}
+
+		shortURLS := make(map[string]bool, len(records))
+		for _, record := range records {
+			if err = purgeRecord(tx, record, reuse); err != nil {
+				return err
+			}
+			shortURLS[record.ID] = true
+		}
+		purged = len(records)
+		return deleteClicks(tx, shortURLS)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// purgeRecord removes the link from indexes of its user and original url,
+// then the link is removed or replaced by the purged link.
+func purgeRecord(tx *kv.Tx, record *kvRecord, reuse bool) error {
+	if record.UserID != "" {
+		if err := tx.Delete(kvKey(kvUserPrefix, record.UserID, kvUint(record.Seq))); err != nil {
+			return err
+		}
+		userKnown, err := hasPrefix(tx, kvKey(kvUserPrefix, record.UserID, ""))
+		if err != nil {
+			return err
+		}
+		if !userKnown {
+			if err = addCounter(tx, kvKey(kvCounterPrefix, "users"), -1); err != nil {
+				return err
+			}
+		}
+	}
+	if record.OriginalURL != "" {
+		key := kvKey(kvOriginalPrefix, urlcrypt.LookupKey(record.OriginalURL))
+		indexed, err := tx.Get(key)
+		if err != nil {
+			return err
+		}
+		if string(indexed) == record.ID {
+			if err = tx.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	if reuse {
+		if err := tx.Delete(kvLinkKey(record.ID)); err != nil {
+			return err
+		}
+		return addCounter(tx, kvKey(kvCounterPrefix, "links"), -1)
+	}
+	purged := purgedLink(record.originalLink())
+	return putRecord(tx, &kvRecord{fileRecord: *newFileRecord(types.Record{ShortURL: record.ID, OriginalLink: purged}), Seq: record.Seq})
+}
+
+// deleteClicks removes rollups and unique visitors of the short urls, buckets of all links are scanned.
+func deleteClicks(tx *kv.Tx, shortURLS map[string]bool) error {
+	if len(shortURLS) == 0 {
+		return nil
+	}
+	var keys [][]byte
+	collect := func(key []byte, value []byte) bool {
+		keys = append(keys, append([]byte(nil), key...))
+		return true
+	}
+	for shortURL := range shortURLS {
+		if err := tx.ScanPrefix(kvKey(kvTotalPrefix, shortURL, ""), collect); err != nil {
+			return err
+		}
+		if err := tx.ScanPrefix(kvKey(kvUniquesPrefix, shortURL, ""), collect); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	scanErr := tx.ScanPrefix(kvKey(kvBucketPrefix), func(key []byte, value []byte) bool {
+		// the granularity, the start of eight bytes and the rollup key are separated by zero bytes
+		keyStart := 1 + bytes.IndexByte(key[1:], 0) + 1 + 8 + 1
+		var rollupKey rollup.Key
+		if err = json.Unmarshal(key[keyStart:], &rollupKey); err != nil {
+			return false
+		}
+		if shortURLS[rollupKey.ShortURL] {
+			collect(key, value)
+		}
+		return true
+	})
+	if scanErr != nil {
+		return scanErr
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err = tx.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *KVRepository) SetSchedule(userID string, shortURL string, schedule types.Schedule) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Schedule = schedule
+	})
+}
+
+func (r *KVRepository) SetTargets(userID string, shortURL string, targets []types.TargetRule) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Targets = targets
+	})
+}
+
+func (r *KVRepository) SetVariants(userID string, shortURL string, variants []types.Variant) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Variants = variants
+	})
+}
+
+func (r *KVRepository) SetPreview(userID string, shortURL string, preview types.Preview) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Preview = preview
+	})
+}
+
+func (r *KVRepository) SetMetadata(userID string, shortURL string, metadata types.Metadata) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Metadata = metadata
+	})
+}
+
+func (r *KVRepository) SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error) {
+	var links []types.Link
+	err := r.db.View(func(tx *kv.Tx) error {
+		return scanRecords(tx, kvKey(kvUserPrefix, userID, ""), func(record *kvRecord) bool {
+			if link := record.link(); matchesQuery(link, query) {
+				links = append(links, link)
+			}
+			return true
+		})
+	})
+	return links, err
+}
+
+func (r *KVRepository) CreateCollection(userID string, collection types.Collection) error {
+	return r.db.Update(func(tx *kv.Tx) error {
+		collections, _, err := getCollections(tx, userID)
+		if err != nil {
+			return err
+		}
+		if hasCollectionName(collections, collection.Name) {
+			return errors.New("collection already exists")
+		}
+		seq, err := nextSeq(tx)
+		if err != nil {
+			return err
+		}
+		collection.Links = 0
+		data, err := json.Marshal(collection)
+		if err != nil {
+			return err
+		}
+		return tx.Put(kvKey(kvCollectionPrefix, userID, kvUint(seq)), data)
+	})
+}
+
+// countKeys returns the number of keys with the prefix.
+func countKeys(tx *kv.Tx, prefix []byte) (int, error) {
+	count := 0
+	err := tx.ScanPrefix(prefix, func(key []byte, value []byte) bool {
+		count++
+		return true
+	})
+	return count, err
+}
+
+func (r *KVRepository) GetCollections(userID string) ([]types.Collection, error) {
+	var collections []types.Collection
+	err := r.db.View(func(tx *kv.Tx) error {
+		var err error
+		if collections, _, err = getCollections(tx, userID); err != nil {
+			return err
+		}
+		for i := range collections {
+			collections[i].Links, err = countKeys(tx, kvKey(kvCollectionLinkPrefix, userID, collections[i].ID, ""))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if collections == nil {
+		collections = []types.Collection{}
+	}
+	return collections, err
+}
+
+func (r *KVRepository) DeleteCollection(userID string, collectionID string) error {
+	return r.db.Update(func(tx *kv.Tx) error {
+		collections, seqs, err := getCollections(tx, userID)
+		if err != nil {
+			return err
+		}
+		i := findCollection(collections, collectionID)
+		if i < 0 {
+			return errors.New("collection not found")
+		}
+		if err = tx.Delete(kvKey(kvCollectionPrefix, userID, kvUint(seqs[i]))); err != nil {
+			return err
+		}
+
+		var records []*kvRecord
+		err = scanRecords(tx, kvKey(kvCollectionLinkPrefix, userID, collectionID, ""), func(record *kvRecord) bool {
+			records = append(records, record)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			link := record.originalLink()
+			link.Collection = ""
+			if err = replaceRecord(tx, record, link); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *KVRepository) MoveURLS(userID string, collectionID string, shortURLS []string) error {
+	return r.db.Update(func(tx *kv.Tx) error {
+		collections, _, err := getCollections(tx, userID)
+		if err != nil {
+			return err
+		}
+		if findCollection(collections, collectionID) < 0 {
+			return errors.New("collection not found")
+		}
+		moved := false
+		for _, shortURL := range shortURLS {
+			record, err := getRecord(tx, shortURL)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if record.UserID != userID {
+				continue
+			}
+			link := record.originalLink()
+			link.Collection = collectionID
+			if err = replaceRecord(tx, record, link); err != nil {
+				return err
+			}
+			moved = true
+		}
+		if !moved {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// GetCollectionURLS skips offset keys of the collection index and reads records of the next limit keys.
+func (r *KVRepository) GetCollectionURLS(userID string, collectionID string, limit int, offset int) ([]types.Link, int, error) {
+	var links []types.Link
+	total := 0
+	err := r.db.View(func(tx *kv.Tx) error {
+		collections, _, err := getCollections(tx, userID)
+		if err != nil {
+			return err
+		}
+		if findCollection(collections, collectionID) < 0 {
+			return errors.New("collection not found")
+		}
+
+		var shortURLS []string
+		err = tx.ScanPrefix(kvKey(kvCollectionLinkPrefix, userID, collectionID, ""), func(key []byte, value []byte) bool {
+			if total >= offset && (limit == 0 || len(shortURLS) < limit) {
+				shortURLS = append(shortURLS, string(value))
+			}
+			total++
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, shortURL := range shortURLS {
+			record, err := getRecord(tx, shortURL)
+			if err != nil {
+				return err
+			}
+			links = append(links, record.link())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return links, total, nil
+}
+
+// SaveHealth saves results of all links in one transaction.
+func (r *KVRepository) SaveHealth(results map[string]types.Health) error {
+	return r.db.Update(func(tx *kv.Tx) error {
+		for shortURL, health := range results {
+			record, err := getRecord(tx, shortURL)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			health := health
+			record.Health = &health
+			if err = putRecord(tx, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *KVRepository) GetHealthCheckURLS(checkedBefore time.Time, limit int) ([]types.Link, error) {
+	var links []types.Link
+	err := r.db.View(func(tx *kv.Tx) error {
+		var err error
+		scanErr := tx.ScanPrefix([]byte{kvLinkPrefix}, func(key []byte, value []byte) bool {
+			record := &kvRecord{}
+			if err = json.Unmarshal(value, record); err != nil {
+				return false
+			}
+			if !record.Deleted && needsHealthCheck(record.Health, checkedBefore) {
+				links = append(links, types.Link{ShortURL: record.ID, OriginalURL: record.OriginalURL, Health: record.Health})
+			}
+			return true
+		})
+		if scanErr != nil {
+			return scanErr
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return oldestChecks(links, limit), nil
+}
+
+func (r *KVRepository) SavePage(shortURL string, page types.Page) error {
+	return r.db.Update(func(tx *kv.Tx) error {
+		record, err := getRecord(tx, shortURL)
+		if err != nil {
+			return err
+		}
+		record.Page = &page
+		return putRecord(tx, record)
+	})
+}
+
+// SaveClicks adds clicks to rollups and unique visitors in one transaction, single clicks are not kept.
+// Counters of the batch are summed, so every counter is written once.
+func (r *KVRepository) SaveClicks(clicks []types.Click) error {
+	counters := make(map[string]int)
+	ranks := make(map[string]uint8)
+	for _, click := range clicks {
+		key, err := json.Marshal(rollup.KeyOf(click))
+		if err != nil {
+			return err
+		}
+		for _, granularity := range rollup.Granularities {
+			counters[string(kvBucketKey(granularity, rollup.BucketStart(granularity, click.Time), key))]++
+		}
+		counters[string(kvKey(kvTotalPrefix, click.ShortURL, string(key)))]++
+		if click.Visitor == 0 {
+			continue
+		}
+
+		register, rank := hll.Position(click.Visitor)
+		var position [2]byte
+		binary.BigEndian.PutUint16(position[:], uint16(register))
+		uniqueKey := string(kvKey(kvUniquesPrefix, click.ShortURL, click.Time.UTC().Format(types.DayLayout), string(position[:])))
+		if rank > ranks[uniqueKey] {
+			ranks[uniqueKey] = rank
+		}
+	}
+
+	return r.db.Update(func(tx *kv.Tx) error {
+		for key, delta := range counters {
+			if err := addCounter(tx, []byte(key), delta); err != nil {
+				return err
+			}
+		}
+		for key, rank := range ranks {
+			current, err := tx.Get([]byte(key))
+			if err != nil {
+				return err
+			}
+			if current == nil || current[0] < rank {
+				if err = tx.Put([]byte(key), []byte{rank}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// scanTotals calls visit for day totals of the short url by rollup keys.
+func scanTotals(tx *kv.Tx, shortURL string, visit func(key rollup.Key, clicks int)) error {
+	prefix := kvKey(kvTotalPrefix, shortURL, "")
+	var err error
+	scanErr := tx.ScanPrefix(prefix, func(key []byte, value []byte) bool {
+		var rollupKey rollup.Key
+		if err = json.Unmarshal(key[len(prefix):], &rollupKey); err != nil {
+			return false
+		}
+		clicks, _ := binary.Uvarint(value)
+		visit(rollupKey, int(clicks))
+		return true
+	})
+	if scanErr != nil {
+		return scanErr
+	}
+	return err
+}
+
+func (r *KVRepository) GetClickStats(shortURL string, includeBots bool) (types.ClickStats, error) {
+	stats := types.NewClickStats()
+	err := r.db.View(func(tx *kv.Tx) error {
+		err := scanTotals(tx, shortURL, func(key rollup.Key, clicks int) {
+			stats.Add(key.Click(), clicks, includeBots)
+		})
+		if err != nil {
+			return err
+		}
+
+		prefix := kvKey(kvUniquesPrefix, shortURL, "")
+		uniques := make(hll.Days)
+		err = tx.ScanPrefix(prefix, func(key []byte, value []byte) bool {
+			// the day and the register of two bytes are separated by a zero byte
+			rest := key[len(prefix):]
+			day := string(rest[:len(rest)-3])
+			uniques.Set(day, int(binary.BigEndian.Uint16(rest[len(rest)-2:])), value[0])
+			return true
+		})
+		stats.Uniques, stats.UniquesByDay = uniques.Estimates()
+		return err
+	})
+	return stats, err
+}
+
+// GetClickReport scans buckets of every span of the range.
+func (r *KVRepository) GetClickReport(query types.ReportQuery) ([]types.ReportItem, error) {
+	totals := make(map[string]int)
+	err := r.db.View(func(tx *kv.Tx) error {
+		for _, span := range rollup.Spans(query.From, query.To) {
+			from := kvKey(kvBucketPrefix, span.Granularity, kvUint(uint64(span.From.Unix())))
+			to := kvKey(kvBucketPrefix, span.Granularity, kvUint(uint64(span.To.Unix())))
+			// the granularity, the start of eight bytes and the rollup key are separated by zero bytes
+			keyStart := len(from) + 1
+			var err error
+			scanErr := tx.Scan(from, to, func(key []byte, value []byte) bool {
+				var rollupKey rollup.Key
+				if err = json.Unmarshal(key[keyStart:], &rollupKey); err != nil {
+					return false
+				}
+				if rollupKey.Class != types.ClickHuman || (query.UserID != "" && rollupKey.UserID != query.UserID) {
+					return true
+				}
+				if dimension := rollupKey.Value(query.Dimension); dimension != "" {
+					clicks, _ := binary.Uvarint(value)
+					totals[dimension] += int(clicks)
+				}
+				return true
+			})
+			if scanErr != nil {
+				return scanErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rollup.Top(totals, query.Limit), nil
+}
+
+// PurgeClicks does nothing, single clicks are not kept.
+func (r *KVRepository) PurgeClicks(before time.Time) (int, error) {
+	return 0, nil
+}
+
+func (r *KVRepository) ReleaseStorage() {
+	if err := r.db.Close(); err != nil {
+		log.Printf("Failed to close KV storage. Error: %v", err.Error())
+	}
+	log.Println("Storage released")
+}
+
+// NewKVRepository returns a new KVRepository of the file at the path, the file is created if it does not exist.
+func NewKVRepository(path string) (*KVRepository, error) {
+	db, err := kv.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("KV storage %s is used", path)
+	return &KVRepository{db: db}, nil
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/types"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKVRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shortener.kv")
+	storage, err := NewKVRepository(path)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.SaveURL("user1", "a", "https://a.example"))
+	require.Error(t, storage.SaveURL("user2", "a", "https://x.example"), "short urls must be unique")
+	_, err = storage.SaveBatchURLS("user1", types.BatchLinks{
+		{CorrelationID: "1", ShortURL: "b", OriginalURL: "https://b.example"},
+		{CorrelationID: "2", ShortURL: "a", OriginalURL: "https://y.example"},
+	})
+	require.Error(t, err)
+	_, err = storage.GetURL("b")
+	assert.ErrorIs(t, err, ErrNotFound, "links of the failed batch must not be saved")
+	response, err := storage.SaveBatchURLS("user1", types.BatchLinks{
+		{CorrelationID: "1", ShortURL: "b", OriginalURL: "https://b.example"},
+		{CorrelationID: "2", ShortURL: "c", OriginalURL: "https://c.example", Metadata: types.Metadata{Tags: []string{"go"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, types.ResponseBatch{{CorrelationID: "1", ShortURL: "b"}, {CorrelationID: "2", ShortURL: "c"}}, response)
+
+	shortURL, err := storage.GetShortURLByOriginalURL("https://c.example")
+	require.NoError(t, err)
+	assert.Equal(t, "c", shortURL)
+	_, err = storage.GetShortURLByOriginalURL("https://unknown.example")
+	assert.ErrorIs(t, err, ErrNotFound)
+	links, err := storage.GetUserStorage("user1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, []string{links[0].ShortURL, links[1].ShortURL, links[2].ShortURL},
+		"links of the user must be ordered by creation")
+	_, err = storage.GetUserStorage("user2")
+	assert.Error(t, err)
+
+	assert.ErrorIs(t, storage.SetMetadata("user2", "a", types.Metadata{Title: "A"}), ErrNotFound)
+	require.NoError(t, storage.SetMetadata("user1", "a", types.Metadata{Title: "A"}))
+	found, err := storage.SearchURLS("user1", types.SearchQuery{Tags: []string{"go"}})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "c", found[0].ShortURL)
+
+	require.NoError(t, storage.CreateCollection("user1", types.Collection{ID: "c1", Name: "Work"}))
+	require.Error(t, storage.CreateCollection("user1", types.Collection{ID: "c2", Name: "Work"}))
+	require.NoError(t, storage.MoveURLS("user1", "c1", []string{"a", "b", "c"}))
+	require.NoError(t, storage.DeleteURLS(context.Background(), "user1", []string{"c"}))
+	collectionLinks, total, err := storage.GetCollectionURLS("user1", "c1", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total, "deleted links must not be counted")
+	require.Len(t, collectionLinks, 1)
+	assert.Equal(t, "b", collectionLinks[0].ShortURL)
+	collections, err := storage.GetCollections("user1")
+	require.NoError(t, err)
+	assert.Equal(t, []types.Collection{{ID: "c1", Name: "Work", Links: 2}}, collections)
+
+	// the storage is restored from the file
+	storage.ReleaseStorage()
+	storage, err = NewKVRepository(path)
+	require.NoError(t, err)
+	defer storage.ReleaseStorage()
+
+	link, err := storage.GetURL("a")
+	require.NoError(t, err)
+	assert.Equal(t, "A", link.Metadata.Title)
+	assert.Equal(t, "c1", link.Collection)
+	link, err = storage.GetURL("c")
+	require.NoError(t, err)
+	assert.True(t, link.Deleted)
+	urls, users, err := storage.GetInternalStats()
+	require.NoError(t, err)
+	assert.Equal(t, 3, urls)
+	assert.Equal(t, 1, users)
+	all, err := storage.GetAllCollections()
+	require.NoError(t, err)
+	assert.Equal(t, []types.CollectionRecord{{UserID: "user1", Collection: types.Collection{ID: "c1", Name: "Work"}}}, all)
+
+	require.NoError(t, storage.DeleteCollection("user1", "c1"))
+	link, err = storage.GetURL("b")
+	require.NoError(t, err)
+	assert.Empty(t, link.Collection)
+
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.SaveHealth(map[string]types.Health{"a": {StatusCode: 200, CheckedAt: now}}))
+	checks, err := storage.GetHealthCheckURLS(now.Add(-time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, checks, 1, "checked and deleted links must be skipped")
+	assert.Equal(t, "b", checks[0].ShortURL)
+	assert.ErrorIs(t, storage.SavePage("x", types.Page{Title: "X"}), ErrNotFound)
+}
+
+func TestKVRepository_Records(t *testing.T) {
+	storage, err := NewKVRepository(filepath.Join(t.TempDir(), "shortener.kv"))
+	require.NoError(t, err)
+	defer storage.ReleaseStorage()
+
+	// records are read in several batches
+	var records []types.Record
+	for i := 0; i < kvBatchSize*2+10; i++ {
+		records = append(records, types.Record{ShortURL: "link" + strconv.Itoa(i),
+			OriginalLink: types.OriginalLink{UserID: "user" + strconv.Itoa(i%2), OriginalURL: "https://example.com/" + strconv.Itoa(i)}})
+	}
+	saved, err := storage.SaveRecords(records)
+	require.NoError(t, err)
+	assert.Equal(t, len(records), saved)
+	saved, err = storage.SaveRecords(records[:10])
+	require.NoError(t, err)
+	assert.Zero(t, saved, "existing short urls must be skipped")
+
+	visited := make(map[string]bool)
+	err = storage.ForEachRecord(context.Background(), func(record types.Record) error {
+		visited[record.ShortURL] = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, visited, len(records))
+
+	require.NoError(t, storage.SaveClicks([]types.Click{{UserID: "user0", ShortURL: "link0", Class: types.ClickHuman, Time: time.Now()}}))
+	exported := 0
+	err = storage.ExportUserURLS(context.Background(), "user0", func(link types.ExportLink) error {
+		if link.ShortURL == "link0" {
+			assert.Equal(t, 1, link.Clicks)
+		}
+		exported++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, kvBatchSize+5, exported)
+}
+
+func TestKVRepository_Clicks(t *testing.T) {
+	storage, err := NewKVRepository(filepath.Join(t.TempDir(), "shortener.kv"))
+	require.NoError(t, err)
+	defer storage.ReleaseStorage()
+
+	created := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	// counters of one batch are summed
+	var clicks []types.Click
+	for i := 0; i < 20; i++ {
+		shortURL := "http://localhost:8080/" + strconv.Itoa(i%5)
+		country := "DE"
+		if i%2 == 0 {
+			country = "FR"
+		}
+		clicks = append(clicks, types.Click{UserID: "user1", ShortURL: shortURL, Class: types.ClickHuman,
+			Country: country, Visitor: uint64(i%3+1) * 0x9E3779B97F4A7C15, Time: created})
+	}
+	require.NoError(t, storage.SaveClicks(clicks[:15]))
+	require.NoError(t, storage.SaveClicks(append(clicks[15:], types.Click{UserID: "user1", ShortURL: "http://localhost:8080/0",
+		Class: types.ClickBot, Bot: "Googlebot", Time: created})))
+
+	stats, err := storage.GetClickStats("http://localhost:8080/0", false)
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.Total)
+	assert.EqualValues(t, 3, stats.Uniques)
+	assert.EqualValues(t, 3, stats.UniquesByDay["2022-05-01"])
+
+	report, err := storage.GetClickReport(types.ReportQuery{Dimension: types.ReportCountries, From: created.Add(-time.Hour),
+		To: created.Add(time.Hour), Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []types.ReportItem{{Key: "DE", Clicks: 10}}, report)
+	report, err = storage.GetClickReport(types.ReportQuery{Dimension: types.ReportCountries, From: created.Add(time.Minute),
+		To: created.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Empty(t, report, "clicks before the range must not be reported")
+}
@@ -6,6 +6,7 @@ import (
 	"go-developer-course-shortener/internal/app/repository"
 	"go-developer-course-shortener/internal/app/types"
 	"log"
+	"time"
 )
 
 // MockRepository implements Repository interface to check negative scenarios
@@ -31,6 +32,90 @@ func (r *MockRepository) DeleteURLS(ctx context.Context, userID string, shortURL
 	return errors.New("DeleteURLS error")
 }
 
+func (r *MockRepository) RestoreURLS(userID string, shortURLS []string, deletedAfter time.Time) ([]string, error) {
+	return nil, errors.New("RestoreURLS error")
+}
+
+func (r *MockRepository) PurgeURLS(deletedBefore time.Time, reuse bool) (int, error) {
+	return 0, errors.New("PurgeURLS error")
+}
+
+func (r *MockRepository) SetSchedule(userID string, shortURL string, schedule types.Schedule) error {
+	return errors.New("SetSchedule error")
+}
+
+func (r *MockRepository) SetTargets(userID string, shortURL string, targets []types.TargetRule) error {
+	return errors.New("SetTargets error")
+}
+
+func (r *MockRepository) SetVariants(userID string, shortURL string, variants []types.Variant) error {
+	return errors.New("SetVariants error")
+}
+
+func (r *MockRepository) SetPreview(userID string, shortURL string, preview types.Preview) error {
+	return errors.New("SetPreview error")
+}
+
+func (r *MockRepository) SetMetadata(userID string, shortURL string, metadata types.Metadata) error {
+	return errors.New("SetMetadata error")
+}
+
+func (r *MockRepository) ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error {
+	return errors.New("ReplaceOriginalURL error")
+}
+
+func (r *MockRepository) SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error) {
+	return nil, errors.New("SearchURLS error")
+}
+
+func (r *MockRepository) CreateCollection(userID string, collection types.Collection) error {
+	return errors.New("CreateCollection error")
+}
+
+func (r *MockRepository) GetCollections(userID string) ([]types.Collection, error) {
+	return nil, errors.New("GetCollections error")
+}
+
+func (r *MockRepository) DeleteCollection(userID string, collectionID string) error {
+	return errors.New("DeleteCollection error")
+}
+
+func (r *MockRepository) MoveURLS(userID string, collectionID string, shortURLS []string) error {
+	return errors.New("MoveURLS error")
+}
+
+func (r *MockRepository) GetCollectionURLS(userID string, collectionID string, limit int, offset int) ([]types.Link, int, error) {
+	return nil, 0, errors.New("GetCollectionURLS error")
+}
+
+func (r *MockRepository) SaveHealth(results map[string]types.Health) error {
+	return errors.New("SaveHealth error")
+}
+
+func (r *MockRepository) GetHealthCheckURLS(checkedBefore time.Time, limit int) ([]types.Link, error) {
+	return nil, errors.New("GetHealthCheckURLS error")
+}
+
+func (r *MockRepository) SavePage(shortURL string, page types.Page) error {
+	return errors.New("SavePage error")
+}
+
+func (r *MockRepository) SaveClicks(clicks []types.Click) error {
+	return errors.New("SaveClicks error")
+}
+
+func (r *MockRepository) GetClickStats(shortURL string, includeBots bool) (types.ClickStats, error) {
+	return types.ClickStats{}, errors.New("GetClickStats error")
+}
+
+func (r *MockRepository) GetClickReport(query types.ReportQuery) ([]types.ReportItem, error) {
+	return nil, errors.New("GetClickReport error")
+}
+
+func (r *MockRepository) PurgeClicks(before time.Time) (int, error) {
+	return 0, errors.New("PurgeClicks error")
+}
+
 func (r *MockRepository) SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error) {
 	var resp types.ResponseBatch
 	return resp, errors.New("SaveBatchURLS error")
@@ -45,6 +130,22 @@ func (r *MockRepository) GetUserStorage(userID string) ([]types.Link, error) {
 	return nil, errors.New("GetUserStorage error")
 }
 
+func (r *MockRepository) ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error {
+	return errors.New("ExportUserURLS error")
+}
+
+func (r *MockRepository) ForEachRecord(ctx context.Context, visit func(record types.Record) error) error {
+	return errors.New("ForEachRecord error")
+}
+
+func (r *MockRepository) SaveRecords(records []types.Record) (int, error) {
+	return 0, errors.New("SaveRecords error")
+}
+
+func (r *MockRepository) GetAllCollections() ([]types.CollectionRecord, error) {
+	return nil, errors.New("GetAllCollections error")
+}
+
 func (r *MockRepository) Ping() bool {
 	return false
 }
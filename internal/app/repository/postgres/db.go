@@ -2,11 +2,24 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/hll"
 	"go-developer-course-shortener/internal/app/repository"
+	"go-developer-course-shortener/internal/app/rollup"
 	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/app/urlcrypt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 const PostgreSQLTable = `create table if not exists urls (
@@ -16,11 +29,108 @@ const PostgreSQLTable = `create table if not exists urls (
 		original_url text,
         deleted      boolean default false
 	);
-    create unique index if not exists original_url_ix on urls(original_url);`
+    alter table urls add column if not exists not_before timestamptz;
+    alter table urls add column if not exists not_after timestamptz;
+    alter table urls add column if not exists pending_url text not null default '';
+    alter table urls add column if not exists targets jsonb not null default '[]';
+    alter table urls add column if not exists variants jsonb not null default '[]';
+    alter table urls add column if not exists preview boolean not null default false;
+    alter table urls add column if not exists title text not null default '';
+    alter table urls add column if not exists description text not null default '';
+    alter table urls add column if not exists created_at timestamptz not null default now();
+    alter table urls add column if not exists link_title text not null default '';
+    alter table urls add column if not exists note text not null default '';
+    alter table urls add column if not exists tags text[] not null default '{}';
+    alter table urls drop column if exists search;
+    alter table urls add column if not exists search_words tsvector generated always as (to_tsvector('simple',
+        regexp_replace(link_title || ' ' || note || ' ' ||
+            case when original_url like 'enc:%' then '' else coalesce(original_url, '') end,
+            '[^[:alnum:]]+', ' ', 'g'))) stored;
+    create index if not exists urls_search_words_ix on urls using gin(search_words);
+    create index if not exists urls_tags_ix on urls using gin(tags);
+    alter table urls add column if not exists collection_id text not null default '';
+    create index if not exists urls_collection_ix on urls(user_id, collection_id);
+    create table if not exists collections (
+		id           text not null primary key,
+		user_id      text not null,
+		name         text not null,
+		created_at   timestamptz not null default now()
+	);
+    create unique index if not exists collections_user_name_ix on collections(user_id, name);
+    create table if not exists clicks (
+		id           serial not null primary key,
+		short_url    text not null,
+		variant      text not null default '',
+		created_at   timestamptz not null default now()
+	);
+    create index if not exists clicks_short_url_ix on clicks(short_url);
+    alter table clicks add column if not exists country text not null default '';
+    alter table urls add column if not exists health_status integer not null default 0;
+    alter table urls add column if not exists health_latency_ms bigint not null default 0;
+    alter table urls add column if not exists health_error text not null default '';
+    alter table urls add column if not exists health_checked_at timestamptz;
+    create index if not exists urls_health_ix on urls(health_checked_at nulls first);
+    alter table urls add column if not exists page_title text not null default '';
+    alter table urls add column if not exists og_title text not null default '';
+    alter table urls add column if not exists og_description text not null default '';
+    alter table urls add column if not exists og_image text not null default '';
+    alter table urls add column if not exists page_fetched_at timestamptz;
+    alter table clicks add column if not exists bot text not null default '';
+    alter table clicks add column if not exists class text not null default '';
+    create table if not exists uniques (
+		short_url    text not null,
+		day          date not null,
+		register     smallint not null,
+		rank         smallint not null,
+		primary key (short_url, day, register)
+	);
+    alter table clicks add column if not exists user_id text not null default '';
+    alter table clicks add column if not exists referrer text not null default '';
+    create index if not exists clicks_created_at_ix on clicks(created_at);
+    create table if not exists click_rollups (
+		granularity  text not null,
+		bucket       timestamptz not null,
+		user_id      text not null,
+		short_url    text not null,
+		variant      text not null,
+		country      text not null,
+		referrer     text not null,
+		bot          text not null,
+		class        text not null,
+		clicks       bigint not null,
+		primary key (granularity, bucket, user_id, short_url, variant, country, referrer, bot, class)
+	);
+    create index if not exists click_rollups_short_url_ix on click_rollups(short_url, granularity);
+    create unique index if not exists urls_short_url_ix on urls(short_url);
+    insert into click_rollups (granularity, bucket, user_id, short_url, variant, country, referrer, bot, class, clicks)
+		select g.granularity, date_trunc(g.granularity, c.created_at at time zone 'UTC') at time zone 'UTC',
+			coalesce(nullif(c.user_id, ''), u.user_id, ''), c.short_url, c.variant, c.country, c.referrer, c.bot,
+			case when c.class <> '' then c.class when c.bot <> '' then 'bot' else 'human' end, count(*)
+		from clicks c left join urls u on u.short_url = c.short_url
+			cross join (values ('minute'), ('hour'), ('day')) as g(granularity)
+		where not exists (select 1 from click_rollups)
+		group by 1, 2, 3, 4, 5, 6, 7, 8, 9;
+    alter table urls add column if not exists url_key text generated always as (case when original_url like 'enc:%'
+        then 'enc:' || split_part(original_url, ':', 2) else original_url end) stored;
+    create unique index if not exists urls_url_key_ix on urls(url_key);
+    drop index if exists original_url_ix;
+    alter table urls add column if not exists deleted_at timestamptz;
+    update urls set deleted_at = now() where deleted and deleted_at is null;`
 
 // DBRepository implements Repository interface
 type DBRepository struct {
-	conn *pgx.Conn
+	pool *pgxpool.Pool
+
+	// replicas serve reads of links and stats, next is the counter of the round robin
+	replicas []*replica
+	next     uint32
+	// pinned keys of users and short urls are read from the primary until the time,
+	// all keys are pinned until pinnedAll after changes of all links by other instances
+	pinWindow time.Duration
+	pinMu     sync.Mutex
+	pinned    map[string]time.Time
+	pinnedAll time.Time
+	now       func() time.Time
 }
 
 // check that DBRepository implements all required methods
@@ -30,14 +140,15 @@ func (r *DBRepository) GetInternalStats() (int, int, error) {
 	var urls int
 	var users int
 
-	row := r.conn.QueryRow(context.Background(), `SELECT COUNT(*) FROM urls`)
-	err := row.Scan(&urls)
-	if err != nil {
-		return urls, users, err
-	}
+	err := r.read(nil, func(pool *pgxpool.Pool) error {
+		row := pool.QueryRow(context.Background(), `SELECT COUNT(*) FROM urls`)
+		if err := row.Scan(&urls); err != nil {
+			return err
+		}
 
-	row = r.conn.QueryRow(context.Background(), `SELECT COUNT(DISTINCT(user_id)) FROM urls`)
-	err = row.Scan(&users)
+		row = pool.QueryRow(context.Background(), `SELECT COUNT(DISTINCT(user_id)) FROM urls WHERE user_id <> ''`)
+		return row.Scan(&users)
+	})
 	if err != nil {
 		return urls, users, err
 	}
@@ -47,25 +158,701 @@ func (r *DBRepository) GetInternalStats() (int, int, error) {
 
 func (r *DBRepository) SaveURL(userID string, shortURL string, originalURL string) error {
 	sql := `INSERT INTO urls (user_id, short_url, original_url) VALUES ($1, $2, $3)`
-	_, err := r.conn.Exec(context.Background(), sql, userID, shortURL, originalURL)
+	_, err := r.pool.Exec(context.Background(), sql, userID, shortURL, originalURL)
+	if err != nil {
+		return err
+	}
+	// other instances may cache the short url as unknown
+	r.notifyAfter(shortURL)
+	r.pin(userID, shortURL)
+	return nil
+}
+
+func (r *DBRepository) ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error {
+	sql := `UPDATE urls SET original_url = $3 WHERE short_url = $1 AND original_url = $2`
+	tag, err := r.pool.Exec(context.Background(), sql, shortURL, oldURL, newURL)
 	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrNotFound
+	}
 	return nil
 }
 
 func (r *DBRepository) DeleteURLS(ctx context.Context, userID string, shortURLS []string) error {
-	sql := `UPDATE urls SET deleted = true WHERE user_id = $1 AND short_url = ANY($2)`
-	_, err := r.conn.Exec(ctx, sql, userID, shortURLS)
+	sql := `UPDATE urls SET deleted = true, deleted_at = now() WHERE user_id = $1 AND short_url = ANY($2) AND NOT deleted`
+	tag, err := r.pool.Exec(ctx, sql, userID, shortURLS)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		r.notifyAfter(shortURLS...)
+		r.pin(userID, shortURLS...)
+	}
+	return nil
+}
+
+func (r *DBRepository) RestoreURLS(userID string, shortURLS []string, deletedAfter time.Time) ([]string, error) {
+	sql := `UPDATE urls SET deleted = false, deleted_at = NULL
+		WHERE user_id = $1 AND short_url = ANY($2) AND deleted AND deleted_at > $3 RETURNING short_url`
+	rows, err := r.pool.Query(context.Background(), sql, userID, shortURLS, deletedAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var restored []string
+	for rows.Next() {
+		var shortURL string
+		if err = rows.Scan(&shortURL); err != nil {
+			return nil, err
+		}
+		restored = append(restored, shortURL)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(restored) > 0 {
+		r.notifyAfter(restored...)
+		r.pin(userID, restored...)
+	}
+	return restored, nil
+}
+
+// PurgeURLS deletes purged rows with their clicks in one transaction. Unless short urls are reused,
+// rows without owner and original url are inserted again, so unique short urls stay reserved.
+func (r *DBRepository) PurgeURLS(deletedBefore time.Time, reuse bool) (int, error) {
+	ctx := context.Background()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `DELETE FROM urls WHERE deleted AND deleted_at < $1 AND (user_id <> '' OR $2)
+		RETURNING short_url, deleted_at, created_at`
+	rows, err := tx.Query(ctx, sql, deletedBefore, reuse)
+	if err != nil {
+		return 0, err
+	}
+	var shortURLS []string
+	var deletedAt, createdAt []time.Time
+	for rows.Next() {
+		var shortURL string
+		var deleted, created time.Time
+		if err = rows.Scan(&shortURL, &deleted, &created); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		shortURLS = append(shortURLS, shortURL)
+		deletedAt = append(deletedAt, deleted)
+		createdAt = append(createdAt, created)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(shortURLS) == 0 {
+		return 0, nil
+	}
+
+	if !reuse {
+		sql = `INSERT INTO urls (user_id, short_url, original_url, deleted, deleted_at, created_at)
+			SELECT '', short_url, NULL, true, deleted_at, created_at
+			FROM unnest($1::text[], $2::timestamptz[], $3::timestamptz[]) AS purged(short_url, deleted_at, created_at)`
+		if _, err = tx.Exec(ctx, sql, shortURLS, deletedAt, createdAt); err != nil {
+			return 0, err
+		}
+	}
+	for _, table := range []string{"clicks", "uniques", "click_rollups"} {
+		if _, err = tx.Exec(ctx, `DELETE FROM `+table+` WHERE short_url = ANY($1)`, shortURLS); err != nil {
+			return 0, err
+		}
+	}
+	if err = notify(ctx, tx, shortURLS); err != nil {
+		return 0, err
+	}
+	return len(shortURLS), tx.Commit(ctx)
+}
+
+func (r *DBRepository) SetSchedule(userID string, shortURL string, schedule types.Schedule) error {
+	sql := `UPDATE urls SET not_before = $3, not_after = $4, pending_url = $5 WHERE user_id = $1 AND short_url = $2`
+	tag, err := r.pool.Exec(context.Background(), sql, userID, shortURL, schedule.NotBefore, schedule.NotAfter, schedule.PendingURL)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("ID not found")
+	}
+	r.notifyAfter(shortURL)
+	r.pin(userID, shortURL)
+	return nil
+}
+
+func (r *DBRepository) SetTargets(userID string, shortURL string, targets []types.TargetRule) error {
+	if targets == nil {
+		targets = []types.TargetRule{}
+	}
+	data, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+
+	sql := `UPDATE urls SET targets = $3 WHERE user_id = $1 AND short_url = $2`
+	tag, err := r.pool.Exec(context.Background(), sql, userID, shortURL, string(data))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("ID not found")
+	}
+	r.notifyAfter(shortURL)
+	r.pin(userID, shortURL)
+	return nil
+}
+
+func (r *DBRepository) SetVariants(userID string, shortURL string, variants []types.Variant) error {
+	if variants == nil {
+		variants = []types.Variant{}
+	}
+	data, err := json.Marshal(variants)
+	if err != nil {
+		return err
+	}
+
+	sql := `UPDATE urls SET variants = $3 WHERE user_id = $1 AND short_url = $2`
+	tag, err := r.pool.Exec(context.Background(), sql, userID, shortURL, string(data))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("ID not found")
+	}
+	r.notifyAfter(shortURL)
+	r.pin(userID, shortURL)
+	return nil
+}
+
+func (r *DBRepository) SetPreview(userID string, shortURL string, preview types.Preview) error {
+	sql := `UPDATE urls SET preview = $3, title = $4, description = $5 WHERE user_id = $1 AND short_url = $2`
+	tag, err := r.pool.Exec(context.Background(), sql, userID, shortURL, preview.Always, preview.Title, preview.Description)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("ID not found")
+	}
+	r.notifyAfter(shortURL)
+	r.pin(userID, shortURL)
+	return nil
+}
+
+func (r *DBRepository) SetMetadata(userID string, shortURL string, metadata types.Metadata) error {
+	tags := metadata.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	sql := `UPDATE urls SET link_title = $3, note = $4, tags = $5 WHERE user_id = $1 AND short_url = $2`
+	tag, err := r.pool.Exec(context.Background(), sql, userID, shortURL, metadata.Title, metadata.Note, tags)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("ID not found")
+	}
+	r.notifyAfter(shortURL)
+	r.pin(userID, shortURL)
+	return nil
+}
+
+func (r *DBRepository) SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error) {
+	tags := query.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	// words are joined back to get the same lexemes as in the search_words column, it has no words of encrypted urls
+	text := strings.Join(repository.SearchWords(query.Text), " ")
+
+	sql := `SELECT short_url, original_url, collection_id, link_title, note, tags,
+		health_status, health_latency_ms, health_error, health_checked_at,
+		page_title, og_title, og_description, og_image, page_fetched_at FROM urls
+		WHERE user_id = $1 AND tags @> $2 AND ($3 = '' OR search_words @@ plainto_tsquery('simple', $3)) ORDER BY id`
+	rows, err := r.pool.Query(context.Background(), sql, userID, tags, text)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanLinks(rows)
+}
+
+// scanLinks reads links with metadata, health and destination page from the rows.
+func scanLinks(rows pgx.Rows) ([]types.Link, error) {
+	var links []types.Link
+	for rows.Next() {
+		var link types.Link
+		var health types.Health
+		var page types.Page
+		var checkedAt, fetchedAt *time.Time
+		err := rows.Scan(&link.ShortURL, &link.OriginalURL, &link.Collection, &link.Title, &link.Note, &link.Tags,
+			&health.StatusCode, &health.LatencyMS, &health.Error, &checkedAt,
+			&page.Title, &page.OGTitle, &page.OGDescription, &page.OGImage, &fetchedAt)
+		if err != nil {
+			return nil, err
+		}
+		if len(link.Tags) == 0 {
+			link.Tags = nil
+		}
+		link.Health = checkedHealth(health, checkedAt)
+		link.Page = fetchedPage(page, fetchedAt)
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// checkedHealth returns nil if the link was never checked.
+func checkedHealth(health types.Health, checkedAt *time.Time) *types.Health {
+	if checkedAt == nil {
+		return nil
+	}
+	health.CheckedAt = *checkedAt
+	return &health
+}
+
+// fetchedPage returns nil if the destination page was never fetched.
+func fetchedPage(page types.Page, fetchedAt *time.Time) *types.Page {
+	if fetchedAt == nil {
+		return nil
+	}
+	page.FetchedAt = *fetchedAt
+	return &page
+}
+
+func (r *DBRepository) CreateCollection(userID string, collection types.Collection) error {
+	sql := `INSERT INTO collections (id, user_id, name) VALUES ($1, $2, $3)`
+	_, err := r.pool.Exec(context.Background(), sql, collection.ID, userID, collection.Name)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return errors.New("collection already exists")
+	}
+	return err
+}
+
+func (r *DBRepository) GetCollections(userID string) ([]types.Collection, error) {
+	sql := `SELECT c.id, c.name, COUNT(u.id) FROM collections c
+		LEFT JOIN urls u ON u.user_id = c.user_id AND u.collection_id = c.id AND NOT u.deleted
+		WHERE c.user_id = $1 GROUP BY c.id, c.name, c.created_at ORDER BY c.created_at, c.id`
+	rows, err := r.pool.Query(context.Background(), sql, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []types.Collection
+	for rows.Next() {
+		var collection types.Collection
+		if err = rows.Scan(&collection.ID, &collection.Name, &collection.Links); err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
+
+func (r *DBRepository) DeleteCollection(userID string, collectionID string) error {
+	ctx := context.Background()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM collections WHERE user_id = $1 AND id = $2`, userID, collectionID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("collection not found")
+	}
+	rows, err := tx.Query(ctx, `UPDATE urls SET collection_id = '' WHERE user_id = $1 AND collection_id = $2 RETURNING short_url`,
+		userID, collectionID)
+	if err != nil {
+		return err
+	}
+	var shortURLS []string
+	for rows.Next() {
+		var shortURL string
+		if err = rows.Scan(&shortURL); err != nil {
+			rows.Close()
+			return err
+		}
+		shortURLS = append(shortURLS, shortURL)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if err = notify(ctx, tx, shortURLS); err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	r.pin(userID, shortURLS...)
+	return nil
+}
+
+func (r *DBRepository) MoveURLS(userID string, collectionID string, shortURLS []string) error {
+	sql := `UPDATE urls SET collection_id = $2 WHERE user_id = $1 AND short_url = ANY($3)
+		AND EXISTS (SELECT 1 FROM collections WHERE user_id = $1 AND id = $2)`
+	tag, err := r.pool.Exec(context.Background(), sql, userID, collectionID, shortURLS)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("ID not found")
+	}
+	r.notifyAfter(shortURLS...)
+	r.pin(userID, shortURLS...)
+	return nil
+}
+
+func (r *DBRepository) GetCollectionURLS(userID string, collectionID string, limit int, offset int) ([]types.Link, int, error) {
+	ctx := context.Background()
+	var total int
+	sql := `SELECT COUNT(u.id) FROM collections c
+		LEFT JOIN urls u ON u.user_id = c.user_id AND u.collection_id = c.id AND NOT u.deleted
+		WHERE c.user_id = $1 AND c.id = $2 GROUP BY c.id`
+	err := r.pool.QueryRow(ctx, sql, userID, collectionID).Scan(&total)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, errors.New("collection not found")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// zero limit is replaced with NULL which means no limit
+	sql = `SELECT short_url, original_url, collection_id, link_title, note, tags,
+		health_status, health_latency_ms, health_error, health_checked_at,
+		page_title, og_title, og_description, og_image, page_fetched_at FROM urls
+		WHERE user_id = $1 AND collection_id = $2 AND NOT deleted ORDER BY id LIMIT NULLIF($3::int, 0) OFFSET $4`
+	rows, err := r.pool.Query(ctx, sql, userID, collectionID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	links, err := scanLinks(rows)
+	return links, total, err
+}
+
+func (r *DBRepository) SaveHealth(results map[string]types.Health) error {
+	ctx := context.Background()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `UPDATE urls SET health_status = $2, health_latency_ms = $3, health_error = $4, health_checked_at = $5
+		WHERE short_url = $1`
+	for shortURL, health := range results {
+		_, err = tx.Exec(ctx, sql, shortURL, health.StatusCode, health.LatencyMS, health.Error, health.CheckedAt)
+		if err != nil {
+			return err
+		}
+	}
+	// checks are not notified, caches of other instances see them after their ttl
+	return tx.Commit(ctx)
+}
+
+func (r *DBRepository) GetHealthCheckURLS(checkedBefore time.Time, limit int) ([]types.Link, error) {
+	sql := `SELECT short_url, original_url, collection_id, link_title, note, tags,
+		health_status, health_latency_ms, health_error, health_checked_at,
+		page_title, og_title, og_description, og_image, page_fetched_at FROM urls
+		WHERE NOT deleted AND (health_checked_at IS NULL OR health_checked_at < $1)
+		ORDER BY health_checked_at NULLS FIRST, id LIMIT $2`
+	rows, err := r.pool.Query(context.Background(), sql, checkedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanLinks(rows)
+}
+
+func (r *DBRepository) SavePage(shortURL string, page types.Page) error {
+	sql := `UPDATE urls SET page_title = $2, og_title = $3, og_description = $4, og_image = $5, page_fetched_at = $6
+		WHERE short_url = $1`
+	tag, err := r.pool.Exec(context.Background(), sql, shortURL, page.Title, page.OGTitle, page.OGDescription, page.OGImage, page.FetchedAt)
 	if err != nil {
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("ID not found")
+	}
+	// pages are not notified, caches of other instances see them after their ttl
 	return nil
 }
 
+// rollupRow is a counter of a bucket of click rollups.
+type rollupRow struct {
+	granularity string
+	bucket      time.Time
+	key         rollup.Key
+}
+
+// uniqueRow is a HyperLogLog register of unique visitors of the short url per day.
+type uniqueRow struct {
+	shortURL string
+	day      string
+	register int
+}
+
+// SaveClicks saves clicks and adds them to rollups in one transaction.
+// Counters of the batch are summed, so every rollup and register is updated once and in the same order,
+// concurrent batches of other instances do not deadlock.
+func (r *DBRepository) SaveClicks(clicks []types.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	counters := make(map[rollupRow]int)
+	ranks := make(map[uniqueRow]uint8)
+	for _, click := range clicks {
+		key := rollup.KeyOf(click)
+		for _, granularity := range rollup.Granularities {
+			counters[rollupRow{granularity: granularity, bucket: rollup.BucketStart(granularity, click.Time), key: key}]++
+		}
+		if click.Visitor != 0 {
+			// only the HyperLogLog register of the visitor is kept, concurrent updates keep the maximum rank
+			register, rank := hll.Position(click.Visitor)
+			row := uniqueRow{shortURL: click.ShortURL, day: click.Time.UTC().Format(types.DayLayout), register: register}
+			if rank > ranks[row] {
+				ranks[row] = rank
+			}
+		}
+	}
+	rows := make([]rollupRow, 0, len(counters))
+	for row := range counters {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].less(rows[j]) })
+	registers := make([]uniqueRow, 0, len(ranks))
+	for row := range ranks {
+		registers = append(registers, row)
+	}
+	sort.Slice(registers, func(i, j int) bool { return registers[i].less(registers[j]) })
+
+	ctx := context.Background()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"clicks"},
+		[]string{"user_id", "short_url", "variant", "country", "referrer", "bot", "class", "created_at"},
+		pgx.CopyFromSlice(len(clicks), func(i int) ([]interface{}, error) {
+			click := clicks[i]
+			return []interface{}{click.UserID, click.ShortURL, click.Variant, click.Country, click.Referrer, click.Bot,
+				click.Class, click.Time}, nil
+		}))
+	if err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	for _, row := range rows {
+		batch.Queue(`INSERT INTO click_rollups (granularity, bucket, user_id, short_url, variant, country, referrer, bot, class, clicks)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (granularity, bucket, user_id, short_url, variant, country, referrer, bot, class)
+			DO UPDATE SET clicks = click_rollups.clicks + EXCLUDED.clicks`,
+			row.granularity, row.bucket, row.key.UserID, row.key.ShortURL, row.key.Variant, row.key.Country, row.key.Referrer,
+			row.key.Bot, row.key.Class, counters[row])
+	}
+	for _, row := range registers {
+		batch.Queue(`INSERT INTO uniques (short_url, day, register, rank) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (short_url, day, register) DO UPDATE SET rank = GREATEST(uniques.rank, EXCLUDED.rank)`,
+			row.shortURL, row.day, row.register, ranks[row])
+	}
+	results := tx.SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err = results.Exec(); err != nil {
+			results.Close()
+			return err
+		}
+	}
+	if err = results.Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r rollupRow) less(other rollupRow) bool {
+	if r.granularity != other.granularity {
+		return r.granularity < other.granularity
+	}
+	if !r.bucket.Equal(other.bucket) {
+		return r.bucket.Before(other.bucket)
+	}
+	a, b := r.key, other.key
+	for _, v := range [][2]string{{a.ShortURL, b.ShortURL}, {a.UserID, b.UserID}, {a.Variant, b.Variant},
+		{a.Country, b.Country}, {a.Referrer, b.Referrer}, {a.Bot, b.Bot}, {a.Class, b.Class}} {
+		if v[0] != v[1] {
+			return v[0] < v[1]
+		}
+	}
+	return false
+}
+
+func (r uniqueRow) less(other uniqueRow) bool {
+	if r.shortURL != other.shortURL {
+		return r.shortURL < other.shortURL
+	}
+	if r.day != other.day {
+		return r.day < other.day
+	}
+	return r.register < other.register
+}
+
+// GetClickStats counts clicks of the short url from day rollups.
+func (r *DBRepository) GetClickStats(shortURL string, includeBots bool) (types.ClickStats, error) {
+	var stats types.ClickStats
+	err := r.read(pinKeys("", shortURL), func(pool *pgxpool.Pool) error {
+		var err error
+		stats, err = clickStats(pool, shortURL, includeBots)
+		return err
+	})
+	return stats, err
+}
+
+// clickStats reads stats of the short url with the connection.
+func clickStats(pool *pgxpool.Pool, shortURL string, includeBots bool) (types.ClickStats, error) {
+	stats := types.NewClickStats()
+	sql := `SELECT variant, country, bot, class, SUM(clicks)::bigint FROM click_rollups WHERE short_url = $1 AND granularity = $2
+		GROUP BY variant, country, bot, class`
+	rows, err := pool.Query(context.Background(), sql, shortURL, rollup.Day)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var click types.Click
+		var clicks int
+		err = rows.Scan(&click.Variant, &click.Country, &click.Bot, &click.Class, &clicks)
+		if err != nil {
+			return stats, err
+		}
+		stats.Add(click, clicks, includeBots)
+	}
+	if err = rows.Err(); err != nil {
+		return stats, err
+	}
+
+	uniques, err := getUniques(pool, shortURL)
+	if err != nil {
+		return stats, err
+	}
+	stats.Uniques, stats.UniquesByDay = uniques.Estimates()
+	return stats, nil
+}
+
+// reportColumns maps report dimensions to columns of rollups.
+var reportColumns = map[string]string{
+	types.ReportLinks:     "short_url",
+	types.ReportReferrers: "referrer",
+	types.ReportCountries: "country",
+}
+
+// GetClickReport sums rollups of spans of the range, every span is a range scan of the primary key.
+func (r *DBRepository) GetClickReport(query types.ReportQuery) ([]types.ReportItem, error) {
+	column, ok := reportColumns[query.Dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown report %s", query.Dimension)
+	}
+	spans := rollup.Spans(query.From, query.To)
+	if len(spans) == 0 {
+		return []types.ReportItem{}, nil
+	}
+
+	args := []interface{}{types.ClickHuman}
+	conditions := make([]string, len(spans))
+	for i, span := range spans {
+		args = append(args, span.Granularity, span.From, span.To)
+		n := len(args)
+		conditions[i] = fmt.Sprintf("(granularity = $%d AND bucket >= $%d AND bucket < $%d)", n-2, n-1, n)
+	}
+	filter := ""
+	if query.UserID != "" {
+		args = append(args, query.UserID)
+		filter = fmt.Sprintf(" AND user_id = $%d", len(args))
+	}
+	args = append(args, query.Limit)
+	sql := fmt.Sprintf(`SELECT %[1]s, SUM(clicks)::bigint FROM click_rollups
+		WHERE class = $1 AND %[1]s <> ''%[2]s AND (%[3]s)
+		GROUP BY %[1]s ORDER BY 2 DESC, 1 LIMIT $%[4]d`, column, filter, strings.Join(conditions, " OR "), len(args))
+
+	var items []types.ReportItem
+	err := r.read(pinKeys(query.UserID), func(pool *pgxpool.Pool) error {
+		rows, err := pool.Query(context.Background(), sql, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		items = []types.ReportItem{}
+		for rows.Next() {
+			var item types.ReportItem
+			if err = rows.Scan(&item.Key, &item.Clicks); err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *DBRepository) PurgeClicks(before time.Time) (int, error) {
+	sql := `DELETE FROM clicks WHERE created_at < $1`
+	tag, err := r.pool.Exec(context.Background(), sql, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// getUniques returns HyperLogLog sketches of the short url by days.
+func getUniques(pool *pgxpool.Pool, shortURL string) (hll.Days, error) {
+	sql := `SELECT to_char(day, 'YYYY-MM-DD'), register, rank FROM uniques WHERE short_url = $1`
+	rows, err := pool.Query(context.Background(), sql, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uniques := make(hll.Days)
+	for rows.Next() {
+		var day string
+		var register int
+		var rank uint8
+		if err = rows.Scan(&day, &register, &rank); err != nil {
+			return nil, err
+		}
+		uniques.Set(day, register, rank)
+	}
+	return uniques, rows.Err()
+}
+
 func (r *DBRepository) SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error) {
 	ctx := context.Background()
-	tx, err := r.conn.Begin(ctx)
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -75,39 +862,98 @@ func (r *DBRepository) SaveBatchURLS(userID string, links types.BatchLinks) (typ
 		}
 	}()
 
-	sql := `INSERT INTO urls (user_id, short_url, original_url) VALUES ($1, $2, $3)`
+	sql := `INSERT INTO urls (user_id, short_url, original_url, link_title, note, tags)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6::text[], '{}'))`
 
 	response := make(types.ResponseBatch, len(links)) // allocate required capacity for the links
+	shortURLS := make([]string, len(links))
 	for i, v := range links {
-		_, err = tx.Exec(ctx, sql, userID, v.ShortURL, v.OriginalURL)
+		_, err = tx.Exec(ctx, sql, userID, v.ShortURL, v.OriginalURL, v.Metadata.Title, v.Metadata.Note, v.Metadata.Tags)
 		if err != nil {
 			return nil, err
 		}
 		response[i] = types.ResponseBatchJSON{CorrelationID: v.CorrelationID, ShortURL: v.ShortURL}
+		shortURLS[i] = v.ShortURL
+	}
+	if err = notify(ctx, tx, shortURLS); err != nil {
+		return nil, err
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
 		return nil, err
 	}
+	r.pin(userID, shortURLS...)
 
 	return response, nil
 }
 
-func (r *DBRepository) GetURL(shortURL string) (types.OriginalLink, error) {
-	sql := `SELECT original_url, deleted FROM urls WHERE short_url = $1`
-	row := r.conn.QueryRow(context.Background(), sql, shortURL)
+// originalLinkColumns are columns of urls read by scanOriginalLink.
+const originalLinkColumns = `user_id, coalesce(original_url, ''), deleted, deleted_at, not_before, not_after, pending_url, targets, variants,
+       preview, title, description, link_title, note, tags, collection_id, created_at,
+       health_status, health_latency_ms, health_error, health_checked_at,
+       page_title, og_title, og_description, og_image, page_fetched_at`
+
+// scanOriginalLink reads originalLinkColumns of the row after the columns read into dest.
+func scanOriginalLink(row pgx.Row, dest ...interface{}) (types.OriginalLink, error) {
 	var originalLink types.OriginalLink
-	err := row.Scan(&originalLink.OriginalURL, &originalLink.Deleted)
+	var targets, variants []byte
+	var health types.Health
+	var page types.Page
+	var deletedAt, checkedAt, fetchedAt *time.Time
+	err := row.Scan(append(dest, &originalLink.UserID, &originalLink.OriginalURL, &originalLink.Deleted, &deletedAt,
+		&originalLink.Schedule.NotBefore, &originalLink.Schedule.NotAfter, &originalLink.Schedule.PendingURL, &targets, &variants,
+		&originalLink.Preview.Always, &originalLink.Preview.Title, &originalLink.Preview.Description,
+		&originalLink.Metadata.Title, &originalLink.Metadata.Note, &originalLink.Metadata.Tags,
+		&originalLink.Collection, &originalLink.CreatedAt,
+		&health.StatusCode, &health.LatencyMS, &health.Error, &checkedAt,
+		&page.Title, &page.OGTitle, &page.OGDescription, &page.OGImage, &fetchedAt)...)
 	if err != nil {
 		return originalLink, err
 	}
+	if deletedAt != nil {
+		originalLink.DeletedAt = *deletedAt
+	}
+	originalLink.Health = checkedHealth(health, checkedAt)
+	originalLink.Page = fetchedPage(page, fetchedAt)
+	if len(originalLink.Metadata.Tags) == 0 {
+		originalLink.Metadata.Tags = nil
+	}
+	var rules []types.TargetRule
+	if err = json.Unmarshal(targets, &rules); err != nil {
+		return originalLink, err
+	}
+	if len(rules) > 0 {
+		originalLink.Targets = rules
+	}
+	var weighted []types.Variant
+	if err = json.Unmarshal(variants, &weighted); err != nil {
+		return originalLink, err
+	}
+	if len(weighted) > 0 {
+		originalLink.Variants = weighted
+	}
 	return originalLink, nil
 }
 
+func (r *DBRepository) GetURL(shortURL string) (types.OriginalLink, error) {
+	sql := `SELECT ` + originalLinkColumns + ` FROM urls WHERE short_url = $1`
+	var link types.OriginalLink
+	err := r.read(pinKeys("", shortURL), func(pool *pgxpool.Pool) error {
+		var err error
+		link, err = scanOriginalLink(pool.QueryRow(context.Background(), sql, shortURL))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return link, repository.ErrNotFound
+	}
+	return link, err
+}
+
+// GetShortURLByOriginalURL looks up the short url by the lookup key, the index of encrypted original urls.
 func (r *DBRepository) GetShortURLByOriginalURL(originalURL string) (string, error) {
-	sql := `SELECT short_url FROM urls WHERE original_url = $1`
-	row := r.conn.QueryRow(context.Background(), sql, originalURL)
+	sql := `SELECT short_url FROM urls WHERE url_key = $1`
+	row := r.pool.QueryRow(context.Background(), sql, urlcrypt.LookupKey(originalURL))
 	var shortURL string
 	err := row.Scan(&shortURL)
 	if err != nil {
@@ -117,46 +963,234 @@ func (r *DBRepository) GetShortURLByOriginalURL(originalURL string) (string, err
 }
 
 func (r *DBRepository) GetUserStorage(userID string) ([]types.Link, error) {
+	sql := `SELECT short_url, original_url, collection_id, link_title, note, tags,
+		health_status, health_latency_ms, health_error, health_checked_at,
+		page_title, og_title, og_description, og_image, page_fetched_at FROM urls WHERE user_id = $1`
 	var links []types.Link
-	sql := `SELECT short_url, original_url FROM urls WHERE user_id = $1`
-	rows, err := r.conn.Query(context.Background(), sql, userID)
+	err := r.read(pinKeys(userID), func(pool *pgxpool.Pool) error {
+		rows, err := pool.Query(context.Background(), sql, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		links, err = scanLinks(rows)
+		return err
+	})
+	return links, err
+}
+
+// exportBatchSize is the number of urls read by one query of the export.
+const exportBatchSize = 500
+
+// ExportUserURLS reads urls in batches ordered by id, the connection is not held while the batch is visited.
+// Clicks are summed from day rollups of people using the short url index.
+func (r *DBRepository) ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error {
+	sql := `SELECT id, short_url, original_url, collection_id, link_title, note, tags,
+		health_status, health_latency_ms, health_error, health_checked_at,
+		page_title, og_title, og_description, og_image, page_fetched_at, created_at,
+		COALESCE((SELECT SUM(r.clicks) FROM click_rollups r
+			WHERE r.short_url = u.short_url AND r.granularity = $2 AND r.class = $3), 0)::bigint
+		FROM urls u WHERE user_id = $1 AND NOT deleted AND id > $4 ORDER BY id LIMIT $5`
+	lastID := 0
+	for {
+		links, err := r.exportBatch(ctx, sql, userID, &lastID)
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if err = visit(link); err != nil {
+				return err
+			}
+		}
+		if len(links) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// exportBatch reads the next batch of the export and moves lastID to the last read url.
+func (r *DBRepository) exportBatch(ctx context.Context, sql string, userID string, lastID *int) ([]types.ExportLink, error) {
+	rows, err := r.pool.Query(ctx, sql, userID, rollup.Day, types.ClickHuman, *lastID, exportBatchSize)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	links := make([]types.ExportLink, 0, exportBatchSize)
 	for rows.Next() {
-		var shortURL string
-		var originalURL string
-		err = rows.Scan(&shortURL, &originalURL)
+		var link types.ExportLink
+		var health types.Health
+		var page types.Page
+		var checkedAt, fetchedAt *time.Time
+		err = rows.Scan(lastID, &link.ShortURL, &link.OriginalURL, &link.Collection, &link.Title, &link.Note, &link.Tags,
+			&health.StatusCode, &health.LatencyMS, &health.Error, &checkedAt,
+			&page.Title, &page.OGTitle, &page.OGDescription, &page.OGImage, &fetchedAt, &link.CreatedAt, &link.Clicks)
+		if err != nil {
+			return nil, err
+		}
+		if len(link.Tags) == 0 {
+			link.Tags = nil
+		}
+		link.Health = checkedHealth(health, checkedAt)
+		link.Page = fetchedPage(page, fetchedAt)
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// ForEachRecord reads urls in batches ordered by id, the connection is not held while the batch is visited.
+func (r *DBRepository) ForEachRecord(ctx context.Context, visit func(record types.Record) error) error {
+	sql := `SELECT id, short_url, ` + originalLinkColumns + ` FROM urls WHERE id > $1 ORDER BY id LIMIT $2`
+	lastID := 0
+	for {
+		records, err := r.recordBatch(ctx, sql, &lastID)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err = visit(record); err != nil {
+				return err
+			}
+		}
+		if len(records) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// recordBatch reads the next batch of records and moves lastID to the last read url.
+func (r *DBRepository) recordBatch(ctx context.Context, sql string, lastID *int) ([]types.Record, error) {
+	rows, err := r.pool.Query(ctx, sql, *lastID, exportBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]types.Record, 0, exportBatchSize)
+	for rows.Next() {
+		var record types.Record
+		record.OriginalLink, err = scanOriginalLink(rows, lastID, &record.ShortURL)
 		if err != nil {
 			return nil, err
 		}
-		links = append(links, types.Link{ShortURL: shortURL, OriginalURL: originalURL})
+		records = append(records, record)
 	}
-	return links, nil
+	return records, rows.Err()
+}
+
+// SaveRecords inserts records in one transaction, records conflicting with existing short urls
+// or original urls are skipped.
+func (r *DBRepository) SaveRecords(records []types.Record) (int, error) {
+	ctx := context.Background()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `INSERT INTO urls (user_id, short_url, original_url, deleted, not_before, not_after, pending_url, targets, variants,
+		preview, title, description, link_title, note, tags, collection_id, created_at,
+		health_status, health_latency_ms, health_error, health_checked_at,
+		page_title, og_title, og_description, og_image, page_fetched_at, deleted_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, COALESCE($15::text[], '{}'), $16, $17,
+		$18, $19, $20, $21, $22, $23, $24, $25, $26, $27)
+		ON CONFLICT DO NOTHING`
+	saved := 0
+	var shortURLS []string
+	for _, record := range records {
+		targets := record.Targets
+		if targets == nil {
+			targets = []types.TargetRule{}
+		}
+		targetsData, err := json.Marshal(targets)
+		if err != nil {
+			return 0, err
+		}
+		variants := record.Variants
+		if variants == nil {
+			variants = []types.Variant{}
+		}
+		variantsData, err := json.Marshal(variants)
+		if err != nil {
+			return 0, err
+		}
+		var health types.Health
+		var checkedAt *time.Time
+		if record.Health != nil {
+			health = *record.Health
+			checkedAt = &health.CheckedAt
+		}
+		var page types.Page
+		var fetchedAt *time.Time
+		if record.Page != nil {
+			page = *record.Page
+			fetchedAt = &page.FetchedAt
+		}
+		var deletedAt *time.Time
+		if !record.DeletedAt.IsZero() {
+			deletedAt = &record.DeletedAt
+		}
+
+		tag, err := tx.Exec(ctx, sql, record.UserID, record.ShortURL, record.OriginalURL, record.Deleted,
+			record.Schedule.NotBefore, record.Schedule.NotAfter, record.Schedule.PendingURL, string(targetsData), string(variantsData),
+			record.Preview.Always, record.Preview.Title, record.Preview.Description,
+			record.Metadata.Title, record.Metadata.Note, record.Metadata.Tags, record.Collection, record.CreatedAt,
+			health.StatusCode, health.LatencyMS, health.Error, checkedAt,
+			page.Title, page.OGTitle, page.OGDescription, page.OGImage, fetchedAt, deletedAt)
+		if err != nil {
+			return 0, err
+		}
+		if tag.RowsAffected() > 0 {
+			saved++
+			shortURLS = append(shortURLS, record.ShortURL)
+		}
+	}
+	if err = notify(ctx, tx, shortURLS); err != nil {
+		return 0, err
+	}
+	return saved, tx.Commit(ctx)
+}
+
+func (r *DBRepository) GetAllCollections() ([]types.CollectionRecord, error) {
+	sql := `SELECT user_id, id, name FROM collections ORDER BY created_at, id`
+	rows, err := r.pool.Query(context.Background(), sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []types.CollectionRecord
+	for rows.Next() {
+		var record types.CollectionRecord
+		if err = rows.Scan(&record.UserID, &record.ID, &record.Name); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
 }
 
 func (r *DBRepository) Ping() bool {
-	err := r.conn.Ping(context.Background())
+	err := r.pool.Ping(context.Background())
 
 	return err == nil
 }
 
 func (r *DBRepository) ReleaseStorage() {
 	log.Println("Storage released")
-	err := r.conn.Close(context.Background())
-	if err != nil {
-		log.Fatalf("Failed to close database connection. Error: %v", err.Error())
+	for _, replica := range r.replicas {
+		replica.close()
 	}
+	r.pool.Close()
 }
 
-// NewDBRepository returns a new DBRepository.
-func NewDBRepository(connection *pgx.Conn) (*DBRepository, error) {
+// NewDBRepository returns a new DBRepository with the pool of the primary.
+func NewDBRepository(pool *pgxpool.Pool) (*DBRepository, error) {
 	log.Print("DB storage is used")
-	_, err := connection.Exec(context.Background(), PostgreSQLTable)
+	_, err := pool.Exec(context.Background(), PostgreSQLTable)
 	if err != nil {
 		return nil, err
 	}
-	return &DBRepository{conn: connection}, nil
+	return &DBRepository{pool: pool, pinned: make(map[string]time.Time), now: time.Now}, nil
 }
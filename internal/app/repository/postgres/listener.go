@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// LinksChannel is the channel of notifications about changed links.
+	LinksChannel = "shortener_links"
+	// maxNotifyPayload limits the payload of notifications below the limit of Postgres of 8000 bytes,
+	// larger changes are notified as changes of all links.
+	maxNotifyPayload = 7000
+
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// linksEvent is the payload of notifications about changed links.
+type linksEvent struct {
+	ShortURLS []string `json:"short_urls,omitempty"`
+	All       bool     `json:"all,omitempty"`
+}
+
+// notifyPayload returns the payload of the notification about changed short urls.
+func notifyPayload(shortURLS []string) string {
+	data, err := json.Marshal(&linksEvent{ShortURLS: shortURLS})
+	if err != nil || len(data) > maxNotifyPayload {
+		data, _ = json.Marshal(&linksEvent{All: true})
+	}
+	return string(data)
+}
+
+// execer executes statements on a connection or in a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+// notify publishes changes of short urls to other instances. In a transaction the notification is sent on commit.
+func notify(ctx context.Context, conn execer, shortURLS []string) error {
+	if len(shortURLS) == 0 {
+		return nil
+	}
+	_, err := conn.Exec(ctx, `SELECT pg_notify($1, $2)`, LinksChannel, notifyPayload(shortURLS))
+	return err
+}
+
+// notifyAfter publishes changes made by a statement outside of a transaction.
+// The change is already saved, so a failed notification is only logged and other instances see it after their cache ttl.
+func (r *DBRepository) notifyAfter(shortURLS ...string) {
+	if err := notify(context.Background(), r.pool, shortURLS); err != nil {
+		log.Printf("Failed to notify about changed links. Error: %v", err)
+	}
+}
+
+// Invalidator removes changed links from a local cache.
+type Invalidator interface {
+	// Invalidate removes the short urls.
+	Invalidate(shortURLS ...string)
+	// Purge removes all links.
+	Purge()
+}
+
+// Listener receives notifications about changed links with its own connection and invalidates them.
+// Notifications sent while the connection is lost are missed, so all links are invalidated after every reconnect.
+type Listener struct {
+	dsn          string
+	invalidators []Invalidator
+}
+
+// NewListener returns a new Listener of the database. Links are invalidated by invalidators in the order,
+// so the repository must precede caches reading from it.
+func NewListener(dsn string, invalidators ...Invalidator) *Listener {
+	return &Listener{dsn: dsn, invalidators: invalidators}
+}
+
+func (l *Listener) invalidate(shortURLS ...string) {
+	for _, invalidator := range l.invalidators {
+		invalidator.Invalidate(shortURLS...)
+	}
+}
+
+func (l *Listener) purge() {
+	for _, invalidator := range l.invalidators {
+		invalidator.Purge()
+	}
+}
+
+// Run listens to notifications until the context is done, the connection is restored with increasing delays.
+func (l *Listener) Run(ctx context.Context) {
+	delay := minReconnectDelay
+	for {
+		listened, err := l.listen(ctx)
+		if ctx.Err() != nil {
+			log.Println("Links listener context done")
+			return
+		}
+		if listened {
+			delay = minReconnectDelay
+		}
+		log.Printf("Links listener disconnected, reconnect in %v. Error: %v", delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			log.Println("Links listener context done")
+			return
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// listen receives notifications with a new connection until an error, it reports whether the channel was listened.
+func (l *Listener) listen(ctx context.Context) (bool, error) {
+	conn, err := pgx.Connect(ctx, l.dsn)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+LinksChannel); err != nil {
+		return false, err
+	}
+	// changes made before listening are missed
+	l.purge()
+	log.Printf("Links listener is listening to %s", LinksChannel)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		var event linksEvent
+		if err = json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Printf("Invalid notification %q. Error: %v", notification.Payload, err)
+			l.purge()
+			continue
+		}
+		if event.All {
+			l.purge()
+		} else {
+			l.invalidate(event.ShortURLS...)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"go-developer-course-shortener/internal/app/repository"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ReplicaCheckInterval is the interval between health checks of replicas.
+const ReplicaCheckInterval = 5 * time.Second
+
+// replica represents a pool of read-only connections, failed replicas are reconnected by health checks.
+type replica struct {
+	dsn string
+
+	mu      sync.RWMutex
+	pool    *pgxpool.Pool
+	healthy bool
+}
+
+// get returns the pool if the replica is healthy.
+func (r *replica) get() (*pgxpool.Pool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool, r.healthy && r.pool != nil
+}
+
+// fail marks the replica unhealthy until the next successful check.
+func (r *replica) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.healthy {
+		log.Printf("Replica is unhealthy. Error: %v", err)
+	}
+	r.healthy = false
+}
+
+// check pings the replica and creates its pool if the replica was not connected.
+// The pool replaces lost connections itself.
+func (r *replica) check(ctx context.Context) {
+	r.mu.RLock()
+	pool := r.pool
+	r.mu.RUnlock()
+
+	var err error
+	if pool == nil {
+		if pool, err = pgxpool.Connect(ctx, r.dsn); err == nil {
+			if err = pool.Ping(ctx); err != nil {
+				pool.Close()
+			}
+		}
+	} else {
+		err = pool.Ping(ctx)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if r.healthy {
+			log.Printf("Replica is unhealthy. Error: %v", err)
+		}
+		r.healthy = false
+		return
+	}
+	if !r.healthy {
+		log.Println("Replica is healthy")
+	}
+	r.pool = pool
+	r.healthy = true
+}
+
+func (r *replica) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pool != nil {
+		r.pool.Close()
+	}
+	r.healthy = false
+}
+
+// AddReplica adds a replica used for reads of links and stats. A replica which can not be connected
+// is added as unhealthy and connected by health checks.
+func (r *DBRepository) AddReplica(ctx context.Context, dsn string) {
+	replica := &replica{dsn: dsn}
+	replica.check(ctx)
+	r.replicas = append(r.replicas, replica)
+}
+
+// SetReadYourWrites sets the time reads of a user and of changed short urls are sent to the primary after writes,
+// so they are not served by lagging replicas. Zero disables pinning.
+func (r *DBRepository) SetReadYourWrites(window time.Duration) {
+	r.pinWindow = window
+}
+
+// RunReplicaChecks checks replicas every interval until the context is done.
+func (r *DBRepository) RunReplicaChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, replica := range r.replicas {
+				replica.check(ctx)
+			}
+			r.unpinExpired()
+		case <-ctx.Done():
+			log.Println("Replica checks context done")
+			return
+		}
+	}
+}
+
+// pinKeys returns keys of pins of the user and of short urls.
+func pinKeys(userID string, shortURLS ...string) []string {
+	keys := make([]string, 0, len(shortURLS)+1)
+	if userID != "" {
+		keys = append(keys, "user:"+userID)
+	}
+	for _, shortURL := range shortURLS {
+		keys = append(keys, "url:"+shortURL)
+	}
+	return keys
+}
+
+// pin sends reads of the user and of the short urls to the primary for the read-your-writes window.
+func (r *DBRepository) pin(userID string, shortURLS ...string) {
+	if r.pinWindow <= 0 || len(r.replicas) == 0 {
+		return
+	}
+	until := r.now().Add(r.pinWindow)
+	r.pinMu.Lock()
+	defer r.pinMu.Unlock()
+	for _, key := range pinKeys(userID, shortURLS...) {
+		r.pinned[key] = until
+	}
+}
+
+// Invalidate pins reads of short urls changed by other instances to the primary for the read-your-writes window,
+// so links evicted from caches by notifications are not read again from lagging replicas.
+func (r *DBRepository) Invalidate(shortURLS ...string) {
+	r.pin("", shortURLS...)
+}
+
+// Purge pins all reads to the primary for the read-your-writes window.
+func (r *DBRepository) Purge() {
+	if r.pinWindow <= 0 || len(r.replicas) == 0 {
+		return
+	}
+	until := r.now().Add(r.pinWindow)
+	r.pinMu.Lock()
+	defer r.pinMu.Unlock()
+	r.pinnedAll = until
+}
+
+// isPinned reports whether one of the keys is pinned to the primary.
+func (r *DBRepository) isPinned(keys []string) bool {
+	if r.pinWindow <= 0 {
+		return false
+	}
+	now := r.now()
+	r.pinMu.Lock()
+	defer r.pinMu.Unlock()
+	if now.Before(r.pinnedAll) {
+		return true
+	}
+	for _, key := range keys {
+		if until, ok := r.pinned[key]; ok && now.Before(until) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *DBRepository) unpinExpired() {
+	now := r.now()
+	r.pinMu.Lock()
+	defer r.pinMu.Unlock()
+	for key, until := range r.pinned {
+		if !now.Before(until) {
+			delete(r.pinned, key)
+		}
+	}
+}
+
+// replica returns the next healthy replica by round robin, nil if keys are pinned or no replica is healthy.
+func (r *DBRepository) replica(keys []string) (*replica, *pgxpool.Pool) {
+	if len(r.replicas) == 0 || r.isPinned(keys) {
+		return nil, nil
+	}
+	start := atomic.AddUint32(&r.next, 1)
+	for i := range r.replicas {
+		replica := r.replicas[(int(start)+i)%len(r.replicas)]
+		if pool, ok := replica.get(); ok {
+			return replica, pool
+		}
+	}
+	return nil, nil
+}
+
+// read runs the query on a replica and on the primary if there is no healthy replica or the replica fails.
+// Errors of the query itself are returned without retry.
+func (r *DBRepository) read(keys []string, query func(pool *pgxpool.Pool) error) error {
+	if replica, pool := r.replica(keys); replica != nil {
+		err := query(pool)
+		if !connectionFailed(err) {
+			return err
+		}
+		replica.fail(err)
+	}
+	return query(r.pool)
+}
+
+// connectionFailed reports whether the error is a failure of the connection to the server, not of the query.
+// Only such errors mark a replica unhealthy, canceled queries and waiting for a connection of a busy pool are not failures.
+func connectionFailed(err error) bool {
+	if err == nil || errors.Is(err, repository.ErrNotFound) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgerrcode.AdminShutdown, pgerrcode.CrashShutdown, pgerrcode.CannotConnectNow:
+			return true
+		}
+		return pgerrcode.IsConnectionException(pgErr.Code)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || pgconn.SafeToRetry(err)
+}
@@ -3,25 +3,89 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"go-developer-course-shortener/internal/app/types"
+	"time"
 )
 
+// ErrNotFound is returned for unknown short urls.
+var ErrNotFound = errors.New("ID not found")
+
 // Repository is the interface that must be implemented by specific repository.
 type Repository interface {
 	// SaveURL saves url to the current repository.
 	SaveURL(userID string, shortURL string, originalURL string) error
 	// SaveBatchURLS saves list of urls to the current repository.
 	SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error)
-	// GetURL returns original url by short url.
+	// GetURL returns original url by short url, ErrNotFound if the short url is unknown.
 	GetURL(shortURL string) (types.OriginalLink, error)
 	// GetShortURLByOriginalURL returns short url by original url.
 	GetShortURLByOriginalURL(originalURL string) (string, error)
 	// GetUserStorage returns list of urls for current user id.
 	GetUserStorage(userID string) ([]types.Link, error)
+	// ExportUserURLS calls visit for every not deleted url of current user id with number of clicks of people.
+	// Urls are read in batches, so the whole list is not kept in memory. Iteration stops on the first error of visit.
+	ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error
+	// ForEachRecord calls visit for every url of all users including deleted urls.
+	// Iteration stops on the first error of visit.
+	ForEachRecord(ctx context.Context, visit func(record types.Record) error) error
+	// SaveRecords saves urls with all attributes as they are, urls with existing short urls are skipped.
+	// It returns number of saved urls.
+	SaveRecords(records []types.Record) (int, error)
+	// ReplaceOriginalURL replaces the stored original url of the short url if it is still oldURL,
+	// ErrNotFound otherwise. It is used to re-encrypt original urls.
+	ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error
+	// GetAllCollections returns collections of all users without number of links.
+	GetAllCollections() ([]types.CollectionRecord, error)
 	// Ping verifies that current repository can accept requests.
 	Ping() bool
-	// DeleteURLS deletes list of short urls for current user id.
+	// DeleteURLS marks list of short urls for current user id as deleted at the current time.
 	DeleteURLS(ctx context.Context, userID string, shortURLS []string) error
+	// RestoreURLS restores short urls of current user id deleted after the time and returns restored short urls.
+	RestoreURLS(userID string, shortURLS []string, deletedAfter time.Time) ([]string, error)
+	// PurgeURLS removes urls deleted before the time with their clicks and returns number of purged urls.
+	// Short urls of purged urls stay reserved by deleted urls without owner unless reuse is set,
+	// then reserved short urls are removed too.
+	PurgeURLS(deletedBefore time.Time, reuse bool) (int, error)
+	// SetSchedule sets activation window for short url of current user id.
+	SetSchedule(userID string, shortURL string, schedule types.Schedule) error
+	// SetTargets replaces target rules for short url of current user id.
+	SetTargets(userID string, shortURL string, targets []types.TargetRule) error
+	// SetVariants replaces weighted variants for short url of current user id.
+	SetVariants(userID string, shortURL string, variants []types.Variant) error
+	// SetPreview sets preview settings for short url of current user id.
+	SetPreview(userID string, shortURL string, preview types.Preview) error
+	// SetMetadata sets title, note and tags for short url of current user id.
+	SetMetadata(userID string, shortURL string, metadata types.Metadata) error
+	// SearchURLS returns urls of current user id matching the query.
+	SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error)
+	// CreateCollection creates a new collection for current user id, names are unique per user.
+	CreateCollection(userID string, collection types.Collection) error
+	// GetCollections returns collections of current user id with number of links.
+	GetCollections(userID string) ([]types.Collection, error)
+	// DeleteCollection deletes collection of current user id, its links are kept without collection.
+	DeleteCollection(userID string, collectionID string) error
+	// MoveURLS moves short urls of current user id to the collection.
+	MoveURLS(userID string, collectionID string, shortURLS []string) error
+	// GetCollectionURLS returns a page of urls in the collection and total number of urls.
+	// Zero limit returns all urls.
+	GetCollectionURLS(userID string, collectionID string, limit int, offset int) ([]types.Link, int, error)
+	// SaveHealth saves results of the health checks by short url.
+	SaveHealth(results map[string]types.Health) error
+	// GetHealthCheckURLS returns up to limit urls which were never checked or checked before the time.
+	// Urls with the oldest checks are returned first, deleted urls are skipped.
+	GetHealthCheckURLS(checkedBefore time.Time, limit int) ([]types.Link, error)
+	// SavePage saves metadata of the destination page for short url.
+	SavePage(shortURL string, page types.Page) error
+	// SaveClicks saves visits of short urls in one batch.
+	SaveClicks(clicks []types.Click) error
+	// GetClickStats returns click counters for short url, visits of bots are counted as clicks if includeBots is set.
+	GetClickStats(shortURL string, includeBots bool) (types.ClickStats, error)
+	// GetClickReport returns top values of the dimension by clicks of people, counted from click rollups.
+	GetClickReport(query types.ReportQuery) ([]types.ReportItem, error)
+	// PurgeClicks deletes single clicks saved before the time and returns number of deleted clicks.
+	// Deleted clicks stay counted in rollups.
+	PurgeClicks(before time.Time) (int, error)
 	// GetInternalStats returns internal stats for repository.
 	GetInternalStats() (int, int, error)
 	// ReleaseStorage releases current storage.
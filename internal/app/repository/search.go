@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"go-developer-course-shortener/internal/app/types"
+	"strings"
+	"unicode"
+)
+
+// SearchWords splits text into lower case words, punctuation of urls separates words too.
+// Postgres repository builds the same words with regexp_replace and 'simple' text search configuration.
+func SearchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchesQuery reports whether the link has all tags of the query
+// and all words of the query text are found in title, note or original url.
+func matchesQuery(link types.Link, query types.SearchQuery) bool {
+	for _, tag := range query.Tags {
+		if !contains(link.Tags, tag) {
+			return false
+		}
+	}
+
+	words := SearchWords(query.Text)
+	if len(words) == 0 {
+		return true
+	}
+	document := SearchWords(link.Title + " " + link.Note + " " + link.OriginalURL)
+	for _, word := range words {
+		if !contains(document, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
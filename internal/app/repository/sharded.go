@@ -0,0 +1,711 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/hll"
+	"go-developer-course-shortener/internal/app/rollup"
+	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/app/urlcrypt"
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ShardedRepository implements Repository interface in memory for many cores.
+// Links are split across shards by a hash of the short url, users and original urls are indexed in their own shards.
+// Links are immutable values replaced on every change, so lookups of short urls take no locks and do not allocate.
+// Every shard keeps click rollups of its links, so redirects of different links do not contend.
+//
+// Locks of user shards are taken before locks of link shards, never the other way round.
+type ShardedRepository struct {
+	mask      uint32
+	links     []*linkShard
+	users     []*userShard
+	originals []*originalShard
+}
+
+type linkShard struct {
+	// mu serializes changes of links, readers load links without it
+	mu    sync.Mutex
+	links sync.Map // short url -> *types.OriginalLink
+	count int64
+
+	clicks    *rollup.Table
+	uniquesMu sync.Mutex
+	uniques   map[string]hll.Days
+}
+
+type userShard struct {
+	mu          sync.RWMutex
+	urls        map[string][]string
+	collections map[string][]types.Collection
+}
+
+type originalShard struct {
+	mu  sync.RWMutex
+	ids map[string]string
+}
+
+// check that ShardedRepository implements all required methods
+var _ Repository = (*ShardedRepository)(nil)
+
+// shardHash is the 32-bit FNV-1a hash of the key, it is inlined to hash strings without allocations.
+func shardHash(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return hash
+}
+
+func (r *ShardedRepository) linkShard(shortURL string) *linkShard {
+	return r.links[shardHash(shortURL)&r.mask]
+}
+
+func (r *ShardedRepository) userShard(userID string) *userShard {
+	return r.users[shardHash(userID)&r.mask]
+}
+
+func (r *ShardedRepository) originalShard(originalURL string) *originalShard {
+	return r.originals[shardHash(originalURL)&r.mask]
+}
+
+// load returns the link of the short url, it must not be changed.
+func (s *linkShard) load(shortURL string) (*types.OriginalLink, bool) {
+	v, ok := s.links.Load(shortURL)
+	if !ok {
+		return nil, false
+	}
+	return v.(*types.OriginalLink), true
+}
+
+// insert adds the link if the short url is unknown and reports whether it was added.
+func (s *linkShard) insert(shortURL string, link types.OriginalLink) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links.Load(shortURL); ok {
+		return false
+	}
+	s.links.Store(shortURL, &link)
+	s.count++
+	return true
+}
+
+func (s *linkShard) remove(shortURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links.Load(shortURL); ok {
+		s.links.Delete(shortURL)
+		s.count--
+	}
+}
+
+// update replaces the link of the short url by its copy changed by change, it reports whether the link was changed.
+func (r *ShardedRepository) update(shortURL string, change func(link *types.OriginalLink) bool) bool {
+	shard := r.linkShard(shortURL)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	current, ok := shard.load(shortURL)
+	if !ok {
+		return false
+	}
+	link := *current
+	if !change(&link) {
+		return false
+	}
+	shard.links.Store(shortURL, &link)
+	return true
+}
+
+// updateOwned changes the link of the short url if it belongs to the user, ErrNotFound otherwise.
+func (r *ShardedRepository) updateOwned(userID string, shortURL string, change func(link *types.OriginalLink)) error {
+	updated := r.update(shortURL, func(link *types.OriginalLink) bool {
+		if link.UserID != userID {
+			return false
+		}
+		change(link)
+		return true
+	})
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// index adds the saved link to indexes of users and original urls, purged links are not indexed.
+func (r *ShardedRepository) index(userID string, shortURL string, originalURL string) {
+	if userID == "" {
+		return
+	}
+	users := r.userShard(userID)
+	users.mu.Lock()
+	users.urls[userID] = append(users.urls[userID], shortURL)
+	users.mu.Unlock()
+
+	key := urlcrypt.LookupKey(originalURL)
+	originals := r.originalShard(key)
+	originals.mu.Lock()
+	if _, ok := originals.ids[key]; !ok {
+		originals.ids[key] = shortURL
+	}
+	originals.mu.Unlock()
+}
+
+// userURLS returns a copy of short urls of the user.
+func (r *ShardedRepository) userURLS(userID string) ([]string, bool) {
+	users := r.userShard(userID)
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+	ids, ok := users.urls[userID]
+	return append([]string(nil), ids...), ok
+}
+
+func (r *ShardedRepository) GetInternalStats() (int, int, error) {
+	urls := 0
+	for _, shard := range r.links {
+		shard.mu.Lock()
+		urls += int(shard.count)
+		shard.mu.Unlock()
+	}
+	users := 0
+	for _, shard := range r.users {
+		shard.mu.RLock()
+		users += len(shard.urls)
+		shard.mu.RUnlock()
+	}
+	return urls, users, nil
+}
+
+func (r *ShardedRepository) SaveURL(userID string, shortURL string, originalURL string) error {
+	link := types.OriginalLink{UserID: userID, OriginalURL: originalURL, CreatedAt: time.Now()}
+	if !r.linkShard(shortURL).insert(shortURL, link) {
+		return fmt.Errorf("short url %s already exists", shortURL)
+	}
+	r.index(userID, shortURL, originalURL)
+	return nil
+}
+
+// SaveBatchURLS saves all links or none of them if one of short urls already exists.
+// Links saved before the conflict are removed again, lookups may see them in the meantime.
+func (r *ShardedRepository) SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error) {
+	now := time.Now()
+	for i, v := range links {
+		link := types.OriginalLink{UserID: userID, OriginalURL: v.OriginalURL, Metadata: v.Metadata, CreatedAt: now}
+		if !r.linkShard(v.ShortURL).insert(v.ShortURL, link) {
+			for _, saved := range links[:i] {
+				r.linkShard(saved.ShortURL).remove(saved.ShortURL)
+			}
+			return nil, fmt.Errorf("short url %s already exists", v.ShortURL)
+		}
+	}
+
+	response := make(types.ResponseBatch, len(links)) // allocate required capacity for the links
+	for i, v := range links {
+		r.index(userID, v.ShortURL, v.OriginalURL)
+		response[i] = types.ResponseBatchJSON{CorrelationID: v.CorrelationID, ShortURL: v.ShortURL}
+	}
+	return response, nil
+}
+
+// GetURL loads the link without locks.
+func (r *ShardedRepository) GetURL(shortURL string) (types.OriginalLink, error) {
+	link, ok := r.linkShard(shortURL).load(shortURL)
+	if !ok {
+		return types.OriginalLink{}, ErrNotFound
+	}
+	return *link, nil
+}
+
+func (r *ShardedRepository) GetShortURLByOriginalURL(originalURL string) (string, error) {
+	key := urlcrypt.LookupKey(originalURL)
+	originals := r.originalShard(key)
+	originals.mu.RLock()
+	defer originals.mu.RUnlock()
+	shortURL, ok := originals.ids[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return shortURL, nil
+}
+
+func (r *ShardedRepository) GetUserStorage(userID string) ([]types.Link, error) {
+	ids, ok := r.userURLS(userID)
+	if !ok {
+		return nil, errors.New("UserID not found")
+	}
+
+	links := make([]types.Link, 0, len(ids)) // allocate required capacity for the links
+	for _, id := range ids {
+		if link, ok := r.linkShard(id).load(id); ok {
+			links = append(links, toLink(id, link))
+		}
+	}
+	return links, nil
+}
+
+func toLink(shortURL string, link *types.OriginalLink) types.Link {
+	return types.Link{ShortURL: shortURL, OriginalURL: link.OriginalURL, Collection: link.Collection,
+		Metadata: link.Metadata, Health: link.Health, Page: link.Page}
+}
+
+func (r *ShardedRepository) ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error {
+	ids, _ := r.userURLS(userID)
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		shard := r.linkShard(id)
+		link, ok := shard.load(id)
+		if !ok || link.Deleted {
+			continue
+		}
+		export := types.ExportLink{Link: toLink(id, link), CreatedAt: link.CreatedAt, Clicks: shard.clicks.Total(id)}
+		if err := visit(export); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ShardedRepository) ForEachRecord(ctx context.Context, visit func(record types.Record) error) error {
+	var ids []string
+	for _, shard := range r.links {
+		shard.links.Range(func(key, _ interface{}) bool {
+			ids = append(ids, key.(string))
+			return true
+		})
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		link, ok := r.linkShard(id).load(id)
+		if !ok {
+			continue
+		}
+		if err := visit(types.Record{ShortURL: id, OriginalLink: *link}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ShardedRepository) SaveRecords(records []types.Record) (int, error) {
+	saved := 0
+	for _, record := range records {
+		if !r.linkShard(record.ShortURL).insert(record.ShortURL, record.OriginalLink) {
+			continue
+		}
+		r.index(record.UserID, record.ShortURL, record.OriginalURL)
+		saved++
+	}
+	return saved, nil
+}
+
+func (r *ShardedRepository) GetAllCollections() ([]types.CollectionRecord, error) {
+	var records []types.CollectionRecord
+	for _, shard := range r.users {
+		shard.mu.RLock()
+		for userID, collections := range shard.collections {
+			for _, collection := range collections {
+				records = append(records, types.CollectionRecord{UserID: userID, Collection: collection})
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return records, nil
+}
+
+func (r *ShardedRepository) Ping() bool {
+	return true
+}
+
+// DeleteURLS marks links of the user as deleted, links of other users are skipped.
+func (r *ShardedRepository) DeleteURLS(ctx context.Context, userID string, shortURLS []string) error {
+	now := time.Now()
+	for _, shortURL := range shortURLS {
+		r.update(shortURL, func(link *types.OriginalLink) bool {
+			if link.UserID != userID || link.Deleted {
+				return false
+			}
+			link.Deleted = true
+			link.DeletedAt = now
+			return true
+		})
+	}
+	return nil
+}
+
+func (r *ShardedRepository) RestoreURLS(userID string, shortURLS []string, deletedAfter time.Time) ([]string, error) {
+	var restored []string
+	for _, shortURL := range shortURLS {
+		updated := r.update(shortURL, func(link *types.OriginalLink) bool {
+			if !restorable(link, userID, deletedAfter) {
+				return false
+			}
+			link.Deleted = false
+			link.DeletedAt = time.Time{}
+			return true
+		})
+		if updated {
+			restored = append(restored, shortURL)
+		}
+	}
+	return restored, nil
+}
+
+// PurgeURLS finds purged links without locks, then every link is purged if it is still purgeable.
+func (r *ShardedRepository) PurgeURLS(deletedBefore time.Time, reuse bool) (int, error) {
+	var shortURLS []string
+	for _, shard := range r.links {
+		shard.links.Range(func(key, value interface{}) bool {
+			if purgeable(value.(*types.OriginalLink), deletedBefore, reuse) {
+				shortURLS = append(shortURLS, key.(string))
+			}
+			return true
+		})
+	}
+
+	purged := 0
+	for _, shortURL := range shortURLS {
+		link, ok := r.purge(shortURL, deletedBefore, reuse)
+		if !ok {
+			continue
+		}
+		purged++
+		if link.UserID != "" {
+			users := r.userShard(link.UserID)
+			users.mu.Lock()
+			users.urls[link.UserID] = removeShortURL(users.urls[link.UserID], shortURL)
+			if len(users.urls[link.UserID]) == 0 {
+				delete(users.urls, link.UserID)
+			}
+			users.mu.Unlock()
+		}
+		if link.OriginalURL != "" {
+			key := urlcrypt.LookupKey(link.OriginalURL)
+			originals := r.originalShard(key)
+			originals.mu.Lock()
+			if originals.ids[key] == shortURL {
+				delete(originals.ids, key)
+			}
+			originals.mu.Unlock()
+		}
+	}
+	return purged, nil
+}
+
+// purge removes the link of the short url or replaces it by the purged link and drops its clicks.
+// It returns the purged link and reports whether the link was purgeable.
+func (r *ShardedRepository) purge(shortURL string, deletedBefore time.Time, reuse bool) (types.OriginalLink, bool) {
+	shard := r.linkShard(shortURL)
+	shard.mu.Lock()
+	link, ok := shard.load(shortURL)
+	if !ok || !purgeable(link, deletedBefore, reuse) {
+		shard.mu.Unlock()
+		return types.OriginalLink{}, false
+	}
+	if reuse {
+		shard.links.Delete(shortURL)
+		shard.count--
+	} else {
+		purged := purgedLink(*link)
+		shard.links.Store(shortURL, &purged)
+	}
+	shard.mu.Unlock()
+
+	shard.clicks.Delete(shortURL)
+	shard.uniquesMu.Lock()
+	delete(shard.uniques, shortURL)
+	shard.uniquesMu.Unlock()
+	return *link, true
+}
+
+func (r *ShardedRepository) SetSchedule(userID string, shortURL string, schedule types.Schedule) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Schedule = schedule
+	})
+}
+
+func (r *ShardedRepository) SetTargets(userID string, shortURL string, targets []types.TargetRule) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Targets = targets
+	})
+}
+
+func (r *ShardedRepository) SetVariants(userID string, shortURL string, variants []types.Variant) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Variants = variants
+	})
+}
+
+func (r *ShardedRepository) SetPreview(userID string, shortURL string, preview types.Preview) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Preview = preview
+	})
+}
+
+func (r *ShardedRepository) SetMetadata(userID string, shortURL string, metadata types.Metadata) error {
+	return r.updateOwned(userID, shortURL, func(link *types.OriginalLink) {
+		link.Metadata = metadata
+	})
+}
+
+// ReplaceOriginalURL moves the short url to the lookup key of the new url if the key is changed.
+func (r *ShardedRepository) ReplaceOriginalURL(shortURL string, oldURL string, newURL string) error {
+	updated := r.update(shortURL, func(link *types.OriginalLink) bool {
+		if link.OriginalURL != oldURL {
+			return false
+		}
+		link.OriginalURL = newURL
+		return true
+	})
+	if !updated {
+		return ErrNotFound
+	}
+
+	oldKey, newKey := urlcrypt.LookupKey(oldURL), urlcrypt.LookupKey(newURL)
+	if oldKey == newKey {
+		return nil
+	}
+	originals := r.originalShard(oldKey)
+	originals.mu.Lock()
+	if originals.ids[oldKey] == shortURL {
+		delete(originals.ids, oldKey)
+	}
+	originals.mu.Unlock()
+	originals = r.originalShard(newKey)
+	originals.mu.Lock()
+	if _, ok := originals.ids[newKey]; !ok {
+		originals.ids[newKey] = shortURL
+	}
+	originals.mu.Unlock()
+	return nil
+}
+
+func (r *ShardedRepository) SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error) {
+	ids, _ := r.userURLS(userID)
+	var links []types.Link
+	for _, id := range ids {
+		link, ok := r.linkShard(id).load(id)
+		if !ok {
+			continue
+		}
+		if found := toLink(id, link); matchesQuery(found, query) {
+			links = append(links, found)
+		}
+	}
+	return links, nil
+}
+
+func (r *ShardedRepository) CreateCollection(userID string, collection types.Collection) error {
+	users := r.userShard(userID)
+	users.mu.Lock()
+	defer users.mu.Unlock()
+	if hasCollectionName(users.collections[userID], collection.Name) {
+		return errors.New("collection already exists")
+	}
+	collection.Links = 0
+	users.collections[userID] = append(users.collections[userID], collection)
+	return nil
+}
+
+func (r *ShardedRepository) GetCollections(userID string) ([]types.Collection, error) {
+	users := r.userShard(userID)
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+	collections := make([]types.Collection, len(users.collections[userID]))
+	copy(collections, users.collections[userID])
+	for _, id := range users.urls[userID] {
+		if link, ok := r.linkShard(id).load(id); ok && !link.Deleted {
+			if i := findCollection(collections, link.Collection); i >= 0 {
+				collections[i].Links++
+			}
+		}
+	}
+	return collections, nil
+}
+
+func (r *ShardedRepository) DeleteCollection(userID string, collectionID string) error {
+	users := r.userShard(userID)
+	users.mu.Lock()
+	defer users.mu.Unlock()
+	collections := users.collections[userID]
+	i := findCollection(collections, collectionID)
+	if i < 0 {
+		return errors.New("collection not found")
+	}
+	users.collections[userID] = append(collections[:i:i], collections[i+1:]...)
+	for _, id := range users.urls[userID] {
+		r.update(id, func(link *types.OriginalLink) bool {
+			if link.Collection != collectionID {
+				return false
+			}
+			link.Collection = ""
+			return true
+		})
+	}
+	return nil
+}
+
+// MoveURLS holds the lock of the user shard, so the collection is not deleted while links are moved.
+func (r *ShardedRepository) MoveURLS(userID string, collectionID string, shortURLS []string) error {
+	users := r.userShard(userID)
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+	if findCollection(users.collections[userID], collectionID) < 0 {
+		return errors.New("collection not found")
+	}
+	moved := false
+	for _, shortURL := range shortURLS {
+		if r.updateOwned(userID, shortURL, func(link *types.OriginalLink) { link.Collection = collectionID }) == nil {
+			moved = true
+		}
+	}
+	if !moved {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *ShardedRepository) GetCollectionURLS(userID string, collectionID string, limit int, offset int) ([]types.Link, int, error) {
+	users := r.userShard(userID)
+	users.mu.RLock()
+	defer users.mu.RUnlock()
+	if findCollection(users.collections[userID], collectionID) < 0 {
+		return nil, 0, errors.New("collection not found")
+	}
+	var links []types.Link
+	for _, id := range users.urls[userID] {
+		if link, ok := r.linkShard(id).load(id); ok && !link.Deleted && link.Collection == collectionID {
+			links = append(links, toLink(id, link))
+		}
+	}
+	return pageLinks(links, limit, offset), len(links), nil
+}
+
+func (r *ShardedRepository) SaveHealth(results map[string]types.Health) error {
+	for shortURL, health := range results {
+		health := health
+		r.update(shortURL, func(link *types.OriginalLink) bool {
+			link.Health = &health
+			return true
+		})
+	}
+	return nil
+}
+
+func (r *ShardedRepository) GetHealthCheckURLS(checkedBefore time.Time, limit int) ([]types.Link, error) {
+	var links []types.Link
+	for _, shard := range r.links {
+		shard.links.Range(func(key, value interface{}) bool {
+			link := value.(*types.OriginalLink)
+			if !link.Deleted && needsHealthCheck(link.Health, checkedBefore) {
+				links = append(links, types.Link{ShortURL: key.(string), OriginalURL: link.OriginalURL, Health: link.Health})
+			}
+			return true
+		})
+	}
+	return oldestChecks(links, limit), nil
+}
+
+func (r *ShardedRepository) SavePage(shortURL string, page types.Page) error {
+	updated := r.update(shortURL, func(link *types.OriginalLink) bool {
+		link.Page = &page
+		return true
+	})
+	if !updated {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveClicks adds clicks to rollups of shards of short urls, single clicks are not kept.
+func (r *ShardedRepository) SaveClicks(clicks []types.Click) error {
+	for _, click := range clicks {
+		r.saveClick(click)
+	}
+	return nil
+}
+
+func (r *ShardedRepository) saveClick(click types.Click) {
+	shard := r.linkShard(click.ShortURL)
+	shard.clicks.Add(click, 1)
+	if click.Visitor == 0 {
+		return
+	}
+
+	shard.uniquesMu.Lock()
+	defer shard.uniquesMu.Unlock()
+	days, ok := shard.uniques[click.ShortURL]
+	if !ok {
+		days = make(hll.Days)
+		shard.uniques[click.ShortURL] = days
+	}
+	register, rank := hll.Position(click.Visitor)
+	days.Set(click.Time.UTC().Format(types.DayLayout), register, rank)
+}
+
+func (r *ShardedRepository) GetClickStats(shortURL string, includeBots bool) (types.ClickStats, error) {
+	shard := r.linkShard(shortURL)
+	stats := shard.clicks.Stats(shortURL, includeBots)
+	shard.uniquesMu.Lock()
+	defer shard.uniquesMu.Unlock()
+	stats.Uniques, stats.UniquesByDay = shard.uniques[shortURL].Estimates()
+	return stats, nil
+}
+
+// GetClickReport sums all values of every shard before the top values are taken.
+func (r *ShardedRepository) GetClickReport(query types.ReportQuery) ([]types.ReportItem, error) {
+	all := query
+	all.Limit = 0
+	totals := make(map[string]int)
+	for _, shard := range r.links {
+		for _, item := range shard.clicks.Report(all) {
+			totals[item.Key] += item.Clicks
+		}
+	}
+	return rollup.Top(totals, query.Limit), nil
+}
+
+// PurgeClicks does nothing, single clicks are not kept in memory.
+func (r *ShardedRepository) PurgeClicks(before time.Time) (int, error) {
+	return 0, nil
+}
+
+func (r *ShardedRepository) ReleaseStorage() {
+	log.Println("Storage released")
+}
+
+// NewShardedRepository returns a new ShardedRepository with the number of shards rounded up to a power of two.
+// Zero shards use four shards per core.
+func NewShardedRepository(shards int) *ShardedRepository {
+	if shards <= 0 {
+		shards = 4 * runtime.GOMAXPROCS(0)
+	}
+	size := 1
+	for size < shards {
+		size <<= 1
+	}
+	log.Printf("Sharded memory storage of %d shards is used", size)
+
+	r := &ShardedRepository{
+		mask:      uint32(size - 1),
+		links:     make([]*linkShard, size),
+		users:     make([]*userShard, size),
+		originals: make([]*originalShard, size),
+	}
+	for i := 0; i < size; i++ {
+		r.links[i] = &linkShard{clicks: rollup.NewTable(), uniques: make(map[string]hll.Days)}
+		r.users[i] = &userShard{urls: make(map[string][]string), collections: make(map[string][]types.Collection)}
+		r.originals[i] = &originalShard{ids: make(map[string]string)}
+	}
+	return r
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/types"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedRepository(t *testing.T) {
+	storage := NewShardedRepository(3)
+	assert.Len(t, storage.links, 4, "number of shards must be rounded up to a power of two")
+
+	require.NoError(t, storage.SaveURL("user1", "a", "https://a.example"))
+	require.Error(t, storage.SaveURL("user2", "a", "https://x.example"), "short urls must be unique")
+	_, err := storage.SaveBatchURLS("user1", types.BatchLinks{
+		{CorrelationID: "1", ShortURL: "b", OriginalURL: "https://b.example"},
+		{CorrelationID: "2", ShortURL: "a", OriginalURL: "https://y.example"},
+	})
+	require.Error(t, err)
+	_, err = storage.GetURL("b")
+	assert.ErrorIs(t, err, ErrNotFound, "links of the failed batch must be removed")
+	response, err := storage.SaveBatchURLS("user1", types.BatchLinks{
+		{CorrelationID: "1", ShortURL: "b", OriginalURL: "https://b.example"},
+		{CorrelationID: "2", ShortURL: "c", OriginalURL: "https://c.example", Metadata: types.Metadata{Tags: []string{"go"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, types.ResponseBatch{{CorrelationID: "1", ShortURL: "b"}, {CorrelationID: "2", ShortURL: "c"}}, response)
+
+	link, err := storage.GetURL("a")
+	require.NoError(t, err)
+	assert.Equal(t, "user1", link.UserID)
+	assert.Equal(t, "https://a.example", link.OriginalURL)
+	shortURL, err := storage.GetShortURLByOriginalURL("https://c.example")
+	require.NoError(t, err)
+	assert.Equal(t, "c", shortURL)
+	_, err = storage.GetShortURLByOriginalURL("https://unknown.example")
+	assert.ErrorIs(t, err, ErrNotFound)
+	links, err := storage.GetUserStorage("user1")
+	require.NoError(t, err)
+	assert.Len(t, links, 3)
+	_, err = storage.GetUserStorage("user2")
+	assert.Error(t, err)
+	urls, users, err := storage.GetInternalStats()
+	require.NoError(t, err)
+	assert.Equal(t, 3, urls)
+	assert.Equal(t, 1, users)
+
+	// links of other users are not changed
+	assert.ErrorIs(t, storage.SetMetadata("user2", "a", types.Metadata{Title: "A"}), ErrNotFound)
+	require.NoError(t, storage.SetMetadata("user1", "a", types.Metadata{Title: "A"}))
+	link, err = storage.GetURL("a")
+	require.NoError(t, err)
+	assert.Equal(t, "A", link.Metadata.Title)
+	found, err := storage.SearchURLS("user1", types.SearchQuery{Tags: []string{"go"}})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "c", found[0].ShortURL)
+
+	require.NoError(t, storage.CreateCollection("user1", types.Collection{ID: "c1", Name: "Work"}))
+	require.Error(t, storage.CreateCollection("user1", types.Collection{ID: "c2", Name: "Work"}))
+	require.NoError(t, storage.MoveURLS("user1", "c1", []string{"a", "b"}))
+	collectionLinks, total, err := storage.GetCollectionURLS("user1", "c1", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Len(t, collectionLinks, 1)
+	collections, err := storage.GetCollections("user1")
+	require.NoError(t, err)
+	assert.Equal(t, []types.Collection{{ID: "c1", Name: "Work", Links: 2}}, collections)
+	require.NoError(t, storage.DeleteCollection("user1", "c1"))
+	link, err = storage.GetURL("b")
+	require.NoError(t, err)
+	assert.Empty(t, link.Collection)
+
+	require.NoError(t, storage.DeleteURLS(context.Background(), "user2", []string{"a"}))
+	require.NoError(t, storage.DeleteURLS(context.Background(), "user1", []string{"b"}))
+	link, err = storage.GetURL("a")
+	require.NoError(t, err)
+	assert.False(t, link.Deleted)
+	link, err = storage.GetURL("b")
+	require.NoError(t, err)
+	assert.True(t, link.Deleted)
+
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.SaveHealth(map[string]types.Health{"a": {StatusCode: 200, CheckedAt: now}}))
+	checks, err := storage.GetHealthCheckURLS(now.Add(-time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, checks, 1, "checked and deleted links must be skipped")
+	assert.Equal(t, "c", checks[0].ShortURL)
+	assert.ErrorIs(t, storage.SavePage("x", types.Page{Title: "X"}), ErrNotFound)
+}
+
+func TestShardedRepository_Clicks(t *testing.T) {
+	storage := NewShardedRepository(4)
+	created := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		shortURL := "http://localhost:8080/" + strconv.Itoa(i%5)
+		country := "DE"
+		if i%2 == 0 {
+			country = "FR"
+		}
+		require.NoError(t, storage.SaveClicks([]types.Click{{UserID: "user1", ShortURL: shortURL, Class: types.ClickHuman,
+			Country: country, Visitor: uint64(i%3+1) * 0x9E3779B97F4A7C15, Time: created}}))
+	}
+
+	stats, err := storage.GetClickStats("http://localhost:8080/0", false)
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.Total)
+	assert.EqualValues(t, 3, stats.Uniques)
+
+	// values of all shards are summed before the top values are taken
+	report, err := storage.GetClickReport(types.ReportQuery{Dimension: types.ReportCountries, From: created.Add(-time.Hour),
+		To: created.Add(time.Hour), Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []types.ReportItem{{Key: "DE", Clicks: 10}}, report)
+	report, err = storage.GetClickReport(types.ReportQuery{Dimension: types.ReportLinks, From: created.Add(-time.Hour),
+		To: created.Add(time.Hour), Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, report, 5)
+}
+
+func TestShardedRepository_Concurrent(t *testing.T) {
+	storage := NewShardedRepository(8)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			userID := "user" + strconv.Itoa(w)
+			for i := 0; i < 200; i++ {
+				shortURL := userID + "/" + strconv.Itoa(i)
+				assert.NoError(t, storage.SaveURL(userID, shortURL, "https://"+shortURL))
+				assert.NoError(t, storage.SetMetadata(userID, shortURL, types.Metadata{Title: shortURL}))
+				link, err := storage.GetURL(shortURL)
+				assert.NoError(t, err)
+				assert.Equal(t, shortURL, link.Metadata.Title)
+				assert.NoError(t, storage.SaveClicks([]types.Click{{UserID: userID, ShortURL: shortURL, Visitor: 1, Time: time.Now()}}))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	urls, users, err := storage.GetInternalStats()
+	require.NoError(t, err)
+	assert.Equal(t, 1600, urls)
+	assert.Equal(t, 8, users)
+	var records int
+	err = storage.ForEachRecord(context.Background(), func(record types.Record) error {
+		records++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1600, records)
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/hll"
+	"go-developer-course-shortener/internal/app/rollup"
+	"go-developer-course-shortener/internal/app/types"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// snapshotVersion is the version of the snapshot format, snapshots of other versions are not restored.
+const snapshotVersion = 1
+
+// snapshotFile is the content of the snapshot file, Checksum is hex SHA-256 of Data.
+type snapshotFile struct {
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// memorySnapshot is the state of the memory storage, links and collections are kept in the records of the file storage.
+type memorySnapshot struct {
+	Links       []*fileRecord          `json:"links"`
+	Collections []fileCollectionRecord `json:"collections"`
+	Rollups     []rollup.Bucket        `json:"rollups"`
+	Uniques     []fileUniquesRecord    `json:"uniques"`
+}
+
+// snapshot returns the current state, links of every user are kept in order of creation.
+// Links without an owner, such as links left by purges to keep their short urls reserved, follow sorted by short url.
+func (r *InMemoryRepository) snapshot() (*memorySnapshot, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	users := make([]string, 0, len(r.inMemoryUserStorage))
+	for userID := range r.inMemoryUserStorage {
+		users = append(users, userID)
+	}
+	for userID := range r.collections {
+		if _, ok := r.inMemoryUserStorage[userID]; !ok {
+			users = append(users, userID)
+		}
+	}
+	sort.Strings(users)
+
+	snapshot := &memorySnapshot{Links: make([]*fileRecord, 0, len(r.inMemoryMap)), Rollups: r.clicks.Buckets()}
+	owned := make(map[string]bool, len(r.inMemoryMap))
+	for _, userID := range users {
+		for _, id := range r.inMemoryUserStorage[userID] {
+			if l, ok := r.inMemoryMap[id]; ok {
+				snapshot.Links = append(snapshot.Links, newFileRecord(types.Record{ShortURL: id, OriginalLink: l.link}))
+				owned[id] = true
+			}
+		}
+		for _, collection := range r.collections[userID] {
+			snapshot.Collections = append(snapshot.Collections, fileCollectionRecord{UserID: userID, ID: collection.ID, Name: collection.Name})
+		}
+	}
+	var unowned []string
+	for id := range r.inMemoryMap {
+		if !owned[id] {
+			unowned = append(unowned, id)
+		}
+	}
+	sort.Strings(unowned)
+	for _, id := range unowned {
+		snapshot.Links = append(snapshot.Links, newFileRecord(types.Record{ShortURL: id, OriginalLink: r.inMemoryMap[id].link}))
+	}
+	for shortURL, days := range r.uniques {
+		for day, sketch := range days {
+			data, err := sketch.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			snapshot.Uniques = append(snapshot.Uniques, fileUniquesRecord{ID: shortURL, Day: day, Sketch: data})
+		}
+	}
+	return snapshot, nil
+}
+
+// WriteSnapshot writes the current state to the file at the path.
+// The snapshot is written next to the path and renamed, so a previous snapshot is replaced only by a complete one.
+func (r *InMemoryRepository) WriteSnapshot(path string) error {
+	r.snapshotMu.Lock()
+	defer r.snapshotMu.Unlock()
+	snapshot, err := r.snapshot()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(data)
+	content, err := json.Marshal(&snapshotFile{Version: snapshotVersion, Checksum: hex.EncodeToString(checksum[:]), Data: data})
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err = temp.Write(content); err != nil {
+		temp.Close()
+		return err
+	}
+	// the snapshot must be on disk before it replaces the previous one
+	if err = temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+	log.Printf("Memory snapshot written to %s: %d links", path, len(snapshot.Links))
+	return nil
+}
+
+// RestoreSnapshot adds links, collections and clicks of the snapshot at the path to the storage.
+// A missing snapshot is not an error, a snapshot of another version or with a wrong checksum is.
+func (r *InMemoryRepository) RestoreSnapshot(path string) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Memory snapshot %s not found", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file snapshotFile
+	if err = json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if file.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", file.Version)
+	}
+	checksum := sha256.Sum256(file.Data)
+	if hex.EncodeToString(checksum[:]) != file.Checksum {
+		return errors.New("snapshot checksum mismatch")
+	}
+	var snapshot memorySnapshot
+	if err = json.Unmarshal(file.Data, &snapshot); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+
+	uniques := make(map[string]hll.Days)
+	for _, record := range snapshot.Uniques {
+		sketch := hll.New()
+		if err = sketch.UnmarshalBinary(record.Sketch); err != nil {
+			return err
+		}
+		if _, ok := uniques[record.ID]; !ok {
+			uniques[record.ID] = make(hll.Days)
+		}
+		uniques[record.ID].Merge(record.Day, sketch)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, record := range snapshot.Links {
+		if _, ok := r.inMemoryMap[record.ID]; ok {
+			continue
+		}
+		r.inMemoryMap[record.ID] = &inMemoryLink{userID: record.UserID, link: record.originalLink()}
+		if record.UserID != "" {
+			r.inMemoryUserStorage[record.UserID] = append(r.inMemoryUserStorage[record.UserID], record.ID)
+		}
+	}
+	for _, record := range snapshot.Collections {
+		if findCollection(r.collections[record.UserID], record.ID) < 0 {
+			r.collections[record.UserID] = append(r.collections[record.UserID], types.Collection{ID: record.ID, Name: record.Name})
+		}
+	}
+	for _, bucket := range snapshot.Rollups {
+		r.clicks.AddBucket(bucket)
+	}
+	for shortURL, days := range uniques {
+		current, ok := r.uniques[shortURL]
+		if !ok {
+			current = make(hll.Days)
+			r.uniques[shortURL] = current
+		}
+		for day, sketch := range days {
+			current.Merge(day, sketch)
+		}
+	}
+	log.Printf("Memory snapshot %s restored: %d links", path, len(snapshot.Links))
+	return nil
+}
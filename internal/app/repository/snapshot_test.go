@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"go-developer-course-shortener/internal/app/types"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.snapshot")
+	storage, err := NewSnapshotRepository(path)
+	require.NoError(t, err, "missing snapshot must be restored as empty storage")
+
+	created := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	_, err = storage.SaveRecords([]types.Record{
+		{ShortURL: "http://localhost:8080/a", OriginalLink: types.OriginalLink{UserID: "user1", OriginalURL: "https://a.example",
+			Variants: []types.Variant{{Name: "b", URL: "https://b.example", Weight: 1}}, Metadata: types.Metadata{Tags: []string{"go"}},
+			Collection: "c1", CreatedAt: created}},
+		{ShortURL: "http://localhost:8080/b", OriginalLink: types.OriginalLink{UserID: "user1", OriginalURL: "https://b.example", Deleted: true, CreatedAt: created}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, storage.CreateCollection("user1", types.Collection{ID: "c1", Name: "Work"}))
+	require.NoError(t, storage.CreateCollection("user2", types.Collection{ID: "c2", Name: "Empty"}))
+	require.NoError(t, storage.SaveClicks([]types.Click{{UserID: "user1", ShortURL: "http://localhost:8080/a", Variant: "b",
+		Country: "DE", Visitor: 42, Time: created}}))
+	stats, err := storage.GetClickStats("http://localhost:8080/a", false)
+	require.NoError(t, err)
+
+	// the final snapshot is written on release
+	storage.ReleaseStorage()
+	restored, err := NewSnapshotRepository(path)
+	require.NoError(t, err)
+
+	for _, shortURL := range []string{"http://localhost:8080/a", "http://localhost:8080/b"} {
+		want, err := storage.GetURL(shortURL)
+		require.NoError(t, err)
+		got, err := restored.GetURL(shortURL)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	links, err := restored.GetUserStorage("user1")
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+	collections, err := restored.GetCollections("user1")
+	require.NoError(t, err)
+	assert.Equal(t, []types.Collection{{ID: "c1", Name: "Work", Links: 1}}, collections)
+	collections, err = restored.GetCollections("user2")
+	require.NoError(t, err)
+	assert.Equal(t, []types.Collection{{ID: "c2", Name: "Empty"}}, collections)
+	got, err := restored.GetClickStats("http://localhost:8080/a", false)
+	require.NoError(t, err)
+	assert.Equal(t, stats, got)
+	report, err := restored.GetClickReport(types.ReportQuery{Dimension: types.ReportCountries, From: created.Add(-time.Hour),
+		To: created.Add(time.Hour), Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []types.ReportItem{{Key: "DE", Clicks: 1}}, report)
+
+	files, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "temporary files must be removed")
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "changed data", content: bytes.Replace(content, []byte("https://a.example"), []byte("https://x.example"), 1)},
+		{name: "other version", content: bytes.Replace(content, []byte(`"version":1`), []byte(`"version":2`), 1)},
+		{name: "truncated", content: content[:len(content)/2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broken := filepath.Join(t.TempDir(), "broken.snapshot")
+			require.NoError(t, os.WriteFile(broken, tt.content, 0666))
+			_, err := NewSnapshotRepository(broken)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSnapshotRecords(t *testing.T) {
+	storage := NewInMemoryRepository()
+	require.NoError(t, storage.SaveURL("user1", "http://localhost:8080/a", "https://a.example"))
+	path := filepath.Join(t.TempDir(), "memory.snapshot")
+	require.NoError(t, storage.WriteSnapshot(path))
+
+	restored := NewInMemoryRepository()
+	require.NoError(t, restored.RestoreSnapshot(path))
+	var records []types.Record
+	err := restored.ForEachRecord(context.Background(), func(record types.Record) error {
+		records = append(records, record)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "user1", records[0].UserID)
+	assert.Equal(t, "https://a.example", records[0].OriginalURL)
+}
+
+func TestSnapshotPurgedURLS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.snapshot")
+	storage, err := NewSnapshotRepository(path)
+	require.NoError(t, err)
+	require.NoError(t, storage.SaveURL("user1", "a", "https://example.com/a"))
+	require.NoError(t, storage.SaveURL("user1", "b", "https://example.com/b"))
+	require.NoError(t, storage.DeleteURLS(context.Background(), "user1", []string{"a"}))
+	purged, err := storage.PurgeURLS(time.Now().Add(time.Hour), false)
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	require.NoError(t, storage.WriteSnapshot(path))
+
+	// short urls left by purges stay reserved after the restore
+	restored, err := NewSnapshotRepository(path)
+	require.NoError(t, err)
+	assert.Error(t, restored.SaveURL("user2", "a", "https://example.com/new"))
+	link, err := restored.GetURL("a")
+	require.NoError(t, err)
+	assert.True(t, link.Deleted)
+	assert.Empty(t, link.UserID)
+	links, err := restored.GetUserStorage("user1")
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "b", links[0].ShortURL)
+	urls, users, err := restored.GetInternalStats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, urls)
+	assert.Equal(t, 1, users)
+}
@@ -0,0 +1,80 @@
+// Package rollup provides aggregation of clicks into minute, hour and day buckets.
+// Reports read buckets instead of single clicks: a range is split into spans of
+// whole days, whole hours at the edges of the days and minutes at the edges of the hours.
+package rollup
+
+import "time"
+
+// Granularities of buckets.
+const (
+	Minute = "minute"
+	Hour   = "hour"
+	Day    = "day"
+)
+
+// Granularities lists granularities of buckets from the finest one, every click is added to all of them.
+var Granularities = []string{Minute, Hour, Day}
+
+// Duration returns length of the bucket of the granularity.
+func Duration(granularity string) time.Duration {
+	switch granularity {
+	case Minute:
+		return time.Minute
+	case Hour:
+		return time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// BucketStart returns start of the bucket of the granularity containing t, days start at midnight UTC.
+func BucketStart(granularity string, t time.Time) time.Time {
+	return t.UTC().Truncate(Duration(granularity))
+}
+
+// Span represents buckets of the granularity starting in [From, To).
+type Span struct {
+	Granularity string
+	From        time.Time
+	To          time.Time
+}
+
+// Spans splits [from, to) into spans of the coarsest possible granularity.
+// The range is extended to whole minutes.
+func Spans(from, to time.Time) []Span {
+	from = BucketStart(Minute, from)
+	if t := BucketStart(Minute, to); t.Before(to) {
+		to = t.Add(time.Minute)
+	}
+	if !from.Before(to) {
+		return nil
+	}
+	return split(len(Granularities)-1, from.UTC(), to.UTC())
+}
+
+// split returns spans of [from, to) using granularities up to the level.
+func split(level int, from, to time.Time) []Span {
+	granularity := Granularities[level]
+	if level == 0 {
+		return []Span{{Granularity: granularity, From: from, To: to}}
+	}
+
+	start := BucketStart(granularity, from)
+	if start.Before(from) {
+		start = start.Add(Duration(granularity))
+	}
+	end := BucketStart(granularity, to)
+	if !start.Before(end) {
+		return split(level-1, from, to)
+	}
+
+	var spans []Span
+	if from.Before(start) {
+		spans = append(spans, split(level-1, from, start)...)
+	}
+	spans = append(spans, Span{Granularity: granularity, From: start, To: end})
+	if end.Before(to) {
+		spans = append(spans, split(level-1, end, to)...)
+	}
+	return spans
+}
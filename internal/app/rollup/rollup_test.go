@@ -0,0 +1,130 @@
+package rollup
+
+import (
+	"go-developer-course-shortener/internal/app/types"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpans(t *testing.T) {
+	at := func(value string) time.Time {
+		result, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want []Span
+	}{
+		{
+			name: "minutes only",
+			from: "2023-05-01T10:15:30Z",
+			to:   "2023-05-01T10:17:10Z",
+			want: []Span{{Granularity: Minute, From: at("2023-05-01T10:15:00Z"), To: at("2023-05-01T10:18:00Z")}},
+		},
+		{
+			name: "hours with minute edges",
+			from: "2023-05-01T10:15:00Z",
+			to:   "2023-05-01T13:05:00Z",
+			want: []Span{
+				{Granularity: Minute, From: at("2023-05-01T10:15:00Z"), To: at("2023-05-01T11:00:00Z")},
+				{Granularity: Hour, From: at("2023-05-01T11:00:00Z"), To: at("2023-05-01T13:00:00Z")},
+				{Granularity: Minute, From: at("2023-05-01T13:00:00Z"), To: at("2023-05-01T13:05:00Z")},
+			},
+		},
+		{
+			name: "days with hour and minute edges",
+			from: "2023-05-01T22:30:00Z",
+			to:   "2023-05-04T01:00:00Z",
+			want: []Span{
+				{Granularity: Minute, From: at("2023-05-01T22:30:00Z"), To: at("2023-05-01T23:00:00Z")},
+				{Granularity: Hour, From: at("2023-05-01T23:00:00Z"), To: at("2023-05-02T00:00:00Z")},
+				{Granularity: Day, From: at("2023-05-02T00:00:00Z"), To: at("2023-05-04T00:00:00Z")},
+				{Granularity: Hour, From: at("2023-05-04T00:00:00Z"), To: at("2023-05-04T01:00:00Z")},
+			},
+		},
+		{
+			name: "whole days in other time zone",
+			from: "2023-05-01T03:00:00+03:00",
+			to:   "2023-05-02T03:00:00+03:00",
+			want: []Span{{Granularity: Day, From: at("2023-05-01T00:00:00Z"), To: at("2023-05-02T00:00:00Z")}},
+		},
+		{
+			name: "empty range",
+			from: "2023-05-01T10:00:00Z",
+			to:   "2023-05-01T10:00:00Z",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Spans(at(tt.from), at(tt.to)))
+		})
+	}
+}
+
+func TestTable(t *testing.T) {
+	table := NewTable()
+	day := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	human := func(userID, shortURL, referrer, country string, at time.Time) types.Click {
+		return types.Click{UserID: userID, ShortURL: shortURL, Referrer: referrer, Country: country, Time: at, Class: types.ClickHuman}
+	}
+
+	table.Add(human("user1", "http://localhost:8080/a", "example.com", "DE", day.Add(10*time.Hour+15*time.Minute)), 3)
+	table.Add(human("user1", "http://localhost:8080/b", "", "FR", day.Add(10*time.Hour+45*time.Minute)), 5)
+	table.Add(human("user1", "http://localhost:8080/a", "news.example", "DE", day.Add(36*time.Hour)), 2)
+	table.Add(human("user2", "http://localhost:8080/c", "example.com", "US", day.Add(11*time.Hour)), 7)
+	table.Add(types.Click{UserID: "user1", ShortURL: "http://localhost:8080/a", Bot: "curl", Time: day.Add(11 * time.Hour)}, 100)
+
+	// buckets of every granularity per click
+	assert.Len(t, table.Buckets(), 15)
+
+	stats := table.Stats("http://localhost:8080/a", false)
+	assert.Equal(t, 5, stats.Total)
+	assert.Equal(t, map[string]int{"DE": 5}, stats.Countries)
+	assert.Equal(t, map[string]int{"curl": 100}, stats.Bots)
+	assert.Equal(t, 105, table.Stats("http://localhost:8080/a", true).Total)
+	assert.Equal(t, 5, table.Total("http://localhost:8080/a"))
+	assert.Equal(t, 0, table.Total("http://localhost:8080/unknown"))
+
+	// whole range of all users
+	report := table.Report(types.ReportQuery{Dimension: types.ReportLinks, From: day, To: day.Add(48 * time.Hour)})
+	assert.Equal(t, []types.ReportItem{
+		{Key: "http://localhost:8080/c", Clicks: 7},
+		{Key: "http://localhost:8080/a", Clicks: 5},
+		{Key: "http://localhost:8080/b", Clicks: 5},
+	}, report)
+
+	// the range ends inside of the hour, the second day is not reported
+	report = table.Report(types.ReportQuery{UserID: "user1", Dimension: types.ReportLinks, From: day.Add(10 * time.Hour), To: day.Add(10*time.Hour + 30*time.Minute)})
+	assert.Equal(t, []types.ReportItem{{Key: "http://localhost:8080/a", Clicks: 3}}, report)
+
+	// direct visits are not reported as referrers
+	report = table.Report(types.ReportQuery{UserID: "user1", Dimension: types.ReportReferrers, From: day, To: day.Add(48 * time.Hour)})
+	assert.Equal(t, []types.ReportItem{{Key: "example.com", Clicks: 3}, {Key: "news.example", Clicks: 2}}, report)
+
+	report = table.Report(types.ReportQuery{Dimension: types.ReportCountries, From: day, To: day.Add(48 * time.Hour), Limit: 2})
+	assert.Equal(t, []types.ReportItem{{Key: "US", Clicks: 7}, {Key: "DE", Clicks: 5}}, report)
+
+	// buckets restore the table
+	restored := NewTable()
+	for _, bucket := range table.Buckets() {
+		restored.AddBucket(bucket)
+	}
+	assert.Equal(t, table.Stats("http://localhost:8080/a", true), restored.Stats("http://localhost:8080/a", true))
+	assert.Equal(t, report, restored.Report(types.ReportQuery{Dimension: types.ReportCountries, From: day, To: day.Add(48 * time.Hour), Limit: 2}))
+
+	// deleted links are not counted any more
+	restored.Delete("http://localhost:8080/a", "http://localhost:8080/unknown")
+	assert.Equal(t, 0, restored.Total("http://localhost:8080/a"))
+	assert.Len(t, restored.Buckets(), 6)
+	report = restored.Report(types.ReportQuery{Dimension: types.ReportLinks, From: day, To: day.Add(48 * time.Hour)})
+	assert.Equal(t, []types.ReportItem{{Key: "http://localhost:8080/c", Clicks: 7}, {Key: "http://localhost:8080/b", Clicks: 5}}, report)
+}
@@ -0,0 +1,218 @@
+package rollup
+
+import (
+	"go-developer-course-shortener/internal/app/types"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Key represents attributes of clicks counted in one bucket.
+type Key struct {
+	UserID   string `json:"user_id"`
+	ShortURL string `json:"short_url"`
+	Variant  string `json:"variant,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Referrer string `json:"referrer,omitempty"`
+	Bot      string `json:"bot,omitempty"`
+	Class    string `json:"class"`
+}
+
+// KeyOf returns attributes of the click, clicks saved before classification get their class.
+func KeyOf(click types.Click) Key {
+	return Key{UserID: click.UserID, ShortURL: click.ShortURL, Variant: click.Variant, Country: click.Country,
+		Referrer: click.Referrer, Bot: click.Bot, Class: click.VisitorClass()}
+}
+
+// Click returns attributes of the key as a click.
+func (k Key) Click() types.Click {
+	return types.Click{UserID: k.UserID, ShortURL: k.ShortURL, Variant: k.Variant, Country: k.Country,
+		Referrer: k.Referrer, Bot: k.Bot, Class: k.Class}
+}
+
+// Value returns value of the report dimension.
+func (k Key) Value(dimension string) string {
+	switch dimension {
+	case types.ReportLinks:
+		return k.ShortURL
+	case types.ReportReferrers:
+		return k.Referrer
+	case types.ReportCountries:
+		return k.Country
+	default:
+		return ""
+	}
+}
+
+// Bucket represents number of clicks with the same attributes in the bucket.
+type Bucket struct {
+	Granularity string    `json:"granularity"`
+	Start       time.Time `json:"start"`
+	Key         Key       `json:"key"`
+	Clicks      int       `json:"clicks"`
+}
+
+// Table keeps buckets in memory, it is safe for concurrent use.
+type Table struct {
+	mu sync.RWMutex
+	// buckets by granularity and unix time of the start
+	buckets map[string]map[int64]map[Key]int
+	// totals of day buckets by short url
+	links map[string]map[Key]int
+}
+
+// NewTable returns an empty Table.
+func NewTable() *Table {
+	buckets := make(map[string]map[int64]map[Key]int, len(Granularities))
+	for _, granularity := range Granularities {
+		buckets[granularity] = make(map[int64]map[Key]int)
+	}
+	return &Table{buckets: buckets, links: make(map[string]map[Key]int)}
+}
+
+// Add adds clicks with the same attributes to buckets of every granularity.
+func (t *Table) Add(click types.Click, clicks int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := KeyOf(click)
+	for _, granularity := range Granularities {
+		t.add(Bucket{Granularity: granularity, Start: BucketStart(granularity, click.Time), Key: key, Clicks: clicks})
+	}
+}
+
+// AddBucket adds clicks of the bucket.
+func (t *Table) AddBucket(bucket Bucket) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(bucket)
+}
+
+func (t *Table) add(bucket Bucket) {
+	byStart, ok := t.buckets[bucket.Granularity]
+	if !ok {
+		return
+	}
+	start := bucket.Start.Unix()
+	counters, ok := byStart[start]
+	if !ok {
+		counters = make(map[Key]int)
+		byStart[start] = counters
+	}
+	counters[bucket.Key] += bucket.Clicks
+
+	if bucket.Granularity == Day {
+		totals, ok := t.links[bucket.Key.ShortURL]
+		if !ok {
+			totals = make(map[Key]int)
+			t.links[bucket.Key.ShortURL] = totals
+		}
+		totals[bucket.Key] += bucket.Clicks
+	}
+}
+
+// Buckets returns all buckets of the table.
+func (t *Table) Buckets() []Bucket {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var result []Bucket
+	for _, granularity := range Granularities {
+		for start, counters := range t.buckets[granularity] {
+			for key, clicks := range counters {
+				result = append(result, Bucket{Granularity: granularity, Start: time.Unix(start, 0).UTC(), Key: key, Clicks: clicks})
+			}
+		}
+	}
+	return result
+}
+
+// Delete removes all buckets of the short urls.
+func (t *Table) Delete(shortURLS ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	deleted := make(map[string]bool, len(shortURLS))
+	for _, shortURL := range shortURLS {
+		if _, ok := t.links[shortURL]; ok {
+			deleted[shortURL] = true
+			delete(t.links, shortURL)
+		}
+	}
+	if len(deleted) == 0 {
+		return
+	}
+	for _, byStart := range t.buckets {
+		for start, counters := range byStart {
+			for key := range counters {
+				if deleted[key.ShortURL] {
+					delete(counters, key)
+				}
+			}
+			if len(counters) == 0 {
+				delete(byStart, start)
+			}
+		}
+	}
+}
+
+// Stats returns click counters of the short url for all time.
+func (t *Table) Stats(shortURL string, includeBots bool) types.ClickStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	stats := types.NewClickStats()
+	for key, clicks := range t.links[shortURL] {
+		stats.Add(key.Click(), clicks, includeBots)
+	}
+	return stats
+}
+
+// Total returns number of clicks of people on the short url for all time.
+func (t *Table) Total(shortURL string) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	total := 0
+	for key, clicks := range t.links[shortURL] {
+		if key.Class == types.ClickHuman {
+			total += clicks
+		}
+	}
+	return total
+}
+
+// Report returns top values of the dimension by clicks of people.
+// Empty values, like direct visits without referrer, are not reported.
+func (t *Table) Report(query types.ReportQuery) []types.ReportItem {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	totals := make(map[string]int)
+	for _, span := range Spans(query.From, query.To) {
+		step := Duration(span.Granularity)
+		for start := span.From; start.Before(span.To); start = start.Add(step) {
+			for key, clicks := range t.buckets[span.Granularity][start.Unix()] {
+				if key.Class != types.ClickHuman || (query.UserID != "" && key.UserID != query.UserID) {
+					continue
+				}
+				if value := key.Value(query.Dimension); value != "" {
+					totals[value] += clicks
+				}
+			}
+		}
+	}
+	return Top(totals, query.Limit)
+}
+
+// Top returns up to limit values with the most clicks, values with the same clicks are sorted by key.
+func Top(totals map[string]int, limit int) []types.ReportItem {
+	items := make([]types.ReportItem, 0, len(totals))
+	for key, clicks := range totals {
+		items = append(items, types.ReportItem{Key: key, Clicks: clicks})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Clicks != items[j].Clicks {
+			return items[i].Clicks > items[j].Clicks
+		}
+		return items[i].Key < items[j].Key
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/rand"
+	"go-developer-course-shortener/internal/app/types"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxCollections limits number of collections per user.
+	maxCollections          = 100
+	maxCollectionNameLength = 100
+	collectionIDLength      = 8
+
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+func (s *Service) CreateCollection(userID string, name string) (types.Collection, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return types.Collection{}, errors.New("name must not be empty")
+	}
+	if utf8.RuneCountInString(name) > maxCollectionNameLength {
+		return types.Collection{}, fmt.Errorf("name is too long, maximum is %d characters", maxCollectionNameLength)
+	}
+
+	collections, err := s.storage.GetCollections(userID)
+	if err != nil {
+		return types.Collection{}, err
+	}
+	if len(collections) >= maxCollections {
+		return types.Collection{}, fmt.Errorf("too many collections, maximum is %d", maxCollections)
+	}
+
+	collection := types.Collection{ID: string(rand.GenerateRandom(collectionIDLength)), Name: name}
+	if err = s.storage.CreateCollection(userID, collection); err != nil {
+		return types.Collection{}, err
+	}
+	return collection, nil
+}
+
+func (s *Service) GetCollections(userID string) ([]types.Collection, error) {
+	return s.storage.GetCollections(userID)
+}
+
+func (s *Service) DeleteCollection(userID string, collectionID string) error {
+	return s.storage.DeleteCollection(userID, collectionID)
+}
+
+func (s *Service) MoveURLS(userID string, collectionID string, shortURLS []string) error {
+	if len(shortURLS) == 0 {
+		return errors.New("list of urls must not be empty")
+	}
+	return s.storage.MoveURLS(userID, collectionID, shortURLS)
+}
+
+// GetCollectionURLS returns a page of urls in the collection, zero limit returns the default page size.
+func (s *Service) GetCollectionURLS(userID string, collectionID string, limit int, offset int) (types.CollectionLinks, error) {
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit < 0 || limit > maxPageLimit {
+		return types.CollectionLinks{}, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	if offset < 0 {
+		return types.CollectionLinks{}, errors.New("offset must not be negative")
+	}
+
+	links, total, err := s.storage.GetCollectionURLS(userID, collectionID, limit, offset)
+	if err != nil {
+		return types.CollectionLinks{}, err
+	}
+	if links == nil {
+		links = []types.Link{}
+	}
+	return types.CollectionLinks{Links: links, Total: total}, nil
+}
+
+// DeleteCollectionURLS deletes all urls in the collection with the worker pool.
+// It returns number of urls queued for deletion.
+func (s *Service) DeleteCollectionURLS(userID string, collectionID string) (int, error) {
+	links, _, err := s.storage.GetCollectionURLS(userID, collectionID, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(links) == 0 {
+		return 0, nil
+	}
+
+	shortURLS := make([]string, len(links)) // allocate required capacity for the links
+	for i, v := range links {
+		shortURLS[i] = v.ShortURL
+	}
+	return len(shortURLS), s.DeleteURLS(userID, shortURLS)
+}
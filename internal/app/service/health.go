@@ -0,0 +1,38 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/types"
+)
+
+// HealthBroken filters links whose original urls failed the last check.
+const HealthBroken = "broken"
+
+// GetUserStorageByHealth returns urls of current user id filtered by health,
+// empty filter returns all urls.
+func (s *Service) GetUserStorageByHealth(userID string, health string) ([]types.Link, error) {
+	if health != "" && health != HealthBroken {
+		return nil, fmt.Errorf("unknown health filter `%s`", health)
+	}
+	links, err := s.storage.GetUserStorage(userID)
+	if err != nil || health == "" {
+		return links, err
+	}
+	var broken []types.Link
+	for _, link := range links {
+		if link.Health != nil && link.Health.Broken() {
+			broken = append(broken, link)
+		}
+	}
+	return broken, nil
+}
+
+// GetLinkHealth returns the last check of short url of current user id, nil if the url was not checked yet.
+func (s *Service) GetLinkHealth(userID string, shortURL string) (*types.Health, error) {
+	link, err := s.storage.GetURL(shortURL)
+	if err != nil || link.UserID != userID {
+		return nil, errors.New("ID not found")
+	}
+	return link.Health, nil
+}
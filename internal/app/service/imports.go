@@ -0,0 +1,180 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/rand"
+	"go-developer-course-shortener/internal/app/types"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// importChunkSize is the number of rows validated and saved together.
+	importChunkSize = 100
+	// maxShortIDLength limits length of custom short ids.
+	maxShortIDLength = 64
+	// generatedIDLength is the length of generated short ids, the same as of links created by handlers.
+	generatedIDLength = 5
+	// generateAttempts limits attempts to generate a short id which is not used yet.
+	generateAttempts = 3
+)
+
+// reservedIDs are paths of the service which can not be used as short ids.
+var reservedIDs = []string{"api", "ping"}
+
+// ValidateShortID checks that the custom short id is a valid path segment of the short url:
+// letters, digits, hyphens and underscores up to 64 characters.
+func ValidateShortID(id string) error {
+	if id == "" || len(id) > maxShortIDLength {
+		return fmt.Errorf("short id must have from 1 to %d characters", maxShortIDLength)
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return errors.New("short id must contain only letters, digits, hyphens and underscores")
+		}
+	}
+	if contains(reservedIDs, id) {
+		return fmt.Errorf("short id `%s` is reserved", id)
+	}
+	return nil
+}
+
+// ImportURLS reads rows by next until io.EOF and saves valid rows as urls of the user in chunks through SaveBatchURLS,
+// so the whole import is never kept in memory. report is called for every row in order of the rows.
+// A chunk failed as a whole is saved again row by row to find the failed rows. Other errors of next stop the import.
+func (s *Service) ImportURLS(userID string, next func() (types.ImportRow, error), report func(result types.ImportResult) error) error {
+	if userID == "" {
+		return errors.New("user is not set")
+	}
+	chunk := importChunk{service: s, userID: userID, shortURLS: make(map[string]bool)}
+	for {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			return chunk.flush(report)
+		}
+		if err != nil {
+			if flushErr := chunk.flush(report); flushErr != nil {
+				return flushErr
+			}
+			return err
+		}
+
+		chunk.add(row)
+		if len(chunk.results) >= importChunkSize {
+			if err = chunk.flush(report); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// importChunk keeps results of rows until valid rows are saved.
+type importChunk struct {
+	service *Service
+	userID  string
+	// results of rows in order, results of valid rows are set after saving
+	results []types.ImportResult
+	// valid rows, correlation id is the index of the result
+	links types.BatchLinks
+	// short urls of valid rows
+	shortURLS map[string]bool
+}
+
+func (c *importChunk) add(row types.ImportRow) {
+	link, err := c.link(row)
+	if err != nil {
+		c.results = append(c.results, types.ImportResult{Line: row.Line, Status: types.ImportFailed, Error: err.Error()})
+		return
+	}
+	link.CorrelationID = strconv.Itoa(len(c.results))
+	c.links = append(c.links, link)
+	c.shortURLS[link.ShortURL] = true
+	c.results = append(c.results, types.ImportResult{Line: row.Line, ShortURL: link.ShortURL})
+}
+
+// link validates the row and returns it as a new link, short ids must not be used yet.
+func (c *importChunk) link(row types.ImportRow) (types.BatchLink, error) {
+	if row.Error != "" {
+		return types.BatchLink{}, errors.New(row.Error)
+	}
+	originalURL, err := ParseURL(strings.TrimSpace(row.OriginalURL))
+	if err != nil {
+		return types.BatchLink{}, err
+	}
+	metadata, err := NormalizeMetadata(types.Metadata{Title: row.Title, Tags: row.Tags})
+	if err != nil {
+		return types.BatchLink{}, err
+	}
+
+	if row.ShortID != "" {
+		if err = ValidateShortID(row.ShortID); err != nil {
+			return types.BatchLink{}, err
+		}
+		shortURL := MakeShortURL(c.service.BaseURL, row.ShortID)
+		if c.used(shortURL) {
+			return types.BatchLink{}, fmt.Errorf("short id `%s` already exists", row.ShortID)
+		}
+		return types.BatchLink{ShortURL: shortURL, OriginalURL: originalURL, Metadata: metadata}, nil
+	}
+
+	for i := 0; i < generateAttempts; i++ {
+		shortURL := MakeShortURL(c.service.BaseURL, string(rand.GenerateRandom(generatedIDLength)))
+		if !c.used(shortURL) {
+			return types.BatchLink{ShortURL: shortURL, OriginalURL: originalURL, Metadata: metadata}, nil
+		}
+	}
+	return types.BatchLink{}, errors.New("failed to generate short id")
+}
+
+// used reports whether the short url is used by the storage or by a row of the chunk.
+func (c *importChunk) used(shortURL string) bool {
+	if c.shortURLS[shortURL] {
+		return true
+	}
+	_, err := c.service.storage.GetURL(shortURL)
+	return err == nil
+}
+
+// flush saves valid rows and reports results of the chunk.
+func (c *importChunk) flush(report func(result types.ImportResult) error) error {
+	if len(c.links) > 0 {
+		if _, err := c.service.SaveBatchURLS(c.userID, c.links); err == nil {
+			for _, link := range c.links {
+				c.created(link)
+			}
+		} else {
+			for _, link := range c.links {
+				if _, err = c.service.SaveBatchURLS(c.userID, types.BatchLinks{link}); err == nil {
+					c.created(link)
+					continue
+				}
+				i, _ := strconv.Atoi(link.CorrelationID)
+				c.results[i].Status = types.ImportFailed
+				c.results[i].ShortURL = ""
+				if status, _ := CheckDBViolation(err); status == http.StatusConflict {
+					c.results[i].Error = "short id or original url already exists"
+				} else {
+					c.results[i].Error = err.Error()
+				}
+			}
+		}
+	}
+
+	for _, result := range c.results {
+		if err := report(result); err != nil {
+			return err
+		}
+	}
+	c.results = c.results[:0]
+	c.links = c.links[:0]
+	c.shortURLS = make(map[string]bool)
+	return nil
+}
+
+func (c *importChunk) created(link types.BatchLink) {
+	i, _ := strconv.Atoi(link.CorrelationID)
+	c.results[i].Status = types.ImportCreated
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/types"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxNoteLength = 1000
+	maxTags       = 20
+	maxTagLength  = 50
+)
+
+// normalizeTags returns trimmed lower case tags without duplicates.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("too many tags, maximum is %d", maxTags)
+	}
+	var result []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, errors.New("tag must not be empty")
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag is too long, maximum is %d characters", maxTagLength)
+		}
+		if !contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeMetadata validates metadata of the link and returns it with normalized tags.
+func NormalizeMetadata(metadata types.Metadata) (types.Metadata, error) {
+	metadata.Title = strings.TrimSpace(metadata.Title)
+	if utf8.RuneCountInString(metadata.Title) > maxTitleLength {
+		return metadata, fmt.Errorf("title is too long, maximum is %d characters", maxTitleLength)
+	}
+	if utf8.RuneCountInString(metadata.Note) > maxNoteLength {
+		return metadata, fmt.Errorf("note is too long, maximum is %d characters", maxNoteLength)
+	}
+	tags, err := normalizeTags(metadata.Tags)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Tags = tags
+	return metadata, nil
+}
+
+func (s *Service) SetMetadata(userID string, shortURL string, metadata types.Metadata) error {
+	metadata, err := NormalizeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	return s.storage.SetMetadata(userID, shortURL, metadata)
+}
+
+func (s *Service) SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error) {
+	tags, err := normalizeTags(query.Tags)
+	if err != nil {
+		return nil, err
+	}
+	query.Tags = tags
+	return s.storage.SearchURLS(userID, query)
+}
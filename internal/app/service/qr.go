@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/qr"
+	"strconv"
+	"sync"
+)
+
+const (
+	// QRFormatPNG defines PNG output of qr codes.
+	QRFormatPNG = "png"
+	// QRFormatSVG defines SVG output of qr codes.
+	QRFormatSVG = "svg"
+
+	defaultQRSize   = 256
+	minQRSize       = 64
+	maxQRSize       = 2048
+	defaultQRMargin = 4
+	maxQRMargin     = 16
+
+	// maxQRCodes limits number of cached qr codes.
+	maxQRCodes = 1024
+)
+
+// QROptions represents parameters of the qr code image.
+// Size is the width of the image in pixels, Margin is the width of the quiet zone in modules.
+type QROptions struct {
+	Format string
+	Size   int
+	Level  qr.Level
+	Margin int
+}
+
+// QRCode represents rendered qr code image.
+type QRCode struct {
+	ContentType string
+	Image       []byte
+}
+
+type qrKey struct {
+	shortURL string
+	options  QROptions
+}
+
+// qrCache keeps rendered qr codes, the short url of the link never changes.
+type qrCache struct {
+	mu    sync.RWMutex
+	codes map[qrKey]QRCode
+}
+
+func newQRCache() *qrCache {
+	return &qrCache{codes: make(map[qrKey]QRCode)}
+}
+
+func (c *qrCache) get(key qrKey) (QRCode, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	code, ok := c.codes[key]
+	return code, ok
+}
+
+func (c *qrCache) put(key qrKey, code QRCode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.codes) >= maxQRCodes {
+		// evict an arbitrary entry
+		for k := range c.codes {
+			delete(c.codes, k)
+			break
+		}
+	}
+	c.codes[key] = code
+}
+
+// DefaultQROptions returns options used for the parameters that are not set.
+func DefaultQROptions() QROptions {
+	return QROptions{Format: QRFormatPNG, Size: defaultQRSize, Level: qr.M, Margin: defaultQRMargin}
+}
+
+// ParseQROptions returns options from string parameters, empty parameters keep default values.
+func ParseQROptions(format, size, level, margin string) (QROptions, error) {
+	options := DefaultQROptions()
+	var err error
+	if format != "" {
+		options.Format = format
+	}
+	if size != "" {
+		if options.Size, err = strconv.Atoi(size); err != nil {
+			return options, errors.New("size must be a number")
+		}
+	}
+	if level != "" {
+		if options.Level, err = qr.ParseLevel(level); err != nil {
+			return options, err
+		}
+	}
+	if margin != "" {
+		if options.Margin, err = strconv.Atoi(margin); err != nil {
+			return options, errors.New("margin must be a number")
+		}
+	}
+	return options, nil
+}
+
+func (o QROptions) validate() error {
+	if o.Format != QRFormatPNG && o.Format != QRFormatSVG {
+		return fmt.Errorf("unknown format `%s`", o.Format)
+	}
+	if o.Size < minQRSize || o.Size > maxQRSize {
+		return fmt.Errorf("size must be between %d and %d", minQRSize, maxQRSize)
+	}
+	if o.Margin < 0 || o.Margin > maxQRMargin {
+		return fmt.Errorf("margin must be between 0 and %d", maxQRMargin)
+	}
+	return nil
+}
+
+// GetQRCode returns qr code of the short url, rendered codes are cached.
+func (s *Service) GetQRCode(shortURL string, options QROptions) (QRCode, error) {
+	if err := options.validate(); err != nil {
+		return QRCode{}, err
+	}
+
+	key := qrKey{shortURL: shortURL, options: options}
+	if code, ok := s.qrCodes.get(key); ok {
+		return code, nil
+	}
+
+	symbol, err := qr.Encode([]byte(shortURL), options.Level)
+	if err != nil {
+		return QRCode{}, err
+	}
+
+	var code QRCode
+	switch options.Format {
+	case QRFormatSVG:
+		code = QRCode{ContentType: "image/svg+xml", Image: symbol.SVG(options.Size, options.Margin)}
+	default:
+		image, err := symbol.PNG(options.Size, options.Margin)
+		if err != nil {
+			return QRCode{}, err
+		}
+		code = QRCode{ContentType: "image/png", Image: image}
+	}
+
+	s.qrCodes.put(key, code)
+	return code, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/types"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultReportLimit is the number of reported values if the limit is not set.
+	defaultReportLimit = 10
+	// maxReportLimit limits number of reported values.
+	maxReportLimit = 100
+	// defaultReportRange is the range of the report ending now if the start is not set.
+	defaultReportRange = 30 * 24 * time.Hour
+	// maxReportRange limits length of the report range.
+	maxReportRange = 366 * 24 * time.Hour
+)
+
+// ErrForbidden is returned for requests to internal data from outside of the trusted subnet.
+var ErrForbidden = errors.New("access forbidden")
+
+// ReferrerHost returns lower case host of the Referer header, empty string for direct visits.
+func ReferrerHost(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// GetReport returns top values of the dimension by clicks of people on short urls of the user.
+// Zero To means now, zero From means 30 days before To, zero Limit means 10 values.
+func (s *Service) GetReport(userID string, query types.ReportQuery) ([]types.ReportItem, error) {
+	if userID == "" {
+		return nil, errors.New("user is not set")
+	}
+	query.UserID = userID
+	return s.getReport(query)
+}
+
+// GetInternalReport returns top values of the dimension by clicks of people on short urls of all users.
+// It is available only from the trusted subnet.
+func (s *Service) GetInternalReport(userIP net.IP, query types.ReportQuery) ([]types.ReportItem, error) {
+	if s.network == nil || !s.network.Contains(userIP) {
+		return nil, ErrForbidden
+	}
+	query.UserID = ""
+	return s.getReport(query)
+}
+
+func (s *Service) getReport(query types.ReportQuery) ([]types.ReportItem, error) {
+	switch query.Dimension {
+	case types.ReportLinks, types.ReportReferrers, types.ReportCountries:
+	default:
+		return nil, fmt.Errorf("unknown report `%s`", query.Dimension)
+	}
+
+	if query.To.IsZero() {
+		query.To = s.clock.Now()
+	}
+	if query.From.IsZero() {
+		query.From = query.To.Add(-defaultReportRange)
+	}
+	if !query.From.Before(query.To) {
+		return nil, errors.New("from must be before to")
+	}
+	if query.To.Sub(query.From) > maxReportRange {
+		return nil, fmt.Errorf("range must not be longer than %d days", maxReportRange/(24*time.Hour))
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultReportLimit
+	}
+	if query.Limit < 0 || query.Limit > maxReportLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxReportLimit)
+	}
+	return s.storage.GetClickReport(query)
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
+	"go-developer-course-shortener/internal/app/bots"
+	"go-developer-course-shortener/internal/app/geo"
 	"go-developer-course-shortener/internal/app/rand"
 	"go-developer-course-shortener/internal/app/repository"
 	"go-developer-course-shortener/internal/app/types"
@@ -19,15 +21,39 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 // Service represents struct for http/https and grpc servers.
 type Service struct {
 	storage repository.Repository
 	job     chan worker.Job
+	pages   chan worker.PageJob
+	clicks  chan types.Click
 	network *net.IPNet
-	BaseURL string
+	clock   Clock
+	geo     *geo.Database
+	bots    *bots.Classifier
+	salt    []byte
+	qrCodes *qrCache
+	// undeleteGrace is the time deleted links can be restored
+	undeleteGrace time.Duration
+	BaseURL       string
+}
+
+// Clock provides current time for the service.
+type Clock interface {
+	// Now returns current time.
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
 }
 
 // UserContextType user context type.
@@ -38,6 +64,11 @@ const (
 	AccessToken = "uniqueAuthToken"
 	// UserCtx defines user context name.
 	UserCtx UserContextType = "UserCtx"
+
+	maxTitleLength       = 200
+	maxDescriptionLength = 1000
+
+	defaultUndeleteGracePeriod = 7 * 24 * time.Hour
 )
 
 type cipherData struct {
@@ -61,12 +92,58 @@ type ShortenerStorage interface {
 	GetShortURLByOriginalURL(originalURL string) (string, error)
 	// GetUserStorage returns list of urls for current user id.
 	GetUserStorage(userID string) ([]types.Link, error)
+	// ExportUserURLS streams urls of current user id with metadata and number of clicks.
+	ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error
+	// ImportURLS validates rows of the import and saves valid rows as urls of current user id in chunks.
+	ImportURLS(userID string, next func() (types.ImportRow, error), report func(result types.ImportResult) error) error
+	// GetUserStorageByHealth returns urls of current user id filtered by health of original urls.
+	GetUserStorageByHealth(userID string, health string) ([]types.Link, error)
+	// GetLinkHealth returns the last check of original url for short url of current user id.
+	GetLinkHealth(userID string, shortURL string) (*types.Health, error)
 	// Ping verifies that current repository can accept requests.
 	Ping() bool
 	// DeleteURLS deletes list of short urls for current user id.
 	DeleteURLS(userID string, shortURLS []string) error
+	// RestoreURLS restores short urls of current user id deleted within the grace period and returns restored short urls.
+	RestoreURLS(userID string, shortURLS []string) ([]string, error)
+	// SetSchedule sets activation window for short url of current user id.
+	SetSchedule(userID string, shortURL string, schedule types.Schedule) error
+	// SetTargets replaces target rules for short url of current user id.
+	SetTargets(userID string, shortURL string, targets []types.TargetRule) error
+	// GetTargets returns default target and rules for short url of current user id.
+	GetTargets(userID string, shortURL string) (types.LinkTargets, error)
+	// SetVariants replaces weighted variants for short url of current user id.
+	SetVariants(userID string, shortURL string, variants []types.Variant) error
+	// GetVariants returns variants with click counters for short url of current user id.
+	GetVariants(userID string, shortURL string) ([]types.VariantStats, error)
+	// SetPreview sets preview settings for short url of current user id.
+	SetPreview(userID string, shortURL string, preview types.Preview) error
+	// SetMetadata sets title, note and tags for short url of current user id.
+	SetMetadata(userID string, shortURL string, metadata types.Metadata) error
+	// SearchURLS returns urls of current user id filtered by tags and text.
+	SearchURLS(userID string, query types.SearchQuery) ([]types.Link, error)
+	// CreateCollection creates a named collection for current user id.
+	CreateCollection(userID string, name string) (types.Collection, error)
+	// GetCollections returns collections of current user id.
+	GetCollections(userID string) ([]types.Collection, error)
+	// DeleteCollection deletes collection of current user id, its urls are kept.
+	DeleteCollection(userID string, collectionID string) error
+	// MoveURLS moves short urls of current user id to the collection.
+	MoveURLS(userID string, collectionID string, shortURLS []string) error
+	// GetCollectionURLS returns a page of urls in the collection of current user id.
+	GetCollectionURLS(userID string, collectionID string, limit int, offset int) (types.CollectionLinks, error)
+	// DeleteCollectionURLS deletes all urls in the collection of current user id.
+	DeleteCollectionURLS(userID string, collectionID string) (int, error)
+	// GetLinkStats returns click counters for short url of current user id, only people are counted unless includeBots is set.
+	GetLinkStats(userID string, shortURL string, includeBots bool) (types.ClickStats, error)
+	// GetQRCode returns qr code image of short url.
+	GetQRCode(shortURL string, options QROptions) (QRCode, error)
 	// GetInternalStats returns internal stats for repository.
 	GetInternalStats(userIP net.IP) (types.ResponseStatsJSON, error)
+	// GetReport returns top values of the dimension by clicks on urls of current user id.
+	GetReport(userID string, query types.ReportQuery) ([]types.ReportItem, error)
+	// GetInternalReport returns top values of the dimension by clicks on urls of all users.
+	GetInternalReport(userIP net.IP, query types.ReportQuery) ([]types.ReportItem, error)
 	// CreateUser creates new uuid user.
 	CreateUser() string
 }
@@ -76,23 +153,83 @@ var _ ShortenerStorage = (*Service)(nil)
 
 func NewService(storage repository.Repository, job chan worker.Job, network *net.IPNet, baseURL string) *Service {
 	return &Service{
-		storage: storage,
-		job:     job,
-		network: network,
-		BaseURL: baseURL,
+		storage:       storage,
+		job:           job,
+		network:       network,
+		clock:         systemClock{},
+		bots:          bots.NewClassifier(nil, bots.DefaultConfig()),
+		salt:          rand.GenerateRandom(visitorSaltSize),
+		qrCodes:       newQRCache(),
+		undeleteGrace: defaultUndeleteGracePeriod,
+		BaseURL:       baseURL,
 	}
 }
 
+// SetGeoDatabase sets database used to locate visitors by ip.
+func (s *Service) SetGeoDatabase(db *geo.Database) {
+	s.geo = db
+}
+
+// SetCrawlerRanges sets networks of known crawlers used to classify visitors.
+func (s *Service) SetCrawlerRanges(ranges *bots.Ranges) {
+	s.bots = bots.NewClassifier(ranges, bots.DefaultConfig())
+}
+
+// SetPageJobs sets queue of jobs fetching destination pages of new links.
+func (s *Service) SetPageJobs(pages chan worker.PageJob) {
+	s.pages = pages
+}
+
+// SetClickQueue sets queue of clicks saved in batches by the click pool.
+func (s *Service) SetClickQueue(clicks chan types.Click) {
+	s.clicks = clicks
+}
+
+// SetUndeleteGracePeriod sets the time deleted links can be restored.
+func (s *Service) SetUndeleteGracePeriod(period time.Duration) {
+	s.undeleteGrace = period
+}
+
+// SetClock replaces the clock used to resolve scheduled links.
+func (s *Service) SetClock(clock Clock) {
+	s.clock = clock
+}
+
 func (s *Service) CreateUser() string {
 	return uuid.NewString()
 }
 
 func (s *Service) SaveURL(userID string, shortURL string, originalURL string) error {
-	return s.storage.SaveURL(userID, shortURL, originalURL)
+	if err := s.storage.SaveURL(userID, shortURL, originalURL); err != nil {
+		return err
+	}
+	s.fetchPages([]string{shortURL})
+	return nil
 }
 
 func (s *Service) SaveBatchURLS(userID string, links types.BatchLinks) (types.ResponseBatch, error) {
-	return s.storage.SaveBatchURLS(userID, links)
+	response, err := s.storage.SaveBatchURLS(userID, links)
+	if err != nil {
+		return response, err
+	}
+	shortURLS := make([]string, len(links))
+	for i, v := range links {
+		shortURLS[i] = v.ShortURL
+	}
+	s.fetchPages(shortURLS)
+	return response, nil
+}
+
+// fetchPages queues fetching of destination pages without blocking, the job is dropped if the queue is full.
+func (s *Service) fetchPages(shortURLS []string) {
+	if s.pages == nil {
+		return
+	}
+	select {
+	case s.pages <- worker.PageJob{ShortURLS: shortURLS}:
+	default:
+		log.Printf("Page queue is full, %d pages are not fetched", len(shortURLS))
+	}
 }
 
 func (s *Service) GetURL(shortURL string) (types.OriginalLink, error) {
@@ -107,6 +244,15 @@ func (s *Service) GetUserStorage(userID string) ([]types.Link, error) {
 	return s.storage.GetUserStorage(userID)
 }
 
+// ExportUserURLS calls visit for every url of the user with metadata and number of clicks of people.
+// Urls are streamed from the storage, iteration stops on the first error of visit.
+func (s *Service) ExportUserURLS(ctx context.Context, userID string, visit func(link types.ExportLink) error) error {
+	if userID == "" {
+		return errors.New("user is not set")
+	}
+	return s.storage.ExportUserURLS(ctx, userID, visit)
+}
+
 func (s *Service) Ping() bool {
 	return s.storage.Ping()
 }
@@ -117,9 +263,87 @@ func (s *Service) DeleteURLS(userID string, shortURLS []string) error {
 	return nil
 }
 
+// RestoreURLS restores links deleted within the grace period, links deleted earlier may be already purged.
+func (s *Service) RestoreURLS(userID string, shortURLS []string) ([]string, error) {
+	return s.storage.RestoreURLS(userID, shortURLS, s.clock.Now().Add(-s.undeleteGrace))
+}
+
+func (s *Service) SetSchedule(userID string, shortURL string, schedule types.Schedule) error {
+	if schedule.NotBefore != nil && schedule.NotAfter != nil && !schedule.NotBefore.Before(*schedule.NotAfter) {
+		return errors.New("not_before must be earlier than not_after")
+	}
+	if schedule.PendingURL != "" {
+		pendingURL, err := ParseURL(schedule.PendingURL)
+		if err != nil {
+			return err
+		}
+		schedule.PendingURL = pendingURL
+	}
+	return s.storage.SetSchedule(userID, shortURL, schedule)
+}
+
+func (s *Service) SetPreview(userID string, shortURL string, preview types.Preview) error {
+	if utf8.RuneCountInString(preview.Title) > maxTitleLength {
+		return fmt.Errorf("title is too long, maximum is %d characters", maxTitleLength)
+	}
+	if utf8.RuneCountInString(preview.Description) > maxDescriptionLength {
+		return fmt.Errorf("description is too long, maximum is %d characters", maxDescriptionLength)
+	}
+	return s.storage.SetPreview(userID, shortURL, preview)
+}
+
+// PreviewOf returns preview settings of the link for the target, title and description which are not set by the owner
+// are taken from the destination page. The destination page is not revealed before activation of the link.
+func PreviewOf(link types.OriginalLink, target Target) types.Preview {
+	preview := link.Preview
+	if link.Page == nil || target.Pending {
+		return preview
+	}
+	if preview.Title == "" {
+		preview.Title = link.Page.OGTitle
+	}
+	if preview.Title == "" {
+		preview.Title = link.Page.Title
+	}
+	if preview.Description == "" {
+		preview.Description = link.Page.OGDescription
+	}
+	return preview
+}
+
+// ResolveTarget returns url to redirect to and http status for the link at the current time.
+// The original url is never returned before activation of the link.
+// The first target rule matching the visitor overrides the original url,
+// otherwise a weighted variant is chosen if the link has any.
+func (s *Service) ResolveTarget(link types.OriginalLink, visitor Visitor) Target {
+	if link.Deleted {
+		return Target{URL: link.OriginalURL, Status: http.StatusGone}
+	}
+
+	now := s.clock.Now()
+	if link.Schedule.NotBefore != nil && now.Before(*link.Schedule.NotBefore) {
+		if link.Schedule.PendingURL == "" {
+			return Target{Status: http.StatusNotFound}
+		}
+		return Target{URL: link.Schedule.PendingURL, Status: http.StatusTemporaryRedirect, Pending: true}
+	}
+	if link.Schedule.NotAfter != nil && !now.Before(*link.Schedule.NotAfter) {
+		return Target{Status: http.StatusGone}
+	}
+	for _, rule := range link.Targets {
+		if visitor.matches(rule) {
+			return Target{URL: rule.URL, Status: http.StatusTemporaryRedirect}
+		}
+	}
+	if variant, ok := chooseVariant(link.Variants, visitor.Variant); ok {
+		return Target{URL: variant.URL, Status: http.StatusTemporaryRedirect, Variant: variant.Name}
+	}
+	return Target{URL: link.OriginalURL, Status: http.StatusTemporaryRedirect}
+}
+
 func (s *Service) GetInternalStats(userIP net.IP) (types.ResponseStatsJSON, error) {
 	if s.network == nil || !s.network.Contains(userIP) {
-		return types.ResponseStatsJSON{}, errors.New("access forbidden")
+		return types.ResponseStatsJSON{}, ErrForbidden
 	}
 
 	urls, users, err := s.storage.GetInternalStats()
@@ -202,6 +426,24 @@ func ExtractUserIDFromContext(ctx context.Context) string {
 	return ""
 }
 
+// ResolveIP returns client ip from "X-Real-IP" or "X-Forwarded-For" headers.
+func ResolveIP(header http.Header) (net.IP, error) {
+	// check "X-Real-IP" header
+	ipStr := header.Get("X-Real-IP")
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		// X-Real-IP is empty then try X-Forwarded-For
+		ips := header.Get("X-Forwarded-For")
+		ipSplit := strings.Split(ips, ",")
+		ipStr = strings.TrimSpace(ipSplit[0])
+		ip = net.ParseIP(ipStr)
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("failed parse ip from http header")
+	}
+	return ip, nil
+}
+
 func MakeShortURL(baseURL string, id string) string {
 	shortURL := fmt.Sprintf("%v/%s", baseURL, id)
 	return shortURL
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/geo"
+	"go-developer-course-shortener/internal/app/types"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxTargetRules limits number of target rules per link.
+const maxTargetRules = 32
+
+// Visitor represents attributes of the request used to choose a redirect target.
+// Variant is a variant served to the visitor before, if any.
+type Visitor struct {
+	Header   http.Header
+	IP       net.IP
+	Location geo.Location
+	Variant  string
+}
+
+// Target represents resolved redirect target of the link.
+type Target struct {
+	URL     string
+	Status  int
+	Variant string
+	// Pending is set before activation of the link, URL is the pending url then
+	Pending bool
+}
+
+// VisitorFromRequest returns a Visitor for the http request.
+// Client ip is taken from proxy headers or from the remote address.
+func VisitorFromRequest(r *http.Request) Visitor {
+	ip, err := ResolveIP(r.Header)
+	if err != nil {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		ip = net.ParseIP(host)
+	}
+	return Visitor{Header: r.Header, IP: ip}
+}
+
+// VisitorFromContext returns a Visitor for the grpc request metadata.
+func VisitorFromContext(ctx context.Context) Visitor {
+	header := make(http.Header)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, values := range md {
+			for _, v := range values {
+				header.Add(k, v)
+			}
+		}
+	}
+	ip, err := ResolveIP(header)
+	if err != nil {
+		if p, ok := peer.FromContext(ctx); ok {
+			if addr, ok := p.Addr.(*net.TCPAddr); ok {
+				ip = addr.IP
+			}
+		}
+	}
+	return Visitor{Header: header, IP: ip}
+}
+
+// Locate sets location of the visitor by ip.
+func (s *Service) Locate(visitor Visitor) Visitor {
+	if location, ok := s.geo.Lookup(visitor.IP); ok {
+		visitor.Location = location
+	}
+	return visitor
+}
+
+// DetectPlatform returns platform of the client by User-Agent header.
+func DetectPlatform(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return types.PlatformIOS
+	case strings.Contains(userAgent, "Android"):
+		return types.PlatformAndroid
+	default:
+		return types.PlatformDesktop
+	}
+}
+
+// PreferredLanguage returns the language with the highest quality from Accept-Language header.
+func PreferredLanguage(acceptLanguage string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+	var languages []language
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+			quality = v
+		}
+		if quality > 0 {
+			languages = append(languages, language{tag: strings.ToLower(tag), quality: quality})
+		}
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	return languages[0].tag
+}
+
+func (v Visitor) matches(rule types.TargetRule) bool {
+	switch rule.Type {
+	case types.TargetPlatform:
+		return DetectPlatform(v.Header.Get("User-Agent")) == rule.Value
+	case types.TargetLanguage:
+		// "de" matches both "de" and "de-at"
+		language := PreferredLanguage(v.Header.Get("Accept-Language"))
+		value := strings.ToLower(rule.Value)
+		return language == value || strings.HasPrefix(language, value+"-")
+	case types.TargetHeader:
+		value := v.Header.Get(rule.Header)
+		if rule.Value == "" {
+			return value != ""
+		}
+		return strings.EqualFold(value, rule.Value)
+	case types.TargetCountry:
+		// value is a country code or a region
+		return v.Location.Country != "" &&
+			(strings.EqualFold(v.Location.Country, rule.Value) || strings.EqualFold(v.Location.Region, rule.Value))
+	}
+	return false
+}
+
+func validateTargetRule(rule *types.TargetRule) error {
+	switch rule.Type {
+	case types.TargetPlatform:
+		if rule.Value != types.PlatformIOS && rule.Value != types.PlatformAndroid && rule.Value != types.PlatformDesktop {
+			return fmt.Errorf("unknown platform `%s`", rule.Value)
+		}
+	case types.TargetLanguage:
+		if rule.Value == "" {
+			return errors.New("language must not be empty")
+		}
+	case types.TargetHeader:
+		if rule.Header == "" {
+			return errors.New("header must not be empty")
+		}
+	case types.TargetCountry:
+		if rule.Value == "" {
+			return errors.New("country must not be empty")
+		}
+	default:
+		return fmt.Errorf("unknown rule type `%s`", rule.Type)
+	}
+
+	targetURL, err := ParseURL(rule.URL)
+	if err != nil {
+		return err
+	}
+	rule.URL = targetURL
+	return nil
+}
+
+func (s *Service) SetTargets(userID string, shortURL string, targets []types.TargetRule) error {
+	if len(targets) > maxTargetRules {
+		return fmt.Errorf("too many rules, maximum is %d", maxTargetRules)
+	}
+	for i := range targets {
+		if err := validateTargetRule(&targets[i]); err != nil {
+			return err
+		}
+	}
+	return s.storage.SetTargets(userID, shortURL, targets)
+}
+
+func (s *Service) GetTargets(userID string, shortURL string) (types.LinkTargets, error) {
+	link, err := s.storage.GetURL(shortURL)
+	if err != nil || link.UserID != userID {
+		return types.LinkTargets{}, errors.New("ID not found")
+	}
+	rules := link.Targets
+	if rules == nil {
+		rules = []types.TargetRule{}
+	}
+	return types.LinkTargets{Default: link.OriginalURL, Rules: rules}, nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"go-developer-course-shortener/internal/app/types"
+	"net/url"
+	"strings"
+)
+
+// linkPreviewBots maps markers of User-Agent header to names of link preview bots.
+var linkPreviewBots = []struct {
+	marker string
+	name   string
+}{
+	{marker: "Slackbot", name: "Slack"},
+	{marker: "Slack-ImgProxy", name: "Slack"},
+	{marker: "Twitterbot", name: "Twitter"},
+	{marker: "facebookexternalhit", name: "Facebook"},
+	{marker: "Facebot", name: "Facebook"},
+	{marker: "TelegramBot", name: "Telegram"},
+	{marker: "Discordbot", name: "Discord"},
+}
+
+// DetectBot returns name of the link preview bot by User-Agent header, empty string for other clients.
+func DetectBot(userAgent string) string {
+	for _, bot := range linkPreviewBots {
+		if strings.Contains(userAgent, bot.marker) {
+			return bot.name
+		}
+	}
+	return ""
+}
+
+// Unfurl represents a card of the short url shown by chat apps and social networks.
+type Unfurl struct {
+	URL         string
+	Title       string
+	Description string
+	Image       string
+}
+
+// UnfurlOf returns a card of the short url leading to the target.
+// Owner settings have priority over metadata of the destination page, the host of the target is the last resort title.
+// Before activation of the link only owner settings and the pending url are used.
+func UnfurlOf(shortURL string, link types.OriginalLink, target Target) Unfurl {
+	preview := PreviewOf(link, target)
+	unfurl := Unfurl{URL: shortURL, Title: preview.Title, Description: preview.Description}
+	if link.Page != nil && !target.Pending {
+		unfurl.Image = link.Page.OGImage
+	}
+	if unfurl.Title == "" {
+		if u, err := url.Parse(target.URL); err == nil && u.Host != "" {
+			unfurl.Title = u.Host
+		} else {
+			unfurl.Title = target.URL
+		}
+	}
+	return unfurl
+}
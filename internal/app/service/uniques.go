@@ -0,0 +1,31 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// visitorSaltSize is the size of a random salt used when the salt is not configured.
+const visitorSaltSize = 32
+
+// SetVisitorSalt sets secret salt of visitor hashes.
+// Instances sharing a storage must use the same salt, otherwise a visitor is counted once per instance.
+func (s *Service) SetVisitorSalt(salt string) {
+	s.salt = []byte(salt)
+}
+
+// visitorHash returns a salted hash of ip and User-Agent of the visitor.
+// Without the salt the hash can not be matched to an ip, the hash itself is not stored.
+func (s *Service) visitorHash(visitor Visitor) uint64 {
+	mac := hmac.New(sha256.New, s.salt)
+	mac.Write([]byte(visitor.IP.String()))
+	mac.Write([]byte{0})
+	mac.Write([]byte(visitor.Header.Get("User-Agent")))
+	hash := binary.BigEndian.Uint64(mac.Sum(nil))
+	if hash == 0 {
+		// zero means there is no visitor
+		hash = 1
+	}
+	return hash
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/rand"
+	"go-developer-course-shortener/internal/app/types"
+	"log"
+	"regexp"
+)
+
+// maxVariants limits number of variants per link.
+const maxVariants = 16
+
+// variantCookiePrefix defines cookie name prefix for sticky variants.
+const variantCookiePrefix = "variant_"
+
+var variantName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// VariantCookie returns name of the cookie that keeps served variant of the link.
+func VariantCookie(id string) string {
+	return variantCookiePrefix + id
+}
+
+// chooseVariant returns the sticky variant if it still has weight, otherwise picks a variant by weight.
+func chooseVariant(variants []types.Variant, sticky string) (types.Variant, bool) {
+	total := 0
+	for _, v := range variants {
+		if v.Name == sticky && v.Weight > 0 {
+			return v, true
+		}
+		total += v.Weight
+	}
+	if total == 0 {
+		return types.Variant{}, false
+	}
+
+	n := rand.Intn(total)
+	for _, v := range variants {
+		if n < v.Weight {
+			return v, true
+		}
+		n -= v.Weight
+	}
+	return types.Variant{}, false
+}
+
+func (s *Service) SetVariants(userID string, shortURL string, variants []types.Variant) error {
+	if len(variants) > maxVariants {
+		return fmt.Errorf("too many variants, maximum is %d", maxVariants)
+	}
+
+	names := make(map[string]bool, len(variants))
+	total := 0
+	for i, v := range variants {
+		if !variantName.MatchString(v.Name) {
+			return fmt.Errorf("invalid variant name `%s`", v.Name)
+		}
+		if names[v.Name] {
+			return fmt.Errorf("duplicate variant name `%s`", v.Name)
+		}
+		names[v.Name] = true
+		if v.Weight < 0 {
+			return errors.New("weight must not be negative")
+		}
+		total += v.Weight
+
+		variantURL, err := ParseURL(v.URL)
+		if err != nil {
+			return err
+		}
+		variants[i].URL = variantURL
+	}
+	if len(variants) > 0 && total == 0 {
+		return errors.New("at least one variant must have positive weight")
+	}
+	return s.storage.SetVariants(userID, shortURL, variants)
+}
+
+func (s *Service) GetVariants(userID string, shortURL string) ([]types.VariantStats, error) {
+	link, err := s.storage.GetURL(shortURL)
+	if err != nil || link.UserID != userID {
+		return nil, errors.New("ID not found")
+	}
+
+	stats, err := s.storage.GetClickStats(shortURL, false)
+	if err != nil {
+		return nil, err
+	}
+
+	variants := make([]types.VariantStats, len(link.Variants)) // allocate required capacity for the variants
+	for i, v := range link.Variants {
+		variants[i] = types.VariantStats{Variant: v, Clicks: stats.Variants[v.Name]}
+	}
+	return variants, nil
+}
+
+func (s *Service) GetLinkStats(userID string, shortURL string, includeBots bool) (types.ClickStats, error) {
+	link, err := s.storage.GetURL(shortURL)
+	if err != nil || link.UserID != userID {
+		return types.ClickStats{}, errors.New("ID not found")
+	}
+	return s.storage.GetClickStats(shortURL, includeBots)
+}
+
+// RecordClick saves a visit of the short url of the link with the served variant, country, referrer and class of the visitor.
+// Visits of link preview bots are saved with the name of the bot, only people are counted in unique visitors.
+// Errors are logged only, the redirect must not fail because of analytics.
+// The click is queued without blocking if the click queue is set, it is dropped if the queue is full.
+func (s *Service) RecordClick(shortURL string, link types.OriginalLink, visitor Visitor, target Target) {
+	click := types.Click{UserID: link.UserID, ShortURL: shortURL, Variant: target.Variant, Country: visitor.Location.Country,
+		Referrer: ReferrerHost(visitor.Header.Get("Referer")), Bot: DetectBot(visitor.Header.Get("User-Agent")), Time: s.clock.Now()}
+	click.Class = s.bots.Classify(visitor.Header, visitor.IP, click.Time)
+	if click.Bot != "" {
+		click.Class = types.ClickBot
+	}
+	if click.Class == types.ClickHuman {
+		click.Visitor = s.visitorHash(visitor)
+	}
+	if s.clicks != nil {
+		select {
+		case s.clicks <- click:
+		default:
+			log.Printf("Click queue is full, click for %s is not saved", shortURL)
+		}
+		return
+	}
+	if err := s.storage.SaveClicks([]types.Click{click}); err != nil {
+		log.Printf("Failed to save click for %s. Error: %v", shortURL, err)
+	}
+}
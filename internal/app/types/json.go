@@ -2,8 +2,12 @@
 package types
 
 // RequestJSON represents a link for json requests.
+// Title, note and tags are optional metadata of the link.
 type RequestJSON struct {
-	URL string `json:"url"`
+	URL   string   `json:"url"`
+	Title string   `json:"title,omitempty"`
+	Note  string   `json:"note,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
 }
 
 // ResponseJSON represents a link for json responses.
@@ -11,6 +15,11 @@ type ResponseJSON struct {
 	Result string `json:"result"`
 }
 
+// RequestCollectionJSON represents a new collection for json requests.
+type RequestCollectionJSON struct {
+	Name string `json:"name"`
+}
+
 // ResponseStatsJSON represents struct for stats json responses.
 type ResponseStatsJSON struct {
 	URLs  int `json:"urls"`
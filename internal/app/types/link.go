@@ -1,9 +1,72 @@
 package types
 
+import "time"
+
 // Link represents a pair of short and original urls for GetUserStorage handler.
 type Link struct {
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	Collection  string `json:"collection,omitempty"`
+	Metadata
+	Health *Health `json:"health,omitempty"`
+	Page   *Page   `json:"page,omitempty"`
+}
+
+// ExportLink represents a link in the export of user links with number of clicks of people.
+type ExportLink struct {
+	Link
+	CreatedAt time.Time `json:"created_at"`
+	Clicks    int       `json:"clicks"`
+}
+
+// Page represents title and OpenGraph metadata of the destination page.
+type Page struct {
+	Title         string    `json:"title,omitempty"`
+	OGTitle       string    `json:"og_title,omitempty"`
+	OGDescription string    `json:"og_description,omitempty"`
+	OGImage       string    `json:"og_image,omitempty"`
+	FetchedAt     time.Time `json:"fetched_at"`
+}
+
+// Health represents the last check of the original url.
+// Error is set if the url did not respond, StatusCode is the last response status otherwise.
+type Health struct {
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMS  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Broken reports whether the original url did not respond or responded with an error status.
+func (h *Health) Broken() bool {
+	return h.Error != "" || h.StatusCode >= 400
+}
+
+// Collection represents a named folder of user links.
+type Collection struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Links int    `json:"links"`
+}
+
+// CollectionLinks represents a page of links in the collection.
+type CollectionLinks struct {
+	Links []Link `json:"links"`
+	Total int    `json:"total"`
+}
+
+// Metadata represents owner-set title, note and tags of the link.
+type Metadata struct {
+	Title string   `json:"title,omitempty"`
+	Note  string   `json:"note,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// SearchQuery represents a filter of user links.
+// Links must have all the tags and contain all words of Text in title, note or original url.
+type SearchQuery struct {
+	Tags []string
+	Text string
 }
 
 // BatchLink represents a link for batch requests.
@@ -11,13 +74,233 @@ type BatchLink struct {
 	CorrelationID string
 	ShortURL      string
 	OriginalURL   string
+	// Metadata is optional, it is set by imports
+	Metadata Metadata
+}
+
+// ImportRow represents a row of the import of links.
+// ShortID is optional, a random one is generated if it is empty.
+// Error is set by readers of the import for rows which can not be decoded.
+type ImportRow struct {
+	Line        int      `json:"-"`
+	Error       string   `json:"-"`
+	OriginalURL string   `json:"original_url"`
+	ShortID     string   `json:"short_id,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// Statuses of imported rows.
+const (
+	ImportCreated = "created"
+	ImportFailed  = "failed"
+)
+
+// ImportResult represents the result of the import of a row.
+type ImportResult struct {
+	Line     int    `json:"line"`
+	Status   string `json:"status"`
+	ShortURL string `json:"short_url,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
 // OriginalLink represents an original link and current state.
 type OriginalLink struct {
+	UserID      string
 	OriginalURL string
 	Deleted     bool
+	// DeletedAt is the time of the deletion, links purged before it was kept have no owner and original url
+	DeletedAt  time.Time
+	Schedule   Schedule
+	Targets    []TargetRule
+	Variants   []Variant
+	Preview    Preview
+	Metadata   Metadata
+	Collection string
+	Health     *Health
+	Page       *Page
+	CreatedAt  time.Time
+}
+
+// Record represents a link of any user with all its attributes, it is used to copy links between storages.
+type Record struct {
+	ShortURL string
+	OriginalLink
+}
+
+// CollectionRecord represents a collection of any user.
+type CollectionRecord struct {
+	UserID string
+	Collection
+}
+
+// Preview represents owner-set information for the preview page of the link.
+// If Always is set the preview page is shown instead of redirect.
+type Preview struct {
+	Always      bool   `json:"always"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schedule represents an activation window of the link.
+// PendingURL is served instead of the original url before NotBefore.
+type Schedule struct {
+	NotBefore  *time.Time `json:"not_before,omitempty"`
+	NotAfter   *time.Time `json:"not_after,omitempty"`
+	PendingURL string     `json:"pending_url,omitempty"`
+}
+
+// Types of target rules.
+const (
+	TargetPlatform = "platform"
+	TargetLanguage = "language"
+	TargetHeader   = "header"
+	TargetCountry  = "country"
+)
+
+// Platforms detected from the User-Agent header.
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformDesktop = "desktop"
+)
+
+// TargetRule represents a redirect target chosen by attributes of the request.
+// Header is used only by the header rule, Value is a platform, a language, a header value,
+// a country code or a region.
+type TargetRule struct {
+	Type   string `json:"type"`
+	Header string `json:"header,omitempty"`
+	Value  string `json:"value"`
+	URL    string `json:"url"`
+}
+
+// LinkTargets represents a default target and rules of the link.
+type LinkTargets struct {
+	Default string       `json:"default"`
+	Rules   []TargetRule `json:"rules"`
+}
+
+// Variant represents a weighted destination of the link for A/B split redirects.
+type Variant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// VariantStats represents a variant of the link and number of clicks served by it.
+type VariantStats struct {
+	Variant
+	Clicks int `json:"clicks"`
+}
+
+// Classes of the visitors.
+const (
+	// ClickHuman is a visit of a person.
+	ClickHuman = "human"
+	// ClickBot is a visit of a known crawler, scanner or link preview bot.
+	ClickBot = "bot"
+	// ClickSuspicious is a visit with odd headers or too frequent visits from the same ip.
+	ClickSuspicious = "suspicious"
+)
+
+// Click represents a single visit of the short url of the user.
+// Referrer is a host of the referring page, Bot is a name of the link preview bot, Class is a class of the visitor.
+// Visitor is a salted hash of the person counted in unique visitors, zero for other visits,
+// storages keep only its HyperLogLog register.
+type Click struct {
+	UserID   string
+	ShortURL string
+	Variant  string
+	Country  string
+	Referrer string
+	Bot      string
+	Class    string
+	Visitor  uint64
+	Time     time.Time
+}
+
+// VisitorClass returns class of the visitor, clicks saved before classification are
+// visits of people unless they came from a link preview bot.
+func (c Click) VisitorClass() string {
+	switch {
+	case c.Class != "":
+		return c.Class
+	case c.Bot != "":
+		return ClickBot
+	default:
+		return ClickHuman
+	}
+}
+
+// ClickStats represents click counters of the short url.
+// Total, Variants and Countries count only people unless bots are included,
+// Bots counts visits of link preview bots, Classes counts visits of every class.
+// Uniques and UniquesByDay are estimates of distinct people, days are in UTC.
+type ClickStats struct {
+	Total        int               `json:"total"`
+	Variants     map[string]int    `json:"variants,omitempty"`
+	Countries    map[string]int    `json:"countries,omitempty"`
+	Bots         map[string]int    `json:"bots,omitempty"`
+	Classes      map[string]int    `json:"classes,omitempty"`
+	Uniques      uint64            `json:"uniques"`
+	UniquesByDay map[string]uint64 `json:"uniques_by_day,omitempty"`
+}
+
+// DayLayout is the format of days in click stats.
+const DayLayout = "2006-01-02"
+
+// NewClickStats returns empty click counters.
+func NewClickStats() ClickStats {
+	return ClickStats{Variants: make(map[string]int), Countries: make(map[string]int), Bots: make(map[string]int),
+		Classes: make(map[string]int), UniquesByDay: make(map[string]uint64)}
+}
+
+// Add adds a number of visits with the same attributes to the counters.
+// Visits of bots and suspicious visitors are counted as clicks only if includeBots is set.
+func (s *ClickStats) Add(click Click, clicks int, includeBots bool) {
+	class := click.VisitorClass()
+	s.Classes[class] += clicks
+	if click.Bot != "" {
+		s.Bots[click.Bot] += clicks
+	}
+	if class != ClickHuman && !includeBots {
+		return
+	}
+	s.Total += clicks
+	if click.Variant != "" {
+		s.Variants[click.Variant] += clicks
+	}
+	if click.Country != "" {
+		s.Countries[click.Country] += clicks
+	}
 }
 
 // BatchLinks represents a slice of links for batch requests.
 type BatchLinks []BatchLink
+
+// Dimensions of click reports.
+const (
+	// ReportLinks reports short urls.
+	ReportLinks = "links"
+	// ReportReferrers reports hosts of referring pages.
+	ReportReferrers = "referrers"
+	// ReportCountries reports countries of visitors.
+	ReportCountries = "countries"
+)
+
+// ReportQuery represents a request of top values of the dimension by clicks of people in [From, To).
+// Empty UserID means clicks of all users.
+type ReportQuery struct {
+	UserID    string
+	Dimension string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+// ReportItem represents a value of the report dimension with number of clicks.
+type ReportItem struct {
+	Key    string `json:"key"`
+	Clicks int    `json:"clicks"`
+}
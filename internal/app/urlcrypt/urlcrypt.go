@@ -0,0 +1,219 @@
+// Package urlcrypt encrypts original urls at rest with envelope encryption.
+//
+// Every url is encrypted with AES-256-GCM by a random data key, the data key is encrypted by the master key
+// of the current version. Stored values have the form
+//
+//	enc:<index>:<version>:<encrypted data key and url>
+//
+// where the index is a keyed hash (blind index) of the url, so equal urls are found without decryption.
+// Master keys are rotated by adding a new version and re-encrypting stored values, the index key is never rotated.
+// Values without the prefix are plaintext urls stored before the encryption was enabled.
+package urlcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// prefix marks encrypted values.
+const prefix = "enc:"
+
+// KeySize is the size of master keys and data keys.
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned for values encrypted by a master key which is not configured.
+	ErrUnknownKey = errors.New("unknown key version")
+	// ErrInvalidValue is returned for values which are not encrypted by this package or are changed.
+	ErrInvalidValue = errors.New("invalid encrypted value")
+)
+
+// Cipher encrypts and decrypts urls, it is safe for concurrent use.
+type Cipher struct {
+	keys     map[uint32]cipher.AEAD
+	current  uint32
+	indexKey []byte
+}
+
+// ParseKeys parses master keys in the form version:base64 key.
+func ParseKeys(values []string) (map[uint32][]byte, error) {
+	keys := make(map[uint32][]byte, len(values))
+	for _, value := range values {
+		version, encoded, ok := strings.Cut(strings.TrimSpace(value), ":")
+		if !ok {
+			return nil, errors.New("key must have the form version:base64 key")
+		}
+		v, err := strconv.ParseUint(version, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("key version %q: %w", version, err)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key of version %d: %w", v, err)
+		}
+		if _, ok = keys[uint32(v)]; ok {
+			return nil, fmt.Errorf("duplicate key version %d", v)
+		}
+		keys[uint32(v)] = key
+	}
+	return keys, nil
+}
+
+// New returns a Cipher encrypting by the master key of the highest version.
+// Keys of other versions only decrypt values, the index key hashes urls for lookups.
+func New(keys map[uint32][]byte, indexKey []byte) (*Cipher, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no master keys")
+	}
+	if len(indexKey) < KeySize {
+		return nil, fmt.Errorf("index key must have at least %d bytes", KeySize)
+	}
+	c := &Cipher{keys: make(map[uint32]cipher.AEAD, len(keys)), indexKey: indexKey}
+	for version, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key of version %d must have %d bytes", version, KeySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		c.keys[version] = aead
+		if version > c.current {
+			c.current = version
+		}
+	}
+	return c, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Index returns the lookup key of the url, it is equal to LookupKey of every encrypted value of the url.
+func (c *Cipher) Index(url string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(url))
+	return prefix + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Encrypt returns the encrypted value of the url.
+// The header with the index and the version is authenticated, so it cannot be moved to another value.
+func (c *Cipher) Encrypt(url string) (string, error) {
+	header := c.Index(url) + ":" + strconv.FormatUint(uint64(c.current), 10)
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	master := c.keys[c.current]
+
+	// the nonce and the data key encrypted by the master key are followed by the nonce and the encrypted url
+	payload := make([]byte, master.NonceSize(), master.NonceSize()+KeySize+master.Overhead()+data.NonceSize()+len(url)+data.Overhead())
+	if _, err = rand.Read(payload); err != nil {
+		return "", err
+	}
+	payload = master.Seal(payload, payload, dataKey, []byte(header))
+	nonce := make([]byte, data.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload = append(payload, nonce...)
+	payload = data.Seal(payload, nonce, []byte(url), []byte(header))
+	return header + ":" + base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+// Decrypt returns the url of the value, plaintext values are returned as they are.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !Encrypted(value) {
+		return value, nil
+	}
+	header, encoded, version, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	master, ok := c.keys[version]
+	if !ok {
+		return "", fmt.Errorf("%w %d", ErrUnknownKey, version)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+
+	wrapped := master.NonceSize() + KeySize + master.Overhead()
+	if len(payload) < wrapped {
+		return "", ErrInvalidValue
+	}
+	dataKey, err := master.Open(nil, payload[:master.NonceSize()], payload[master.NonceSize():wrapped], []byte(header))
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	payload = payload[wrapped:]
+	if len(payload) < data.NonceSize() {
+		return "", ErrInvalidValue
+	}
+	url, err := data.Open(nil, payload[:data.NonceSize()], payload[data.NonceSize():], []byte(header))
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	return string(url), nil
+}
+
+// Current reports whether the value is encrypted by the current master key.
+func (c *Cipher) Current(value string) bool {
+	if !Encrypted(value) {
+		return false
+	}
+	_, _, version, err := parse(value)
+	return err == nil && version == c.current
+}
+
+// parse returns the authenticated header, the encoded payload and the key version of the value.
+func parse(value string) (string, string, uint32, error) {
+	parts := strings.SplitN(value[len(prefix):], ":", 3)
+	if len(parts) != 3 {
+		return "", "", 0, ErrInvalidValue
+	}
+	version, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return "", "", 0, ErrInvalidValue
+	}
+	return prefix + parts[0] + ":" + parts[1], parts[2], uint32(version), nil
+}
+
+// Encrypted reports whether the value is encrypted.
+func Encrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// LookupKey returns the key of the stored value for equality lookups of original urls:
+// the index of encrypted values and plaintext values as they are.
+func LookupKey(value string) string {
+	if !Encrypted(value) {
+		return value
+	}
+	if i := strings.IndexByte(value[len(prefix):], ':'); i >= 0 {
+		return value[:len(prefix)+i]
+	}
+	return value
+}
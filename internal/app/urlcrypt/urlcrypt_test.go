@@ -0,0 +1,78 @@
+package urlcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestCipher(t *testing.T) {
+	url := "https://example.com/reset?token=secret"
+	old, err := New(map[uint32][]byte{1: testKey(1)}, testKey(9))
+	require.NoError(t, err)
+	value, err := old.Encrypt(url)
+	require.NoError(t, err)
+	assert.NotContains(t, value, "secret")
+	assert.True(t, Encrypted(value))
+	assert.True(t, old.Current(value))
+
+	// every value has its own data key, lookups use the index
+	other, err := old.Encrypt(url)
+	require.NoError(t, err)
+	assert.NotEqual(t, value, other)
+	assert.Equal(t, old.Index(url), LookupKey(value))
+	assert.Equal(t, LookupKey(value), LookupKey(other))
+	assert.NotEqual(t, old.Index(url), old.Index("https://example.com"))
+	assert.Equal(t, url, LookupKey(url), "plaintext values are looked up as they are")
+
+	// values of the old key are decrypted after rotation
+	keys, err := ParseKeys([]string{"1:" + base64.StdEncoding.EncodeToString(testKey(1)),
+		"2:" + base64.StdEncoding.EncodeToString(testKey(2))})
+	require.NoError(t, err)
+	rotated, err := New(keys, testKey(9))
+	require.NoError(t, err)
+	assert.False(t, rotated.Current(value))
+	decrypted, err := rotated.Decrypt(value)
+	require.NoError(t, err)
+	assert.Equal(t, url, decrypted)
+	value, err = rotated.Encrypt(url)
+	require.NoError(t, err)
+	assert.True(t, rotated.Current(value))
+	assert.Equal(t, old.Index(url), LookupKey(value), "the index must not depend on the master key")
+	_, err = old.Decrypt(value)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	plain, err := rotated.Decrypt(url)
+	require.NoError(t, err)
+	assert.Equal(t, url, plain)
+	assert.False(t, rotated.Current(url))
+
+	// the header is authenticated
+	index := LookupKey(value)
+	forged := rotated.Index("https://example.com") + value[len(index):]
+	_, err = rotated.Decrypt(forged)
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	_, err = rotated.Decrypt(strings.TrimSuffix(value, value[len(value)-4:]))
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, testKey(9))
+	assert.Error(t, err)
+	_, err = New(map[uint32][]byte{1: testKey(1)[:16]}, testKey(9))
+	assert.Error(t, err)
+	_, err = New(map[uint32][]byte{1: testKey(1)}, testKey(9)[:8])
+	assert.Error(t, err)
+	_, err = ParseKeys([]string{"key"})
+	assert.Error(t, err)
+	_, err = ParseKeys([]string{"1:AAAA", "1:AAAA"})
+	assert.Error(t, err)
+}
@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 )
@@ -23,6 +26,73 @@ type Config struct {
 	Config          string `env:"CONFIG" envDefault:""`
 	TrustedSubnet   string `env:"TRUSTED_SUBNET" envDefault:"" json:"trusted_subnet"`
 	GrpcPort        int    `env:"GRPC_PORT" envDefault:"3200" json:"grpc_port"`
+	GeoIPPath       string `env:"GEOIP_PATH" envDefault:"" json:"geoip_path"`
+	// CrawlerRangesPath is the path to the file with networks of known crawlers.
+	CrawlerRangesPath string `env:"CRAWLER_RANGES_PATH" envDefault:"" json:"crawler_ranges_path"`
+	// VisitorSalt is the secret salt of visitor hashes used to count unique visitors, random if empty.
+	VisitorSalt string `env:"VISITOR_SALT" envDefault:"" json:"visitor_salt"`
+	// HealthCheckInterval is the interval between checks of original urls, zero disables the checks.
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"1h" json:"health_check_interval"`
+	// ClickRetention is the age of raw clicks to purge, their rollups are kept. Zero keeps raw clicks forever.
+	ClickRetention time.Duration `env:"CLICK_RETENTION" envDefault:"0" json:"click_retention"`
+	// MemorySnapshotPath is the snapshot of the memory storage restored at startup and written at shutdown,
+	// it can be copied to another storage by shortener-migrate.
+	MemorySnapshotPath string `env:"MEMORY_SNAPSHOT_PATH" envDefault:"" json:"memory_snapshot_path"`
+	// MemorySnapshotInterval is the interval between snapshots of the memory storage, zero writes only the final snapshot.
+	MemorySnapshotInterval time.Duration `env:"MEMORY_SNAPSHOT_INTERVAL" envDefault:"0" json:"memory_snapshot_interval"`
+	// MemoryShards is the number of shards of the memory storage for many cores, zero uses a single map.
+	MemoryShards int `env:"MEMORY_SHARDS" envDefault:"0" json:"memory_shards"`
+	// CacheSize is the number of links kept in the cache of redirects, zero disables the cache.
+	CacheSize int `env:"CACHE_SIZE" envDefault:"10000" json:"cache_size"`
+	// CacheTTL is the time links are kept in the cache.
+	CacheTTL time.Duration `env:"CACHE_TTL" envDefault:"1m" json:"cache_ttl"`
+	// CacheNegativeTTL is the time unknown short urls are kept in the cache, zero disables caching of unknown short urls.
+	CacheNegativeTTL time.Duration `env:"CACHE_NEGATIVE_TTL" envDefault:"5s" json:"cache_negative_ttl"`
+	// DatabaseReplicaDsns are dsns of read replicas of the database serving redirects and stats, separated by commas.
+	DatabaseReplicaDsns []string `env:"DATABASE_REPLICA_DSNS" envSeparator:"," json:"database_replica_dsns"`
+	// ReadYourWrites is the time reads of a user and of changed links are sent to the primary after writes, zero disables it.
+	ReadYourWrites time.Duration `env:"READ_YOUR_WRITES" envDefault:"0" json:"read_your_writes"`
+	// Storage is the storage mode: memory, file, postgres or kv. Empty selects postgres if DatabaseDsn is set,
+	// file if FileStoragePath is set and memory otherwise.
+	Storage string `env:"STORAGE" envDefault:"" json:"storage"`
+	// KVPath is the file of the embedded key-value storage.
+	KVPath string `env:"KV_PATH" envDefault:"shortener.kv" json:"kv_path"`
+	// URLEncryptionKeys are master keys encrypting original urls in the form version:base64 key, separated by commas.
+	// The key of the highest version encrypts, other keys only decrypt. Empty keeps original urls in plaintext.
+	URLEncryptionKeys []string `env:"URL_ENCRYPTION_KEYS" envSeparator:"," json:"url_encryption_keys"`
+	// URLIndexKey is the base64 key of the blind index of encrypted original urls, it must never change.
+	URLIndexKey string `env:"URL_INDEX_KEY" envDefault:"" json:"url_index_key"`
+	// URLReencryptInterval is the interval between re-encryptions of original urls by the current key, zero disables them.
+	URLReencryptInterval time.Duration `env:"URL_REENCRYPT_INTERVAL" envDefault:"1h" json:"url_reencrypt_interval"`
+	// UndeleteGracePeriod is the time deleted links can be restored by their owners.
+	UndeleteGracePeriod time.Duration `env:"UNDELETE_GRACE_PERIOD" envDefault:"168h" json:"undelete_grace_period"`
+	// DeletedRetention is the age of deleted links to purge with their clicks, zero keeps deleted links forever.
+	// It must not be shorter than the undelete grace period.
+	DeletedRetention time.Duration `env:"DELETED_RETENTION" envDefault:"0" json:"deleted_retention"`
+	// ReusePurgedShortURLS allows new links to take short urls of purged links, otherwise they stay reserved.
+	ReusePurgedShortURLS bool `env:"REUSE_PURGED_SHORT_URLS" envDefault:"false" json:"reuse_purged_short_urls"`
+}
+
+// Storage modes.
+const (
+	StorageMemory   = "memory"
+	StorageFile     = "file"
+	StoragePostgres = "postgres"
+	StorageKV       = "kv"
+)
+
+// StorageMode returns the selected storage mode.
+func (c *Config) StorageMode() string {
+	switch {
+	case c.Storage != "":
+		return c.Storage
+	case c.DatabaseDsn != "":
+		return StoragePostgres
+	case c.FileStoragePath != "":
+		return StorageFile
+	default:
+		return StorageMemory
+	}
 }
 
 var once sync.Once
@@ -37,6 +107,33 @@ func (c *Config) readCommandLineArgs() {
 		flag.StringVar(&c.Config, "c", c.Config, "json config path")
 		flag.StringVar(&c.TrustedSubnet, "t", c.TrustedSubnet, "enable trusted subnet mode")
 		flag.IntVar(&c.GrpcPort, "g", c.GrpcPort, "grpc port")
+		flag.StringVar(&c.GeoIPPath, "geoip", c.GeoIPPath, "path to CSV file with networks and countries")
+		flag.StringVar(&c.CrawlerRangesPath, "crawlers", c.CrawlerRangesPath, "path to file with networks of known crawlers")
+		flag.StringVar(&c.VisitorSalt, "salt", c.VisitorSalt, "secret salt of visitor hashes, shared by all instances")
+		flag.DurationVar(&c.HealthCheckInterval, "health", c.HealthCheckInterval, "interval between checks of original urls, 0 disables checks")
+		flag.DurationVar(&c.ClickRetention, "retention", c.ClickRetention, "age of raw clicks to purge, 0 keeps raw clicks")
+		flag.StringVar(&c.MemorySnapshotPath, "snapshot", c.MemorySnapshotPath, "snapshot of memory storage restored at startup and written at shutdown")
+		flag.DurationVar(&c.MemorySnapshotInterval, "snapshot-interval", c.MemorySnapshotInterval, "interval between snapshots of memory storage, 0 writes only at shutdown")
+		flag.IntVar(&c.MemoryShards, "shards", c.MemoryShards, "number of shards of memory storage, 0 uses a single map")
+		flag.IntVar(&c.CacheSize, "cache", c.CacheSize, "number of links in cache of redirects, 0 disables cache")
+		flag.DurationVar(&c.CacheTTL, "cache-ttl", c.CacheTTL, "time links are kept in cache")
+		flag.DurationVar(&c.CacheNegativeTTL, "cache-negative-ttl", c.CacheNegativeTTL, "time unknown short urls are kept in cache, 0 disables")
+		flag.Func("replicas", "comma separated dsns of database read replicas", func(value string) error {
+			c.DatabaseReplicaDsns = strings.Split(value, ",")
+			return nil
+		})
+		flag.DurationVar(&c.ReadYourWrites, "read-your-writes", c.ReadYourWrites, "time reads are sent to primary after writes, 0 disables")
+		flag.StringVar(&c.Storage, "storage", c.Storage, "storage mode: memory, file, postgres or kv")
+		flag.StringVar(&c.KVPath, "kv-path", c.KVPath, "file of kv storage")
+		flag.Func("url-keys", "comma separated master keys of original urls in the form version:base64 key", func(value string) error {
+			c.URLEncryptionKeys = strings.Split(value, ",")
+			return nil
+		})
+		flag.StringVar(&c.URLIndexKey, "url-index-key", c.URLIndexKey, "base64 key of blind index of original urls")
+		flag.DurationVar(&c.URLReencryptInterval, "url-reencrypt-interval", c.URLReencryptInterval, "interval between re-encryptions of original urls, 0 disables")
+		flag.DurationVar(&c.UndeleteGracePeriod, "undelete-grace", c.UndeleteGracePeriod, "time deleted links can be restored")
+		flag.DurationVar(&c.DeletedRetention, "deleted-retention", c.DeletedRetention, "age of deleted links to purge, 0 keeps deleted links")
+		flag.BoolVar(&c.ReusePurgedShortURLS, "reuse-purged", c.ReusePurgedShortURLS, "allow new links to take short urls of purged links")
 		flag.Parse()
 	})
 }
@@ -91,6 +188,88 @@ func ReadConfig() (*Config, error) {
 		if cfg.GrpcPort == 3200 && fileConfig.GrpcPort > 0 {
 			cfg.GrpcPort = fileConfig.GrpcPort
 		}
+		if cfg.GeoIPPath == "" && fileConfig.GeoIPPath != "" {
+			cfg.GeoIPPath = fileConfig.GeoIPPath
+		}
+		if cfg.CrawlerRangesPath == "" && fileConfig.CrawlerRangesPath != "" {
+			cfg.CrawlerRangesPath = fileConfig.CrawlerRangesPath
+		}
+		if cfg.VisitorSalt == "" && fileConfig.VisitorSalt != "" {
+			cfg.VisitorSalt = fileConfig.VisitorSalt
+		}
+		// duration in the config file is set in nanoseconds
+		if cfg.HealthCheckInterval == time.Hour && fileConfig.HealthCheckInterval > 0 {
+			cfg.HealthCheckInterval = fileConfig.HealthCheckInterval
+		}
+		if cfg.ClickRetention == 0 && fileConfig.ClickRetention > 0 {
+			cfg.ClickRetention = fileConfig.ClickRetention
+		}
+		if cfg.MemorySnapshotPath == "" && fileConfig.MemorySnapshotPath != "" {
+			cfg.MemorySnapshotPath = fileConfig.MemorySnapshotPath
+		}
+		if cfg.MemorySnapshotInterval == 0 && fileConfig.MemorySnapshotInterval > 0 {
+			cfg.MemorySnapshotInterval = fileConfig.MemorySnapshotInterval
+		}
+		if cfg.MemoryShards == 0 && fileConfig.MemoryShards > 0 {
+			cfg.MemoryShards = fileConfig.MemoryShards
+		}
+		if cfg.CacheSize == 10000 && fileConfig.CacheSize > 0 {
+			cfg.CacheSize = fileConfig.CacheSize
+		}
+		if cfg.CacheTTL == time.Minute && fileConfig.CacheTTL > 0 {
+			cfg.CacheTTL = fileConfig.CacheTTL
+		}
+		if cfg.CacheNegativeTTL == 5*time.Second && fileConfig.CacheNegativeTTL > 0 {
+			cfg.CacheNegativeTTL = fileConfig.CacheNegativeTTL
+		}
+		if len(cfg.DatabaseReplicaDsns) == 0 && len(fileConfig.DatabaseReplicaDsns) > 0 {
+			cfg.DatabaseReplicaDsns = fileConfig.DatabaseReplicaDsns
+		}
+		if cfg.ReadYourWrites == 0 && fileConfig.ReadYourWrites > 0 {
+			cfg.ReadYourWrites = fileConfig.ReadYourWrites
+		}
+		if cfg.Storage == "" && fileConfig.Storage != "" {
+			cfg.Storage = fileConfig.Storage
+		}
+		if cfg.KVPath == "shortener.kv" && fileConfig.KVPath != "" {
+			cfg.KVPath = fileConfig.KVPath
+		}
+		if len(cfg.URLEncryptionKeys) == 0 && len(fileConfig.URLEncryptionKeys) > 0 {
+			cfg.URLEncryptionKeys = fileConfig.URLEncryptionKeys
+		}
+		if cfg.URLIndexKey == "" && fileConfig.URLIndexKey != "" {
+			cfg.URLIndexKey = fileConfig.URLIndexKey
+		}
+		if cfg.URLReencryptInterval == time.Hour && fileConfig.URLReencryptInterval > 0 {
+			cfg.URLReencryptInterval = fileConfig.URLReencryptInterval
+		}
+		if cfg.UndeleteGracePeriod == 168*time.Hour && fileConfig.UndeleteGracePeriod > 0 {
+			cfg.UndeleteGracePeriod = fileConfig.UndeleteGracePeriod
+		}
+		if cfg.DeletedRetention == 0 && fileConfig.DeletedRetention > 0 {
+			cfg.DeletedRetention = fileConfig.DeletedRetention
+		}
+		if !cfg.ReusePurgedShortURLS && fileConfig.ReusePurgedShortURLS {
+			cfg.ReusePurgedShortURLS = fileConfig.ReusePurgedShortURLS
+		}
+	}
+
+	switch cfg.StorageMode() {
+	case StorageMemory, StorageKV:
+	case StorageFile:
+		if cfg.FileStoragePath == "" {
+			return nil, errors.New("file storage requires file storage path")
+		}
+	case StoragePostgres:
+		if cfg.DatabaseDsn == "" {
+			return nil, errors.New("postgres storage requires database dsn")
+		}
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+	// links deleted within the grace period must not be purged
+	if cfg.DeletedRetention > 0 && cfg.DeletedRetention < cfg.UndeleteGracePeriod {
+		return nil, errors.New("deleted retention must not be shorter than undelete grace period")
 	}
 
 	log.Printf("%+v\n\n", cfg)
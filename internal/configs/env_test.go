@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -27,7 +28,8 @@ func TestReadConfig(t *testing.T) {
 		},
 		{
 			name: "read config from json config",
-			want: &Config{ServerAddress: "host:9090", BaseURL: "https://baseurl", FileStoragePath: "/path/to/file.db", DatabaseDsn: "databaseConnectionString", EnableHTTPS: true, TrustedSubnet: "192.168.0.15/24", GrpcPort: 999},
+			want: &Config{ServerAddress: "host:9090", BaseURL: "https://baseurl", FileStoragePath: "/path/to/file.db", DatabaseDsn: "databaseConnectionString", EnableHTTPS: true, TrustedSubnet: "192.168.0.15/24", GrpcPort: 999,
+				GeoIPPath: "/path/to/geo.csv"},
 			jsonConfig: map[string]interface{}{
 				"server_address":    "host:9090",
 				"base_url":          "https://baseurl",
@@ -36,6 +38,7 @@ func TestReadConfig(t *testing.T) {
 				"enable_https":      true,
 				"trusted_subnet":    "192.168.0.15/24",
 				"grpc_port":         999,
+				"geoip_path":        "/path/to/geo.csv",
 			},
 			deleteConfig: false,
 			wantErr:      false,
@@ -47,6 +50,20 @@ func TestReadConfig(t *testing.T) {
 			deleteConfig: false,
 			wantErr:      true,
 		},
+		{
+			name:         "read config with unknown storage",
+			want:         nil,
+			jsonConfig:   map[string]interface{}{"storage": "unknown"},
+			deleteConfig: false,
+			wantErr:      true,
+		},
+		{
+			name:         "read config with retention of deleted links in grace period",
+			want:         nil,
+			jsonConfig:   map[string]interface{}{"deleted_retention": int64(time.Hour)},
+			deleteConfig: false,
+			wantErr:      true,
+		},
 		{
 			name:         "read not existing config file",
 			want:         nil,
@@ -93,7 +110,7 @@ func TestReadConfig(t *testing.T) {
 
 			if !tt.wantErr {
 				testConfig := &Config{ServerAddress: got.ServerAddress, BaseURL: got.BaseURL, FileStoragePath: got.FileStoragePath, DatabaseDsn: got.DatabaseDsn, EnableHTTPS: got.EnableHTTPS,
-					TrustedSubnet: got.TrustedSubnet, GrpcPort: got.GrpcPort}
+					TrustedSubnet: got.TrustedSubnet, GrpcPort: got.GrpcPort, GeoIPPath: got.GeoIPPath}
 				if !reflect.DeepEqual(testConfig, tt.want) {
 					t.Errorf("ReadConfig() got = %v, want %v", testConfig, tt.want)
 				}
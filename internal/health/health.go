@@ -0,0 +1,204 @@
+// Package health provides background checks of the original urls.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-developer-course-shortener/internal/app/repository"
+	"go-developer-course-shortener/internal/app/types"
+	"go-developer-course-shortener/internal/worker"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// userAgent is sent with every check, so owners of the sites can recognize the requests.
+	userAgent = "go-developer-course-shortener health checker"
+	// maxRedirects limits number of followed redirects like the default client.
+	maxRedirects = 10
+)
+
+// Config contains settings of the checker.
+type Config struct {
+	// Interval between checks of the same url.
+	Interval time.Duration
+	// Timeout of a single request.
+	Timeout time.Duration
+	// Workers is the maximum number of concurrent requests.
+	Workers int
+	// HostInterval is the minimum interval between requests to the same host.
+	HostInterval time.Duration
+	// BatchSize is the maximum number of urls checked in one round.
+	BatchSize int
+}
+
+// DefaultConfig returns settings of the checker for the interval.
+func DefaultConfig(interval time.Duration) Config {
+	return Config{Interval: interval, Timeout: 10 * time.Second, Workers: 10, HostInterval: time.Second, BatchSize: 1000}
+}
+
+// Checker periodically requests original urls and saves the results to the repository.
+type Checker struct {
+	repository repository.Repository
+	config     Config
+	client     *http.Client
+	limiter    *hostLimiter
+}
+
+// NewChecker returns a new Checker, serving the provided Repository.
+// Urls are requested only at public addresses, targets of redirects are checked too.
+func NewChecker(repo repository.Repository, config Config) *Checker {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	dialer := &net.Dialer{Timeout: config.Timeout, Control: worker.DenyPrivateAddress}
+	transport := &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: config.Timeout}
+	return &Checker{
+		repository: repo,
+		config:     config,
+		client:     &http.Client{Timeout: config.Timeout, Transport: transport, CheckRedirect: checkRedirect},
+		limiter:    newHostLimiter(config.HostInterval),
+	}
+}
+
+// SetTransport replaces the transport of requests, the transport is responsible for rejecting private addresses.
+func (c *Checker) SetTransport(transport http.RoundTripper) {
+	c.client.Transport = transport
+}
+
+// checkRedirect rejects redirects to other schemes than http and https and to private ip addresses.
+// Host names are resolved by the dialer, which rejects private addresses as well.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("too many redirects")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("scheme %s is not allowed", req.URL.Scheme)
+	}
+	host := req.URL.Hostname()
+	if net.ParseIP(host) == nil {
+		return nil
+	}
+	return worker.DenyPrivateAddress("tcp", net.JoinHostPort(host, "0"), nil)
+}
+
+// Run checks urls every interval until the context is done.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		checked, err := c.CheckOnce(ctx)
+		if err != nil {
+			log.Printf("Health check failed. Error: %v", err)
+		} else {
+			log.Printf("Health check done, %d urls checked", checked)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Println("Health checker context done")
+			return
+		}
+	}
+}
+
+// CheckOnce checks urls which were not checked during the interval and returns number of checked urls.
+// Requests run concurrently, results are saved in one batch.
+func (c *Checker) CheckOnce(ctx context.Context) (int, error) {
+	links, err := c.repository.GetHealthCheckURLS(time.Now().Add(-c.config.Interval), c.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	c.limiter.prune()
+
+	jobs := make(chan types.Link)
+	var mu sync.Mutex
+	results := make(map[string]types.Health, len(links))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < c.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range jobs {
+				health := c.Check(ctx, link.OriginalURL)
+				if ctx.Err() != nil {
+					// interrupted checks must not mark urls as broken
+					continue
+				}
+				mu.Lock()
+				results[link.ShortURL] = health
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for _, link := range links {
+		select {
+		case jobs <- link:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return len(results), c.repository.SaveHealth(results)
+}
+
+// Check requests the url with HEAD method. Servers often do not support HEAD,
+// so the url is requested with GET method if HEAD fails.
+func (c *Checker) Check(ctx context.Context, rawURL string) types.Health {
+	health := c.request(ctx, http.MethodHead, rawURL)
+	if health.Broken() && ctx.Err() == nil {
+		health = c.request(ctx, http.MethodGet, rawURL)
+	}
+	return health
+}
+
+func (c *Checker) request(ctx context.Context, method string, rawURL string) types.Health {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return types.Health{Error: "invalid url", CheckedAt: time.Now()}
+	}
+	if err = c.limiter.wait(ctx, u.Host); err != nil {
+		return types.Health{Error: err.Error(), CheckedAt: time.Now()}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return types.Health{Error: err.Error(), CheckedAt: time.Now()}
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	health := types.Health{LatencyMS: time.Since(start).Milliseconds(), CheckedAt: start}
+	if err != nil {
+		health.Error = requestError(err)
+		return health
+	}
+	// the body is not needed, closing it without reading aborts the download
+	resp.Body.Close()
+	health.StatusCode = resp.StatusCode
+	return health
+}
+
+// requestError returns a generic reason of the failed request. Errors of dialers and redirects are not returned,
+// because they are shown to owners of links and would reveal addresses of the internal network.
+func requestError(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.Timeout() {
+		return "timeout"
+	}
+	return "request failed"
+}
@@ -0,0 +1,238 @@
+package health
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, userAgent, r.UserAgent())
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestChecker returns a checker which connects to the local test server,
+// redirects are checked unless they stay at the same server.
+func newTestChecker(repo repository.Repository, config Config) *Checker {
+	checker := NewChecker(repo, config)
+	checker.SetTransport(&http.Transport{})
+	checker.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Host == via[len(via)-1].URL.Host {
+			return nil
+		}
+		return checkRedirect(req, via)
+	}
+	return checker
+}
+
+func TestChecker_Check(t *testing.T) {
+	server := newTestServer(t)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantError  string
+		wantBroken bool
+	}{
+		{name: "ok", url: server.URL + "/ok", wantStatus: http.StatusOK},
+		{name: "gone", url: server.URL + "/gone", wantStatus: http.StatusGone, wantBroken: true},
+		{name: "fallback to GET", url: server.URL + "/get-only", wantStatus: http.StatusOK},
+		{name: "redirect is followed", url: server.URL + "/redirect", wantStatus: http.StatusOK},
+		{name: "redirect to private address", url: server.URL + "/metadata", wantError: "request failed", wantBroken: true},
+		{name: "timeout", url: server.URL + "/slow", wantError: "timeout", wantBroken: true},
+		{name: "connection refused", url: closed.URL, wantError: "request failed", wantBroken: true},
+		{name: "invalid url", url: "http://[::1", wantError: "invalid url", wantBroken: true},
+	}
+
+	config := DefaultConfig(time.Hour)
+	config.Timeout = 100 * time.Millisecond
+	config.HostInterval = 0
+	checker := newTestChecker(repository.NewInMemoryRepository(), config)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := checker.Check(context.Background(), tt.url)
+			assert.Equal(t, tt.wantStatus, health.StatusCode)
+			if tt.wantError != "" {
+				assert.Equal(t, tt.wantError, health.Error)
+			}
+			assert.Equal(t, tt.wantBroken, health.Broken())
+			assert.False(t, health.CheckedAt.IsZero())
+		})
+	}
+}
+
+func TestChecker_CheckOnce(t *testing.T) {
+	server := newTestServer(t)
+	repo := repository.NewInMemoryRepository()
+	require.NoError(t, repo.SaveURL("user", "ok", server.URL+"/ok"))
+	require.NoError(t, repo.SaveURL("user", "gone", server.URL+"/gone"))
+	require.NoError(t, repo.SaveURL("user", "get-only", server.URL+"/get-only"))
+
+	config := DefaultConfig(time.Hour)
+	config.HostInterval = 0
+	checker := newTestChecker(repo, config)
+
+	checked, err := checker.CheckOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, checked)
+
+	links, err := repo.GetUserStorage("user")
+	require.NoError(t, err)
+	broken := make(map[string]bool)
+	for _, link := range links {
+		require.NotNil(t, link.Health, link.ShortURL)
+		broken[link.ShortURL] = link.Health.Broken()
+	}
+	assert.Equal(t, map[string]bool{"ok": false, "gone": true, "get-only": false}, broken)
+
+	// urls checked during the interval are skipped
+	checked, err = checker.CheckOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, checked)
+}
+
+func TestChecker_CheckOnceConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	repo := repository.NewInMemoryRepository()
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		require.NoError(t, repo.SaveURL("user", id, server.URL+"/"+id))
+	}
+
+	config := DefaultConfig(time.Hour)
+	config.Workers = 2
+	config.HostInterval = 0
+	checked, err := newTestChecker(repo, config).CheckOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 6, checked)
+	assert.Equal(t, 2, maxActive)
+}
+
+func TestChecker_CheckOnceCanceled(t *testing.T) {
+	server := newTestServer(t)
+	repo := repository.NewInMemoryRepository()
+	require.NoError(t, repo.SaveURL("user", "slow", server.URL+"/slow"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	checked, err := newTestChecker(repo, DefaultConfig(time.Hour)).CheckOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, checked)
+
+	link, err := repo.GetURL("slow")
+	require.NoError(t, err)
+	assert.Nil(t, link.Health)
+}
+
+func TestChecker_PrivateAddress(t *testing.T) {
+	server := newTestServer(t)
+	config := DefaultConfig(time.Hour)
+	config.HostInterval = 0
+	checker := NewChecker(repository.NewInMemoryRepository(), config)
+
+	// the address is not revealed to the owner of the link
+	health := checker.Check(context.Background(), server.URL+"/ok")
+	assert.Equal(t, 0, health.StatusCode)
+	assert.Equal(t, "request failed", health.Error)
+	assert.True(t, health.Broken())
+}
+
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://example.com/next", wantErr: false},
+		{url: "http://93.184.216.34/", wantErr: false},
+		{url: "http://169.254.169.254/latest/meta-data/", wantErr: true},
+		{url: "http://10.0.0.1:8080/", wantErr: true},
+		{url: "http://[::1]/", wantErr: true},
+		{url: "ftp://example.com/", wantErr: true},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		require.NoError(t, err)
+		err = checkRedirect(req, []*http.Request{{}})
+		assert.Equal(t, tt.wantErr, err != nil, tt.url)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	require.NoError(t, err)
+	assert.Error(t, checkRedirect(req, make([]*http.Request, maxRedirects)))
+}
+
+func TestHostLimiter(t *testing.T) {
+	limiter := newHostLimiter(50 * time.Millisecond)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.wait(ctx, "example.com"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	// other hosts are not delayed
+	start = time.Now()
+	require.NoError(t, limiter.wait(ctx, "example.org"))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, limiter.wait(canceled, "example.com"))
+
+	time.Sleep(200 * time.Millisecond)
+	limiter.prune()
+	assert.Empty(t, limiter.next)
+}
@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostLimiter spaces requests to the same host by the interval.
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{interval: interval, next: make(map[string]time.Time)}
+}
+
+// wait reserves the next free slot of the host and blocks until it comes or the context is done.
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// prune forgets hosts whose slots have passed.
+func (l *hostLimiter) prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for host, at := range l.next {
+		if at.Before(now) {
+			delete(l.next, host)
+		}
+	}
+}
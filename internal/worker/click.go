@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"go-developer-course-shortener/internal/app/types"
+	"log"
+	"time"
+)
+
+const (
+	// MaxClickQueueSize maximum number of queued clicks.
+	MaxClickQueueSize = 4096
+	// MaxClickBatchSize maximum number of clicks saved in one batch.
+	MaxClickBatchSize = 512
+	// ClickFlushInterval is the maximum time a click waits in the batch.
+	ClickFlushInterval = time.Second
+)
+
+// ClickPool saves queued clicks in batches, so redirects do not wait for the storage.
+type ClickPool struct {
+	repository repository.Repository
+	inputCh    chan types.Click
+}
+
+// NewClickPool returns a new ClickPool, serving the provided Repository.
+func NewClickPool(repo repository.Repository, inputCh chan types.Click) *ClickPool {
+	return &ClickPool{repository: repo, inputCh: inputCh}
+}
+
+// ClosePool closes input channel for new clicks, queued clicks are saved before Run returns.
+func (p *ClickPool) ClosePool() {
+	log.Println("Closing click pool")
+	close(p.inputCh)
+}
+
+// Run collects clicks into batches, a batch is saved when it is full or every ClickFlushInterval.
+// Queued clicks are saved when the pool is closed or the context is done, Run returns after the last batch is saved,
+// so the storage must be released only after Run returns.
+func (p *ClickPool) Run(ctx context.Context) {
+	ticker := time.NewTicker(ClickFlushInterval)
+	defer ticker.Stop()
+	batch := make([]types.Click, 0, MaxClickBatchSize)
+	for {
+		select {
+		case click, ok := <-p.inputCh:
+			if !ok {
+				p.save(batch)
+				return
+			}
+			if batch = append(batch, click); len(batch) >= MaxClickBatchSize {
+				batch = p.save(batch)
+			}
+		case <-ticker.C:
+			batch = p.save(batch)
+		case <-ctx.Done():
+			log.Println("Click pool context done")
+			p.save(p.drain(batch))
+			return
+		}
+	}
+}
+
+// drain adds clicks left in the queue to the batch, full batches are saved.
+func (p *ClickPool) drain(batch []types.Click) []types.Click {
+	for {
+		select {
+		case click, ok := <-p.inputCh:
+			if !ok {
+				return batch
+			}
+			if batch = append(batch, click); len(batch) >= MaxClickBatchSize {
+				batch = p.save(batch)
+			}
+		default:
+			return batch
+		}
+	}
+}
+
+// save saves the batch and returns it emptied, failed clicks are logged only.
+func (p *ClickPool) save(batch []types.Click) []types.Click {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := p.repository.SaveClicks(batch); err != nil {
+		log.Printf("Failed to save %d clicks. Error: %v", len(batch), err)
+	}
+	return batch[:0]
+}
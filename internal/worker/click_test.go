@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"go-developer-course-shortener/internal/app/types"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchRecorder records sizes of saved batches of clicks.
+type batchRecorder struct {
+	repository.Repository
+	mu      sync.Mutex
+	batches []int
+}
+
+func (r *batchRecorder) SaveClicks(clicks []types.Click) error {
+	r.mu.Lock()
+	r.batches = append(r.batches, len(clicks))
+	r.mu.Unlock()
+	return r.Repository.SaveClicks(clicks)
+}
+
+func TestClickPool(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		clicks   int
+		shutdown func(pool *ClickPool, cancel context.CancelFunc)
+		batches  []int
+	}{
+		{
+			name:     "queued clicks are saved when the pool is closed",
+			clicks:   MaxClickBatchSize + 10,
+			shutdown: func(pool *ClickPool, _ context.CancelFunc) { pool.ClosePool() },
+			batches:  []int{MaxClickBatchSize, 10},
+		},
+		{
+			name:     "queued clicks are saved when the context is done",
+			clicks:   MaxClickBatchSize*2 + 1,
+			shutdown: func(_ *ClickPool, cancel context.CancelFunc) { cancel() },
+			batches:  []int{MaxClickBatchSize, MaxClickBatchSize, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &batchRecorder{Repository: repository.NewInMemoryRepository()}
+			clicks := make(chan types.Click, MaxClickQueueSize)
+			pool := NewClickPool(repo, clicks)
+			for i := 0; i < tt.clicks; i++ {
+				clicks <- types.Click{UserID: "user1", ShortURL: "a", Class: types.ClickHuman, Visitor: uint64(i + 1), Time: now}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tt.shutdown(pool, cancel)
+			pool.Run(ctx)
+
+			assert.Equal(t, tt.batches, repo.batches)
+			stats, err := repo.GetClickStats("a", false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.clicks, stats.Total)
+		})
+	}
+}
+
+func TestClickPool_FlushInterval(t *testing.T) {
+	repo := &batchRecorder{Repository: repository.NewInMemoryRepository()}
+	clicks := make(chan types.Click, MaxClickQueueSize)
+	pool := NewClickPool(repo, clicks)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pool.Run(ctx)
+	}()
+
+	// a batch which is not full is saved by the ticker
+	clicks <- types.Click{UserID: "user1", ShortURL: "a", Class: types.ClickHuman, Time: time.Now()}
+	assert.Eventually(t, func() bool {
+		stats, err := repo.GetClickStats("a", false)
+		return err == nil && stats.Total == 1
+	}, 3*ClickFlushInterval, 10*time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, []int{1}, repo.batches)
+}
@@ -0,0 +1,271 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"go-developer-course-shortener/internal/app/repository"
+	"go-developer-course-shortener/internal/app/types"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// MaxPageQueueSize maximum number of queued page jobs.
+	MaxPageQueueSize = 100
+
+	// maxPageSize limits number of bytes read from the destination page.
+	maxPageSize = 512 << 10
+	// pageTimeout limits time of the destination page request.
+	pageTimeout = 5 * time.Second
+	// maxPageTextLength limits length of the title and description in characters.
+	maxPageTextLength = 1000
+	// maxPageURLLength limits length of the image url.
+	maxPageURLLength = 2048
+
+	pageUserAgent = "go-developer-course-shortener page fetcher"
+)
+
+// PageJob is a task to fetch title and OpenGraph metadata of the destination pages.
+type PageJob struct {
+	// slice of short urls whose original urls are fetched.
+	ShortURLS []string
+}
+
+// PagePool represents queue of page jobs.
+type PagePool struct {
+	repository repository.Repository
+	inputCh    chan PageJob
+	client     *http.Client
+}
+
+// NewPagePool returns a new PagePool, serving the provided Repository.
+// Pages are requested only from public addresses.
+func NewPagePool(repo repository.Repository, inputCh chan PageJob) *PagePool {
+	dialer := &net.Dialer{Timeout: pageTimeout, Control: DenyPrivateAddress}
+	transport := &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: pageTimeout}
+	return &PagePool{repository: repo, inputCh: inputCh, client: &http.Client{Timeout: pageTimeout, Transport: transport}}
+}
+
+// DenyPrivateAddress rejects connections to loopback, private and link-local addresses. It is the Control
+// of dialers, so short links can not be used to reach the internal network.
+func DenyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return fmt.Errorf("address %s is not allowed", host)
+	}
+	return nil
+}
+
+// ClosePool closes input channel for new tasks.
+func (p *PagePool) ClosePool() {
+	log.Println("Closing page pool")
+	close(p.inputCh)
+}
+
+// Run processing PageJob channels in the current context.
+// Pages of one job are fetched concurrently.
+func (p *PagePool) Run(ctx context.Context) {
+	for {
+		select {
+		case v, ok := <-p.inputCh:
+			if !ok {
+				return
+			}
+			p.process(ctx, v)
+		case <-ctx.Done():
+			log.Println("Page pool context done")
+			return
+		}
+	}
+}
+
+func (p *PagePool) process(ctx context.Context, job PageJob) {
+	var mu sync.Mutex
+	pages := make(map[string]types.Page, len(job.ShortURLS))
+	sem := make(chan struct{}, MaxWorkerPoolSize)
+	wg := sync.WaitGroup{}
+	for _, shortURL := range job.ShortURLS {
+		link, err := p.repository.GetURL(shortURL)
+		if err != nil {
+			log.Printf("Failed to get %s for page job. Error: %v", shortURL, err)
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(shortURL string, originalURL string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			page, err := fetchPage(ctx, p.client, originalURL)
+			if err != nil {
+				log.Printf("Failed to fetch page %s. Error: %v", originalURL, err)
+				return
+			}
+			mu.Lock()
+			pages[shortURL] = page
+			mu.Unlock()
+		}(shortURL, link.OriginalURL)
+	}
+	wg.Wait()
+
+	// results are saved from one goroutine, the repository may not support concurrent writes
+	for shortURL, page := range pages {
+		if err := p.repository.SavePage(shortURL, page); err != nil {
+			log.Printf("Failed to save page of %s. Error: %v", shortURL, err)
+		}
+	}
+}
+
+// fetchPage requests the page and parses its metadata from the head of html document.
+func fetchPage(ctx context.Context, client *http.Client, rawURL string) (types.Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return types.Page{}, err
+	}
+	req.Header.Set("User-Agent", pageUserAgent)
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return types.Page{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return types.Page{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil &&
+		mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return types.Page{}, fmt.Errorf("unexpected content type %s", mediaType)
+	}
+
+	page := parsePage(io.LimitReader(resp.Body, maxPageSize), resp.Request.URL)
+	page.FetchedAt = time.Now()
+	return page, nil
+}
+
+// parsePage reads title and OpenGraph properties until the end of the head.
+// Relative image url is resolved against the page url.
+func parsePage(r io.Reader, base *url.URL) types.Page {
+	var page types.Page
+	var title strings.Builder
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			// io.EOF or the limit of the reader
+			page.Title = cleanText(title.String())
+			return page
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				page.Title = cleanText(title.String())
+				return page
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = title.Len() == 0
+			case atom.Body:
+				page.Title = cleanText(title.String())
+				return page
+			case atom.Meta:
+				if hasAttr {
+					setProperty(&page, metaAttributes(z), base)
+				}
+			}
+		}
+	}
+}
+
+func metaAttributes(z *html.Tokenizer) map[string]string {
+	attributes := make(map[string]string)
+	for {
+		key, value, more := z.TagAttr()
+		attributes[strings.ToLower(string(key))] = string(value)
+		if !more {
+			return attributes
+		}
+	}
+}
+
+// setProperty sets OpenGraph property of meta tag, the first value of the property wins.
+func setProperty(page *types.Page, attributes map[string]string, base *url.URL) {
+	property := attributes["property"]
+	if property == "" {
+		// some sites use name instead of property
+		property = attributes["name"]
+	}
+	content := attributes["content"]
+	switch strings.ToLower(property) {
+	case "og:title":
+		if page.OGTitle == "" {
+			page.OGTitle = cleanText(content)
+		}
+	case "og:description":
+		if page.OGDescription == "" {
+			page.OGDescription = cleanText(content)
+		}
+	case "og:image":
+		if page.OGImage == "" {
+			page.OGImage = resolveImage(content, base)
+		}
+	}
+}
+
+// cleanText collapses white space and limits length of the text.
+func cleanText(s string) string {
+	s = strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+	if utf8.RuneCountInString(s) > maxPageTextLength {
+		s = string([]rune(s)[:maxPageTextLength])
+	}
+	return s
+}
+
+// resolveImage returns absolute http(s) url of the image or empty string.
+func resolveImage(s string, base *url.URL) string {
+	image, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		image = base.ResolveReference(image)
+	}
+	if image.Scheme != "http" && image.Scheme != "https" {
+		return ""
+	}
+	result := image.String()
+	if len(result) > maxPageURLLength {
+		return ""
+	}
+	return result
+}
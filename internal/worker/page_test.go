@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"go-developer-course-shortener/internal/app/types"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePage(t *testing.T) {
+	base, err := url.Parse("https://example.com/blog/post")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		html string
+		want types.Page
+	}{
+		{
+			name: "title and open graph",
+			html: `<!DOCTYPE html><html><head>
+				<title>  Post &amp; comments
+				</title>
+				<meta property="og:title" content="Post">
+				<meta property="og:description" content="About   the post">
+				<meta property="og:image" content="/images/post.png">
+				</head><body></body></html>`,
+			want: types.Page{Title: "Post & comments", OGTitle: "Post", OGDescription: "About the post",
+				OGImage: "https://example.com/images/post.png"},
+		},
+		{
+			name: "name attribute and first value wins",
+			html: `<head><META NAME="og:title" CONTENT="First"><meta property="og:title" content="Second"></head>`,
+			want: types.Page{OGTitle: "First"},
+		},
+		{
+			name: "body is not parsed",
+			html: `<head><title>Head</title></head><body><title>Body</title><meta property="og:title" content="Body"></body>`,
+			want: types.Page{Title: "Head"},
+		},
+		{
+			name: "no head",
+			html: `<title>Only title</title><p>text</p>`,
+			want: types.Page{Title: "Only title"},
+		},
+		{
+			name: "unsafe image",
+			html: `<meta property="og:image" content="javascript:alert(1)">`,
+			want: types.Page{},
+		},
+		{
+			name: "long text",
+			html: `<title>` + strings.Repeat("a", maxPageTextLength+10) + `</title>`,
+			want: types.Page{Title: strings.Repeat("a", maxPageTextLength)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parsePage(strings.NewReader(tt.html), base))
+		})
+	}
+}
+
+func newPageServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, pageUserAgent, r.UserAgent())
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>Page</title><meta property="og:image" content="img.png"></head></html>`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><head><title>`))
+		_, _ = w.Write([]byte(strings.Repeat(" ", maxPageSize)))
+		_, _ = w.Write([]byte(`late</title>`))
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchPage(t *testing.T) {
+	server := newPageServer(t)
+	client := server.Client()
+
+	page, err := fetchPage(context.Background(), client, server.URL+"/page")
+	require.NoError(t, err)
+	assert.Equal(t, "Page", page.Title)
+	assert.Equal(t, server.URL+"/img.png", page.OGImage)
+	assert.False(t, page.FetchedAt.IsZero())
+
+	// image url is resolved against the final url
+	page, err = fetchPage(context.Background(), client, server.URL+"/redirect")
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/img.png", page.OGImage)
+
+	// the rest of the page is not read
+	page, err = fetchPage(context.Background(), client, server.URL+"/huge")
+	require.NoError(t, err)
+	assert.Equal(t, "", page.Title)
+
+	for _, path := range []string{"/image", "/missing"} {
+		_, err = fetchPage(context.Background(), client, server.URL+path)
+		assert.Error(t, err, path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = fetchPage(ctx, client, server.URL+"/slow")
+	assert.Error(t, err)
+}
+
+func TestPagePool(t *testing.T) {
+	server := newPageServer(t)
+	repo := repository.NewInMemoryRepository()
+	require.NoError(t, repo.SaveURL("user", "page", server.URL+"/page"))
+	require.NoError(t, repo.SaveURL("user", "missing", server.URL+"/missing"))
+
+	// the default client does not connect to the local test server
+	pages := make(chan PageJob, MaxPageQueueSize)
+	pool := NewPagePool(repo, pages)
+	pool.process(context.Background(), PageJob{ShortURLS: []string{"page"}})
+	link, err := repo.GetURL("page")
+	require.NoError(t, err)
+	assert.Nil(t, link.Page)
+
+	pool.client = server.Client()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(done)
+	}()
+
+	pages <- PageJob{ShortURLS: []string{"page", "missing", "unknown"}}
+	pool.ClosePool()
+	<-done
+
+	link, err = repo.GetURL("page")
+	require.NoError(t, err)
+	require.NotNil(t, link.Page)
+	assert.Equal(t, "Page", link.Page.Title)
+	link, err = repo.GetURL("missing")
+	require.NoError(t, err)
+	assert.Nil(t, link.Page)
+}
+
+func TestDenyPrivateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{address: "93.184.216.34:443", wantErr: false},
+		{address: "[2606:2800:220:1:248:1893:25c8:1946]:80", wantErr: false},
+		{address: "127.0.0.1:80", wantErr: true},
+		{address: "10.1.2.3:80", wantErr: true},
+		{address: "192.168.0.1:80", wantErr: true},
+		{address: "169.254.169.254:80", wantErr: true},
+		{address: "[::1]:80", wantErr: true},
+		{address: "0.0.0.0:80", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := DenyPrivateAddress("tcp", tt.address, nil)
+		assert.Equal(t, tt.wantErr, err != nil, tt.address)
+	}
+}
@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"log"
+	"time"
+)
+
+// RunReencryption encrypts original urls stored in plaintext or by old master keys at start and every interval
+// until the context is done, so a rotated key can be removed once all urls are re-encrypted.
+func RunReencryption(ctx context.Context, storage *repository.EncryptedRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		reencrypted, err := storage.Reencrypt(ctx)
+		if err != nil {
+			log.Printf("Failed to re-encrypt original urls. Error: %v", err)
+		} else if reencrypted > 0 {
+			log.Printf("Re-encryption done, %d original urls re-encrypted", reencrypted)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Println("Re-encryption context done")
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"log"
+	"time"
+)
+
+// retentionInterval is the interval between purges of raw clicks and deleted links.
+const retentionInterval = time.Hour
+
+// RunClickRetention purges raw clicks older than the retention every hour until the context is done.
+// Rollups of the purged clicks are kept, so stats and reports are not changed.
+func RunClickRetention(ctx context.Context, repo repository.Repository, retention time.Duration) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := repo.PurgeClicks(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Failed to purge clicks. Error: %v", err)
+		} else {
+			log.Printf("Clicks retention done, %d clicks purged", purged)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Println("Clicks retention context done")
+			return
+		}
+	}
+}
+
+// RunDeletedRetention purges links deleted before the retention every hour until the context is done.
+// Short urls of purged links are reserved unless reuse is set.
+func RunDeletedRetention(ctx context.Context, repo repository.Repository, retention time.Duration, reuse bool) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := repo.PurgeURLS(time.Now().Add(-retention), reuse)
+		if err != nil {
+			log.Printf("Failed to purge deleted links. Error: %v", err)
+		} else {
+			log.Printf("Deleted links retention done, %d links purged", purged)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Println("Deleted links retention context done")
+			return
+		}
+	}
+}
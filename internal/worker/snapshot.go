@@ -0,0 +1,26 @@
+package worker
+
+import (
+	"context"
+	"go-developer-course-shortener/internal/app/repository"
+	"log"
+	"time"
+)
+
+// RunMemorySnapshots writes snapshots of the memory storage to the path every interval until the context is done.
+// The final snapshot is written by ReleaseStorage of the storage.
+func RunMemorySnapshots(ctx context.Context, storage *repository.InMemoryRepository, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := storage.WriteSnapshot(path); err != nil {
+				log.Printf("Failed to write memory snapshot. Error: %v", err)
+			}
+		case <-ctx.Done():
+			log.Println("Memory snapshots context done")
+			return
+		}
+	}
+}
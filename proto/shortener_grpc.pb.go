@@ -30,12 +30,58 @@ type ShortenerClient interface {
 	AddLink(ctx context.Context, in *AddLinkRequest, opts ...grpc.CallOption) (*AddLinkResponse, error)
 	// HandlerUseStorageDELETE (/api/user/urls)
 	DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error)
+	// HandlerRestorePOST (/api/user/urls/restore)
+	RestoreLinks(ctx context.Context, in *RestoreLinksRequest, opts ...grpc.CallOption) (*RestoreLinksResponse, error)
 	// HandlerUserStorageGET (/api/user/urls)
 	GetUserLinks(ctx context.Context, in *GetUserLinksRequest, opts ...grpc.CallOption) (*GetUserLinksResponse, error)
+	// HandlerExportGET (/api/user/urls/export), links are streamed one by one
+	ExportUserLinks(ctx context.Context, in *ExportUserLinksRequest, opts ...grpc.CallOption) (Shortener_ExportUserLinksClient, error)
+	// HandlerImportPOST (/api/user/urls/import), links are streamed one by one
+	ImportLinks(ctx context.Context, opts ...grpc.CallOption) (Shortener_ImportLinksClient, error)
 	// HandlerGET (/{ID})
 	GetOriginalByShort(ctx context.Context, in *GetOriginalByShortRequest, opts ...grpc.CallOption) (*GetOriginalByShortResponse, error)
 	// HandlerStats (/api/internal/stats)
 	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
+	// HandlerSchedulePUT (/api/user/urls/{ID}/schedule)
+	SetLinkSchedule(ctx context.Context, in *SetLinkScheduleRequest, opts ...grpc.CallOption) (*SetLinkScheduleResponse, error)
+	// HandlerTargetsPUT (/api/user/urls/{ID}/targets)
+	SetLinkTargets(ctx context.Context, in *SetLinkTargetsRequest, opts ...grpc.CallOption) (*SetLinkTargetsResponse, error)
+	// HandlerTargetsGET (/api/user/urls/{ID}/targets)
+	GetLinkTargets(ctx context.Context, in *GetLinkTargetsRequest, opts ...grpc.CallOption) (*GetLinkTargetsResponse, error)
+	// HandlerVariantsPUT (/api/user/urls/{ID}/variants)
+	SetLinkVariants(ctx context.Context, in *SetLinkVariantsRequest, opts ...grpc.CallOption) (*SetLinkVariantsResponse, error)
+	// HandlerVariantsGET (/api/user/urls/{ID}/variants)
+	GetLinkVariants(ctx context.Context, in *GetLinkVariantsRequest, opts ...grpc.CallOption) (*GetLinkVariantsResponse, error)
+	// HandlerLinkStatsGET (/api/user/urls/{ID}/stats)
+	GetLinkStats(ctx context.Context, in *GetLinkStatsRequest, opts ...grpc.CallOption) (*GetLinkStatsResponse, error)
+	// HandlerLinkHealthGET (/api/user/urls/{ID}/health)
+	GetLinkHealth(ctx context.Context, in *GetLinkHealthRequest, opts ...grpc.CallOption) (*GetLinkHealthResponse, error)
+	// HandlerPreviewPUT (/api/user/urls/{ID}/preview)
+	SetLinkPreview(ctx context.Context, in *SetLinkPreviewRequest, opts ...grpc.CallOption) (*SetLinkPreviewResponse, error)
+	// HandlerPreviewGET (/{ID}+)
+	GetLinkPreview(ctx context.Context, in *GetLinkPreviewRequest, opts ...grpc.CallOption) (*GetLinkPreviewResponse, error)
+	// HandlerQRGET (/{ID}/qr)
+	GetQRCode(ctx context.Context, in *GetQRCodeRequest, opts ...grpc.CallOption) (*GetQRCodeResponse, error)
+	// HandlerMetadataPUT (/api/user/urls/{ID}/metadata)
+	SetLinkMetadata(ctx context.Context, in *SetLinkMetadataRequest, opts ...grpc.CallOption) (*SetLinkMetadataResponse, error)
+	// HandlerSearchGET (/api/user/urls/search)
+	SearchUserLinks(ctx context.Context, in *SearchUserLinksRequest, opts ...grpc.CallOption) (*SearchUserLinksResponse, error)
+	// HandlerCollectionPOST (/api/user/collections)
+	CreateCollection(ctx context.Context, in *CreateCollectionRequest, opts ...grpc.CallOption) (*CreateCollectionResponse, error)
+	// HandlerCollectionsGET (/api/user/collections)
+	GetCollections(ctx context.Context, in *GetCollectionsRequest, opts ...grpc.CallOption) (*GetCollectionsResponse, error)
+	// HandlerCollectionDELETE (/api/user/collections/{CollectionID})
+	DeleteCollection(ctx context.Context, in *DeleteCollectionRequest, opts ...grpc.CallOption) (*DeleteCollectionResponse, error)
+	// HandlerCollectionURLSPUT (/api/user/collections/{CollectionID}/urls)
+	MoveLinks(ctx context.Context, in *MoveLinksRequest, opts ...grpc.CallOption) (*MoveLinksResponse, error)
+	// HandlerCollectionURLSGET (/api/user/collections/{CollectionID}/urls)
+	GetCollectionLinks(ctx context.Context, in *GetCollectionLinksRequest, opts ...grpc.CallOption) (*GetCollectionLinksResponse, error)
+	// HandlerCollectionURLSDELETE (/api/user/collections/{CollectionID}/urls)
+	DeleteCollectionLinks(ctx context.Context, in *DeleteCollectionLinksRequest, opts ...grpc.CallOption) (*DeleteCollectionLinksResponse, error)
+	// HandlerReportGET (/api/user/reports/{Report})
+	GetReport(ctx context.Context, in *GetReportRequest, opts ...grpc.CallOption) (*GetReportResponse, error)
+	// HandlerInternalReportGET (/api/internal/reports/{Report})
+	GetInternalReport(ctx context.Context, in *GetReportRequest, opts ...grpc.CallOption) (*GetReportResponse, error)
 	// HandlerPing (/ping)
 	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
 }
@@ -84,6 +130,15 @@ func (c *shortenerClient) DeleteLink(ctx context.Context, in *DeleteLinkRequest,
 	return out, nil
 }
 
+func (c *shortenerClient) RestoreLinks(ctx context.Context, in *RestoreLinksRequest, opts ...grpc.CallOption) (*RestoreLinksResponse, error) {
+	out := new(RestoreLinksResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/RestoreLinks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shortenerClient) GetUserLinks(ctx context.Context, in *GetUserLinksRequest, opts ...grpc.CallOption) (*GetUserLinksResponse, error) {
 	out := new(GetUserLinksResponse)
 	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetUserLinks", in, out, opts...)
@@ -93,6 +148,72 @@ func (c *shortenerClient) GetUserLinks(ctx context.Context, in *GetUserLinksRequ
 	return out, nil
 }
 
+func (c *shortenerClient) ExportUserLinks(ctx context.Context, in *ExportUserLinksRequest, opts ...grpc.CallOption) (Shortener_ExportUserLinksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[0], "/shortener.Shortener/ExportUserLinks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerExportUserLinksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Shortener_ExportUserLinksClient interface {
+	Recv() (*ExportedLink, error)
+	grpc.ClientStream
+}
+
+type shortenerExportUserLinksClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerExportUserLinksClient) Recv() (*ExportedLink, error) {
+	m := new(ExportedLink)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *shortenerClient) ImportLinks(ctx context.Context, opts ...grpc.CallOption) (Shortener_ImportLinksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[1], "/shortener.Shortener/ImportLinks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerImportLinksClient{stream}
+	return x, nil
+}
+
+type Shortener_ImportLinksClient interface {
+	Send(*ImportLinkRequest) error
+	CloseAndRecv() (*ImportLinksResponse, error)
+	grpc.ClientStream
+}
+
+type shortenerImportLinksClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerImportLinksClient) Send(m *ImportLinkRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *shortenerImportLinksClient) CloseAndRecv() (*ImportLinksResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportLinksResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *shortenerClient) GetOriginalByShort(ctx context.Context, in *GetOriginalByShortRequest, opts ...grpc.CallOption) (*GetOriginalByShortResponse, error) {
 	out := new(GetOriginalByShortResponse)
 	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetOriginalByShort", in, out, opts...)
@@ -111,6 +232,186 @@ func (c *shortenerClient) GetStats(ctx context.Context, in *GetStatsRequest, opt
 	return out, nil
 }
 
+func (c *shortenerClient) SetLinkSchedule(ctx context.Context, in *SetLinkScheduleRequest, opts ...grpc.CallOption) (*SetLinkScheduleResponse, error) {
+	out := new(SetLinkScheduleResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/SetLinkSchedule", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SetLinkTargets(ctx context.Context, in *SetLinkTargetsRequest, opts ...grpc.CallOption) (*SetLinkTargetsResponse, error) {
+	out := new(SetLinkTargetsResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/SetLinkTargets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetLinkTargets(ctx context.Context, in *GetLinkTargetsRequest, opts ...grpc.CallOption) (*GetLinkTargetsResponse, error) {
+	out := new(GetLinkTargetsResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetLinkTargets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SetLinkVariants(ctx context.Context, in *SetLinkVariantsRequest, opts ...grpc.CallOption) (*SetLinkVariantsResponse, error) {
+	out := new(SetLinkVariantsResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/SetLinkVariants", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetLinkVariants(ctx context.Context, in *GetLinkVariantsRequest, opts ...grpc.CallOption) (*GetLinkVariantsResponse, error) {
+	out := new(GetLinkVariantsResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetLinkVariants", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetLinkStats(ctx context.Context, in *GetLinkStatsRequest, opts ...grpc.CallOption) (*GetLinkStatsResponse, error) {
+	out := new(GetLinkStatsResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetLinkStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetLinkHealth(ctx context.Context, in *GetLinkHealthRequest, opts ...grpc.CallOption) (*GetLinkHealthResponse, error) {
+	out := new(GetLinkHealthResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetLinkHealth", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SetLinkPreview(ctx context.Context, in *SetLinkPreviewRequest, opts ...grpc.CallOption) (*SetLinkPreviewResponse, error) {
+	out := new(SetLinkPreviewResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/SetLinkPreview", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetLinkPreview(ctx context.Context, in *GetLinkPreviewRequest, opts ...grpc.CallOption) (*GetLinkPreviewResponse, error) {
+	out := new(GetLinkPreviewResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetLinkPreview", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetQRCode(ctx context.Context, in *GetQRCodeRequest, opts ...grpc.CallOption) (*GetQRCodeResponse, error) {
+	out := new(GetQRCodeResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetQRCode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SetLinkMetadata(ctx context.Context, in *SetLinkMetadataRequest, opts ...grpc.CallOption) (*SetLinkMetadataResponse, error) {
+	out := new(SetLinkMetadataResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/SetLinkMetadata", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SearchUserLinks(ctx context.Context, in *SearchUserLinksRequest, opts ...grpc.CallOption) (*SearchUserLinksResponse, error) {
+	out := new(SearchUserLinksResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/SearchUserLinks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) CreateCollection(ctx context.Context, in *CreateCollectionRequest, opts ...grpc.CallOption) (*CreateCollectionResponse, error) {
+	out := new(CreateCollectionResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/CreateCollection", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetCollections(ctx context.Context, in *GetCollectionsRequest, opts ...grpc.CallOption) (*GetCollectionsResponse, error) {
+	out := new(GetCollectionsResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetCollections", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) DeleteCollection(ctx context.Context, in *DeleteCollectionRequest, opts ...grpc.CallOption) (*DeleteCollectionResponse, error) {
+	out := new(DeleteCollectionResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/DeleteCollection", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) MoveLinks(ctx context.Context, in *MoveLinksRequest, opts ...grpc.CallOption) (*MoveLinksResponse, error) {
+	out := new(MoveLinksResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/MoveLinks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetCollectionLinks(ctx context.Context, in *GetCollectionLinksRequest, opts ...grpc.CallOption) (*GetCollectionLinksResponse, error) {
+	out := new(GetCollectionLinksResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetCollectionLinks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) DeleteCollectionLinks(ctx context.Context, in *DeleteCollectionLinksRequest, opts ...grpc.CallOption) (*DeleteCollectionLinksResponse, error) {
+	out := new(DeleteCollectionLinksResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/DeleteCollectionLinks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetReport(ctx context.Context, in *GetReportRequest, opts ...grpc.CallOption) (*GetReportResponse, error) {
+	out := new(GetReportResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetReport", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetInternalReport(ctx context.Context, in *GetReportRequest, opts ...grpc.CallOption) (*GetReportResponse, error) {
+	out := new(GetReportResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetInternalReport", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shortenerClient) Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error) {
 	out := new(PingResponse)
 	err := c.cc.Invoke(ctx, "/shortener.Shortener/Ping", in, out, opts...)
@@ -132,12 +433,58 @@ type ShortenerServer interface {
 	AddLink(context.Context, *AddLinkRequest) (*AddLinkResponse, error)
 	// HandlerUseStorageDELETE (/api/user/urls)
 	DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error)
+	// HandlerRestorePOST (/api/user/urls/restore)
+	RestoreLinks(context.Context, *RestoreLinksRequest) (*RestoreLinksResponse, error)
 	// HandlerUserStorageGET (/api/user/urls)
 	GetUserLinks(context.Context, *GetUserLinksRequest) (*GetUserLinksResponse, error)
+	// HandlerExportGET (/api/user/urls/export), links are streamed one by one
+	ExportUserLinks(*ExportUserLinksRequest, Shortener_ExportUserLinksServer) error
+	// HandlerImportPOST (/api/user/urls/import), links are streamed one by one
+	ImportLinks(Shortener_ImportLinksServer) error
 	// HandlerGET (/{ID})
 	GetOriginalByShort(context.Context, *GetOriginalByShortRequest) (*GetOriginalByShortResponse, error)
 	// HandlerStats (/api/internal/stats)
 	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
+	// HandlerSchedulePUT (/api/user/urls/{ID}/schedule)
+	SetLinkSchedule(context.Context, *SetLinkScheduleRequest) (*SetLinkScheduleResponse, error)
+	// HandlerTargetsPUT (/api/user/urls/{ID}/targets)
+	SetLinkTargets(context.Context, *SetLinkTargetsRequest) (*SetLinkTargetsResponse, error)
+	// HandlerTargetsGET (/api/user/urls/{ID}/targets)
+	GetLinkTargets(context.Context, *GetLinkTargetsRequest) (*GetLinkTargetsResponse, error)
+	// HandlerVariantsPUT (/api/user/urls/{ID}/variants)
+	SetLinkVariants(context.Context, *SetLinkVariantsRequest) (*SetLinkVariantsResponse, error)
+	// HandlerVariantsGET (/api/user/urls/{ID}/variants)
+	GetLinkVariants(context.Context, *GetLinkVariantsRequest) (*GetLinkVariantsResponse, error)
+	// HandlerLinkStatsGET (/api/user/urls/{ID}/stats)
+	GetLinkStats(context.Context, *GetLinkStatsRequest) (*GetLinkStatsResponse, error)
+	// HandlerLinkHealthGET (/api/user/urls/{ID}/health)
+	GetLinkHealth(context.Context, *GetLinkHealthRequest) (*GetLinkHealthResponse, error)
+	// HandlerPreviewPUT (/api/user/urls/{ID}/preview)
+	SetLinkPreview(context.Context, *SetLinkPreviewRequest) (*SetLinkPreviewResponse, error)
+	// HandlerPreviewGET (/{ID}+)
+	GetLinkPreview(context.Context, *GetLinkPreviewRequest) (*GetLinkPreviewResponse, error)
+	// HandlerQRGET (/{ID}/qr)
+	GetQRCode(context.Context, *GetQRCodeRequest) (*GetQRCodeResponse, error)
+	// HandlerMetadataPUT (/api/user/urls/{ID}/metadata)
+	SetLinkMetadata(context.Context, *SetLinkMetadataRequest) (*SetLinkMetadataResponse, error)
+	// HandlerSearchGET (/api/user/urls/search)
+	SearchUserLinks(context.Context, *SearchUserLinksRequest) (*SearchUserLinksResponse, error)
+	// HandlerCollectionPOST (/api/user/collections)
+	CreateCollection(context.Context, *CreateCollectionRequest) (*CreateCollectionResponse, error)
+	// HandlerCollectionsGET (/api/user/collections)
+	GetCollections(context.Context, *GetCollectionsRequest) (*GetCollectionsResponse, error)
+	// HandlerCollectionDELETE (/api/user/collections/{CollectionID})
+	DeleteCollection(context.Context, *DeleteCollectionRequest) (*DeleteCollectionResponse, error)
+	// HandlerCollectionURLSPUT (/api/user/collections/{CollectionID}/urls)
+	MoveLinks(context.Context, *MoveLinksRequest) (*MoveLinksResponse, error)
+	// HandlerCollectionURLSGET (/api/user/collections/{CollectionID}/urls)
+	GetCollectionLinks(context.Context, *GetCollectionLinksRequest) (*GetCollectionLinksResponse, error)
+	// HandlerCollectionURLSDELETE (/api/user/collections/{CollectionID}/urls)
+	DeleteCollectionLinks(context.Context, *DeleteCollectionLinksRequest) (*DeleteCollectionLinksResponse, error)
+	// HandlerReportGET (/api/user/reports/{Report})
+	GetReport(context.Context, *GetReportRequest) (*GetReportResponse, error)
+	// HandlerInternalReportGET (/api/internal/reports/{Report})
+	GetInternalReport(context.Context, *GetReportRequest) (*GetReportResponse, error)
 	// HandlerPing (/ping)
 	Ping(context.Context, *PingRequest) (*PingResponse, error)
 	mustEmbedUnimplementedShortenerServer()
@@ -159,15 +506,84 @@ func (UnimplementedShortenerServer) AddLink(context.Context, *AddLinkRequest) (*
 func (UnimplementedShortenerServer) DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteLink not implemented")
 }
+func (UnimplementedShortenerServer) RestoreLinks(context.Context, *RestoreLinksRequest) (*RestoreLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreLinks not implemented")
+}
 func (UnimplementedShortenerServer) GetUserLinks(context.Context, *GetUserLinksRequest) (*GetUserLinksResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetUserLinks not implemented")
 }
+func (UnimplementedShortenerServer) ExportUserLinks(*ExportUserLinksRequest, Shortener_ExportUserLinksServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportUserLinks not implemented")
+}
+func (UnimplementedShortenerServer) ImportLinks(Shortener_ImportLinksServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportLinks not implemented")
+}
 func (UnimplementedShortenerServer) GetOriginalByShort(context.Context, *GetOriginalByShortRequest) (*GetOriginalByShortResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetOriginalByShort not implemented")
 }
 func (UnimplementedShortenerServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
 }
+func (UnimplementedShortenerServer) SetLinkSchedule(context.Context, *SetLinkScheduleRequest) (*SetLinkScheduleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLinkSchedule not implemented")
+}
+func (UnimplementedShortenerServer) SetLinkTargets(context.Context, *SetLinkTargetsRequest) (*SetLinkTargetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLinkTargets not implemented")
+}
+func (UnimplementedShortenerServer) GetLinkTargets(context.Context, *GetLinkTargetsRequest) (*GetLinkTargetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLinkTargets not implemented")
+}
+func (UnimplementedShortenerServer) SetLinkVariants(context.Context, *SetLinkVariantsRequest) (*SetLinkVariantsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLinkVariants not implemented")
+}
+func (UnimplementedShortenerServer) GetLinkVariants(context.Context, *GetLinkVariantsRequest) (*GetLinkVariantsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLinkVariants not implemented")
+}
+func (UnimplementedShortenerServer) GetLinkStats(context.Context, *GetLinkStatsRequest) (*GetLinkStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLinkStats not implemented")
+}
+func (UnimplementedShortenerServer) GetLinkHealth(context.Context, *GetLinkHealthRequest) (*GetLinkHealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLinkHealth not implemented")
+}
+func (UnimplementedShortenerServer) SetLinkPreview(context.Context, *SetLinkPreviewRequest) (*SetLinkPreviewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLinkPreview not implemented")
+}
+func (UnimplementedShortenerServer) GetLinkPreview(context.Context, *GetLinkPreviewRequest) (*GetLinkPreviewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLinkPreview not implemented")
+}
+func (UnimplementedShortenerServer) GetQRCode(context.Context, *GetQRCodeRequest) (*GetQRCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQRCode not implemented")
+}
+func (UnimplementedShortenerServer) SetLinkMetadata(context.Context, *SetLinkMetadataRequest) (*SetLinkMetadataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLinkMetadata not implemented")
+}
+func (UnimplementedShortenerServer) SearchUserLinks(context.Context, *SearchUserLinksRequest) (*SearchUserLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchUserLinks not implemented")
+}
+func (UnimplementedShortenerServer) CreateCollection(context.Context, *CreateCollectionRequest) (*CreateCollectionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCollection not implemented")
+}
+func (UnimplementedShortenerServer) GetCollections(context.Context, *GetCollectionsRequest) (*GetCollectionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCollections not implemented")
+}
+func (UnimplementedShortenerServer) DeleteCollection(context.Context, *DeleteCollectionRequest) (*DeleteCollectionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteCollection not implemented")
+}
+func (UnimplementedShortenerServer) MoveLinks(context.Context, *MoveLinksRequest) (*MoveLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MoveLinks not implemented")
+}
+func (UnimplementedShortenerServer) GetCollectionLinks(context.Context, *GetCollectionLinksRequest) (*GetCollectionLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCollectionLinks not implemented")
+}
+func (UnimplementedShortenerServer) DeleteCollectionLinks(context.Context, *DeleteCollectionLinksRequest) (*DeleteCollectionLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteCollectionLinks not implemented")
+}
+func (UnimplementedShortenerServer) GetReport(context.Context, *GetReportRequest) (*GetReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReport not implemented")
+}
+func (UnimplementedShortenerServer) GetInternalReport(context.Context, *GetReportRequest) (*GetReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInternalReport not implemented")
+}
 func (UnimplementedShortenerServer) Ping(context.Context, *PingRequest) (*PingResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
@@ -256,6 +672,24 @@ func _Shortener_DeleteLink_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_RestoreLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).RestoreLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/RestoreLinks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).RestoreLinks(ctx, req.(*RestoreLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Shortener_GetUserLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetUserLinksRequest)
 	if err := dec(in); err != nil {
@@ -274,6 +708,53 @@ func _Shortener_GetUserLinks_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_ExportUserLinks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportUserLinksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShortenerServer).ExportUserLinks(m, &shortenerExportUserLinksServer{stream})
+}
+
+type Shortener_ExportUserLinksServer interface {
+	Send(*ExportedLink) error
+	grpc.ServerStream
+}
+
+type shortenerExportUserLinksServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerExportUserLinksServer) Send(m *ExportedLink) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Shortener_ImportLinks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShortenerServer).ImportLinks(&shortenerImportLinksServer{stream})
+}
+
+type Shortener_ImportLinksServer interface {
+	SendAndClose(*ImportLinksResponse) error
+	Recv() (*ImportLinkRequest, error)
+	grpc.ServerStream
+}
+
+type shortenerImportLinksServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerImportLinksServer) SendAndClose(m *ImportLinksResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *shortenerImportLinksServer) Recv() (*ImportLinkRequest, error) {
+	m := new(ImportLinkRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _Shortener_GetOriginalByShort_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetOriginalByShortRequest)
 	if err := dec(in); err != nil {
@@ -310,64 +791,519 @@ func _Shortener_GetStats_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Shortener_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(PingRequest)
+func _Shortener_SetLinkSchedule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLinkScheduleRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(ShortenerServer).Ping(ctx, in)
+		return srv.(ShortenerServer).SetLinkSchedule(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/shortener.Shortener/Ping",
+		FullMethod: "/shortener.Shortener/SetLinkSchedule",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ShortenerServer).Ping(ctx, req.(*PingRequest))
+		return srv.(ShortenerServer).SetLinkSchedule(ctx, req.(*SetLinkScheduleRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-// Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var Shortener_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "shortener.Shortener",
-	HandlerType: (*ShortenerServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "AddBatch",
-			Handler:    _Shortener_AddBatch_Handler,
-		},
-		{
-			MethodName: "AddLinkJSON",
-			Handler:    _Shortener_AddLinkJSON_Handler,
-		},
-		{
-			MethodName: "AddLink",
-			Handler:    _Shortener_AddLink_Handler,
-		},
-		{
-			MethodName: "DeleteLink",
-			Handler:    _Shortener_DeleteLink_Handler,
-		},
-		{
-			MethodName: "GetUserLinks",
-			Handler:    _Shortener_GetUserLinks_Handler,
-		},
-		{
-			MethodName: "GetOriginalByShort",
-			Handler:    _Shortener_GetOriginalByShort_Handler,
-		},
-		{
-			MethodName: "GetStats",
-			Handler:    _Shortener_GetStats_Handler,
+func _Shortener_SetLinkTargets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLinkTargetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SetLinkTargets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/SetLinkTargets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SetLinkTargets(ctx, req.(*SetLinkTargetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetLinkTargets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkTargetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetLinkTargets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetLinkTargets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetLinkTargets(ctx, req.(*GetLinkTargetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_SetLinkVariants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLinkVariantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SetLinkVariants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/SetLinkVariants",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SetLinkVariants(ctx, req.(*SetLinkVariantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetLinkVariants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkVariantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetLinkVariants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetLinkVariants",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetLinkVariants(ctx, req.(*GetLinkVariantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetLinkStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetLinkStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetLinkStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetLinkStats(ctx, req.(*GetLinkStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetLinkHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkHealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetLinkHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetLinkHealth",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetLinkHealth(ctx, req.(*GetLinkHealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_SetLinkPreview_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLinkPreviewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SetLinkPreview(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/SetLinkPreview",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SetLinkPreview(ctx, req.(*SetLinkPreviewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetLinkPreview_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkPreviewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetLinkPreview(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetLinkPreview",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetLinkPreview(ctx, req.(*GetLinkPreviewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetQRCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetQRCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetQRCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetQRCode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetQRCode(ctx, req.(*GetQRCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_SetLinkMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLinkMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SetLinkMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/SetLinkMetadata",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SetLinkMetadata(ctx, req.(*SetLinkMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_SearchUserLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchUserLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SearchUserLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/SearchUserLinks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SearchUserLinks(ctx, req.(*SearchUserLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_CreateCollection_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateCollectionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).CreateCollection(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/CreateCollection",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).CreateCollection(ctx, req.(*CreateCollectionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetCollections_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCollectionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetCollections(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetCollections",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetCollections(ctx, req.(*GetCollectionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_DeleteCollection_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteCollectionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).DeleteCollection(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/DeleteCollection",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).DeleteCollection(ctx, req.(*DeleteCollectionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_MoveLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).MoveLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/MoveLinks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).MoveLinks(ctx, req.(*MoveLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetCollectionLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCollectionLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetCollectionLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetCollectionLinks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetCollectionLinks(ctx, req.(*GetCollectionLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_DeleteCollectionLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteCollectionLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).DeleteCollectionLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/DeleteCollectionLinks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).DeleteCollectionLinks(ctx, req.(*DeleteCollectionLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetReport",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetReport(ctx, req.(*GetReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetInternalReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetInternalReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetInternalReport",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetInternalReport(ctx, req.(*GetReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/Ping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).Ping(ctx, req.(*PingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Shortener_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "shortener.Shortener",
+	HandlerType: (*ShortenerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddBatch",
+			Handler:    _Shortener_AddBatch_Handler,
+		},
+		{
+			MethodName: "AddLinkJSON",
+			Handler:    _Shortener_AddLinkJSON_Handler,
+		},
+		{
+			MethodName: "AddLink",
+			Handler:    _Shortener_AddLink_Handler,
+		},
+		{
+			MethodName: "DeleteLink",
+			Handler:    _Shortener_DeleteLink_Handler,
+		},
+		{
+			MethodName: "RestoreLinks",
+			Handler:    _Shortener_RestoreLinks_Handler,
+		},
+		{
+			MethodName: "GetUserLinks",
+			Handler:    _Shortener_GetUserLinks_Handler,
+		},
+		{
+			MethodName: "GetOriginalByShort",
+			Handler:    _Shortener_GetOriginalByShort_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _Shortener_GetStats_Handler,
+		},
+		{
+			MethodName: "SetLinkSchedule",
+			Handler:    _Shortener_SetLinkSchedule_Handler,
+		},
+		{
+			MethodName: "SetLinkTargets",
+			Handler:    _Shortener_SetLinkTargets_Handler,
+		},
+		{
+			MethodName: "GetLinkTargets",
+			Handler:    _Shortener_GetLinkTargets_Handler,
+		},
+		{
+			MethodName: "SetLinkVariants",
+			Handler:    _Shortener_SetLinkVariants_Handler,
+		},
+		{
+			MethodName: "GetLinkVariants",
+			Handler:    _Shortener_GetLinkVariants_Handler,
+		},
+		{
+			MethodName: "GetLinkStats",
+			Handler:    _Shortener_GetLinkStats_Handler,
+		},
+		{
+			MethodName: "GetLinkHealth",
+			Handler:    _Shortener_GetLinkHealth_Handler,
+		},
+		{
+			MethodName: "SetLinkPreview",
+			Handler:    _Shortener_SetLinkPreview_Handler,
+		},
+		{
+			MethodName: "GetLinkPreview",
+			Handler:    _Shortener_GetLinkPreview_Handler,
+		},
+		{
+			MethodName: "GetQRCode",
+			Handler:    _Shortener_GetQRCode_Handler,
+		},
+		{
+			MethodName: "SetLinkMetadata",
+			Handler:    _Shortener_SetLinkMetadata_Handler,
+		},
+		{
+			MethodName: "SearchUserLinks",
+			Handler:    _Shortener_SearchUserLinks_Handler,
+		},
+		{
+			MethodName: "CreateCollection",
+			Handler:    _Shortener_CreateCollection_Handler,
+		},
+		{
+			MethodName: "GetCollections",
+			Handler:    _Shortener_GetCollections_Handler,
+		},
+		{
+			MethodName: "DeleteCollection",
+			Handler:    _Shortener_DeleteCollection_Handler,
+		},
+		{
+			MethodName: "MoveLinks",
+			Handler:    _Shortener_MoveLinks_Handler,
+		},
+		{
+			MethodName: "GetCollectionLinks",
+			Handler:    _Shortener_GetCollectionLinks_Handler,
+		},
+		{
+			MethodName: "DeleteCollectionLinks",
+			Handler:    _Shortener_DeleteCollectionLinks_Handler,
+		},
+		{
+			MethodName: "GetReport",
+			Handler:    _Shortener_GetReport_Handler,
+		},
+		{
+			MethodName: "GetInternalReport",
+			Handler:    _Shortener_GetInternalReport_Handler,
 		},
 		{
 			MethodName: "Ping",
 			Handler:    _Shortener_Ping_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExportUserLinks",
+			Handler:       _Shortener_ExportUserLinks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportLinks",
+			Handler:       _Shortener_ImportLinks_Handler,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "proto/shortener.proto",
 }